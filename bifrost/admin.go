@@ -0,0 +1,263 @@
+package bifrost
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+
+	"github.com/Mintegral-official/mtggokit/bifrost/container"
+	"github.com/Mintegral-official/mtggokit/bifrost/streamer"
+)
+
+const (
+	defaultSampleNum = 10
+	maxSampleNum     = 1000
+)
+
+type admin struct {
+	bf *Bifrost
+}
+
+// NewAdminHandler returns an http.Handler to inspect the data held by Bifrost, mount it
+// with http.StripPrefix:
+//
+//	GET  /streamers                                      the registered streamers and their GetInfo()
+//	GET  /get?streamer=name&key=k[&key_type=int64]       the value of a key, key_type is string by default,
+//	                                                     or int64, int32, uint64, bytes16 (hex or UUID)
+//	GET  /sample?streamer=name[&n=10]                    n entries of the container
+//	POST /reload?streamer=name[&kind=inc]                a base load, or an inc load with kind=inc
+//	GET  /versions?streamer=name                         the base versions of a VersionedContainer
+//	POST /rollback?streamer=name&version=id              serves the version and drops the newer ones
+//	POST /pin?streamer=name&version=id                   serves the version until unpin
+//	POST /unpin?streamer=name                            serves the latest version again
+//
+// The values are rendered as JSON, or by fmt when they can't be marshaled.
+func NewAdminHandler(bf *Bifrost) http.Handler {
+	a := &admin{bf: bf}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/streamers", a.streamers)
+	mux.HandleFunc("/get", a.get)
+	mux.HandleFunc("/sample", a.sample)
+	mux.HandleFunc("/reload", a.reload)
+	mux.HandleFunc("/versions", a.versions)
+	mux.HandleFunc("/rollback", a.versionOp(true, func(name string, id int64) error { return a.bf.Rollback(name, id) }))
+	mux.HandleFunc("/pin", a.versionOp(true, func(name string, id int64) error { return a.bf.Pin(name, id) }))
+	mux.HandleFunc("/unpin", a.versionOp(false, func(name string, _ int64) error { return a.bf.Unpin(name) }))
+	return mux
+}
+
+type streamerInfo struct {
+	Name string         `json:"name"`
+	Info *streamer.Info `json:"info"`
+}
+
+type entry struct {
+	Key   interface{} `json:"key"`
+	Value interface{} `json:"value"`
+}
+
+func (a *admin) streamers(w http.ResponseWriter, r *http.Request) {
+	a.bf.mu.RLock()
+	infos := make([]streamerInfo, 0, len(a.bf.DataStreamers))
+	streamers := make([]streamer.Streamer, 0, len(a.bf.DataStreamers))
+	for name, s := range a.bf.DataStreamers {
+		infos = append(infos, streamerInfo{Name: name})
+		streamers = append(streamers, s)
+	}
+	a.bf.mu.RUnlock()
+	for i, s := range streamers {
+		infos[i].Info = s.GetInfo()
+	}
+	sort.Slice(infos, func(i, j int) bool { return infos[i].Name < infos[j].Name })
+	writeJSON(w, http.StatusOK, map[string]interface{}{"streamers": infos})
+}
+
+func (a *admin) get(w http.ResponseWriter, r *http.Request) {
+	name := r.FormValue("streamer")
+	c, status, err := a.container(name)
+	if err != nil {
+		writeError(w, status, err)
+		return
+	}
+	key, err := parseKey(r.FormValue("key"), r.FormValue("key_type"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	value, err := c.Get(key)
+	if err != nil {
+		writeError(w, http.StatusNotFound, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"streamer": name,
+		"key":      key.Value(),
+		"value":    renderable(value),
+	})
+}
+
+func (a *admin) sample(w http.ResponseWriter, r *http.Request) {
+	name := r.FormValue("streamer")
+	c, status, err := a.container(name)
+	if err != nil {
+		writeError(w, status, err)
+		return
+	}
+	n := defaultSampleNum
+	if v := r.FormValue("n"); v != "" {
+		n, err = strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			writeError(w, http.StatusBadRequest, errors.New("invalid n["+v+"]"))
+			return
+		}
+		if n > maxSampleNum {
+			n = maxSampleNum
+		}
+	}
+	entries := make([]entry, 0, n)
+	c.Range(func(key, value interface{}) bool {
+		entries = append(entries, entry{Key: renderable(key), Value: renderable(value)})
+		return len(entries) < n
+	})
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"streamer": name,
+		"total":    c.Len(),
+		"entries":  entries,
+	})
+}
+
+func (a *admin) reload(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, errors.New("reload must be a POST"))
+		return
+	}
+	name := r.FormValue("streamer")
+	s, err := a.bf.GetStreamer(name)
+	if err != nil {
+		writeError(w, http.StatusNotFound, err)
+		return
+	}
+	kind := streamer.LoadKindBase
+	switch r.FormValue("kind") {
+	case "", "base":
+	case "inc":
+		kind = streamer.LoadKindInc
+	default:
+		writeError(w, http.StatusBadRequest, errors.New("invalid kind["+r.FormValue("kind")+"]"))
+		return
+	}
+	reloader, ok := s.(streamer.Reloader)
+	if !ok {
+		writeError(w, http.StatusNotImplemented, errors.New("streamer["+name+"] doesn't support reload"))
+		return
+	}
+	if err := reloader.Reload(r.Context(), kind); err != nil {
+		writeError(w, http.StatusInternalServerError, fmt.Errorf("streamer[%s] reload %s error: %s", name, kind, err.Error()))
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"streamer": name,
+		"kind":     kind.String(),
+		"info":     s.GetInfo(),
+	})
+}
+
+func (a *admin) versions(w http.ResponseWriter, r *http.Request) {
+	name := r.FormValue("streamer")
+	if _, err := a.bf.GetStreamer(name); err != nil {
+		writeError(w, http.StatusNotFound, err)
+		return
+	}
+	versions, err := a.bf.Versions(name)
+	if err != nil {
+		writeError(w, http.StatusNotImplemented, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"streamer": name,
+		"versions": versions,
+	})
+}
+
+// versionOp handles a POST changing the served version, with the version parameter if withID
+func (a *admin) versionOp(withID bool, op func(name string, id int64) error) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			writeError(w, http.StatusMethodNotAllowed, errors.New(r.URL.Path+" must be a POST"))
+			return
+		}
+		name := r.FormValue("streamer")
+		if _, err := a.bf.GetStreamer(name); err != nil {
+			writeError(w, http.StatusNotFound, err)
+			return
+		}
+		var id int64
+		if withID {
+			v := r.FormValue("version")
+			var err error
+			if id, err = strconv.ParseInt(v, 10, 64); err != nil {
+				writeError(w, http.StatusBadRequest, errors.New("invalid version["+v+"]"))
+				return
+			}
+		}
+		if err := op(name, id); err != nil {
+			writeError(w, http.StatusConflict, err)
+			return
+		}
+		versions, _ := a.bf.Versions(name)
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"streamer": name,
+			"versions": versions,
+		})
+	}
+}
+
+func (a *admin) container(name string) (container.Container, int, error) {
+	s, err := a.bf.GetStreamer(name)
+	if err != nil {
+		return nil, http.StatusNotFound, err
+	}
+	c := s.GetContainer()
+	if c == nil {
+		return nil, http.StatusNotFound, errors.New("contain is nil, streamer[" + name + "]")
+	}
+	return c, http.StatusOK, nil
+}
+
+func parseKey(key, keyType string) (container.MapKey, error) {
+	switch keyType {
+	case "", "string":
+		return container.StrKey(key), nil
+	case "int64":
+		return container.ParseI64Key(key)
+	case "int32":
+		return container.ParseI32Key(key)
+	case "uint64":
+		return container.ParseU64Key(key)
+	case "bytes16":
+		return container.ParseB16Key(key)
+	default:
+		return nil, errors.New("invalid key_type[" + keyType + "]")
+	}
+}
+
+// renderable returns v if it can be marshaled to JSON, otherwise its fmt representation
+func renderable(v interface{}) interface{} {
+	if _, err := json.Marshal(v); err != nil {
+		return fmt.Sprintf("%+v", v)
+	}
+	return v
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, map[string]string{"error": err.Error()})
+}
@@ -0,0 +1,206 @@
+package bifrost
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Mintegral-official/mtggokit/bifrost/container"
+	"github.com/Mintegral-official/mtggokit/bifrost/streamer"
+	"github.com/smartystreets/goconvey/convey"
+)
+
+func doAdmin(h http.Handler, method, target string) (int, map[string]interface{}) {
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(method, target, nil))
+	body := make(map[string]interface{})
+	_ = json.Unmarshal(w.Body.Bytes(), &body)
+	return w.Code, body
+}
+
+func TestAdminHandler(t *testing.T) {
+	convey.Convey("Test admin endpoints", t, func() {
+		dir, err := ioutil.TempDir("", "bifrost")
+		convey.So(err, convey.ShouldBeNil)
+		defer os.RemoveAll(dir)
+		path := filepath.Join(dir, "base")
+		convey.So(ioutil.WriteFile(path, []byte("a\taa\nb\tbb\n"), 0644), convey.ShouldBeNil)
+
+		bf := NewBifrost()
+		lfs := streamer.NewFileStreamer(&streamer.LocalFileStreamerCfg{
+			Name:       "file",
+			Path:       path,
+			UpdatMode:  streamer.Static,
+			IsSync:     true,
+			DataParser: &streamer.DefaultTextParser{},
+		})
+		lfs.SetContainer(&container.BufferedMapContainer{})
+		convey.So(bf.Register("file", lfs), convey.ShouldBeNil)
+		ids := container.CreateBlockingMapContainer(1, 0)
+		convey.So(ids.Set(container.I64Key(7), map[string]int{"price": 3}), convey.ShouldBeNil)
+		convey.So(ids.Set(container.I64Key(8), func() {}), convey.ShouldBeNil)
+		convey.So(bf.Register("ids", &containerStreamer{c: ids}), convey.ShouldBeNil)
+		convey.So(bf.Start(context.Background()), convey.ShouldBeNil)
+		defer bf.Stop()
+		convey.So(bf.WaitReady(), convey.ShouldBeNil)
+
+		h := http.StripPrefix("/admin", NewAdminHandler(bf))
+
+		code, body := doAdmin(h, "GET", "/admin/streamers")
+		convey.So(code, convey.ShouldEqual, http.StatusOK)
+		infos := body["streamers"].([]interface{})
+		convey.So(len(infos), convey.ShouldEqual, 2)
+		file := infos[0].(map[string]interface{})
+		convey.So(file["name"], convey.ShouldEqual, "file")
+		convey.So(file["info"].(map[string]interface{})["total_num"], convey.ShouldEqual, 2)
+		convey.So(infos[1].(map[string]interface{})["info"], convey.ShouldBeNil)
+
+		code, body = doAdmin(h, "GET", "/admin/get?streamer=file&key=a")
+		convey.So(code, convey.ShouldEqual, http.StatusOK)
+		convey.So(body["value"], convey.ShouldEqual, "aa")
+
+		code, body = doAdmin(h, "GET", "/admin/get?streamer=ids&key=7&key_type=int64")
+		convey.So(code, convey.ShouldEqual, http.StatusOK)
+		convey.So(body["key"], convey.ShouldEqual, 7)
+		convey.So(body["value"], convey.ShouldResemble, map[string]interface{}{"price": 3.0})
+
+		// not marshalable, rendered by fmt
+		code, body = doAdmin(h, "GET", "/admin/get?streamer=ids&key=8&key_type=int64")
+		convey.So(code, convey.ShouldEqual, http.StatusOK)
+		convey.So(body["value"], convey.ShouldHaveSameTypeAs, "")
+
+		code, _ = doAdmin(h, "GET", "/admin/get?streamer=file&key=c")
+		convey.So(code, convey.ShouldEqual, http.StatusNotFound)
+		code, _ = doAdmin(h, "GET", "/admin/get?streamer=ids&key=x&key_type=int64")
+		convey.So(code, convey.ShouldEqual, http.StatusBadRequest)
+		code, body = doAdmin(h, "GET", "/admin/get?streamer=none&key=a")
+		convey.So(code, convey.ShouldEqual, http.StatusNotFound)
+		convey.So(body["error"], convey.ShouldEqual, "not found streamer[none]")
+
+		code, body = doAdmin(h, "GET", "/admin/sample?streamer=file&n=1")
+		convey.So(code, convey.ShouldEqual, http.StatusOK)
+		convey.So(body["total"], convey.ShouldEqual, 2)
+		convey.So(len(body["entries"].([]interface{})), convey.ShouldEqual, 1)
+		code, _ = doAdmin(h, "GET", "/admin/sample?streamer=file&n=-1")
+		convey.So(code, convey.ShouldEqual, http.StatusBadRequest)
+
+		// the file is not modified, a forced reload still loads it
+		convey.So(ioutil.WriteFile(path, []byte("c\tcc\n"), 0644), convey.ShouldBeNil)
+		convey.So(os.Chtimes(path, lfs.GetInfo().LastBaseTime, lfs.GetInfo().LastBaseTime.AddDate(-1, 0, 0)), convey.ShouldBeNil)
+		code, _ = doAdmin(h, "GET", "/admin/reload?streamer=file")
+		convey.So(code, convey.ShouldEqual, http.StatusMethodNotAllowed)
+		code, body = doAdmin(h, "POST", "/admin/reload?streamer=file")
+		convey.So(code, convey.ShouldEqual, http.StatusOK)
+		convey.So(body["kind"], convey.ShouldEqual, "base")
+		code, body = doAdmin(h, "GET", "/admin/get?streamer=file&key=c")
+		convey.So(code, convey.ShouldEqual, http.StatusOK)
+		convey.So(body["value"], convey.ShouldEqual, "cc")
+
+		code, _ = doAdmin(h, "POST", "/admin/reload?streamer=file&kind=inc")
+		convey.So(code, convey.ShouldEqual, http.StatusOK)
+		code, _ = doAdmin(h, "POST", "/admin/reload?streamer=file&kind=all")
+		convey.So(code, convey.ShouldEqual, http.StatusBadRequest)
+		code, _ = doAdmin(h, "POST", "/admin/reload?streamer=ids")
+		convey.So(code, convey.ShouldEqual, http.StatusNotImplemented)
+	})
+}
+
+func TestAdminVersions(t *testing.T) {
+	convey.Convey("Test admin endpoints of the versions", t, func() {
+		bf := NewBifrost()
+		vc := container.CreateVersionedContainer(2, container.PinIncApply, func() container.Container {
+			return container.CreateBlockingMapContainer(1, 0)
+		})
+		convey.So(vc.LoadBase(&resultsIter{results: []streamer.ParserResult{{Key: container.StrKey("a"), Value: "1"}}}), convey.ShouldBeNil)
+		convey.So(vc.LoadBase(&resultsIter{results: []streamer.ParserResult{{Key: container.StrKey("a"), Value: "2"}, {Key: container.StrKey("b"), Value: "2"}}}), convey.ShouldBeNil)
+		convey.So(bf.Register("versioned", &containerStreamer{c: vc}), convey.ShouldBeNil)
+		convey.So(bf.Register("plain", &containerStreamer{c: container.CreateBlockingMapContainer(1, 0)}), convey.ShouldBeNil)
+		h := http.StripPrefix("/admin", NewAdminHandler(bf))
+
+		code, body := doAdmin(h, "GET", "/admin/versions?streamer=versioned")
+		convey.So(code, convey.ShouldEqual, http.StatusOK)
+		versions := body["versions"].([]interface{})
+		convey.So(len(versions), convey.ShouldEqual, 2)
+		convey.So(versions[1].(map[string]interface{})["active"], convey.ShouldBeTrue)
+		code, _ = doAdmin(h, "GET", "/admin/versions?streamer=plain")
+		convey.So(code, convey.ShouldEqual, http.StatusNotImplemented)
+		code, _ = doAdmin(h, "GET", "/admin/versions?streamer=none")
+		convey.So(code, convey.ShouldEqual, http.StatusNotFound)
+
+		code, _ = doAdmin(h, "GET", "/admin/pin?streamer=versioned&version=1")
+		convey.So(code, convey.ShouldEqual, http.StatusMethodNotAllowed)
+		code, _ = doAdmin(h, "POST", "/admin/pin?streamer=versioned&version=x")
+		convey.So(code, convey.ShouldEqual, http.StatusBadRequest)
+		code, body = doAdmin(h, "POST", "/admin/pin?streamer=versioned&version=1")
+		convey.So(code, convey.ShouldEqual, http.StatusOK)
+		convey.So(body["versions"].([]interface{})[0].(map[string]interface{})["pinned"], convey.ShouldBeTrue)
+		v, err := bf.Get("versioned", container.StrKey("a"))
+		convey.So(err, convey.ShouldBeNil)
+		convey.So(v, convey.ShouldEqual, "1")
+
+		code, _ = doAdmin(h, "POST", "/admin/unpin?streamer=versioned")
+		convey.So(code, convey.ShouldEqual, http.StatusOK)
+		code, _ = doAdmin(h, "POST", "/admin/unpin?streamer=versioned")
+		convey.So(code, convey.ShouldEqual, http.StatusConflict)
+
+		code, body = doAdmin(h, "POST", "/admin/rollback?streamer=versioned&version=1")
+		convey.So(code, convey.ShouldEqual, http.StatusOK)
+		convey.So(len(body["versions"].([]interface{})), convey.ShouldEqual, 1)
+		v, err = bf.Get("versioned", container.StrKey("a"))
+		convey.So(err, convey.ShouldBeNil)
+		convey.So(v, convey.ShouldEqual, "1")
+		convey.So(bf.Rollback("plain", 1).Error(), convey.ShouldEqual, "container is not versioned, streamer[plain]")
+	})
+}
+
+// run it with the race detector: go test -race ./bifrost/
+func TestAdminStreamersDuringReload(t *testing.T) {
+	convey.Convey("Test the streamers are listed during the reloads", t, func() {
+		dir, err := ioutil.TempDir("", "bifrost")
+		convey.So(err, convey.ShouldBeNil)
+		defer os.RemoveAll(dir)
+		path := filepath.Join(dir, "base")
+		convey.So(ioutil.WriteFile(path, []byte("a\taa\nb\tbb\nc\n"), 0644), convey.ShouldBeNil)
+
+		bf := NewBifrost()
+		lfs := streamer.NewFileStreamer(&streamer.LocalFileStreamerCfg{
+			Name:       "file",
+			Path:       path,
+			UpdatMode:  streamer.Static,
+			IsSync:     true,
+			DataParser: &streamer.DefaultTextParser{},
+		})
+		lfs.SetContainer(&container.BufferedMapContainer{Tolerate: 0.5})
+		convey.So(bf.Register("file", lfs), convey.ShouldBeNil)
+		convey.So(bf.Start(context.Background()), convey.ShouldBeNil)
+		defer bf.Stop()
+		convey.So(bf.WaitReady(), convey.ShouldBeNil)
+		h := http.StripPrefix("/admin", NewAdminHandler(bf))
+
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			for i := 0; i < 20; i++ {
+				doAdmin(h, "POST", "/admin/reload?streamer=file&kind=base")
+			}
+		}()
+		for listing := true; listing; {
+			select {
+			case <-done:
+				listing = false
+			default:
+				code, _ := doAdmin(h, "GET", "/admin/streamers")
+				convey.So(code, convey.ShouldEqual, http.StatusOK)
+			}
+		}
+		code, body := doAdmin(h, "GET", "/admin/streamers")
+		convey.So(code, convey.ShouldEqual, http.StatusOK)
+		info := body["streamers"].([]interface{})[0].(map[string]interface{})["info"].(map[string]interface{})
+		convey.So(info["error_num"], convey.ShouldEqual, 1)
+	})
+}
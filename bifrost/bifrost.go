@@ -1,47 +1,239 @@
 package bifrost
 
 import (
+	"context"
 	"errors"
+	"fmt"
 	"github.com/Mintegral-official/mtggokit/bifrost/container"
 	"github.com/Mintegral-official/mtggokit/bifrost/log"
+	"github.com/Mintegral-official/mtggokit/bifrost/metrics"
 	"github.com/Mintegral-official/mtggokit/bifrost/streamer"
+	"sync"
+	"time"
 )
 
 type Bifrost struct {
+	// DataStreamers is guarded by mu once Bifrost is shared, use GetStreamer/Register/Unregister
 	DataStreamers map[string]streamer.Streamer
-	logger        *log.BiLogger
+	logger        log.BiLogger
+
+	mu        sync.RWMutex
+	ctx       context.Context
+	cancel    context.CancelFunc
+	started   bool
+	stopped   bool
+	runnings  map[string]*running
+	deps      map[string][]string            // the dependencies of each streamer, see DependsOn
+	parsers   map[string]streamer.DataParser // the parsers declared by the config
+	sched     *streamer.Sched
+	schedDone chan struct{}
+
+	collector       metrics.Collector
+	metricsInterval time.Duration
+	metricsDone     chan struct{}
+	statsMu         sync.Mutex
+	gauges          map[string]metrics.Gauges
+}
+
+// Option configures a Bifrost
+type Option func(*Bifrost)
+
+// WithLogger sets the logger of Bifrost, it is also given to the streamers built from config
+func WithLogger(logger log.BiLogger) Option {
+	return func(l *Bifrost) {
+		l.logger = logger
+	}
 }
 
-func NewBifrost() *Bifrost {
-	return &Bifrost{
+// WithScheduler runs all streamers under one streamer.Sched instead of their own update loops,
+// use streamer.WithConcurrency to bound the number of concurrent reloads
+func WithScheduler(opts ...streamer.SchedOption) Option {
+	return func(l *Bifrost) {
+		l.sched = streamer.NewSched(opts...)
+	}
+}
+
+func NewBifrost(opts ...Option) *Bifrost {
+	l := &Bifrost{
 		DataStreamers: make(map[string]streamer.Streamer),
+		runnings:      make(map[string]*running),
+		deps:          make(map[string][]string),
+		gauges:        make(map[string]metrics.Gauges),
+	}
+	for _, opt := range opts {
+		opt(l)
 	}
+	return l
 }
 
 func (l *Bifrost) Get(name string, key container.MapKey) (interface{}, error) {
-	s, ok := l.DataStreamers[name]
-	if !ok {
-		return nil, errors.New("not found streamer[" + name + "]")
+	c, err := l.container(name)
+	if err != nil {
+		return nil, err
+	}
+	return c.Get(key)
+}
+
+// GetInt64 is Get(name, container.I64Key(key)), it doesn't allocate if the container is a
+// container.FastGetter, such as BufferedMapContainer and BlockingMapContainer
+func (l *Bifrost) GetInt64(name string, key int64) (interface{}, error) {
+	c, err := l.container(name)
+	if err != nil {
+		return nil, err
+	}
+	return container.GetInt64(c, key)
+}
+
+// GetString is Get(name, container.StrKey(key)), it doesn't allocate if the container is a
+// container.FastGetter
+func (l *Bifrost) GetString(name string, key string) (interface{}, error) {
+	c, err := l.container(name)
+	if err != nil {
+		return nil, err
+	}
+	return container.GetString(c, key)
+}
+
+func (l *Bifrost) container(name string) (container.Container, error) {
+	s, err := l.GetStreamer(name)
+	if err != nil {
+		return nil, err
 	}
 	c := s.GetContainer()
 	if c == nil {
 		return nil, errors.New("contain is nil, streamer[" + name + "]")
 	}
-	return c.Get(key)
+	return c, nil
+}
+
+// GetBy looks the values up by a secondary index, the container must be an IndexedContainer
+func (l *Bifrost) GetBy(name string, index string, key container.MapKey) ([]interface{}, error) {
+	s, err := l.GetStreamer(name)
+	if err != nil {
+		return nil, err
+	}
+	ic, ok := s.GetContainer().(*container.IndexedContainer)
+	if !ok {
+		return nil, errors.New("container is not indexed, streamer[" + name + "]")
+	}
+	return ic.GetBy(index, key)
+}
+
+// Versions returns the base versions kept by the container, the oldest first, the container
+// must be a VersionedContainer
+func (l *Bifrost) Versions(name string) ([]container.Version, error) {
+	vc, err := l.versioned(name)
+	if err != nil {
+		return nil, err
+	}
+	return vc.Versions(), nil
+}
+
+// Rollback serves the version id and drops the newer versions
+func (l *Bifrost) Rollback(name string, id int64) error {
+	vc, err := l.versioned(name)
+	if err != nil {
+		return err
+	}
+	return vc.Rollback(id)
+}
+
+// Pin serves the version id until Unpin, whatever the base loads in between
+func (l *Bifrost) Pin(name string, id int64) error {
+	vc, err := l.versioned(name)
+	if err != nil {
+		return err
+	}
+	return vc.Pin(id)
+}
+
+// Unpin serves the latest version again
+func (l *Bifrost) Unpin(name string) error {
+	vc, err := l.versioned(name)
+	if err != nil {
+		return err
+	}
+	return vc.Unpin()
+}
+
+func (l *Bifrost) versioned(name string) (*container.VersionedContainer, error) {
+	s, err := l.GetStreamer(name)
+	if err != nil {
+		return nil, err
+	}
+	vc, ok := s.GetContainer().(*container.VersionedContainer)
+	if !ok {
+		return nil, errors.New("container is not versioned, streamer[" + name + "]")
+	}
+	return vc, nil
 }
 
-func (l *Bifrost) Register(name string, streamer streamer.Streamer) error {
+// Register adds a streamer, it is started at once if Bifrost has been started. Its dependencies
+// may be registered later, until Start, which fails if any of them is missing.
+func (l *Bifrost) Register(name string, s streamer.Streamer, opts ...RegisterOption) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
 	if _, ok := l.DataStreamers[name]; ok {
 		return errors.New("streamer[" + name + "] has already exist")
 	}
-	l.DataStreamers[name] = streamer
+	if l.stopped {
+		return errors.New("bifrost has been stopped")
+	}
+	deps := dependencies(s, opts)
+	if l.started {
+		for _, dep := range deps {
+			if _, ok := l.DataStreamers[dep]; !ok {
+				return errors.New("streamer[" + name + "] depends on not found streamer[" + dep + "]")
+			}
+		}
+	}
+	l.DataStreamers[name] = s
+	if len(deps) > 0 {
+		l.deps[name] = deps
+	}
+	if o, ok := s.(streamer.Observable); ok {
+		o.SetObserver(l.observer(name))
+	}
+	if l.started {
+		l.startStreamer(name, s)
+	}
 	return nil
 }
 
 func (l *Bifrost) GetStreamer(name string) (streamer.Streamer, error) {
+	l.mu.RLock()
 	s, ok := l.DataStreamers[name]
+	l.mu.RUnlock()
 	if !ok {
 		return nil, errors.New("not found streamer[" + name + "]")
 	}
 	return s, nil
 }
+
+// Get is the typed version of Bifrost.Get, the value is asserted to V
+func Get[V any](bf *Bifrost, name string, key container.MapKey) (V, error) {
+	var zv V
+	v, err := bf.Get(name, key)
+	if err != nil {
+		return zv, err
+	}
+	data, ok := v.(V)
+	if !ok {
+		return zv, fmt.Errorf("value type error, streamer[%s], want[%T], got[%T]", name, zv, v)
+	}
+	return data, nil
+}
+
+// Lookup looks up a typed key, when the container was created by container.ToContainer
+// from a TypedContainer[K, V] the key is neither boxed nor converted
+func Lookup[K comparable, V any](bf *Bifrost, name string, key K) (V, error) {
+	var zv V
+	c, err := bf.container(name)
+	if err != nil {
+		return zv, err
+	}
+	if tc, ok := container.AsTyped[K, V](c); ok {
+		return tc.Get(key)
+	}
+	return Get[V](bf, name, container.Key(key))
+}
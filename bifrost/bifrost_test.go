@@ -53,3 +53,105 @@ func TestLoader_Register(t *testing.T) {
 		convey.So(e.Error(), convey.ShouldEqual, "streamer[abc] has already exist")
 	})
 }
+
+type containerStreamer struct {
+	FakeStreamer
+	c container.Container
+}
+
+func (cs *containerStreamer) GetContainer() container.Container {
+	return cs.c
+}
+
+func TestTypedGet(t *testing.T) {
+	convey.Convey("Test typed Get and Lookup", t, func() {
+		bf := NewBifrost()
+		typed := container.CreateBlockingMap[int64, []int64](0)
+		convey.So(typed.Set(1, []int64{1, 2, 3}), convey.ShouldBeNil)
+		convey.So(bf.Register("typed", &containerStreamer{c: container.ToContainer[int64, []int64](typed)}), convey.ShouldBeNil)
+
+		plain := container.CreateBlockingMapContainer(1, 0)
+		convey.So(plain.Set(container.StrKey("a"), "aa"), convey.ShouldBeNil)
+		convey.So(bf.Register("plain", &containerStreamer{c: plain}), convey.ShouldBeNil)
+
+		ids, err := Get[[]int64](bf, "typed", container.I64Key(1))
+		convey.So(err, convey.ShouldBeNil)
+		convey.So(ids, convey.ShouldResemble, []int64{1, 2, 3})
+
+		ids, err = Lookup[int64, []int64](bf, "typed", 1)
+		convey.So(err, convey.ShouldBeNil)
+		convey.So(ids, convey.ShouldResemble, []int64{1, 2, 3})
+
+		s, err := Lookup[string, string](bf, "plain", "a")
+		convey.So(err, convey.ShouldBeNil)
+		convey.So(s, convey.ShouldEqual, "aa")
+
+		pairs := container.CreateBlockingMapContainer(16, 0)
+		convey.So(pairs.Set(container.NewPairKey(int64(123), "US"), "us"), convey.ShouldBeNil)
+		convey.So(bf.Register("pairs", &containerStreamer{c: pairs}), convey.ShouldBeNil)
+		s, err = Lookup[container.Pair[int64, string], string](bf, "pairs", container.Pair[int64, string]{First: 123, Second: "US"})
+		convey.So(err, convey.ShouldBeNil)
+		convey.So(s, convey.ShouldEqual, "us")
+
+		_, err = Get[int](bf, "plain", container.StrKey("a"))
+		convey.So(err, convey.ShouldNotBeNil)
+		_, err = Lookup[string, string](bf, "not_exist", "a")
+		convey.So(err, convey.ShouldNotBeNil)
+	})
+}
+
+func TestGetInt64AndGetString(t *testing.T) {
+	convey.Convey("Test GetInt64 and GetString", t, func() {
+		bf := NewBifrost()
+		bm := container.CreateBlockingMapContainer(4, 0)
+		convey.So(bm.Set(container.I64Key(1), "one"), convey.ShouldBeNil)
+		convey.So(bm.Set(container.StrKey("a"), "aa"), convey.ShouldBeNil)
+		convey.So(bf.Register("blocking", &containerStreamer{c: bm}), convey.ShouldBeNil)
+		typed := container.CreateBlockingMap[string, string](0)
+		convey.So(typed.Set("a", "ta"), convey.ShouldBeNil)
+		convey.So(bf.Register("typed", &containerStreamer{c: container.ToContainer[string, string](typed)}), convey.ShouldBeNil)
+
+		v, err := bf.GetInt64("blocking", 1)
+		convey.So(err, convey.ShouldBeNil)
+		convey.So(v, convey.ShouldEqual, "one")
+		v, err = bf.GetString("blocking", "a")
+		convey.So(err, convey.ShouldBeNil)
+		convey.So(v, convey.ShouldEqual, "aa")
+		_, err = bf.GetInt64("blocking", 2)
+		convey.So(err, convey.ShouldEqual, container.NotExistErr)
+
+		// the containers which are not FastGetters are looked up by Get
+		v, err = bf.GetString("typed", "a")
+		convey.So(err, convey.ShouldBeNil)
+		convey.So(v, convey.ShouldEqual, "ta")
+		_, err = bf.GetInt64("not_exist", 1)
+		convey.So(err, convey.ShouldNotBeNil)
+
+		allocs := testing.AllocsPerRun(100, func() {
+			_, _ = bf.GetInt64("blocking", 1)
+			_, _ = bf.GetString("blocking", "a")
+		})
+		convey.So(allocs, convey.ShouldEqual, 0)
+	})
+}
+
+func TestGetBy(t *testing.T) {
+	convey.Convey("Test GetBy", t, func() {
+		bf := NewBifrost()
+		ic := container.CreateIndexedContainer(container.CreateBlockingMapContainer(1, 0), map[string]container.IndexFunc{
+			"first": func(v interface{}) []container.MapKey {
+				return []container.MapKey{container.StrKey(v.(string)[:1])}
+			},
+		})
+		convey.So(ic.Set(container.StrKey("a"), "xa"), convey.ShouldBeNil)
+		convey.So(bf.Register("indexed", &containerStreamer{c: ic}), convey.ShouldBeNil)
+		convey.So(bf.Register("plain", &containerStreamer{c: container.CreateBlockingMapContainer(1, 0)}), convey.ShouldBeNil)
+
+		values, err := bf.GetBy("indexed", "first", container.StrKey("x"))
+		convey.So(err, convey.ShouldBeNil)
+		convey.So(values, convey.ShouldResemble, []interface{}{"xa"})
+
+		_, err = bf.GetBy("plain", "first", container.StrKey("x"))
+		convey.So(err.Error(), convey.ShouldEqual, "container is not indexed, streamer[plain]")
+	})
+}
@@ -1,32 +1,124 @@
 package conf
 
-import "github.com/Mintegral-official/mtggokit/bifrost/streamer"
+import (
+	"github.com/Mintegral-official/mtggokit/bifrost/container"
+	"github.com/Mintegral-official/mtggokit/bifrost/streamer"
+)
 
 type StreamerConfig struct {
 	StreamerCfg *StreamerCfg `toml:"bifrost"`
 }
 
 type StreamerCfg struct {
+	Parser        []ParserCfg        `toml:"parser"`
 	FileStreamer  []FileStreamerCfg  `toml:"file_streamer"`
 	MongoStreamer []MongoStreamerCfg `toml:"mongo_streamer"`
+	RedisStreamer []RedisStreamerCfg `toml:"redis_streamer"`
+	HTTPStreamer  []HTTPStreamerCfg  `toml:"http_streamer"`
+}
+
+// ParserCfg declares a built-in parser, the streamers select it by its name
+type ParserCfg struct {
+	Name      string   `toml:"name"`
+	Format    string   `toml:"format"`     // tsv/csv/jsonl/bson
+	Type      string   `toml:"type"`       // the value type registered by bifrost.RegisterType
+	KeyType   string   `toml:"key_type"`   // string/int64
+	KeyColumn int      `toml:"key_column"` // tsv/csv: the index of the key column
+	Columns   []string `toml:"columns"`    // tsv/csv: the names of the columns
+	KeyField  string   `toml:"key_field"`  // jsonl/bson: the name of the key field
 }
 
 type FileStreamerCfg struct {
 	Name       string              `toml:"name"`
 	Path       string              `toml:"path"`
+	IncPath    string              `toml:"inc_path"`
 	Mode       string              `toml:"mode"`
+	Interval   int                 `toml:"interval"`
+	IsSync     bool                `toml:"is_sync"`
 	Parser     string              `toml:"parser"`
+	Container  string              `toml:"container"`
+	Partition  int                 `toml:"partition"`
+	Tolerate   float64             `toml:"tolerate"`
 	DataParser streamer.DataParser `toml:"-"`
+
+	SnapshotPath  string               `toml:"snapshot_path"`
+	SnapshotCodec string               `toml:"snapshot_codec"`
+	ValueCodec    container.ValueCodec `toml:"-"`
 }
 
 type MongoStreamerCfg struct {
-	Mongo      string              `toml:"mongo"`
-	Timeout    int                 `toml:"timeout"`
+	Mongo         string              `toml:"mongo"`
+	Timeout       int                 `toml:"timeout"`
+	ReadTimeout   int                 `toml:"read_timeout"`
+	Name          string              `toml:"name"`
+	Mode          string              `toml:"mode"`
+	IncInterval   int                 `toml:"inc_interval"`
+	BaseInterval  int                 `toml:"base_interval"`
+	IsSync        bool                `toml:"is_sync"`
+	TryTimes      int                 `toml:"try_times"`
+	Db            string              `toml:"db"`
+	Collection    string              `toml:"collection"`
+	BaseQuery     string              `toml:"base_query"`
+	IncQuery      string              `toml:"inc_query"`
+	Parser        string              `toml:"parser"`
+	IncParser     string              `toml:"inc_parser"`
+	Container     string              `toml:"container"`
+	Partition     int                 `toml:"partition"`
+	Tolerate      float64             `toml:"tolerate"`
+	DataParser    streamer.DataParser `toml:"-"`
+	IncDataParser streamer.DataParser `toml:"-"`
+
+	SnapshotPath  string               `toml:"snapshot_path"`
+	SnapshotCodec string               `toml:"snapshot_codec"`
+	ValueCodec    container.ValueCodec `toml:"-"`
+
+	ChangeStream     bool                `toml:"change_stream"`
+	DeleteParser     string              `toml:"delete_parser"`
+	ResumeTokenPath  string              `toml:"resume_token_path"`
+	DeleteDataParser streamer.DataParser `toml:"-"`
+
+	WatermarkField   string `toml:"watermark_field"`
+	WatermarkOverlap int    `toml:"watermark_overlap"`
+	WatermarkPath    string `toml:"watermark_path"`
+}
+
+type RedisStreamerCfg struct {
+	Addr         string              `toml:"addr"`
+	Password     string              `toml:"password"`
+	Db           int                 `toml:"db"`
+	Timeout      int                 `toml:"timeout"`
+	ReadTimeout  int                 `toml:"read_timeout"`
+	Name         string              `toml:"name"`
+	IncInterval  int                 `toml:"inc_interval"`
+	BaseInterval int                 `toml:"base_interval"`
+	IsSync       bool                `toml:"is_sync"`
+	TryTimes     int                 `toml:"try_times"`
+	Source       string              `toml:"source"`
+	Pattern      string              `toml:"pattern"`
+	Key          string              `toml:"key"`
+	ScanCount    int                 `toml:"scan_count"`
+	Keyspace     bool                `toml:"keyspace"`
+	Channel      string              `toml:"channel"`
+	Parser       string              `toml:"parser"`
+	Container    string              `toml:"container"`
+	Partition    int                 `toml:"partition"`
+	Tolerate     float64             `toml:"tolerate"`
+	DataParser   streamer.DataParser `toml:"-"`
+}
+
+type HTTPStreamerCfg struct {
 	Name       string              `toml:"name"`
-	Db         string              `toml:"db"`
-	Collection string              `toml:"collection"`
-	BaseQuery  string              `toml:"base_query"`
-	IncQuery   string              `toml:"inc_query"`
+	URL        string              `toml:"url"`
+	Mode       string              `toml:"mode"`
+	Interval   int                 `toml:"interval"`
+	IsSync     bool                `toml:"is_sync"`
+	Timeout    int                 `toml:"timeout"`
+	TryTimes   int                 `toml:"try_times"`
+	RetryWait  int                 `toml:"retry_wait"`
+	MaxBytes   int64               `toml:"max_bytes"`
 	Parser     string              `toml:"parser"`
+	Container  string              `toml:"container"`
+	Partition  int                 `toml:"partition"`
+	Tolerate   float64             `toml:"tolerate"`
 	DataParser streamer.DataParser `toml:"-"`
 }
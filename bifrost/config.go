@@ -0,0 +1,388 @@
+package bifrost
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/BurntSushi/toml"
+	"github.com/Mintegral-official/mtggokit/bifrost/conf"
+	"github.com/Mintegral-official/mtggokit/bifrost/container"
+	"github.com/Mintegral-official/mtggokit/bifrost/streamer"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// NewFromConfig reads the toml file at path, builds and registers all streamers
+// declared in it, then starts them
+func NewFromConfig(ctx context.Context, path string, opts ...Option) (*Bifrost, error) {
+	cfg := &conf.StreamerConfig{}
+	if _, err := toml.DecodeFile(path, cfg); err != nil {
+		return nil, fmt.Errorf("decode config[%s] error: %s", path, err.Error())
+	}
+	return NewFromStreamerConfig(ctx, cfg, opts...)
+}
+
+// NewFromStreamerConfig is like NewFromConfig for a config which is already decoded,
+// DataParser fields set by the caller take precedence over the parser names
+func NewFromStreamerConfig(ctx context.Context, cfg *conf.StreamerConfig, opts ...Option) (*Bifrost, error) {
+	if cfg == nil || cfg.StreamerCfg == nil {
+		return nil, errors.New("config has no [bifrost] section")
+	}
+	bf := NewBifrost(opts...)
+	if err := bf.registerFromConfig(cfg.StreamerCfg); err != nil {
+		// release the mongo clients already created
+		_ = bf.Stop()
+		return nil, err
+	}
+	if err := bf.Start(ctx); err != nil {
+		return nil, err
+	}
+	if err := bf.WaitReady(); err != nil {
+		_ = bf.Stop()
+		return nil, err
+	}
+	return bf, nil
+}
+
+func (l *Bifrost) registerFromConfig(cfg *conf.StreamerCfg) error {
+	l.parsers = make(map[string]streamer.DataParser, len(cfg.Parser))
+	for i := range cfg.Parser {
+		name := cfg.Parser[i].Name
+		if _, err := getParser(name); err == nil {
+			return errors.New("parser[" + name + "] has already exist")
+		}
+		if _, ok := l.parsers[name]; ok {
+			return errors.New("parser[" + name + "] has already exist")
+		}
+		p, err := newParser(&cfg.Parser[i])
+		if err != nil {
+			return fmt.Errorf("parser[%s]: %s", name, err.Error())
+		}
+		l.parsers[name] = p
+	}
+	for i := range cfg.FileStreamer {
+		s, err := l.newFileStreamer(&cfg.FileStreamer[i])
+		if err != nil {
+			return err
+		}
+		if err := l.Register(cfg.FileStreamer[i].Name, s); err != nil {
+			return err
+		}
+	}
+	for i := range cfg.MongoStreamer {
+		s, err := l.newMongoStreamer(&cfg.MongoStreamer[i])
+		if err != nil {
+			return err
+		}
+		if err := l.Register(cfg.MongoStreamer[i].Name, s); err != nil {
+			if c, ok := s.(streamer.Closer); ok {
+				_ = c.Close()
+			}
+			return err
+		}
+	}
+	for i := range cfg.RedisStreamer {
+		s, err := l.newRedisStreamer(&cfg.RedisStreamer[i])
+		if err != nil {
+			return err
+		}
+		if err := l.Register(cfg.RedisStreamer[i].Name, s); err != nil {
+			_ = s.(streamer.Closer).Close()
+			return err
+		}
+	}
+	for i := range cfg.HTTPStreamer {
+		s, err := l.newHTTPStreamer(&cfg.HTTPStreamer[i])
+		if err != nil {
+			return err
+		}
+		if err := l.Register(cfg.HTTPStreamer[i].Name, s); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (l *Bifrost) newFileStreamer(cfg *conf.FileStreamerCfg) (streamer.Streamer, error) {
+	mode, err := parseMode(cfg.Mode)
+	if err != nil {
+		return nil, fmt.Errorf("file_streamer[%s]: %s", cfg.Name, err.Error())
+	}
+	parser, err := l.resolveParser(cfg.DataParser, cfg.Parser)
+	if err != nil {
+		return nil, fmt.Errorf("file_streamer[%s]: %s", cfg.Name, err.Error())
+	}
+	containerName := cfg.Container
+	if containerName == "" {
+		containerName = "buffered_map"
+		if mode == streamer.Increment || mode == streamer.DynInc {
+			containerName = "blocking_map"
+		}
+	}
+	c, err := newContainer(containerName, cfg.Partition, cfg.Tolerate)
+	if err != nil {
+		return nil, fmt.Errorf("file_streamer[%s]: %s", cfg.Name, err.Error())
+	}
+	codec, err := resolveCodec(cfg.SnapshotPath, cfg.ValueCodec, cfg.SnapshotCodec)
+	if err != nil {
+		return nil, fmt.Errorf("file_streamer[%s]: %s", cfg.Name, err.Error())
+	}
+	s := streamer.NewFileStreamer(&streamer.LocalFileStreamerCfg{
+		Name:          cfg.Name,
+		Path:          cfg.Path,
+		IncPath:       cfg.IncPath,
+		UpdatMode:     mode,
+		Interval:      cfg.Interval,
+		IsSync:        cfg.IsSync,
+		DataParser:    parser,
+		Logger:        l.logger,
+		SnapshotPath:  cfg.SnapshotPath,
+		SnapshotCodec: codec,
+	})
+	s.SetContainer(c)
+	return s, nil
+}
+
+func (l *Bifrost) newMongoStreamer(cfg *conf.MongoStreamerCfg) (streamer.Streamer, error) {
+	mode, err := parseMode(cfg.Mode)
+	if err != nil {
+		return nil, fmt.Errorf("mongo_streamer[%s]: %s", cfg.Name, err.Error())
+	}
+	baseParser, err := l.resolveParser(cfg.DataParser, cfg.Parser)
+	if err != nil {
+		return nil, fmt.Errorf("mongo_streamer[%s]: %s", cfg.Name, err.Error())
+	}
+	incParser := baseParser
+	if cfg.IncDataParser != nil || cfg.IncParser != "" {
+		if incParser, err = l.resolveParser(cfg.IncDataParser, cfg.IncParser); err != nil {
+			return nil, fmt.Errorf("mongo_streamer[%s]: %s", cfg.Name, err.Error())
+		}
+	}
+	var deleteParser streamer.DataParser
+	if cfg.DeleteDataParser != nil || cfg.DeleteParser != "" {
+		if deleteParser, err = l.resolveParser(cfg.DeleteDataParser, cfg.DeleteParser); err != nil {
+			return nil, fmt.Errorf("mongo_streamer[%s]: %s", cfg.Name, err.Error())
+		}
+	}
+	baseQuery, err := parseQuery(cfg.BaseQuery)
+	if err != nil {
+		return nil, fmt.Errorf("mongo_streamer[%s] base_query: %s", cfg.Name, err.Error())
+	}
+	incQuery, err := parseQuery(cfg.IncQuery)
+	if err != nil {
+		return nil, fmt.Errorf("mongo_streamer[%s] inc_query: %s", cfg.Name, err.Error())
+	}
+	containerName := cfg.Container
+	if containerName == "" {
+		containerName = "blocking_map"
+	}
+	c, err := newContainer(containerName, cfg.Partition, cfg.Tolerate)
+	if err != nil {
+		return nil, fmt.Errorf("mongo_streamer[%s]: %s", cfg.Name, err.Error())
+	}
+	codec, err := resolveCodec(cfg.SnapshotPath, cfg.ValueCodec, cfg.SnapshotCodec)
+	if err != nil {
+		return nil, fmt.Errorf("mongo_streamer[%s]: %s", cfg.Name, err.Error())
+	}
+	s, err := streamer.NewMongoStreamer(&streamer.MongoStreamerCfg{
+		Name:            cfg.Name,
+		UpdateMode:      mode,
+		IncInterval:     cfg.IncInterval,
+		BaseInterval:    cfg.BaseInterval,
+		IsSync:          cfg.IsSync,
+		TryTimes:        cfg.TryTimes,
+		URI:             cfg.Mongo,
+		DB:              cfg.Db,
+		Collection:      cfg.Collection,
+		ConnectTimeout:  cfg.Timeout,
+		ReadTimeout:     cfg.ReadTimeout,
+		BaseParser:      baseParser,
+		IncParser:       incParser,
+		BaseQuery:       baseQuery,
+		IncQuery:        incQuery,
+		Logger:          l.logger,
+		SnapshotPath:    cfg.SnapshotPath,
+		SnapshotCodec:   codec,
+		ChangeStream:    cfg.ChangeStream,
+		DeleteParser:    deleteParser,
+		ResumeTokenPath: cfg.ResumeTokenPath,
+
+		WatermarkField:   cfg.WatermarkField,
+		WatermarkOverlap: cfg.WatermarkOverlap,
+		WatermarkPath:    cfg.WatermarkPath,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("mongo_streamer[%s]: %s", cfg.Name, err.Error())
+	}
+	s.SetContainer(c)
+	return s, nil
+}
+
+func (l *Bifrost) newHTTPStreamer(cfg *conf.HTTPStreamerCfg) (streamer.Streamer, error) {
+	mode, err := parseMode(cfg.Mode)
+	if err != nil {
+		return nil, fmt.Errorf("http_streamer[%s]: %s", cfg.Name, err.Error())
+	}
+	if mode != streamer.Static && mode != streamer.Dynamic {
+		return nil, fmt.Errorf("http_streamer[%s]: not support mode[%s]", cfg.Name, cfg.Mode)
+	}
+	parser, err := l.resolveParser(cfg.DataParser, cfg.Parser)
+	if err != nil {
+		return nil, fmt.Errorf("http_streamer[%s]: %s", cfg.Name, err.Error())
+	}
+	containerName := cfg.Container
+	if containerName == "" {
+		containerName = "buffered_map"
+	}
+	c, err := newContainer(containerName, cfg.Partition, cfg.Tolerate)
+	if err != nil {
+		return nil, fmt.Errorf("http_streamer[%s]: %s", cfg.Name, err.Error())
+	}
+	s := streamer.NewHTTPStreamer(&streamer.HTTPStreamerCfg{
+		Name:       cfg.Name,
+		URL:        cfg.URL,
+		UpdatMode:  mode,
+		Interval:   cfg.Interval,
+		IsSync:     cfg.IsSync,
+		Timeout:    cfg.Timeout,
+		TryTimes:   cfg.TryTimes,
+		RetryWait:  cfg.RetryWait,
+		MaxBytes:   cfg.MaxBytes,
+		DataParser: parser,
+		Logger:     l.logger,
+	})
+	s.SetContainer(c)
+	return s, nil
+}
+
+func (l *Bifrost) newRedisStreamer(cfg *conf.RedisStreamerCfg) (streamer.Streamer, error) {
+	source := streamer.RedisScan
+	if cfg.Source != "" {
+		var err error
+		if source, err = streamer.ParseRedisSource(cfg.Source); err != nil {
+			return nil, fmt.Errorf("redis_streamer[%s]: %s", cfg.Name, err.Error())
+		}
+	}
+	parser, err := l.resolveParser(cfg.DataParser, cfg.Parser)
+	if err != nil {
+		return nil, fmt.Errorf("redis_streamer[%s]: %s", cfg.Name, err.Error())
+	}
+	containerName := cfg.Container
+	if containerName == "" {
+		containerName = "blocking_map"
+	}
+	c, err := newContainer(containerName, cfg.Partition, cfg.Tolerate)
+	if err != nil {
+		return nil, fmt.Errorf("redis_streamer[%s]: %s", cfg.Name, err.Error())
+	}
+	s, err := streamer.NewRedisStreamer(&streamer.RedisStreamerCfg{
+		Name:           cfg.Name,
+		IncInterval:    cfg.IncInterval,
+		BaseInterval:   cfg.BaseInterval,
+		IsSync:         cfg.IsSync,
+		TryTimes:       cfg.TryTimes,
+		Addr:           cfg.Addr,
+		Password:       cfg.Password,
+		DB:             cfg.Db,
+		ConnectTimeout: cfg.Timeout,
+		ReadTimeout:    cfg.ReadTimeout,
+		Source:         source,
+		Pattern:        cfg.Pattern,
+		Key:            cfg.Key,
+		ScanCount:      cfg.ScanCount,
+		Keyspace:       cfg.Keyspace,
+		Channel:        cfg.Channel,
+		DataParser:     parser,
+		Logger:         l.logger,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("redis_streamer[%s]: %s", cfg.Name, err.Error())
+	}
+	s.SetContainer(c)
+	return s, nil
+}
+
+func parseMode(mode string) (streamer.UpdatMode, error) {
+	if mode == "" {
+		return streamer.Dynamic, nil
+	}
+	return streamer.ParseUpdatMode(mode)
+}
+
+// resolveParser returns parser if it's set, otherwise the parser declared by the config or
+// registered with the name
+func (l *Bifrost) resolveParser(parser streamer.DataParser, name string) (streamer.DataParser, error) {
+	if parser != nil {
+		return parser, nil
+	}
+	if name == "" {
+		name = "default"
+	}
+	if p, ok := l.parsers[name]; ok {
+		return p, nil
+	}
+	return getParser(name)
+}
+
+// newParser creates a parser declared by the config
+func newParser(cfg *conf.ParserCfg) (streamer.DataParser, error) {
+	keyType, err := streamer.ParseKeyType(cfg.KeyType)
+	if err != nil {
+		return nil, err
+	}
+	var prototype interface{}
+	if cfg.Type != "" {
+		if prototype, err = getType(cfg.Type); err != nil {
+			return nil, err
+		}
+	}
+	switch cfg.Format {
+	case "tsv", "csv":
+		dpc := &streamer.DelimitedParserCfg{
+			KeyColumn: cfg.KeyColumn,
+			KeyType:   keyType,
+			Columns:   cfg.Columns,
+			Type:      prototype,
+		}
+		if cfg.Format == "csv" {
+			return streamer.NewCSVParser(dpc)
+		}
+		return streamer.NewTSVParser(dpc)
+	case "jsonl":
+		return streamer.NewJSONLinesParser(&streamer.JSONLinesParserCfg{
+			KeyField: cfg.KeyField,
+			KeyType:  keyType,
+			Type:     prototype,
+		})
+	case "bson":
+		return streamer.NewBSONParser(&streamer.BSONParserCfg{
+			KeyField: cfg.KeyField,
+			KeyType:  keyType,
+			Type:     prototype,
+		})
+	default:
+		return nil, errors.New("unknown format[" + cfg.Format + "]")
+	}
+}
+
+func resolveCodec(path string, codec container.ValueCodec, name string) (container.ValueCodec, error) {
+	if path == "" || codec != nil {
+		return codec, nil
+	}
+	if name == "" {
+		name = "string"
+	}
+	return getCodec(name)
+}
+
+// parseQuery parses a query written in mongo extended json
+func parseQuery(query string) (interface{}, error) {
+	if query == "" {
+		return bson.M{}, nil
+	}
+	q := bson.M{}
+	if err := bson.UnmarshalExtJSON([]byte(query), false, &q); err != nil {
+		return nil, err
+	}
+	return q, nil
+}
@@ -0,0 +1,239 @@
+package bifrost
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/Mintegral-official/mtggokit/bifrost/container"
+	"github.com/Mintegral-official/mtggokit/bifrost/streamer"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/smartystreets/goconvey/convey"
+)
+
+type upperParser struct {
+}
+
+func (*upperParser) Parse(data []byte, userData interface{}) []streamer.ParserResult {
+	items := strings.SplitN(string(data), "\t", 2)
+	if len(items) != 2 {
+		return nil
+	}
+	return []streamer.ParserResult{{DataMode: container.DataModeAdd, Key: container.StrKey(items[0]), Value: strings.ToUpper(items[1])}}
+}
+
+type offer struct {
+	Id      int64
+	Package string
+}
+
+func TestNewFromConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "bifrost")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	dataPath := filepath.Join(dir, "data.txt")
+	if err := ioutil.WriteFile(dataPath, []byte("a\taa\nb\tbb\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	_ = RegisterParser("upper", &upperParser{})
+
+	writeCfg := func(content string) string {
+		path := filepath.Join(dir, "bifrost.toml")
+		if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+
+	convey.Convey("Test file streamers from config", t, func() {
+		path := writeCfg(`
+[bifrost]
+[[bifrost.file_streamer]]
+name = "text"
+path = "` + dataPath + `"
+mode = "dynamic"
+interval = 60
+is_sync = true
+
+[[bifrost.file_streamer]]
+name = "upper"
+path = "` + dataPath + `"
+mode = "Static"
+parser = "upper"
+container = "blocking_map"
+partition = 4
+is_sync = true
+`)
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		bf, err := NewFromConfig(ctx, path)
+		convey.So(err, convey.ShouldBeNil)
+		convey.So(len(bf.DataStreamers), convey.ShouldEqual, 2)
+
+		v, err := bf.Get("text", container.StrKey("a"))
+		convey.So(err, convey.ShouldBeNil)
+		convey.So(v, convey.ShouldEqual, "aa")
+
+		v, err = bf.Get("upper", container.StrKey("b"))
+		convey.So(err, convey.ShouldBeNil)
+		convey.So(v, convey.ShouldEqual, "BB")
+
+		s, err := bf.GetStreamer("upper")
+		convey.So(err, convey.ShouldBeNil)
+		_, ok := s.GetContainer().(*container.BlockingMapContainer)
+		convey.So(ok, convey.ShouldBeTrue)
+	})
+
+	convey.Convey("Test unknown parser", t, func() {
+		path := writeCfg(`
+[bifrost]
+[[bifrost.file_streamer]]
+name = "text"
+path = "` + dataPath + `"
+parser = "not_exist"
+`)
+		_, err := NewFromConfig(context.Background(), path)
+		convey.So(err, convey.ShouldNotBeNil)
+		convey.So(err.Error(), convey.ShouldEqual, "file_streamer[text]: not found parser[not_exist]")
+	})
+
+	convey.Convey("Test parsers declared by config", t, func() {
+		_ = RegisterType("offer", offer{})
+		csvPath := filepath.Join(dir, "offers.csv")
+		convey.So(ioutil.WriteFile(csvPath, []byte("1,com.a\n2,com.b\n"), 0644), convey.ShouldBeNil)
+		path := writeCfg(`
+[bifrost]
+[[bifrost.parser]]
+name = "offer"
+format = "csv"
+type = "offer"
+key_type = "int64"
+columns = ["Id", "Package"]
+
+[[bifrost.file_streamer]]
+name = "offer"
+path = "` + csvPath + `"
+parser = "offer"
+is_sync = true
+
+[[bifrost.file_streamer]]
+name = "tsv"
+path = "` + dataPath + `"
+parser = "tsv"
+is_sync = true
+`)
+		bf, err := NewFromConfig(context.Background(), path)
+		convey.So(err, convey.ShouldBeNil)
+		defer bf.Stop()
+		v, err := bf.Get("offer", container.I64Key(2))
+		convey.So(err, convey.ShouldBeNil)
+		convey.So(v, convey.ShouldResemble, &offer{Id: 2, Package: "com.b"})
+		v, err = bf.Get("tsv", container.StrKey("a"))
+		convey.So(err, convey.ShouldBeNil)
+		convey.So(v, convey.ShouldResemble, []string{"a", "aa"})
+
+		path = writeCfg(`
+[bifrost]
+[[bifrost.parser]]
+name = "bad"
+format = "jsonl"
+type = "not_exist"
+`)
+		_, err = NewFromConfig(context.Background(), path)
+		convey.So(err.Error(), convey.ShouldEqual, "parser[bad]: not found type[not_exist]")
+	})
+
+	convey.Convey("Test unknown mode", t, func() {
+		path := writeCfg(`
+[bifrost]
+[[bifrost.file_streamer]]
+name = "text"
+path = "` + dataPath + `"
+mode = "hourly"
+`)
+		_, err := NewFromConfig(context.Background(), path)
+		convey.So(err, convey.ShouldNotBeNil)
+		convey.So(err.Error(), convey.ShouldEqual, "file_streamer[text]: unknown update mode[hourly]")
+	})
+
+	convey.Convey("Test snapshot from config", t, func() {
+		snapshot := filepath.Join(dir, "snapshot")
+		path := writeCfg(`
+[bifrost]
+[[bifrost.file_streamer]]
+name = "text"
+path = "` + dataPath + `"
+is_sync = true
+snapshot_path = "` + snapshot + `"
+`)
+		bf, err := NewFromConfig(context.Background(), path)
+		convey.So(err, convey.ShouldBeNil)
+		convey.So(bf.Stop(), convey.ShouldBeNil)
+		restored := &container.BufferedMapContainer{}
+		_, err = container.LoadSnapshot(restored, snapshot, container.StringCodec{})
+		convey.So(err, convey.ShouldBeNil)
+		convey.So(restored.Len(), convey.ShouldEqual, 2)
+
+		path = writeCfg(`
+[bifrost]
+[[bifrost.file_streamer]]
+name = "text"
+path = "` + dataPath + `"
+snapshot_path = "` + snapshot + `"
+snapshot_codec = "not_exist"
+`)
+		_, err = NewFromConfig(context.Background(), path)
+		convey.So(err, convey.ShouldNotBeNil)
+		convey.So(err.Error(), convey.ShouldEqual, "file_streamer[text]: not found codec[not_exist]")
+	})
+
+	convey.Convey("Test redis streamer from config", t, func() {
+		m := miniredis.RunT(t)
+		m.HSet("conf", "a", "aa")
+		path := writeCfg(`
+[bifrost]
+[[bifrost.redis_streamer]]
+name = "conf"
+addr = "` + m.Addr() + `"
+source = "hash"
+key = "conf"
+parser = "upper"
+inc_interval = 60
+is_sync = true
+`)
+		bf, err := NewFromConfig(context.Background(), path)
+		convey.So(err, convey.ShouldBeNil)
+		v, err := bf.Get("conf", container.StrKey("a"))
+		convey.So(err, convey.ShouldBeNil)
+		convey.So(v, convey.ShouldEqual, "AA")
+		convey.So(bf.Stop(), convey.ShouldBeNil)
+
+		path = writeCfg(`
+[bifrost]
+[[bifrost.redis_streamer]]
+name = "conf"
+addr = "` + m.Addr() + `"
+source = "list"
+`)
+		_, err = NewFromConfig(context.Background(), path)
+		convey.So(err, convey.ShouldNotBeNil)
+		convey.So(err.Error(), convey.ShouldEqual, "redis_streamer[conf]: unknown redis source[list]")
+	})
+
+	convey.Convey("Test missing bifrost section", t, func() {
+		_, err := NewFromConfig(context.Background(), writeCfg(""))
+		convey.So(err, convey.ShouldNotBeNil)
+	})
+
+	convey.Convey("Test duplicate registry name", t, func() {
+		convey.So(RegisterParser("default", &upperParser{}), convey.ShouldNotBeNil)
+		convey.So(RegisterContainer("buffered_map", nil), convey.ShouldNotBeNil)
+		convey.So(RegisterCodec("string", container.StringCodec{}), convey.ShouldNotBeNil)
+		convey.So(RegisterType("offer", offer{}), convey.ShouldNotBeNil)
+	})
+}
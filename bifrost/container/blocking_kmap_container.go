@@ -4,28 +4,27 @@ import (
 	"errors"
 	"fmt"
 	"sync"
+	"sync/atomic"
 )
 
 // 多线程读写安全的container，支持增量
 type BlockingKMapContainer struct {
-	innerData *sync.Map
-	errorNum  int64
-	totalNum  int64
-	Tolerate  float64
+	innerData atomic.Pointer[sync.Map]
+	loadStats
+	validation
+	Tolerate float64
 }
 
 func CreateBlockingKSetContainer(tolerate float64) *BlockingMapContainer {
-	return &BlockingMapContainer{
-		innerData: &sync.Map{},
-		Tolerate:  tolerate,
-	}
+	return CreateBlockingMapContainer(1, tolerate)
 }
 
 func (bm *BlockingKMapContainer) Get(key MapKey) (interface{}, error) {
-	if bm.innerData == nil {
+	m := bm.innerData.Load()
+	if m == nil {
 		return nil, NotExistErr
 	}
-	data, in := bm.innerData.Load(key.Value())
+	data, in := m.Load(key.Value())
 	if !in {
 		return nil, NotExistErr
 	}
@@ -34,8 +33,7 @@ func (bm *BlockingKMapContainer) Get(key MapKey) (interface{}, error) {
 
 func (bm *BlockingKMapContainer) LoadBase(iterator DataIterator) error {
 	tmpM := &sync.Map{}
-	bm.errorNum = 0
-	bm.totalNum = 0
+	bm.resetStats()
 
 	b, e := iterator.HasNext()
 	if e != nil {
@@ -43,9 +41,9 @@ func (bm *BlockingKMapContainer) LoadBase(iterator DataIterator) error {
 	}
 	for b {
 		m, k, v, e := iterator.Next()
-		bm.totalNum++
+		bm.addTotal()
 		if e != nil {
-			bm.errorNum++
+			bm.addError()
 			b, e = iterator.HasNext()
 			if e != nil {
 				return fmt.Errorf("LoadBase Error, err[%s]", e.Error())
@@ -63,14 +61,14 @@ func (bm *BlockingKMapContainer) LoadBase(iterator DataIterator) error {
 			return fmt.Errorf("LoadBase Error, err[%s]", e.Error())
 		}
 	}
-	if bm.totalNum == 0 {
-		bm.totalNum = 1
-	}
-	f := float64(bm.errorNum) / float64(bm.totalNum)
+	f := bm.errorRatio()
 	if f > bm.Tolerate {
 		return errors.New(fmt.Sprintf("LoadBase error, tolerate[%f], err[%f]", bm.Tolerate, f))
 	}
-	bm.innerData = tmpM
+	if err := bm.validate(&syncMapData{m: tmpM, prev: bm.Len()}); err != nil {
+		return err
+	}
+	bm.innerData.Store(tmpM)
 	return nil
 }
 
@@ -81,9 +79,9 @@ func (bm *BlockingKMapContainer) LoadInc(iterator DataIterator) error {
 	}
 	for b {
 		m, k, v, e := iterator.Next()
-		bm.totalNum++
+		bm.addTotal()
 		if e != nil {
-			bm.errorNum++
+			bm.addError()
 			b, e = iterator.HasNext()
 			if e != nil {
 				return fmt.Errorf("LoadBase Error, err[%s]", e.Error())
@@ -93,7 +91,7 @@ func (bm *BlockingKMapContainer) LoadInc(iterator DataIterator) error {
 		switch m {
 		case DataModeAdd, DataModeUpdate:
 			if bm.Set(k, v) != nil {
-				bm.errorNum++
+				bm.addError()
 			}
 		case DataModeDel:
 			bm.Del(k, v)
@@ -103,10 +101,7 @@ func (bm *BlockingKMapContainer) LoadInc(iterator DataIterator) error {
 			return fmt.Errorf("LoadInc Error, err[%s]", e.Error())
 		}
 	}
-	if bm.totalNum == 0 {
-		bm.totalNum = 1
-	}
-	f := float64(bm.errorNum) / float64(bm.totalNum)
+	f := bm.errorRatio()
 	if f > bm.Tolerate {
 		return errors.New(fmt.Sprintf("LoadInc error, tolerate[%f], err[%f]", bm.Tolerate, f))
 	}
@@ -117,12 +112,21 @@ func (bm *BlockingKMapContainer) Del(key MapKey, value interface{}) {
 }
 
 func (bm *BlockingKMapContainer) Set(key MapKey, value interface{}) error {
-	bm.innerData.Store(key.Value(), value)
+	m := bm.innerData.Load()
+	if m == nil {
+		bm.innerData.CompareAndSwap(nil, &sync.Map{})
+		m = bm.innerData.Load()
+	}
+	m.Store(key.Value(), value)
 	return nil
 }
 
 func (bm *BlockingKMapContainer) Range(f func(key, value interface{}) bool) {
-	bm.innerData.Range(f)
+	m := bm.innerData.Load()
+	if m == nil {
+		return
+	}
+	m.Range(f)
 }
 
 func (bm *BlockingKMapContainer) Len() int {
@@ -133,3 +137,26 @@ func (bm *BlockingKMapContainer) Len() int {
 	})
 	return l
 }
+
+// syncMapData is the BaseData of BlockingKMapContainer
+type syncMapData struct {
+	m    *sync.Map
+	prev int
+}
+
+func (sd *syncMapData) Len() int {
+	l := 0
+	sd.m.Range(func(key, value interface{}) bool {
+		l++
+		return true
+	})
+	return l
+}
+
+func (sd *syncMapData) PrevLen() int {
+	return sd.prev
+}
+
+func (sd *syncMapData) Range(f func(key, value interface{}) bool) {
+	sd.m.Range(f)
+}
@@ -4,28 +4,97 @@ import (
 	"errors"
 	"fmt"
 	"sync"
+	"sync/atomic"
 )
 
+const loadBatchSize = 256
+
+type partition struct {
+	sync.RWMutex
+	data *keyedMap[interface{}]
+}
+
+type record struct {
+	mode  DataMode
+	key   interface{}
+	value interface{}
+}
+
 // 多线程读写安全的container，支持增量
+// keys are routed by MapKey.PartitionKey() into numPartision RWMutex guarded partitions
 type BlockingMapContainer struct {
-	innerData *sync.Map
-	errorNum  int64
-	totalNum  int64
-	Tolerate  float64
+	innerData []*partition
+	size      int64
+	loadStats
+	validation
+	Tolerate float64
 }
 
 func CreateBlockingMapContainer(numPartision int, tolerate float64) *BlockingMapContainer {
-	return &BlockingMapContainer{
-		innerData: &sync.Map{},
+	if numPartision <= 0 {
+		numPartision = 1
+	}
+	bm := &BlockingMapContainer{
+		innerData: make([]*partition, numPartision),
 		Tolerate:  tolerate,
 	}
+	for i := range bm.innerData {
+		bm.innerData[i] = &partition{data: newKeyedMap[interface{}]()}
+	}
+	return bm
+}
+
+// NumPartition returns the number of partitions, see RangePartition
+func (bm *BlockingMapContainer) NumPartition() int {
+	return len(bm.innerData)
+}
+
+func (bm *BlockingMapContainer) partitionIndex(key MapKey) int {
+	return bm.partitionOf(key.PartitionKey())
+}
+
+func (bm *BlockingMapContainer) partitionOf(partitionKey int64) int {
+	return int(uint64(partitionKey) % uint64(len(bm.innerData)))
 }
 
 func (bm *BlockingMapContainer) Get(key MapKey) (interface{}, error) {
-	if bm.innerData == nil {
+	if len(bm.innerData) == 0 {
+		return nil, NotExistErr
+	}
+	p := bm.innerData[bm.partitionIndex(key)]
+	p.RLock()
+	data, in := p.data.get(key.Value())
+	p.RUnlock()
+	if !in {
+		return nil, NotExistErr
+	}
+	return data, nil
+}
+
+// GetInt64 is Get(I64Key(key)) without allocating, the partition is the same as I64Key's
+func (bm *BlockingMapContainer) GetInt64(key int64) (interface{}, error) {
+	if len(bm.innerData) == 0 {
+		return nil, NotExistErr
+	}
+	p := bm.innerData[bm.partitionOf(key)]
+	p.RLock()
+	data, in := p.data.ints[key]
+	p.RUnlock()
+	if !in {
+		return nil, NotExistErr
+	}
+	return data, nil
+}
+
+// GetString is Get(StrKey(key)) without allocating, the partition is the same as StrKey's
+func (bm *BlockingMapContainer) GetString(key string) (interface{}, error) {
+	if len(bm.innerData) == 0 {
 		return nil, NotExistErr
 	}
-	data, in := bm.innerData.Load(key.Value())
+	p := bm.innerData[bm.partitionOf(int64(hash(key)))]
+	p.RLock()
+	data, in := p.data.strs[key]
+	p.RUnlock()
 	if !in {
 		return nil, NotExistErr
 	}
@@ -33,53 +102,122 @@ func (bm *BlockingMapContainer) Get(key MapKey) (interface{}, error) {
 }
 
 func (bm *BlockingMapContainer) Set(key MapKey, value interface{}) error {
-	bm.innerData.Store(key.Value(), value)
+	if len(bm.innerData) == 0 {
+		return errors.New("container is not created by CreateBlockingMapContainer")
+	}
+	k := key.Value()
+	p := bm.innerData[bm.partitionIndex(key)]
+	p.Lock()
+	if p.data.set(k, value) {
+		atomic.AddInt64(&bm.size, 1)
+	}
+	p.Unlock()
 	return nil
 }
 
 func (bm *BlockingMapContainer) Del(key MapKey, value interface{}) {
-	bm.innerData.Delete(key.Value())
+	if len(bm.innerData) == 0 {
+		return
+	}
+	k := key.Value()
+	p := bm.innerData[bm.partitionIndex(key)]
+	p.Lock()
+	if p.data.del(k) {
+		atomic.AddInt64(&bm.size, -1)
+	}
+	p.Unlock()
 }
 
+// LoadBase reads the iterator once and builds the partitions in parallel,
+// all partitions are replaced together after the data is fully loaded
 func (bm *BlockingMapContainer) LoadBase(iterator DataIterator) error {
-	tmpM := &sync.Map{}
-	bm.errorNum = 0
-	bm.totalNum = 0
+	if len(bm.innerData) == 0 {
+		return errors.New("container is not created by CreateBlockingMapContainer")
+	}
+	bm.resetStats()
+
+	n := len(bm.innerData)
+	tmpM := make([]*keyedMap[interface{}], n)
+	chans := make([]chan []record, n)
+	batches := make([][]record, n)
+	wg := sync.WaitGroup{}
+	for i := 0; i < n; i++ {
+		tmpM[i] = newKeyedMap[interface{}]()
+		chans[i] = make(chan []record, 4)
+		wg.Add(1)
+		go func(m *keyedMap[interface{}], ch chan []record) {
+			defer wg.Done()
+			for batch := range ch {
+				for _, r := range batch {
+					switch r.mode {
+					case DataModeAdd, DataModeUpdate:
+						m.set(r.key, r.value)
+					case DataModeDel:
+						m.del(r.key)
+					}
+				}
+			}
+		}(tmpM[i], chans[i])
+	}
+	err := bm.dispatch(iterator, chans, batches)
+	for i := 0; i < n; i++ {
+		if err == nil && len(batches[i]) > 0 {
+			chans[i] <- batches[i]
+		}
+		close(chans[i])
+	}
+	wg.Wait()
+	if err != nil {
+		return err
+	}
+
+	f := bm.errorRatio()
+	if f > bm.Tolerate {
+		return errors.New(fmt.Sprintf("LoadBase error, tolerate[%f], err[%f]", bm.Tolerate, f))
+	}
+
+	if err := bm.validate(&mapsData{maps: tmpM, prev: bm.Len()}); err != nil {
+		return err
+	}
 
+	size := 0
+	for _, p := range bm.innerData {
+		p.Lock()
+	}
+	for i, p := range bm.innerData {
+		p.data = tmpM[i]
+		size += tmpM[i].len()
+	}
+	atomic.StoreInt64(&bm.size, int64(size))
+	for _, p := range bm.innerData {
+		p.Unlock()
+	}
+	return nil
+}
+
+func (bm *BlockingMapContainer) dispatch(iterator DataIterator, chans []chan []record, batches [][]record) error {
 	b, e := iterator.HasNext()
 	if e != nil {
 		return fmt.Errorf("LoadBase Error, err[%s]", e.Error())
 	}
 	for b {
 		m, k, v, e := iterator.Next()
-		bm.totalNum++
+		bm.addTotal()
 		if e != nil {
-			bm.errorNum++
-			b, e = iterator.HasNext()
-			if e != nil {
-				return fmt.Errorf("LoadBase Error, err[%s]", e.Error())
+			bm.addError()
+		} else {
+			i := bm.partitionIndex(k)
+			batches[i] = append(batches[i], record{mode: m, key: k.Value(), value: v})
+			if len(batches[i]) >= loadBatchSize {
+				chans[i] <- batches[i]
+				batches[i] = make([]record, 0, loadBatchSize)
 			}
-			continue
-		}
-		switch m {
-		case DataModeAdd, DataModeUpdate:
-			tmpM.Store(k.Value(), v)
-		case DataModeDel:
-			tmpM.Delete(k.Value())
 		}
 		b, e = iterator.HasNext()
 		if e != nil {
 			return fmt.Errorf("LoadBase Error, err[%s]", e.Error())
 		}
 	}
-	if bm.totalNum == 0 {
-		bm.totalNum = 1
-	}
-	f := float64(bm.errorNum) / float64(bm.totalNum)
-	if f > bm.Tolerate {
-		return errors.New(fmt.Sprintf("LoadBase error, tolerate[%f], err[%f]", bm.Tolerate, f))
-	}
-	bm.innerData = tmpM
 	return nil
 }
 
@@ -90,9 +228,9 @@ func (bm *BlockingMapContainer) LoadInc(iterator DataIterator) error {
 	}
 	for b {
 		m, k, v, e := iterator.Next()
-		bm.totalNum++
+		bm.addTotal()
 		if e != nil {
-			bm.errorNum++
+			bm.addError()
 			b, e = iterator.HasNext()
 			if e != nil {
 				return fmt.Errorf("LoadBase Error, err[%s]", e.Error())
@@ -101,7 +239,9 @@ func (bm *BlockingMapContainer) LoadInc(iterator DataIterator) error {
 		}
 		switch m {
 		case DataModeAdd, DataModeUpdate:
-			bm.innerData.Store(k.Value(), v)
+			if bm.Set(k, v) != nil {
+				bm.addError()
+			}
 		case DataModeDel:
 			bm.Del(k, v)
 		}
@@ -110,25 +250,48 @@ func (bm *BlockingMapContainer) LoadInc(iterator DataIterator) error {
 			return fmt.Errorf("LoadInc Error, err[%s]", e.Error())
 		}
 	}
-	if bm.totalNum == 0 {
-		bm.totalNum = 1
-	}
-	f := float64(bm.errorNum) / float64(bm.totalNum)
+	f := bm.errorRatio()
 	if f > bm.Tolerate {
 		return errors.New(fmt.Sprintf("LoadInc error, tolerate[%f], err[%f]", bm.Tolerate, f))
 	}
 	return nil
 }
 
+// Len is kept by counters, it doesn't walk the map
 func (bm *BlockingMapContainer) Len() int {
-	l := 0
-	bm.Range(func(key, value interface{}) bool {
-		l++
-		return true
-	})
-	return l
+	return int(atomic.LoadInt64(&bm.size))
 }
 
+// Range ranges over the partitions in place under their read locks, f must not write to the
+// container, use RangePartition for that.
 func (bm *BlockingMapContainer) Range(f func(key, value interface{}) bool) {
-	bm.innerData.Range(f)
+	for _, p := range bm.innerData {
+		p.RLock()
+		ok := p.data.rangeAll(f)
+		p.RUnlock()
+		if !ok {
+			return
+		}
+	}
+}
+
+// RangePartition ranges over a copy of the i-th partition, so f may write to the container.
+// It returns false if f stopped the iteration.
+func (bm *BlockingMapContainer) RangePartition(i int, f func(key, value interface{}) bool) bool {
+	p := bm.innerData[i]
+	p.RLock()
+	keys := make([]interface{}, 0, p.data.len())
+	values := make([]interface{}, 0, p.data.len())
+	p.data.rangeAll(func(k, v interface{}) bool {
+		keys = append(keys, k)
+		values = append(values, v)
+		return true
+	})
+	p.RUnlock()
+	for j := range keys {
+		if !f(keys[j], values[j]) {
+			return false
+		}
+	}
+	return true
 }
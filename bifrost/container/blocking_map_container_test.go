@@ -2,6 +2,7 @@ package container
 
 import (
 	"github.com/smartystreets/goconvey/convey"
+	"strconv"
 	"testing"
 )
 
@@ -128,3 +129,173 @@ func TestBlockingMapContainer_LoadInc(t *testing.T) {
 		})
 	})
 }
+
+func TestBlockingMapContainer_Partition(t *testing.T) {
+	convey.Convey("Test keys are routed into partitions", t, func() {
+		bm := CreateBlockingMapContainer(4, 0)
+		convey.So(bm.NumPartition(), convey.ShouldEqual, 4)
+		data := make([]string, 0, 1000)
+		for i := -500; i < 500; i++ {
+			data = append(data, strconv.Itoa(i)+"\tv"+strconv.Itoa(i))
+		}
+		convey.So(bm.LoadBase(NewTestIntDataIter(data)), convey.ShouldBeNil)
+		convey.So(bm.Len(), convey.ShouldEqual, 1000)
+
+		total := 0
+		for i := 0; i < bm.NumPartition(); i++ {
+			n := 0
+			bm.RangePartition(i, func(key, value interface{}) bool {
+				convey.So(bm.partitionIndex(I64Key(key.(int64))), convey.ShouldEqual, i)
+				n++
+				return true
+			})
+			convey.So(n, convey.ShouldEqual, 250)
+			total += n
+		}
+		convey.So(total, convey.ShouldEqual, 1000)
+
+		v, e := bm.Get(I64Key(-3))
+		convey.So(e, convey.ShouldBeNil)
+		convey.So(v, convey.ShouldEqual, "v-3")
+	})
+
+	convey.Convey("Test Len is kept by Set and Del", t, func() {
+		bm := CreateBlockingMapContainer(3, 0)
+		convey.So(bm.Set(StrKey("a"), 1), convey.ShouldBeNil)
+		convey.So(bm.Set(StrKey("a"), 2), convey.ShouldBeNil)
+		convey.So(bm.Set(StrKey("b"), 3), convey.ShouldBeNil)
+		convey.So(bm.Len(), convey.ShouldEqual, 2)
+		bm.Del(StrKey("a"), nil)
+		bm.Del(StrKey("not exist"), nil)
+		convey.So(bm.Len(), convey.ShouldEqual, 1)
+
+		// RangePartition works on a copy, the callback may write
+		for i := 0; i < bm.NumPartition(); i++ {
+			bm.RangePartition(i, func(key, value interface{}) bool {
+				bm.Del(StrKey(key.(string)), value)
+				return true
+			})
+		}
+		convey.So(bm.Len(), convey.ShouldEqual, 0)
+	})
+
+	convey.Convey("Test Range stops early", t, func() {
+		bm := CreateBlockingMapContainer(4, 0)
+		for i := 0; i < 100; i++ {
+			convey.So(bm.Set(I64Key(int64(i)), i), convey.ShouldBeNil)
+		}
+		n := 0
+		bm.Range(func(key, value interface{}) bool {
+			n++
+			return n < 10
+		})
+		convey.So(n, convey.ShouldEqual, 10)
+	})
+
+	convey.Convey("Test zero value container", t, func() {
+		bm := &BlockingMapContainer{}
+		_, e := bm.Get(StrKey("a"))
+		convey.So(e, convey.ShouldEqual, NotExistErr)
+		convey.So(bm.Set(StrKey("a"), 1), convey.ShouldNotBeNil)
+		convey.So(bm.LoadBase(NewTestDataIter([]string{})), convey.ShouldNotBeNil)
+	})
+}
+
+func TestStringKey_PartitionKey(t *testing.T) {
+	convey.Convey("Test the hash of string keys is stable", t, func() {
+		convey.So(StrKey("").PartitionKey(), convey.ShouldEqual, 1325880984)
+		convey.So(StrKey("a").PartitionKey(), convey.ShouldEqual, 3238259379)
+		convey.So(StrKey("abc").PartitionKey(), convey.ShouldEqual, 366106623)
+		convey.So(StrKey("abcd").PartitionKey(), convey.ShouldEqual, 2845765222)
+		convey.So(StrKey("hello world").PartitionKey(), convey.ShouldEqual, 4008393376)
+		convey.So(StrKey("com.example.app").PartitionKey(), convey.ShouldEqual, 1757765458)
+	})
+}
+
+func BenchmarkBlockingMapContainer_Set(b *testing.B) {
+	bm := CreateBlockingMapContainer(16, 0)
+	b.RunParallel(func(pb *testing.PB) {
+		i := int64(0)
+		for pb.Next() {
+			_ = bm.Set(I64Key(i%10000), i)
+			i++
+		}
+	})
+}
+
+func TestBlockingMapContainer_FastGet(t *testing.T) {
+	convey.Convey("Test GetInt64 and GetString find the keys in the partitions of Set", t, func() {
+		bm := CreateBlockingMapContainer(7, 0)
+		for i := 0; i < 100; i++ {
+			convey.So(bm.Set(I64Key(int64(i)), i), convey.ShouldBeNil)
+			convey.So(bm.Set(StrKey(strconv.Itoa(i)), -i), convey.ShouldBeNil)
+		}
+		convey.So(bm.Len(), convey.ShouldEqual, 200)
+		for i := 0; i < 100; i++ {
+			v, e := bm.GetInt64(int64(i))
+			convey.So(e, convey.ShouldBeNil)
+			convey.So(v, convey.ShouldEqual, i)
+			v, e = bm.GetString(strconv.Itoa(i))
+			convey.So(e, convey.ShouldBeNil)
+			convey.So(v, convey.ShouldEqual, -i)
+		}
+		_, e := bm.GetInt64(100)
+		convey.So(e, convey.ShouldEqual, NotExistErr)
+		bm.Del(I64Key(1), nil)
+		_, e = bm.GetInt64(1)
+		convey.So(e, convey.ShouldEqual, NotExistErr)
+		convey.So(bm.Len(), convey.ShouldEqual, 199)
+
+		allocs := testing.AllocsPerRun(100, func() {
+			_, _ = bm.GetInt64(5)
+			_, _ = bm.GetString("5")
+		})
+		convey.So(allocs, convey.ShouldEqual, 0)
+	})
+
+	convey.Convey("Test zero value container", t, func() {
+		bm := &BlockingMapContainer{}
+		_, e := bm.GetInt64(1)
+		convey.So(e, convey.ShouldEqual, NotExistErr)
+		_, e = bm.GetString("a")
+		convey.So(e, convey.ShouldEqual, NotExistErr)
+	})
+}
+
+func BenchmarkBlockingMapContainer_Get(b *testing.B) {
+	bm := CreateBlockingMapContainer(16, 0)
+	for i := int64(0); i < 10000; i++ {
+		_ = bm.Set(I64Key(i), i)
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_, _ = bm.Get(I64Key(int64(i % 10000)))
+	}
+}
+
+func BenchmarkBlockingMapContainer_GetInt64(b *testing.B) {
+	bm := CreateBlockingMapContainer(16, 0)
+	for i := int64(0); i < 10000; i++ {
+		_ = bm.Set(I64Key(i), i)
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_, _ = bm.GetInt64(int64(i % 10000))
+	}
+}
+
+func BenchmarkBlockingMapContainer_GetString(b *testing.B) {
+	bm := CreateBlockingMapContainer(16, 0)
+	keys := make([]string, 10000)
+	for i := range keys {
+		keys[i] = "key" + strconv.Itoa(i)
+		_ = bm.Set(StrKey(keys[i]), i)
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_, _ = bm.GetString(keys[i%len(keys)])
+	}
+}
@@ -3,12 +3,21 @@ package container
 import (
 	"errors"
 	"fmt"
+	"sync/atomic"
 )
 
 // 双bufMap, 仅提供Get/LoadBase接口
+// the buffer is swapped atomically, Get is safe during LoadBase.
+// The lists are kept boxed, so that Get doesn't box them again.
 type BufferedKListContainer struct {
-	innerData *map[interface{}][]interface{}
-	ErrorNum  int
+	innerData atomic.Pointer[keyedMap[interface{}]]
+	loadStats
+	validation
+	// ErrorNum is the number of records failed in the last LoadBase, it's written during the
+	// load without synchronization.
+	//
+	// Deprecated: use Stats().ErrorNum, which is safe to read concurrently with the loads.
+	ErrorNum int
 }
 
 func CreateBufferedKListContainer() *BufferedKListContainer {
@@ -16,7 +25,35 @@ func CreateBufferedKListContainer() *BufferedKListContainer {
 }
 
 func (bm *BufferedKListContainer) Get(key MapKey) (interface{}, error) {
-	data, in := (*bm.innerData)[key.Value()]
+	m := bm.innerData.Load()
+	if m == nil {
+		return nil, NotExistErr
+	}
+	data, in := m.get(key.Value())
+	if !in {
+		return nil, NotExistErr
+	}
+	return data, nil
+}
+
+func (bm *BufferedKListContainer) GetInt64(key int64) (interface{}, error) {
+	m := bm.innerData.Load()
+	if m == nil {
+		return nil, NotExistErr
+	}
+	data, in := m.ints[key]
+	if !in {
+		return nil, NotExistErr
+	}
+	return data, nil
+}
+
+func (bm *BufferedKListContainer) GetString(key string) (interface{}, error) {
+	m := bm.innerData.Load()
+	if m == nil {
+		return nil, NotExistErr
+	}
+	data, in := m.strs[key]
 	if !in {
 		return nil, NotExistErr
 	}
@@ -24,15 +61,18 @@ func (bm *BufferedKListContainer) Get(key MapKey) (interface{}, error) {
 }
 
 func (bm *BufferedKListContainer) LoadBase(iterator DataIterator) error {
+	bm.resetStats()
 	bm.ErrorNum = 0
-	tmpM := make(map[interface{}][]interface{})
+	tmpM := newKeyedMap[interface{}]()
 	b, e := iterator.HasNext()
 	if e != nil {
 		return fmt.Errorf("LoadBase Error, err[%s]", e.Error())
 	}
 	for b {
 		_, k, v, e := iterator.Next()
+		bm.addTotal()
 		if e != nil {
+			bm.addError()
 			bm.ErrorNum++
 			b, e = iterator.HasNext()
 			if e != nil {
@@ -40,19 +80,18 @@ func (bm *BufferedKListContainer) LoadBase(iterator DataIterator) error {
 			}
 			continue
 		}
-		res, in := tmpM[k.Value()]
-		if in {
-			res = append(res, v)
-			tmpM[k.Value()] = res
-		} else {
-			tmpM[k.Value()] = []interface{}{v}
-		}
+		res, _ := tmpM.get(k.Value())
+		list, _ := res.([]interface{})
+		tmpM.set(k.Value(), append(list, v))
 		b, e = iterator.HasNext()
 		if e != nil {
 			return fmt.Errorf("LoadBase Error, err[%s]", e.Error())
 		}
 	}
-	bm.innerData = &tmpM
+	if err := bm.validate(&klistData{m: tmpM, prev: bm.Len()}); err != nil {
+		return err
+	}
+	bm.innerData.Store(tmpM)
 	return nil
 }
 
@@ -66,3 +105,37 @@ func (bm *BufferedKListContainer) Del(key MapKey, value interface{}) {
 func (bm *BufferedKListContainer) LoadInc(iterator DataIterator) error {
 	return errors.New("not implement")
 }
+
+func (bm *BufferedKListContainer) Len() int {
+	m := bm.innerData.Load()
+	if m == nil {
+		return 0
+	}
+	return m.len()
+}
+
+func (bm *BufferedKListContainer) Range(f func(key, value interface{}) bool) {
+	m := bm.innerData.Load()
+	if m == nil {
+		return
+	}
+	m.rangeAll(f)
+}
+
+// klistData is the BaseData of BufferedKListContainer, the values are the lists
+type klistData struct {
+	m    *keyedMap[interface{}]
+	prev int
+}
+
+func (kd *klistData) Len() int {
+	return kd.m.len()
+}
+
+func (kd *klistData) PrevLen() int {
+	return kd.prev
+}
+
+func (kd *klistData) Range(f func(key, value interface{}) bool) {
+	kd.m.rangeAll(f)
+}
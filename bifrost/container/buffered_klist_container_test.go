@@ -42,11 +42,20 @@ func (this *TestIntIntDataIter) Next() (DataMode, MapKey, interface{}, error) {
 }
 
 func TestBufferedKListContainer(t *testing.T) {
+	convey.Convey("Test the deprecated ErrorNum is kept in sync", t, func() {
+		bm := CreateBufferedKListContainer()
+		convey.So(bm.LoadBase(NewTestDataIter([]string{"1\t2", "x"})), convey.ShouldBeNil)
+		convey.So(bm.ErrorNum, convey.ShouldEqual, 1)
+		convey.So(bm.Stats().ErrorNum, convey.ShouldEqual, 1)
+		convey.So(bm.LoadBase(NewTestDataIter([]string{"1\t2"})), convey.ShouldBeNil)
+		convey.So(bm.ErrorNum, convey.ShouldEqual, 0)
+	})
+
 	convey.Convey("Test BufferedMapContainer Get", t, func() {
 		bm := BufferedKListContainer{}
 		convey.So(bm.LoadBase(NewTestDataIter([]string{})), convey.ShouldBeNil)
-		convey.So(bm.ErrorNum, convey.ShouldEqual, 0)
-		convey.So(len(*bm.innerData), convey.ShouldEqual, 0)
+		convey.So(bm.errorNum, convey.ShouldEqual, 0)
+		convey.So(bm.innerData.Load().len(), convey.ShouldEqual, 0)
 	})
 
 	convey.Convey("Test BufferedMapContainer Get", t, func() {
@@ -56,8 +65,8 @@ func TestBufferedKListContainer(t *testing.T) {
 			"a\tb",
 			"a\tcc",
 		})), convey.ShouldBeNil)
-		convey.So(bm.ErrorNum, convey.ShouldEqual, 0)
-		convey.So(len(*bm.innerData), convey.ShouldEqual, 2)
+		convey.So(bm.errorNum, convey.ShouldEqual, 0)
+		convey.So(bm.innerData.Load().len(), convey.ShouldEqual, 2)
 		{
 			v, e := bm.Get(StrKey("1"))
 			convey.So(e, convey.ShouldBeNil)
@@ -75,5 +84,16 @@ func TestBufferedKListContainer(t *testing.T) {
 			convey.So(arr[0], convey.ShouldEqual, "b")
 			convey.So(arr[1], convey.ShouldEqual, "cc")
 		}
+		{
+			v, e := bm.GetString("a")
+			convey.So(e, convey.ShouldBeNil)
+			convey.So(len(v.([]interface{})), convey.ShouldEqual, 2)
+			_, e = bm.GetInt64(1)
+			convey.So(e, convey.ShouldEqual, NotExistErr)
+			allocs := testing.AllocsPerRun(100, func() {
+				_, _ = bm.GetString("a")
+			})
+			convey.So(allocs, convey.ShouldEqual, 0)
+		}
 	})
 }
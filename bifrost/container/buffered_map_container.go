@@ -3,21 +3,48 @@ package container
 import (
 	"errors"
 	"fmt"
+	"sync/atomic"
 )
 
 // 双bufMap, 仅提供Get/LoadBase接口
+// the buffer is swapped atomically, Get is safe during LoadBase
 type BufferedMapContainer struct {
-	innerData *map[interface{}]interface{}
-	errorNum  int64
-	totalNum  int64
-	Tolerate  float64
+	innerData atomic.Pointer[keyedMap[interface{}]]
+	loadStats
+	validation
+	Tolerate float64
 }
 
 func (bm *BufferedMapContainer) Get(key MapKey) (interface{}, error) {
-	if bm.innerData == nil {
+	m := bm.innerData.Load()
+	if m == nil {
 		return nil, NotExistErr
 	}
-	data, in := (*bm.innerData)[key.Value()]
+	data, in := m.get(key.Value())
+	if !in {
+		return nil, NotExistErr
+	}
+	return data, nil
+}
+
+func (bm *BufferedMapContainer) GetInt64(key int64) (interface{}, error) {
+	m := bm.innerData.Load()
+	if m == nil {
+		return nil, NotExistErr
+	}
+	data, in := m.ints[key]
+	if !in {
+		return nil, NotExistErr
+	}
+	return data, nil
+}
+
+func (bm *BufferedMapContainer) GetString(key string) (interface{}, error) {
+	m := bm.innerData.Load()
+	if m == nil {
+		return nil, NotExistErr
+	}
+	data, in := m.strs[key]
 	if !in {
 		return nil, NotExistErr
 	}
@@ -25,38 +52,37 @@ func (bm *BufferedMapContainer) Get(key MapKey) (interface{}, error) {
 }
 
 func (bm *BufferedMapContainer) LoadBase(iterator DataIterator) error {
-	bm.errorNum = 0
-	bm.totalNum = 0
-	tmpM := make(map[interface{}]interface{})
+	bm.resetStats()
+	tmpM := newKeyedMap[interface{}]()
 	b, e := iterator.HasNext()
 	if e != nil {
 		return fmt.Errorf("LoadBase Error, err[%s]", e.Error())
 	}
 	for b {
 		_, k, v, e := iterator.Next()
-		bm.totalNum++
+		bm.addTotal()
 		if e != nil {
-			bm.errorNum++
+			bm.addError()
 			b, e = iterator.HasNext()
 			if e != nil {
 				return fmt.Errorf("LoadBase Error, err[%s]", e.Error())
 			}
 			continue
 		}
-		tmpM[k.Value()] = v
+		tmpM.set(k.Value(), v)
 		b, e = iterator.HasNext()
 		if e != nil {
 			return fmt.Errorf("LoadBase Error, err[%s]", e.Error())
 		}
 	}
-	if bm.totalNum == 0 {
-		bm.totalNum = 1
-	}
-	f := float64(bm.errorNum) / float64(bm.totalNum)
+	f := bm.errorRatio()
 	if f > bm.Tolerate {
 		return errors.New(fmt.Sprintf("LoadBase error, tolerate[%f], err[%f]", bm.Tolerate, f))
 	}
-	bm.innerData = &tmpM
+	if err := bm.validate(&mapsData{maps: []*keyedMap[interface{}]{tmpM}, prev: bm.Len()}); err != nil {
+		return err
+	}
+	bm.innerData.Store(tmpM)
 	return nil
 }
 
@@ -72,20 +98,17 @@ func (bm *BufferedMapContainer) LoadInc(iterator DataIterator) error {
 }
 
 func (bm *BufferedMapContainer) Len() int {
-	if bm.innerData == nil {
+	m := bm.innerData.Load()
+	if m == nil {
 		return 0
 	}
-	return len(*bm.innerData)
+	return m.len()
 }
 
 func (bm *BufferedMapContainer) Range(f func(key, value interface{}) bool) {
-	if bm.innerData == nil {
+	m := bm.innerData.Load()
+	if m == nil {
 		return
 	}
-
-	for k, v := range *bm.innerData {
-		if !f(k, v) {
-			break
-		}
-	}
+	m.rangeAll(f)
 }
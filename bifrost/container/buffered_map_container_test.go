@@ -75,7 +75,7 @@ func TestBufferedMap_Get(t *testing.T) {
 		bm := BufferedMapContainer{}
 		convey.So(bm.LoadBase(NewTestDataIter([]string{})), convey.ShouldBeNil)
 		convey.So(bm.errorNum, convey.ShouldEqual, 0)
-		convey.So(len(*bm.innerData), convey.ShouldEqual, 0)
+		convey.So(bm.innerData.Load().len(), convey.ShouldEqual, 0)
 	})
 
 	convey.Convey("Test BufferedMapContainer Get", t, func() {
@@ -85,7 +85,7 @@ func TestBufferedMap_Get(t *testing.T) {
 			"a\tb",
 		})), convey.ShouldBeNil)
 		convey.So(bm.errorNum, convey.ShouldEqual, 0)
-		convey.So(len(*bm.innerData), convey.ShouldEqual, 2)
+		convey.So(bm.innerData.Load().len(), convey.ShouldEqual, 2)
 		convey.So(bm.Len(), convey.ShouldEqual, 2)
 		v, e := bm.Get(StrKey("1"))
 		convey.So(e, convey.ShouldBeNil)
@@ -103,7 +103,7 @@ func TestBufferedMap_Get(t *testing.T) {
 			"4\tb",
 		})), convey.ShouldBeNil)
 		convey.So(bm.errorNum, convey.ShouldEqual, 0)
-		convey.So(len(*bm.innerData), convey.ShouldEqual, 2)
+		convey.So(bm.innerData.Load().len(), convey.ShouldEqual, 2)
 		convey.So(bm.Len(), convey.ShouldEqual, 2)
 		v, e := bm.Get(I64Key(1))
 		convey.So(e, convey.ShouldBeNil)
@@ -114,3 +114,62 @@ func TestBufferedMap_Get(t *testing.T) {
 		convey.So(v, convey.ShouldEqual, "b")
 	})
 }
+
+func TestBufferedMap_FastGet(t *testing.T) {
+	convey.Convey("Test BufferedMapContainer GetInt64 and GetString", t, func() {
+		bm := &BufferedMapContainer{}
+		_, e := bm.GetInt64(1)
+		convey.So(e, convey.ShouldEqual, NotExistErr)
+		convey.So(bm.LoadBase(NewTestIntDataIter([]string{"1\t2", "4\tb"})), convey.ShouldBeNil)
+		v, e := bm.GetInt64(4)
+		convey.So(e, convey.ShouldBeNil)
+		convey.So(v, convey.ShouldEqual, "b")
+		_, e = bm.GetInt64(2)
+		convey.So(e, convey.ShouldEqual, NotExistErr)
+		_, e = bm.GetString("4")
+		convey.So(e, convey.ShouldEqual, NotExistErr)
+
+		convey.So(bm.LoadBase(NewTestDataIter([]string{"1\t2", "a\tb"})), convey.ShouldBeNil)
+		v, e = bm.GetString("a")
+		convey.So(e, convey.ShouldBeNil)
+		convey.So(v, convey.ShouldEqual, "b")
+		_, e = bm.GetInt64(1)
+		convey.So(e, convey.ShouldEqual, NotExistErr)
+
+		allocs := testing.AllocsPerRun(100, func() {
+			_, _ = bm.GetString("a")
+			_, _ = bm.GetString("x")
+		})
+		convey.So(allocs, convey.ShouldEqual, 0)
+	})
+}
+
+func BenchmarkBufferedMapContainer_GetInt64(b *testing.B) {
+	bm := &BufferedMapContainer{}
+	data := make([]string, 10000)
+	for i := range data {
+		data[i] = strconv.Itoa(i) + "\tv"
+	}
+	_ = bm.LoadBase(NewTestIntDataIter(data))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_, _ = bm.GetInt64(int64(i % 10000))
+	}
+}
+
+func BenchmarkBufferedMapContainer_GetString(b *testing.B) {
+	bm := &BufferedMapContainer{}
+	keys := make([]string, 10000)
+	data := make([]string, len(keys))
+	for i := range data {
+		keys[i] = "key" + strconv.Itoa(i)
+		data[i] = keys[i] + "\tv"
+	}
+	_ = bm.LoadBase(NewTestDataIter(data))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_, _ = bm.GetString(keys[i%len(keys)])
+	}
+}
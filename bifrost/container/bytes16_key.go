@@ -0,0 +1,52 @@
+package container
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"strings"
+)
+
+// Bytes16Key is for the 16 bytes keys such as UUIDs and MD5 sums, the key of the containers is
+// a [16]byte
+type Bytes16Key struct {
+	Data [16]byte
+	v    interface{} // Data boxed by B16Key, so that Value doesn't allocate
+}
+
+// PartitionKey is the first 8 bytes, which are evenly distributed for UUIDs and MD5 sums
+func (b *Bytes16Key) PartitionKey() int64 {
+	return int64(binary.LittleEndian.Uint64(b.Data[:8]))
+}
+
+func (b *Bytes16Key) Value() interface{} {
+	if b.v == nil {
+		return b.Data
+	}
+	return b.v
+}
+
+// String returns the 32 hex digits of the key
+func (b *Bytes16Key) String() string {
+	return hex.EncodeToString(b.Data[:])
+}
+
+func B16Key(key [16]byte) *Bytes16Key {
+	return &Bytes16Key{Data: key, v: key}
+}
+
+// ParseB16Key parses 32 hex digits, such as a MD5 sum, or a UUID with the dashes
+func ParseB16Key(s string) (*Bytes16Key, error) {
+	h := s
+	if len(h) == 36 && h[8] == '-' && h[13] == '-' && h[18] == '-' && h[23] == '-' {
+		h = strings.Replace(h, "-", "", 4)
+	}
+	var key [16]byte
+	if len(h) != 32 {
+		return nil, errors.New("invalid 16 bytes key[" + s + "]")
+	}
+	if _, err := hex.Decode(key[:], []byte(h)); err != nil {
+		return nil, errors.New("invalid 16 bytes key[" + s + "]")
+	}
+	return B16Key(key), nil
+}
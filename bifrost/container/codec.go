@@ -0,0 +1,73 @@
+package container
+
+import (
+	"bytes"
+	"encoding/gob"
+	"encoding/json"
+	"fmt"
+)
+
+// ValueCodec encodes the values of a container to bytes, it's used by the snapshots
+type ValueCodec interface {
+	Encode(value interface{}) ([]byte, error)
+	Decode(data []byte) (interface{}, error)
+}
+
+// StringCodec is the codec of string values, such as the ones of DefaultTextParser
+type StringCodec struct{}
+
+func (StringCodec) Encode(value interface{}) ([]byte, error) {
+	s, ok := value.(string)
+	if !ok {
+		return nil, fmt.Errorf("value type error, want[string], got[%T]", value)
+	}
+	return []byte(s), nil
+}
+
+func (StringCodec) Decode(data []byte) (interface{}, error) {
+	return string(data), nil
+}
+
+// JSONCodec encodes the values of type V as json, the decoded values are V
+type JSONCodec[V any] struct{}
+
+func (JSONCodec[V]) Encode(value interface{}) ([]byte, error) {
+	v, ok := value.(V)
+	if !ok {
+		var zv V
+		return nil, fmt.Errorf("value type error, want[%T], got[%T]", zv, value)
+	}
+	return json.Marshal(v)
+}
+
+func (JSONCodec[V]) Decode(data []byte) (interface{}, error) {
+	var v V
+	if err := json.Unmarshal(data, &v); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+// GobCodec encodes the values of type V by encoding/gob, the decoded values are V
+type GobCodec[V any] struct{}
+
+func (GobCodec[V]) Encode(value interface{}) ([]byte, error) {
+	v, ok := value.(V)
+	if !ok {
+		var zv V
+		return nil, fmt.Errorf("value type error, want[%T], got[%T]", zv, value)
+	}
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(&v); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (GobCodec[V]) Decode(data []byte) (interface{}, error) {
+	var v V
+	if err := gob.NewDecoder(bytes.NewReader(data)).Decode(&v); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
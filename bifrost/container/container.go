@@ -18,3 +18,26 @@ type Container interface {
 	LoadBase(dataIter DataIterator) error
 	LoadInc(dataIter DataIterator) error
 }
+
+// FastGetter is implemented by the containers which look the int64 and the string keys up
+// without allocating, the value is the same as Get(I64Key(key)) or Get(StrKey(key))
+type FastGetter interface {
+	GetInt64(key int64) (interface{}, error)
+	GetString(key string) (interface{}, error)
+}
+
+// GetInt64 looks key up by c.GetInt64 if c is a FastGetter, by c.Get(I64Key(key)) otherwise
+func GetInt64(c Container, key int64) (interface{}, error) {
+	if fg, ok := c.(FastGetter); ok {
+		return fg.GetInt64(key)
+	}
+	return c.Get(I64Key(key))
+}
+
+// GetString looks key up by c.GetString if c is a FastGetter, by c.Get(StrKey(key)) otherwise
+func GetString(c Container, key string) (interface{}, error) {
+	if fg, ok := c.(FastGetter); ok {
+		return fg.GetString(key)
+	}
+	return c.Get(StrKey(key))
+}
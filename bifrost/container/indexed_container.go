@@ -0,0 +1,190 @@
+package container
+
+import (
+	"errors"
+	"sync"
+)
+
+// IndexFunc returns the index keys of a value, a value may have none or several
+type IndexFunc func(value interface{}) []MapKey
+
+// index maps the index keys to the values, and the primary keys back to their index keys
+type index struct {
+	fn      IndexFunc
+	entries map[interface{}]map[interface{}]interface{} // index key -> primary key -> value
+	keys    map[interface{}][]interface{}               // primary key -> index keys
+}
+
+func newIndex(fn IndexFunc) *index {
+	return &index{
+		fn:      fn,
+		entries: make(map[interface{}]map[interface{}]interface{}),
+		keys:    make(map[interface{}][]interface{}),
+	}
+}
+
+func (idx *index) add(key, value interface{}) {
+	for _, ik := range idx.fn(value) {
+		if ik == nil {
+			continue
+		}
+		k := ik.Value()
+		m, ok := idx.entries[k]
+		if !ok {
+			m = make(map[interface{}]interface{})
+			idx.entries[k] = m
+		}
+		m[key] = value
+		idx.keys[key] = append(idx.keys[key], k)
+	}
+}
+
+func (idx *index) remove(key interface{}) {
+	for _, k := range idx.keys[key] {
+		m := idx.entries[k]
+		delete(m, key)
+		if len(m) == 0 {
+			delete(idx.entries, k)
+		}
+	}
+	delete(idx.keys, key)
+}
+
+// IndexedContainer wraps a container with secondary indexes, GetBy looks the values up by
+// the keys an IndexFunc derives from them. The indexes follow LoadBase, LoadInc, Set and Del
+// of the wrapper: LoadBase rebuilds them from the new data, the others reindex the keys they
+// changed. During a load GetBy may still return the values of the previous data.
+type IndexedContainer struct {
+	Container
+	mu      sync.RWMutex
+	indexes map[string]*index
+}
+
+func CreateIndexedContainer(c Container, indexes map[string]IndexFunc) *IndexedContainer {
+	ic := &IndexedContainer{
+		Container: c,
+		indexes:   make(map[string]*index, len(indexes)),
+	}
+	for name, fn := range indexes {
+		ic.indexes[name] = newIndex(fn)
+	}
+	ic.rebuild()
+	return ic
+}
+
+// GetBy returns all the values whose index keys of the index contain key, in no particular order
+func (ic *IndexedContainer) GetBy(indexName string, key MapKey) ([]interface{}, error) {
+	ic.mu.RLock()
+	defer ic.mu.RUnlock()
+	idx, ok := ic.indexes[indexName]
+	if !ok {
+		return nil, errors.New("index[" + indexName + "] not exist")
+	}
+	m := idx.entries[key.Value()]
+	if len(m) == 0 {
+		return nil, NotExistErr
+	}
+	values := make([]interface{}, 0, len(m))
+	for _, v := range m {
+		values = append(values, v)
+	}
+	return values, nil
+}
+
+func (ic *IndexedContainer) GetInt64(key int64) (interface{}, error) {
+	return GetInt64(ic.Container, key)
+}
+
+func (ic *IndexedContainer) GetString(key string) (interface{}, error) {
+	return GetString(ic.Container, key)
+}
+
+func (ic *IndexedContainer) Set(key MapKey, value interface{}) error {
+	if err := ic.Container.Set(key, value); err != nil {
+		return err
+	}
+	ic.reindex(key)
+	return nil
+}
+
+func (ic *IndexedContainer) Del(key MapKey, value interface{}) {
+	ic.Container.Del(key, value)
+	ic.reindex(key)
+}
+
+// SetValidators sets the validators of the wrapped container if it's Validatable
+func (ic *IndexedContainer) SetValidators(validators ...Validator) {
+	if v, ok := ic.Container.(Validatable); ok {
+		v.SetValidators(validators...)
+	}
+}
+
+func (ic *IndexedContainer) ValidationFailures() int64 {
+	if v, ok := ic.Container.(Validatable); ok {
+		return v.ValidationFailures()
+	}
+	return 0
+}
+
+// LoadBase rebuilds the indexes after the data is swapped, they are kept if the load fails
+func (ic *IndexedContainer) LoadBase(dataIter DataIterator) error {
+	if err := ic.Container.LoadBase(dataIter); err != nil {
+		return err
+	}
+	ic.rebuild()
+	return nil
+}
+
+// LoadInc reindexes the keys of the records, the records are applied even if it returns an error
+func (ic *IndexedContainer) LoadInc(dataIter DataIterator) error {
+	iter := &touchedIter{DataIterator: dataIter, keys: make(map[interface{}]MapKey)}
+	err := ic.Container.LoadInc(iter)
+	for _, key := range iter.keys {
+		ic.reindex(key)
+	}
+	return err
+}
+
+// reindex updates the entries of key from its current value in the container
+func (ic *IndexedContainer) reindex(key MapKey) {
+	ic.mu.Lock()
+	defer ic.mu.Unlock()
+	k := key.Value()
+	value, err := ic.Container.Get(key)
+	for _, idx := range ic.indexes {
+		idx.remove(k)
+		if err == nil {
+			idx.add(k, value)
+		}
+	}
+}
+
+func (ic *IndexedContainer) rebuild() {
+	indexes := make(map[string]*index, len(ic.indexes))
+	for name, idx := range ic.indexes {
+		indexes[name] = newIndex(idx.fn)
+	}
+	ic.Container.Range(func(key, value interface{}) bool {
+		for _, idx := range indexes {
+			idx.add(key, value)
+		}
+		return true
+	})
+	ic.mu.Lock()
+	ic.indexes = indexes
+	ic.mu.Unlock()
+}
+
+// touchedIter records the keys read from the iterator
+type touchedIter struct {
+	DataIterator
+	keys map[interface{}]MapKey
+}
+
+func (ti *touchedIter) Next() (DataMode, MapKey, interface{}, error) {
+	m, k, v, e := ti.DataIterator.Next()
+	if e == nil && k != nil {
+		ti.keys[k.Value()] = k
+	}
+	return m, k, v, e
+}
@@ -0,0 +1,97 @@
+package container
+
+import (
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/smartystreets/goconvey/convey"
+)
+
+// campaign values are "package,advertiser"
+func byPackage(value interface{}) []MapKey {
+	return []MapKey{StrKey(strings.Split(value.(string), ",")[0])}
+}
+
+func byAdvertiser(value interface{}) []MapKey {
+	return []MapKey{StrKey(strings.Split(value.(string), ",")[1])}
+}
+
+type deltaIter struct {
+	modes []DataMode
+	keys  []MapKey
+	i     int
+}
+
+func (di *deltaIter) HasNext() (bool, error) {
+	return di.i < len(di.keys), nil
+}
+
+func (di *deltaIter) Next() (DataMode, MapKey, interface{}, error) {
+	di.i++
+	return di.modes[di.i-1], di.keys[di.i-1], nil, nil
+}
+
+func getBy(ic *IndexedContainer, index, key string) []string {
+	values, _ := ic.GetBy(index, StrKey(key))
+	s := make([]string, 0, len(values))
+	for _, v := range values {
+		s = append(s, v.(string))
+	}
+	sort.Strings(s)
+	return s
+}
+
+func TestIndexedContainer(t *testing.T) {
+	convey.Convey("Test IndexedContainer", t, func() {
+		ic := CreateIndexedContainer(CreateBlockingMapContainer(2, 0), map[string]IndexFunc{
+			"package":    byPackage,
+			"advertiser": byAdvertiser,
+		})
+		convey.So(ic.LoadBase(NewTestDataIter([]string{
+			"1\tcom.a,903",
+			"2\tcom.b,903",
+			"3\tcom.a,904",
+		})), convey.ShouldBeNil)
+		convey.So(getBy(ic, "package", "com.a"), convey.ShouldResemble, []string{"com.a,903", "com.a,904"})
+		convey.So(getBy(ic, "advertiser", "903"), convey.ShouldResemble, []string{"com.a,903", "com.b,903"})
+
+		_, err := ic.GetBy("package", StrKey("com.c"))
+		convey.So(err, convey.ShouldEqual, NotExistErr)
+		_, err = ic.GetBy("country", StrKey("us"))
+		convey.So(err, convey.ShouldNotBeNil)
+
+		convey.Convey("Set and Del reindex the key", func() {
+			convey.So(ic.Set(StrKey("2"), "com.c,904"), convey.ShouldBeNil)
+			convey.So(getBy(ic, "advertiser", "903"), convey.ShouldResemble, []string{"com.a,903"})
+			convey.So(getBy(ic, "package", "com.c"), convey.ShouldResemble, []string{"com.c,904"})
+
+			ic.Del(StrKey("1"), nil)
+			convey.So(getBy(ic, "package", "com.a"), convey.ShouldResemble, []string{"com.a,904"})
+			convey.So(getBy(ic, "advertiser", "903"), convey.ShouldResemble, []string{})
+		})
+
+		convey.Convey("LoadInc reindexes the keys of the records", func() {
+			convey.So(ic.LoadInc(NewTestDataIter([]string{"3\tcom.b,903", "4\tcom.d,905"})), convey.ShouldBeNil)
+			convey.So(getBy(ic, "package", "com.b"), convey.ShouldResemble, []string{"com.b,903", "com.b,903"})
+			convey.So(getBy(ic, "package", "com.a"), convey.ShouldResemble, []string{"com.a,903"})
+			convey.So(getBy(ic, "advertiser", "905"), convey.ShouldResemble, []string{"com.d,905"})
+
+			convey.So(ic.LoadInc(&deltaIter{
+				modes: []DataMode{DataModeDel},
+				keys:  []MapKey{StrKey("4")},
+			}), convey.ShouldBeNil)
+			convey.So(getBy(ic, "advertiser", "905"), convey.ShouldResemble, []string{})
+		})
+
+		convey.Convey("LoadBase replaces the indexes", func() {
+			convey.So(ic.LoadBase(NewTestDataIter([]string{"5\tcom.e,906"})), convey.ShouldBeNil)
+			convey.So(getBy(ic, "package", "com.a"), convey.ShouldResemble, []string{})
+			convey.So(getBy(ic, "package", "com.e"), convey.ShouldResemble, []string{"com.e,906"})
+
+			// a failed load keeps the data and the indexes
+			convey.So(ic.LoadBase(NewTestDataIter([]string{"bad"})), convey.ShouldNotBeNil)
+			convey.So(getBy(ic, "advertiser", "906"), convey.ShouldResemble, []string{"com.e,906"})
+		})
+	})
+}
@@ -1,5 +1,10 @@
 package container
 
+import (
+	"errors"
+	"strconv"
+)
+
 type Int64Key struct {
 	Data int64
 }
@@ -15,3 +20,72 @@ func (i *Int64Key) Value() interface{} {
 func I64Key(key int64) *Int64Key {
 	return &Int64Key{key}
 }
+
+// ParseI64Key parses a decimal int64 key
+func ParseI64Key(s string) (*Int64Key, error) {
+	v, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return nil, errors.New("invalid int64 key[" + s + "]")
+	}
+	return I64Key(v), nil
+}
+
+// Int32Key is for the int32 type key, the key of the containers is an int32
+type Int32Key struct {
+	Data int32
+	v    interface{} // Data boxed by I32Key, so that Value doesn't allocate
+}
+
+func (i *Int32Key) PartitionKey() int64 {
+	return int64(i.Data)
+}
+
+func (i *Int32Key) Value() interface{} {
+	if i.v == nil {
+		return i.Data
+	}
+	return i.v
+}
+
+func I32Key(key int32) *Int32Key {
+	return &Int32Key{Data: key, v: key}
+}
+
+// ParseI32Key parses a decimal int32 key
+func ParseI32Key(s string) (*Int32Key, error) {
+	v, err := strconv.ParseInt(s, 10, 32)
+	if err != nil {
+		return nil, errors.New("invalid int32 key[" + s + "]")
+	}
+	return I32Key(int32(v)), nil
+}
+
+// Uint64Key is for the uint64 type key, the key of the containers is an uint64
+type Uint64Key struct {
+	Data uint64
+	v    interface{} // Data boxed by U64Key, so that Value doesn't allocate
+}
+
+func (u *Uint64Key) PartitionKey() int64 {
+	return int64(u.Data)
+}
+
+func (u *Uint64Key) Value() interface{} {
+	if u.v == nil {
+		return u.Data
+	}
+	return u.v
+}
+
+func U64Key(key uint64) *Uint64Key {
+	return &Uint64Key{Data: key, v: key}
+}
+
+// ParseU64Key parses a decimal uint64 key
+func ParseU64Key(s string) (*Uint64Key, error) {
+	v, err := strconv.ParseUint(s, 10, 64)
+	if err != nil {
+		return nil, errors.New("invalid uint64 key[" + s + "]")
+	}
+	return U64Key(v), nil
+}
@@ -0,0 +1,134 @@
+package container
+
+import (
+	"strconv"
+	"testing"
+
+	"github.com/smartystreets/goconvey/convey"
+)
+
+func parseCountry(s string) (string, error) {
+	return s, nil
+}
+
+func parseInt64(s string) (int64, error) {
+	return strconv.ParseInt(s, 10, 64)
+}
+
+func TestKeys(t *testing.T) {
+	convey.Convey("Test the keys in every container", t, func() {
+		uuid, err := ParseB16Key("123e4567-e89b-12d3-a456-426614174000")
+		convey.So(err, convey.ShouldBeNil)
+		keys := []MapKey{I32Key(7), U64Key(1<<64 - 1), uuid, NewPairKey(int64(1), "US"), NewPairKey("com.a", int32(2))}
+		// equal keys made apart
+		same := []MapKey{I32Key(7), U64Key(1<<64 - 1), B16Key(uuid.Data), NewPairKey(int64(1), "US"), NewPairKey("com.a", int32(2))}
+		values := []interface{}{"i32", "u64", "uuid", "pair", "pair2"}
+
+		containers := map[string]Container{
+			"blocking_map":   CreateBlockingMapContainer(4, 0),
+			"buffered_map":   &BufferedMapContainer{},
+			"buffered_klist": CreateBufferedKListContainer(),
+			"indexed":        CreateIndexedContainer(CreateBlockingMapContainer(4, 0), nil),
+		}
+		for name, c := range containers {
+			convey.So(c.LoadBase(&snapshotIter{keys: keys, values: values}), convey.ShouldBeNil)
+			for i, k := range same {
+				v, err := c.Get(k)
+				convey.So(err, convey.ShouldBeNil)
+				if name == "buffered_klist" {
+					convey.So(v, convey.ShouldResemble, []interface{}{values[i]})
+				} else {
+					convey.So(v, convey.ShouldEqual, values[i])
+				}
+			}
+			_, err := c.Get(NewPairKey(int64(1), "CN"))
+			convey.So(err, convey.ShouldEqual, NotExistErr)
+		}
+
+		typed := ToContainer[Pair[int64, string], string](CreateBlockingMap[Pair[int64, string], string](0))
+		convey.So(typed.Set(NewPairKey(int64(1), "US"), "pair"), convey.ShouldBeNil)
+		v, err := typed.Get(NewPairKey(int64(1), "US"))
+		convey.So(err, convey.ShouldBeNil)
+		convey.So(v, convey.ShouldEqual, "pair")
+		i32 := ToContainer[int32, string](CreateBufferedMap[int32, string](0))
+		convey.So(i32.LoadBase(&snapshotIter{keys: []MapKey{Key(int32(3))}, values: []interface{}{"i32"}}), convey.ShouldBeNil)
+		v, err = i32.Get(I32Key(3))
+		convey.So(err, convey.ShouldBeNil)
+		convey.So(v, convey.ShouldEqual, "i32")
+	})
+
+	convey.Convey("Test Pair keys made by Key are in the partition of NewPairKey", t, func() {
+		pair := Pair[int64, string]{First: 123, Second: "US"}
+		convey.So(Key(pair), convey.ShouldResemble, NewPairKey(int64(123), "US"))
+
+		bm := CreateBlockingMapContainer(16, 0)
+		convey.So(bm.Set(NewPairKey(int64(123), "US"), "set"), convey.ShouldBeNil)
+		v, err := bm.Get(Key(pair))
+		convey.So(err, convey.ShouldBeNil)
+		convey.So(v, convey.ShouldEqual, "set")
+
+		convey.So(bm.LoadBase(FromTypedIterator[Pair[int64, string], string](newTestTypedIter(
+			testRecord[Pair[int64, string], string]{key: pair, value: "loaded"},
+		))), convey.ShouldBeNil)
+		v, err = bm.Get(NewPairKey(int64(123), "US"))
+		convey.So(err, convey.ShouldBeNil)
+		convey.So(v, convey.ShouldEqual, "loaded")
+
+		literal := &PairKey[int64, string]{Data: pair}
+		convey.So(literal.Value(), convey.ShouldResemble, pair)
+		convey.So(literal.PartitionKey(), convey.ShouldEqual, NewPairKey(int64(123), "US").PartitionKey())
+		v, err = bm.Get(literal)
+		convey.So(err, convey.ShouldBeNil)
+		convey.So(v, convey.ShouldEqual, "loaded")
+	})
+
+	convey.Convey("Test the partition keys are stable", t, func() {
+		convey.So(Key(7).PartitionKey(), convey.ShouldEqual, 7)
+		convey.So(Key(uint32(7)).PartitionKey(), convey.ShouldEqual, 7)
+		convey.So(Key(1.5).PartitionKey(), convey.ShouldEqual, int64(hash("1.5")))
+		convey.So(I32Key(-3).PartitionKey(), convey.ShouldEqual, -3)
+		convey.So(U64Key(5).PartitionKey(), convey.ShouldEqual, 5)
+		md5, _ := ParseB16Key("0cc175b9c0f1b6a831c399e269772661")
+		convey.So(md5.PartitionKey(), convey.ShouldEqual, -6289574019528802036)
+		convey.So(NewPairKey(int64(1), "US").PartitionKey(), convey.ShouldEqual, 31+StrKey("US").PartitionKey())
+		convey.So(NewPairKey("US", int64(1)).PartitionKey(), convey.ShouldNotEqual, NewPairKey(int64(1), "US").PartitionKey())
+	})
+
+	convey.Convey("Test the parsers", t, func() {
+		k, err := ParseI64Key("-9")
+		convey.So(err, convey.ShouldBeNil)
+		convey.So(k.Data, convey.ShouldEqual, -9)
+		_, err = ParseI32Key("4294967296")
+		convey.So(err.Error(), convey.ShouldEqual, "invalid int32 key[4294967296]")
+		_, err = ParseU64Key("-1")
+		convey.So(err.Error(), convey.ShouldEqual, "invalid uint64 key[-1]")
+		md5, err := ParseB16Key("0CC175B9C0F1B6A831C399E269772661")
+		convey.So(err, convey.ShouldBeNil)
+		convey.So(md5.String(), convey.ShouldEqual, "0cc175b9c0f1b6a831c399e269772661")
+		_, err = ParseB16Key("0cc175b9")
+		convey.So(err.Error(), convey.ShouldEqual, "invalid 16 bytes key[0cc175b9]")
+
+		pair, err := ParsePairKey("123|US", "|", parseInt64, parseCountry)
+		convey.So(err, convey.ShouldBeNil)
+		convey.So(pair.Data, convey.ShouldResemble, Pair[int64, string]{First: 123, Second: "US"})
+		convey.So(pair.Value() == NewPairKey(int64(123), "US").Value(), convey.ShouldBeTrue)
+		_, err = ParsePairKey("123", "|", parseInt64, parseCountry)
+		convey.So(err.Error(), convey.ShouldEqual, "invalid pair key[123], no separator[|]")
+		_, err = ParsePairKey("x|US", "|", parseInt64, parseCountry)
+		convey.So(err, convey.ShouldNotBeNil)
+	})
+
+	convey.Convey("Test the keys are compared without allocating", t, func() {
+		m := map[interface{}]interface{}{}
+		keys := []MapKey{I32Key(1000), U64Key(1000), B16Key([16]byte{1}), NewPairKey(int64(1000), "US")}
+		for _, k := range keys {
+			m[k.Value()] = true
+		}
+		for _, k := range keys {
+			allocs := testing.AllocsPerRun(100, func() {
+				_ = m[k.Value()]
+			})
+			convey.So(allocs, convey.ShouldEqual, 0)
+		}
+	})
+}
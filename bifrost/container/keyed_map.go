@@ -0,0 +1,84 @@
+package container
+
+// keyedMap keeps the int64 and the string keys in maps of their own, so that they are looked
+// up by GetInt64 and GetString without being boxed, the other keys are in a map of interfaces
+type keyedMap[V any] struct {
+	ints  map[int64]V
+	strs  map[string]V
+	other map[interface{}]V
+}
+
+func newKeyedMap[V any]() *keyedMap[V] {
+	return &keyedMap[V]{
+		ints:  make(map[int64]V),
+		strs:  make(map[string]V),
+		other: make(map[interface{}]V),
+	}
+}
+
+// get looks up the value of a MapKey.Value()
+func (m *keyedMap[V]) get(key interface{}) (V, bool) {
+	var v V
+	var in bool
+	switch k := key.(type) {
+	case int64:
+		v, in = m.ints[k]
+	case string:
+		v, in = m.strs[k]
+	default:
+		v, in = m.other[k]
+	}
+	return v, in
+}
+
+// set returns whether the key is new
+func (m *keyedMap[V]) set(key interface{}, value V) bool {
+	n := m.len()
+	switch k := key.(type) {
+	case int64:
+		m.ints[k] = value
+	case string:
+		m.strs[k] = value
+	default:
+		m.other[k] = value
+	}
+	return m.len() > n
+}
+
+// del returns whether the key existed
+func (m *keyedMap[V]) del(key interface{}) bool {
+	n := m.len()
+	switch k := key.(type) {
+	case int64:
+		delete(m.ints, k)
+	case string:
+		delete(m.strs, k)
+	default:
+		delete(m.other, k)
+	}
+	return m.len() < n
+}
+
+func (m *keyedMap[V]) len() int {
+	return len(m.ints) + len(m.strs) + len(m.other)
+}
+
+// rangeAll returns false if f stopped the iteration
+func (m *keyedMap[V]) rangeAll(f func(key interface{}, value V) bool) bool {
+	for k, v := range m.ints {
+		if !f(k, v) {
+			return false
+		}
+	}
+	for k, v := range m.strs {
+		if !f(k, v) {
+			return false
+		}
+	}
+	for k, v := range m.other {
+		if !f(k, v) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,127 @@
+package container
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Pair is a composite key of two parts, such as (campaignId, countryCode), it's comparable so
+// that the containers use it as the key without concatenating the parts into a string
+type Pair[A, B comparable] struct {
+	First  A
+	Second B
+}
+
+// pairMapKey is implemented by every Pair, so that Key makes a *PairKey of it without knowing
+// the types of the parts
+type pairMapKey interface {
+	mapKey() MapKey
+}
+
+func (p Pair[A, B]) mapKey() MapKey {
+	return NewPairKey(p.First, p.Second)
+}
+
+func (p Pair[A, B]) parts() (interface{}, interface{}) {
+	return p.First, p.Second
+}
+
+// sortable returns whether the parts are keys supported by SortedContainer
+func (p Pair[A, B]) sortable() bool {
+	return scalarRank(any(p.First)) >= 0 && scalarRank(any(p.Second)) >= 0
+}
+
+// comparePair compares p with other by First, then by Second, without boxing the parts. It
+// returns false when other is not a Pair[A, B].
+func (p Pair[A, B]) comparePair(other interface{}) (int, bool) {
+	q, ok := other.(Pair[A, B])
+	if !ok {
+		return 0, false
+	}
+	if c := compareScalars(any(p.First), any(q.First)); c != 0 {
+		return c, true
+	}
+	return compareScalars(any(p.Second), any(q.Second)), true
+}
+
+// PairKey is the MapKey of a Pair, the key of the containers is the Pair
+type PairKey[A, B comparable] struct {
+	Data      Pair[A, B]
+	v         interface{} // Data boxed by NewPairKey, so that Value doesn't allocate
+	partition int64       // computed by NewPairKey
+}
+
+// PartitionKey combines the hashes of the parts, it's the same across processes
+func (p *PairKey[A, B]) PartitionKey() int64 {
+	if p.v == nil {
+		return pairPartition(p.Data.First, p.Data.Second)
+	}
+	return p.partition
+}
+
+func (p *PairKey[A, B]) Value() interface{} {
+	if p.v == nil {
+		return p.Data
+	}
+	return p.v
+}
+
+func NewPairKey[A, B comparable](first A, second B) *PairKey[A, B] {
+	data := Pair[A, B]{First: first, Second: second}
+	return &PairKey[A, B]{
+		Data:      data,
+		v:         data,
+		partition: pairPartition(first, second),
+	}
+}
+
+func pairPartition(first, second interface{}) int64 {
+	return int64(partHash(first)*31 + partHash(second))
+}
+
+// ParsePairKey splits s at the first sep and parses the parts, such as
+// ParsePairKey("123|US", "|", parseInt64, parseString)
+func ParsePairKey[A, B comparable](s, sep string, parseFirst func(string) (A, error), parseSecond func(string) (B, error)) (*PairKey[A, B], error) {
+	i := strings.Index(s, sep)
+	if i < 0 {
+		return nil, errors.New("invalid pair key[" + s + "], no separator[" + sep + "]")
+	}
+	first, err := parseFirst(s[:i])
+	if err != nil {
+		return nil, fmt.Errorf("invalid pair key[%s]: %s", s, err.Error())
+	}
+	second, err := parseSecond(s[i+len(sep):])
+	if err != nil {
+		return nil, fmt.Errorf("invalid pair key[%s]: %s", s, err.Error())
+	}
+	return NewPairKey(first, second), nil
+}
+
+// partHash hashes a part of a composite key
+func partHash(v interface{}) uint64 {
+	switch k := v.(type) {
+	case int64:
+		return uint64(k)
+	case int32:
+		return uint64(k)
+	case int:
+		return uint64(k)
+	case uint64:
+		return k
+	case uint32:
+		return uint64(k)
+	case string:
+		return uint64(hash(k))
+	case [16]byte:
+		return binary.LittleEndian.Uint64(k[:8])
+	case bool:
+		if k {
+			return 1
+		}
+		return 0
+	default:
+		return uint64(hash(fmt.Sprint(k)))
+	}
+}
@@ -0,0 +1,131 @@
+package container
+
+import (
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/smartystreets/goconvey/convey"
+)
+
+// The tests in this file are meant to be run with the race detector:
+//   go test -race ./bifrost/container/
+
+type statsGetter interface {
+	Stats() Stats
+}
+
+func raceContainers() map[string]func() Container {
+	return map[string]func() Container{
+		"BufferedMapContainer":   func() Container { return &BufferedMapContainer{Tolerate: 0.5} },
+		"BufferedKListContainer": func() Container { return CreateBufferedKListContainer() },
+		"BlockingMapContainer":   func() Container { return CreateBlockingMapContainer(4, 0.5) },
+		"BlockingKMapContainer":  func() Container { return &BlockingKMapContainer{Tolerate: 0.5} },
+		"SortedContainer":        func() Container { return CreateSortedContainer(0.5) },
+		"BufferedMap":            func() Container { return ToContainer[int64, string](CreateBufferedMap[int64, string](0.5)) },
+		"BlockingMap":            func() Container { return ToContainer[int64, string](CreateBlockingMap[int64, string](0.5)) },
+	}
+}
+
+func raceData(version int) []string {
+	data := make([]string, 0, 100)
+	for i := 0; i < 100; i++ {
+		data = append(data, strconv.Itoa(i)+"\t"+strconv.Itoa(version))
+	}
+	return data
+}
+
+func TestContainer_ConcurrentGetDuringLoadBase(t *testing.T) {
+	for name, create := range raceContainers() {
+		convey.Convey("Test concurrent Get during LoadBase: "+name, t, func() {
+			c := create()
+			convey.So(c.LoadBase(NewTestIntDataIter(raceData(0))), convey.ShouldBeNil)
+
+			stop := make(chan struct{})
+			wg := sync.WaitGroup{}
+			var readErr, loadErr error
+			var once sync.Once
+			for r := 0; r < 4; r++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					for i := int64(0); ; i = (i + 1) % 100 {
+						select {
+						case <-stop:
+							return
+						default:
+						}
+						if _, e := c.Get(I64Key(i)); e != nil {
+							once.Do(func() { readErr = e })
+						}
+						_ = c.Len()
+						c.Range(func(key, value interface{}) bool {
+							return false
+						})
+						if sg, ok := c.(statsGetter); ok {
+							_ = sg.Stats()
+						}
+					}
+				}()
+			}
+			for v := 1; v <= 20; v++ {
+				if e := c.LoadBase(NewTestIntDataIter(raceData(v))); e != nil {
+					loadErr = e
+				}
+			}
+			close(stop)
+			wg.Wait()
+			convey.So(loadErr, convey.ShouldBeNil)
+			convey.So(readErr, convey.ShouldBeNil)
+			convey.So(c.Len(), convey.ShouldEqual, 100)
+		})
+	}
+}
+
+func TestContainer_ConcurrentGetDuringLoadInc(t *testing.T) {
+	convey.Convey("Test concurrent Get during LoadInc", t, func() {
+		for _, c := range []Container{
+			CreateBlockingMapContainer(4, 0.5),
+			ToContainer[int64, string](CreateBlockingMap[int64, string](0.5)),
+		} {
+			convey.So(c.LoadBase(NewTestIntDataIter(raceData(0))), convey.ShouldBeNil)
+			stop := make(chan struct{})
+			wg := sync.WaitGroup{}
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for i := int64(0); ; i = (i + 1) % 100 {
+					select {
+					case <-stop:
+						return
+					default:
+					}
+					_, _ = c.Get(I64Key(i))
+					if sg, ok := c.(statsGetter); ok {
+						_ = sg.Stats()
+					}
+				}
+			}()
+			for v := 1; v <= 20; v++ {
+				convey.So(c.LoadInc(NewTestIntDataIter(raceData(v))), convey.ShouldBeNil)
+			}
+			close(stop)
+			wg.Wait()
+			v, e := c.Get(I64Key(1))
+			convey.So(e, convey.ShouldBeNil)
+			convey.So(v, convey.ShouldEqual, "20")
+		}
+	})
+}
+
+func TestContainer_Stats(t *testing.T) {
+	convey.Convey("Test Stats", t, func() {
+		bm := &BufferedMapContainer{Tolerate: 0.5}
+		convey.So(bm.LoadBase(NewTestIntDataIter([]string{"1\t2", "2"})), convey.ShouldBeNil)
+		convey.So(bm.Stats(), convey.ShouldResemble, Stats{ErrorNum: 1, TotalNum: 2})
+
+		kl := CreateBufferedKListContainer()
+		convey.So(kl.LoadBase(NewTestIntDataIter([]string{"1\t2", "1\t3"})), convey.ShouldBeNil)
+		convey.So(kl.Stats(), convey.ShouldResemble, Stats{ErrorNum: 0, TotalNum: 2})
+	})
+}
@@ -0,0 +1,434 @@
+package container
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	stdhash "hash"
+	"hash/crc32"
+	"io"
+	"os"
+	"time"
+)
+
+// Snapshot file layout, all integers are little endian:
+//
+//	header:  magic "BFSN" | version uint16 | created unix nano int64
+//	record:  key type uint8 (1: int64, 2: string, 3: int32, 4: uint64, 5: [16]byte, 6: pair) |
+//	         key | value length uvarint | value
+//	         a string key is its length uvarint followed by the bytes, a pair is the key type
+//	         and the key of each part, the others are fixed size
+//	trailer: 0 uint8 | record count uint64 | crc32 (IEEE) of all the bytes before it uint32
+const (
+	snapshotMagic   = "BFSN"
+	snapshotVersion = 1
+
+	keyTypeEnd     = 0
+	keyTypeInt64   = 1
+	keyTypeString  = 2
+	keyTypeInt32   = 3
+	keyTypeUint64  = 4
+	keyTypeBytes16 = 5
+	keyTypePair    = 6
+
+	// maxSnapshotBytes bounds a key or value length, a larger one means a corrupted file
+	maxSnapshotBytes = 1 << 30
+)
+
+// WriteSnapshot dumps all entries of c to path. The file is written to path + ".tmp" and
+// renamed at the end, so that a reader never sees a partial snapshot. Only int64, string,
+// int32, uint64 and [16]byte keys are supported, and the pairs of them.
+func WriteSnapshot(c Container, path string, codec ValueCodec) (err error) {
+	tmp := path + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			_ = f.Close()
+			_ = os.Remove(tmp)
+		}
+	}()
+
+	crc := crc32.NewIEEE()
+	bw := bufio.NewWriter(f)
+	w := io.MultiWriter(bw, crc)
+	buf := make([]byte, binary.MaxVarintLen64)
+
+	header := make([]byte, 0, 14)
+	header = append(header, snapshotMagic...)
+	header = binary.LittleEndian.AppendUint16(header, snapshotVersion)
+	header = binary.LittleEndian.AppendUint64(header, uint64(time.Now().UnixNano()))
+	if _, err = w.Write(header); err != nil {
+		return err
+	}
+
+	var count uint64
+	c.Range(func(key, value interface{}) bool {
+		if err = writeKey(w, buf, key); err != nil {
+			return false
+		}
+		var data []byte
+		if data, err = codec.Encode(value); err != nil {
+			err = fmt.Errorf("encode value of key[%v] error: %s", key, err.Error())
+			return false
+		}
+		if err = writeBytes(w, buf, data); err != nil {
+			return false
+		}
+		count++
+		return true
+	})
+	if err != nil {
+		return err
+	}
+
+	trailer := make([]byte, 0, 13)
+	trailer = append(trailer, keyTypeEnd)
+	trailer = binary.LittleEndian.AppendUint64(trailer, count)
+	if _, err = w.Write(trailer); err != nil {
+		return err
+	}
+	if _, err = bw.Write(binary.LittleEndian.AppendUint32(nil, crc.Sum32())); err != nil {
+		return err
+	}
+	if err = bw.Flush(); err != nil {
+		return err
+	}
+	if err = f.Sync(); err != nil {
+		return err
+	}
+	if err = f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+func writeKey(w io.Writer, buf []byte, key interface{}) error {
+	switch k := key.(type) {
+	case int64:
+		b := make([]byte, 0, 9)
+		b = append(b, keyTypeInt64)
+		b = binary.LittleEndian.AppendUint64(b, uint64(k))
+		_, err := w.Write(b)
+		return err
+	case string:
+		if _, err := w.Write([]byte{keyTypeString}); err != nil {
+			return err
+		}
+		return writeBytes(w, buf, []byte(k))
+	case int32:
+		b := make([]byte, 0, 5)
+		b = append(b, keyTypeInt32)
+		b = binary.LittleEndian.AppendUint32(b, uint32(k))
+		_, err := w.Write(b)
+		return err
+	case uint64:
+		b := make([]byte, 0, 9)
+		b = append(b, keyTypeUint64)
+		b = binary.LittleEndian.AppendUint64(b, k)
+		_, err := w.Write(b)
+		return err
+	case [16]byte:
+		_, err := w.Write(append([]byte{keyTypeBytes16}, k[:]...))
+		return err
+	case pairParts:
+		first, second := k.parts()
+		if !isPairPart(first) || !isPairPart(second) {
+			return fmt.Errorf("snapshot not support key type[%T]", key)
+		}
+		if _, err := w.Write([]byte{keyTypePair}); err != nil {
+			return err
+		}
+		if err := writeKey(w, buf, first); err != nil {
+			return err
+		}
+		return writeKey(w, buf, second)
+	default:
+		return fmt.Errorf("snapshot not support key type[%T]", key)
+	}
+}
+
+// isPairPart returns whether v is a part of a pair key supported by the snapshots
+func isPairPart(v interface{}) bool {
+	switch v.(type) {
+	case int64, string, int32, uint64, [16]byte:
+		return true
+	default:
+		return false
+	}
+}
+
+func writeBytes(w io.Writer, buf []byte, data []byte) error {
+	n := binary.PutUvarint(buf, uint64(len(data)))
+	if _, err := w.Write(buf[:n]); err != nil {
+		return err
+	}
+	_, err := w.Write(data)
+	return err
+}
+
+// SnapshotReader reads a snapshot written by WriteSnapshot, it's a DataIterator to be given
+// to Container.LoadBase. The checksum is verified when the last record is read, HasNext returns
+// an error if it doesn't match, so a corrupted snapshot is never swapped in.
+type SnapshotReader struct {
+	path    string
+	f       *os.File
+	r       *bufio.Reader
+	crc     stdhash.Hash32
+	codec   ValueCodec
+	created time.Time
+	count   uint64
+	done    bool
+
+	key   MapKey
+	value []byte
+}
+
+// OpenSnapshot opens a snapshot and checks its header
+func OpenSnapshot(path string, codec ValueCodec) (*SnapshotReader, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	sr := &SnapshotReader{
+		path:  path,
+		f:     f,
+		r:     bufio.NewReader(f),
+		crc:   crc32.NewIEEE(),
+		codec: codec,
+	}
+	header := make([]byte, 14)
+	if _, err := sr.read(header); err != nil {
+		_ = f.Close()
+		return nil, fmt.Errorf("read snapshot header error: %s", err.Error())
+	}
+	if string(header[:4]) != snapshotMagic {
+		_ = f.Close()
+		return nil, errors.New("not a snapshot file[" + path + "]")
+	}
+	if v := binary.LittleEndian.Uint16(header[4:6]); v != snapshotVersion {
+		_ = f.Close()
+		return nil, fmt.Errorf("not support snapshot version[%d]", v)
+	}
+	sr.created = time.Unix(0, int64(binary.LittleEndian.Uint64(header[6:])))
+	return sr, nil
+}
+
+// Created returns the time the snapshot was written
+func (sr *SnapshotReader) Created() time.Time {
+	return sr.created
+}
+
+// Describe returns the source of the records, see Describer
+func (sr *SnapshotReader) Describe() string {
+	return "snapshot[" + sr.path + "]"
+}
+
+func (sr *SnapshotReader) Close() error {
+	return sr.f.Close()
+}
+
+func (sr *SnapshotReader) HasNext() (bool, error) {
+	if sr.done {
+		return false, nil
+	}
+	keyType, err := sr.readByte()
+	if err != nil {
+		return false, sr.truncated(err)
+	}
+	if keyType == keyTypeEnd {
+		return false, sr.readTrailer()
+	}
+	if sr.key, err = sr.readKey(keyType); err != nil {
+		return false, sr.truncated(err)
+	}
+	if sr.value, err = sr.readBytes(); err != nil {
+		return false, sr.truncated(err)
+	}
+	sr.count++
+	return true, nil
+}
+
+func (sr *SnapshotReader) readKey(keyType byte) (MapKey, error) {
+	switch keyType {
+	case keyTypeInt64:
+		b := make([]byte, 8)
+		if _, err := sr.read(b); err != nil {
+			return nil, err
+		}
+		return I64Key(int64(binary.LittleEndian.Uint64(b))), nil
+	case keyTypeString:
+		b, err := sr.readBytes()
+		if err != nil {
+			return nil, err
+		}
+		return StrKey(string(b)), nil
+	case keyTypeInt32:
+		b := make([]byte, 4)
+		if _, err := sr.read(b); err != nil {
+			return nil, err
+		}
+		return I32Key(int32(binary.LittleEndian.Uint32(b))), nil
+	case keyTypeUint64:
+		b := make([]byte, 8)
+		if _, err := sr.read(b); err != nil {
+			return nil, err
+		}
+		return U64Key(binary.LittleEndian.Uint64(b)), nil
+	case keyTypeBytes16:
+		var k [16]byte
+		if _, err := sr.read(k[:]); err != nil {
+			return nil, err
+		}
+		return B16Key(k), nil
+	case keyTypePair:
+		first, err := sr.readPart()
+		if err != nil {
+			return nil, err
+		}
+		second, err := sr.readPart()
+		if err != nil {
+			return nil, err
+		}
+		return pairKeyOf(first, second), nil
+	default:
+		return nil, fmt.Errorf("snapshot corrupted, unknown key type[%d]", keyType)
+	}
+}
+
+// readPart reads a part of a pair key, which is any key but a pair
+func (sr *SnapshotReader) readPart() (interface{}, error) {
+	keyType, err := sr.readByte()
+	if err != nil {
+		return nil, err
+	}
+	if keyType == keyTypeEnd || keyType == keyTypePair {
+		return nil, fmt.Errorf("snapshot corrupted, key type[%d] in a pair", keyType)
+	}
+	key, err := sr.readKey(keyType)
+	if err != nil {
+		return nil, err
+	}
+	return key.Value(), nil
+}
+
+// pairKeyOf makes the PairKey of the parts read from a snapshot, they are of the key types
+// supported by the snapshots
+func pairKeyOf(first, second interface{}) MapKey {
+	switch a := first.(type) {
+	case int64:
+		return pairKeyWith(a, second)
+	case string:
+		return pairKeyWith(a, second)
+	case int32:
+		return pairKeyWith(a, second)
+	case uint64:
+		return pairKeyWith(a, second)
+	default:
+		return pairKeyWith(a.([16]byte), second)
+	}
+}
+
+func pairKeyWith[A comparable](first A, second interface{}) MapKey {
+	switch b := second.(type) {
+	case int64:
+		return NewPairKey(first, b)
+	case string:
+		return NewPairKey(first, b)
+	case int32:
+		return NewPairKey(first, b)
+	case uint64:
+		return NewPairKey(first, b)
+	default:
+		return NewPairKey(first, b.([16]byte))
+	}
+}
+
+func (sr *SnapshotReader) Next() (DataMode, MapKey, interface{}, error) {
+	v, err := sr.codec.Decode(sr.value)
+	if err != nil {
+		return DataModeAdd, sr.key, nil, fmt.Errorf("decode value of key[%v] error: %s", sr.key.Value(), err.Error())
+	}
+	return DataModeAdd, sr.key, v, nil
+}
+
+func (sr *SnapshotReader) readTrailer() error {
+	b := make([]byte, 8)
+	if _, err := sr.read(b); err != nil {
+		return sr.truncated(err)
+	}
+	sum := sr.crc.Sum32()
+	crc := make([]byte, 4)
+	if _, err := io.ReadFull(sr.r, crc); err != nil {
+		return sr.truncated(err)
+	}
+	if binary.LittleEndian.Uint32(crc) != sum {
+		return errors.New("snapshot checksum mismatch")
+	}
+	if count := binary.LittleEndian.Uint64(b); count != sr.count {
+		return fmt.Errorf("snapshot corrupted, count[%d], read[%d]", count, sr.count)
+	}
+	sr.done = true
+	return nil
+}
+
+func (sr *SnapshotReader) truncated(err error) error {
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return errors.New("snapshot truncated")
+	}
+	return err
+}
+
+func (sr *SnapshotReader) read(b []byte) (int, error) {
+	n, err := io.ReadFull(sr.r, b)
+	_, _ = sr.crc.Write(b[:n])
+	return n, err
+}
+
+func (sr *SnapshotReader) readByte() (byte, error) {
+	b, err := sr.r.ReadByte()
+	if err != nil {
+		return 0, err
+	}
+	_, _ = sr.crc.Write([]byte{b})
+	return b, nil
+}
+
+func (sr *SnapshotReader) readBytes() ([]byte, error) {
+	n, err := binary.ReadUvarint(byteReader{sr})
+	if err != nil {
+		return nil, err
+	}
+	if n > maxSnapshotBytes {
+		return nil, fmt.Errorf("snapshot corrupted, length[%d]", n)
+	}
+	b := make([]byte, n)
+	if _, err := sr.read(b); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+type byteReader struct {
+	sr *SnapshotReader
+}
+
+func (br byteReader) ReadByte() (byte, error) {
+	return br.sr.readByte()
+}
+
+// LoadSnapshot loads a snapshot into c by LoadBase, it returns the time the snapshot was written
+func LoadSnapshot(c Container, path string, codec ValueCodec) (time.Time, error) {
+	sr, err := OpenSnapshot(path, codec)
+	if err != nil {
+		return time.Time{}, err
+	}
+	defer func() { _ = sr.Close() }()
+	if err := c.LoadBase(sr); err != nil {
+		return time.Time{}, err
+	}
+	return sr.Created(), nil
+}
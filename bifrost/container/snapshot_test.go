@@ -0,0 +1,200 @@
+package container
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/smartystreets/goconvey/convey"
+)
+
+type snapshotIter struct {
+	keys   []MapKey
+	values []interface{}
+	i      int
+}
+
+func (si *snapshotIter) HasNext() (bool, error) {
+	return si.i < len(si.keys), nil
+}
+
+func (si *snapshotIter) Next() (DataMode, MapKey, interface{}, error) {
+	si.i++
+	return DataModeAdd, si.keys[si.i-1], si.values[si.i-1], nil
+}
+
+type price struct {
+	ID    int64
+	Price float64
+}
+
+func TestSnapshot(t *testing.T) {
+	dir, err := ioutil.TempDir("", "snapshot")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	convey.Convey("Test string keys and values", t, func() {
+		path := filepath.Join(dir, "str")
+		bm := &BufferedMapContainer{}
+		convey.So(bm.LoadBase(&snapshotIter{
+			keys:   []MapKey{StrKey("a"), StrKey(""), StrKey("中文")},
+			values: []interface{}{"aa", "empty", "value"},
+		}), convey.ShouldBeNil)
+		convey.So(WriteSnapshot(bm, path, StringCodec{}), convey.ShouldBeNil)
+		_, err := os.Stat(path + ".tmp")
+		convey.So(os.IsNotExist(err), convey.ShouldBeTrue)
+
+		restored := &BufferedMapContainer{}
+		created, err := LoadSnapshot(restored, path, StringCodec{})
+		convey.So(err, convey.ShouldBeNil)
+		convey.So(created.IsZero(), convey.ShouldBeFalse)
+		convey.So(restored.Len(), convey.ShouldEqual, 3)
+		v, err := restored.Get(StrKey("中文"))
+		convey.So(err, convey.ShouldBeNil)
+		convey.So(v, convey.ShouldEqual, "value")
+		v, err = restored.Get(StrKey(""))
+		convey.So(err, convey.ShouldBeNil)
+		convey.So(v, convey.ShouldEqual, "empty")
+	})
+
+	convey.Convey("Test int64 keys with json and gob codecs", t, func() {
+		bm := CreateBlockingMapContainer(4, 0)
+		for i := int64(-2); i < 100; i++ {
+			convey.So(bm.Set(I64Key(i), map[string]int64{"id": i}), convey.ShouldBeNil)
+		}
+		path := filepath.Join(dir, "json")
+		convey.So(WriteSnapshot(bm, path, JSONCodec[map[string]int64]{}), convey.ShouldBeNil)
+		restored := CreateBlockingMapContainer(4, 0)
+		_, err := LoadSnapshot(restored, path, JSONCodec[map[string]int64]{})
+		convey.So(err, convey.ShouldBeNil)
+		convey.So(restored.Len(), convey.ShouldEqual, 102)
+		v, err := restored.Get(I64Key(-2))
+		convey.So(err, convey.ShouldBeNil)
+		convey.So(v, convey.ShouldResemble, map[string]int64{"id": -2})
+
+		typed := CreateBufferedMap[int64, price](0)
+		convey.So(typed.LoadBase(ToTypedIterator[int64, price](&snapshotIter{
+			keys:   []MapKey{I64Key(1), I64Key(2)},
+			values: []interface{}{price{1, 0.5}, price{2, 1.5}},
+		})), convey.ShouldBeNil)
+		path = filepath.Join(dir, "gob")
+		convey.So(WriteSnapshot(ToContainer[int64, price](typed), path, GobCodec[price]{}), convey.ShouldBeNil)
+		restoredTyped := CreateBufferedMap[int64, price](0)
+		_, err = LoadSnapshot(ToContainer[int64, price](restoredTyped), path, GobCodec[price]{})
+		convey.So(err, convey.ShouldBeNil)
+		p, err := restoredTyped.Get(2)
+		convey.So(err, convey.ShouldBeNil)
+		convey.So(p, convey.ShouldResemble, price{2, 1.5})
+	})
+
+	convey.Convey("Test int32, uint64 and 16 bytes keys", t, func() {
+		path := filepath.Join(dir, "keys")
+		md5, _ := ParseB16Key("0cc175b9c0f1b6a831c399e269772661")
+		bm := &BufferedMapContainer{}
+		convey.So(bm.LoadBase(&snapshotIter{
+			keys:   []MapKey{I32Key(-1), U64Key(1 << 63), md5},
+			values: []interface{}{"i32", "u64", "md5"},
+		}), convey.ShouldBeNil)
+		convey.So(WriteSnapshot(bm, path, StringCodec{}), convey.ShouldBeNil)
+
+		restored := &BufferedMapContainer{}
+		_, err := LoadSnapshot(restored, path, StringCodec{})
+		convey.So(err, convey.ShouldBeNil)
+		for _, k := range []MapKey{I32Key(-1), U64Key(1 << 63), md5} {
+			v, _ := bm.Get(k)
+			r, err := restored.Get(k)
+			convey.So(err, convey.ShouldBeNil)
+			convey.So(r, convey.ShouldEqual, v)
+		}
+
+	})
+
+	convey.Convey("Test pair keys", t, func() {
+		path := filepath.Join(dir, "pairs")
+		md5, _ := ParseB16Key("0cc175b9c0f1b6a831c399e269772661")
+		keys := []MapKey{NewPairKey(int64(1), "US"), NewPairKey("US", int32(-1)), NewPairKey(uint64(2), md5.Data)}
+		pairs := &BufferedMapContainer{}
+		convey.So(pairs.LoadBase(&snapshotIter{keys: keys, values: []interface{}{"a", "b", "c"}}), convey.ShouldBeNil)
+		convey.So(WriteSnapshot(pairs, path, StringCodec{}), convey.ShouldBeNil)
+
+		restored := &BufferedMapContainer{}
+		_, err := LoadSnapshot(restored, path, StringCodec{})
+		convey.So(err, convey.ShouldBeNil)
+		for i, k := range keys {
+			r, err := restored.Get(k)
+			convey.So(err, convey.ShouldBeNil)
+			convey.So(r, convey.ShouldEqual, []string{"a", "b", "c"}[i])
+		}
+
+		nested := &BufferedMapContainer{}
+		convey.So(nested.LoadBase(&snapshotIter{keys: []MapKey{NewPairKey(int64(1), Pair[int64, int64]{1, 2})}, values: []interface{}{"a"}}), convey.ShouldBeNil)
+		convey.So(WriteSnapshot(nested, path, StringCodec{}), convey.ShouldNotBeNil)
+		unsupported := &BufferedMapContainer{}
+		convey.So(unsupported.LoadBase(&snapshotIter{keys: []MapKey{NewPairKey(int64(1), 1.5)}, values: []interface{}{"a"}}), convey.ShouldBeNil)
+		convey.So(WriteSnapshot(unsupported, path, StringCodec{}).Error(), convey.ShouldEqual, "snapshot not support key type[container.Pair[int64,float64]]")
+
+		// the snapshot written before is kept
+		_, err = LoadSnapshot(&BufferedMapContainer{}, path, StringCodec{})
+		convey.So(err, convey.ShouldBeNil)
+	})
+
+	convey.Convey("Test corrupted snapshots are not loaded", t, func() {
+		path := filepath.Join(dir, "corrupted")
+		bm := &BufferedMapContainer{}
+		convey.So(bm.LoadBase(&snapshotIter{
+			keys:   []MapKey{StrKey("a"), StrKey("b")},
+			values: []interface{}{"aa", "bb"},
+		}), convey.ShouldBeNil)
+		convey.So(WriteSnapshot(bm, path, StringCodec{}), convey.ShouldBeNil)
+		data, err := ioutil.ReadFile(path)
+		convey.So(err, convey.ShouldBeNil)
+
+		restored := &BufferedMapContainer{}
+		convey.So(restored.LoadBase(&snapshotIter{
+			keys:   []MapKey{StrKey("old")},
+			values: []interface{}{"old"},
+		}), convey.ShouldBeNil)
+
+		// a flipped value byte is found by the checksum
+		flipped := append([]byte{}, data...)
+		flipped[len(flipped)-20] ^= 0xff
+		convey.So(ioutil.WriteFile(path, flipped, 0644), convey.ShouldBeNil)
+		_, err = LoadSnapshot(restored, path, StringCodec{})
+		convey.So(err, convey.ShouldNotBeNil)
+		convey.So(err.Error(), convey.ShouldContainSubstring, "checksum mismatch")
+		v, _ := restored.Get(StrKey("old"))
+		convey.So(v, convey.ShouldEqual, "old")
+
+		convey.So(ioutil.WriteFile(path, data[:len(data)-6], 0644), convey.ShouldBeNil)
+		_, err = LoadSnapshot(restored, path, StringCodec{})
+		convey.So(err, convey.ShouldNotBeNil)
+		convey.So(err.Error(), convey.ShouldContainSubstring, "snapshot truncated")
+
+		convey.So(ioutil.WriteFile(path, []byte("a\taa\n"), 0644), convey.ShouldBeNil)
+		_, err = LoadSnapshot(restored, path, StringCodec{})
+		convey.So(err, convey.ShouldNotBeNil)
+		convey.So(restored.Len(), convey.ShouldEqual, 1)
+	})
+
+	convey.Convey("Test write errors keep the old snapshot", t, func() {
+		path := filepath.Join(dir, "keep")
+		bm := &BufferedMapContainer{}
+		convey.So(bm.LoadBase(&snapshotIter{keys: []MapKey{StrKey("a")}, values: []interface{}{"aa"}}), convey.ShouldBeNil)
+		convey.So(WriteSnapshot(bm, path, StringCodec{}), convey.ShouldBeNil)
+
+		bad := &BufferedMapContainer{}
+		convey.So(bad.LoadBase(&snapshotIter{keys: []MapKey{StrKey("a")}, values: []interface{}{1}}), convey.ShouldBeNil)
+		convey.So(WriteSnapshot(bad, path, StringCodec{}), convey.ShouldNotBeNil)
+		_, err := os.Stat(path + ".tmp")
+		convey.So(os.IsNotExist(err), convey.ShouldBeTrue)
+
+		restored := &BufferedMapContainer{}
+		_, err = LoadSnapshot(restored, path, StringCodec{})
+		convey.So(err, convey.ShouldBeNil)
+		v, _ := restored.Get(StrKey("a"))
+		convey.So(v, convey.ShouldEqual, "aa")
+	})
+}
@@ -0,0 +1,393 @@
+package container
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+type sortedEntry struct {
+	key   interface{}
+	value interface{}
+}
+
+// SortedContainer keeps the keys in order, for the range tables such as IP ranges or time
+// buckets, and the prefix matches of string keys. The data is a sorted array swapped atomically:
+// the reads never block, every write copies the array, so Set/Del are O(n), LoadInc merges all
+// its records in one copy.
+//
+// The keys may be StringKey, Int64Key, Int32Key, Uint64Key, Bytes16Key and the PairKey of two
+// of them, the others are counted as errors. The keys of different types are ordered by type
+// first, in that order: int32, int64, uint64, string, [16]byte, Pair. The pairs are ordered by
+// First, then by Second.
+type SortedContainer struct {
+	innerData atomic.Pointer[[]sortedEntry]
+	mu        sync.Mutex // serializes the writers, so that a LoadInc never loses a LoadBase
+	loadStats
+	validation
+	Tolerate float64
+}
+
+func CreateSortedContainer(tolerate float64) *SortedContainer {
+	return &SortedContainer{Tolerate: tolerate}
+}
+
+func (sc *SortedContainer) entries() []sortedEntry {
+	es := sc.innerData.Load()
+	if es == nil {
+		return nil
+	}
+	return *es
+}
+
+func (sc *SortedContainer) Get(key MapKey) (interface{}, error) {
+	return sc.get(key.Value())
+}
+
+// GetInt64 searches the int64 key without boxing it, see FastGetter
+func (sc *SortedContainer) GetInt64(key int64) (interface{}, error) {
+	es := sc.entries()
+	i := sort.Search(len(es), func(i int) bool {
+		if k, ok := es[i].key.(int64); ok {
+			return k >= key
+		}
+		return keyRank(es[i].key) > 1
+	})
+	if i == len(es) {
+		return nil, NotExistErr
+	}
+	if k, ok := es[i].key.(int64); !ok || k != key {
+		return nil, NotExistErr
+	}
+	return es[i].value, nil
+}
+
+// GetString searches the string key without boxing it, see FastGetter
+func (sc *SortedContainer) GetString(key string) (interface{}, error) {
+	es := sc.entries()
+	i := sort.Search(len(es), func(i int) bool {
+		if k, ok := es[i].key.(string); ok {
+			return k >= key
+		}
+		return keyRank(es[i].key) > 3
+	})
+	if i == len(es) {
+		return nil, NotExistErr
+	}
+	if k, ok := es[i].key.(string); !ok || k != key {
+		return nil, NotExistErr
+	}
+	return es[i].value, nil
+}
+
+func (sc *SortedContainer) get(k interface{}) (interface{}, error) {
+	es := sc.entries()
+	i := searchSorted(es, k)
+	if i == len(es) || compareKeys(es[i].key, k) != 0 {
+		return nil, NotExistErr
+	}
+	return es[i].value, nil
+}
+
+// Floor returns the entry of the greatest key less than or equal to key
+func (sc *SortedContainer) Floor(key MapKey) (interface{}, interface{}, error) {
+	k := key.Value()
+	if keyRank(k) < 0 {
+		return nil, nil, fmt.Errorf("not support key type[%T]", k)
+	}
+	es := sc.entries()
+	i := searchSorted(es, k)
+	if i < len(es) && compareKeys(es[i].key, k) == 0 {
+		return es[i].key, es[i].value, nil
+	}
+	if i == 0 {
+		return nil, nil, NotExistErr
+	}
+	return es[i-1].key, es[i-1].value, nil
+}
+
+// Ceil returns the entry of the least key greater than or equal to key
+func (sc *SortedContainer) Ceil(key MapKey) (interface{}, interface{}, error) {
+	k := key.Value()
+	if keyRank(k) < 0 {
+		return nil, nil, fmt.Errorf("not support key type[%T]", k)
+	}
+	es := sc.entries()
+	i := searchSorted(es, k)
+	if i == len(es) {
+		return nil, nil, NotExistErr
+	}
+	return es[i].key, es[i].value, nil
+}
+
+// RangeBetween ranges over the keys in [lo, hi) in order
+func (sc *SortedContainer) RangeBetween(lo, hi MapKey, f func(key, value interface{}) bool) error {
+	l, h := lo.Value(), hi.Value()
+	if keyRank(l) < 0 {
+		return fmt.Errorf("not support key type[%T]", l)
+	}
+	if keyRank(h) < 0 {
+		return fmt.Errorf("not support key type[%T]", h)
+	}
+	es := sc.entries()
+	for i := searchSorted(es, l); i < len(es) && compareKeys(es[i].key, h) < 0; i++ {
+		if !f(es[i].key, es[i].value) {
+			return nil
+		}
+	}
+	return nil
+}
+
+// PrefixScan ranges over the string keys starting with prefix in order
+func (sc *SortedContainer) PrefixScan(prefix string, f func(key, value interface{}) bool) {
+	es := sc.entries()
+	for i := searchSorted(es, prefix); i < len(es); i++ {
+		s, ok := es[i].key.(string)
+		if !ok || !strings.HasPrefix(s, prefix) {
+			return
+		}
+		if !f(es[i].key, es[i].value) {
+			return
+		}
+	}
+}
+
+func (sc *SortedContainer) Set(key MapKey, value interface{}) error {
+	k := key.Value()
+	if keyRank(k) < 0 {
+		return fmt.Errorf("not support key type[%T]", k)
+	}
+	sc.apply([]record{{mode: DataModeAdd, key: k, value: value}})
+	return nil
+}
+
+func (sc *SortedContainer) Del(key MapKey, value interface{}) {
+	k := key.Value()
+	if keyRank(k) < 0 {
+		return
+	}
+	sc.apply([]record{{mode: DataModeDel, key: k}})
+}
+
+func (sc *SortedContainer) Len() int {
+	return len(sc.entries())
+}
+
+// Range ranges over all the keys in order
+func (sc *SortedContainer) Range(f func(key, value interface{}) bool) {
+	for _, e := range sc.entries() {
+		if !f(e.key, e.value) {
+			return
+		}
+	}
+}
+
+func (sc *SortedContainer) LoadBase(iterator DataIterator) error {
+	sc.resetStats()
+	records, err := sc.read(iterator)
+	if err != nil {
+		return fmt.Errorf("LoadBase Error, err[%s]", err.Error())
+	}
+	f := sc.errorRatio()
+	if f > sc.Tolerate {
+		return errors.New(fmt.Sprintf("LoadBase error, tolerate[%f], err[%f]", sc.Tolerate, f))
+	}
+	es := mergeSorted(nil, records)
+	if err := sc.validate(&sortedData{entries: es, prev: sc.Len()}); err != nil {
+		return err
+	}
+	sc.mu.Lock()
+	sc.innerData.Store(&es)
+	sc.mu.Unlock()
+	return nil
+}
+
+func (sc *SortedContainer) LoadInc(iterator DataIterator) error {
+	records, err := sc.read(iterator)
+	if err != nil {
+		return fmt.Errorf("LoadInc Error, err[%s]", err.Error())
+	}
+	sc.apply(records)
+	f := sc.errorRatio()
+	if f > sc.Tolerate {
+		return errors.New(fmt.Sprintf("LoadInc error, tolerate[%f], err[%f]", sc.Tolerate, f))
+	}
+	return nil
+}
+
+// read collects the records of the iterator, the records of the keys not supported are errors
+func (sc *SortedContainer) read(iterator DataIterator) ([]record, error) {
+	records := make([]record, 0)
+	b, e := iterator.HasNext()
+	if e != nil {
+		return nil, e
+	}
+	for b {
+		m, k, v, e := iterator.Next()
+		sc.addTotal()
+		if e != nil || keyRank(k.Value()) < 0 {
+			sc.addError()
+		} else {
+			records = append(records, record{mode: m, key: k.Value(), value: v})
+		}
+		b, e = iterator.HasNext()
+		if e != nil {
+			return nil, e
+		}
+	}
+	return records, nil
+}
+
+func (sc *SortedContainer) apply(records []record) {
+	if len(records) == 0 {
+		return
+	}
+	sc.mu.Lock()
+	es := mergeSorted(sc.entries(), records)
+	sc.innerData.Store(&es)
+	sc.mu.Unlock()
+}
+
+// mergeSorted returns a new array of the sorted entries es updated by the records, the last
+// record of a key wins
+func mergeSorted(es []sortedEntry, records []record) []sortedEntry {
+	sort.SliceStable(records, func(i, j int) bool {
+		return compareKeys(records[i].key, records[j].key) < 0
+	})
+	res := make([]sortedEntry, 0, len(es)+len(records))
+	i := 0
+	for j := 0; j < len(records); j++ {
+		r := records[j]
+		if j+1 < len(records) && compareKeys(r.key, records[j+1].key) == 0 {
+			continue
+		}
+		for i < len(es) && compareKeys(es[i].key, r.key) < 0 {
+			res = append(res, es[i])
+			i++
+		}
+		if i < len(es) && compareKeys(es[i].key, r.key) == 0 {
+			i++
+		}
+		if r.mode != DataModeDel {
+			res = append(res, sortedEntry{key: r.key, value: r.value})
+		}
+	}
+	return append(res, es[i:]...)
+}
+
+// searchSorted returns the index of the first entry whose key is not less than k
+func searchSorted(es []sortedEntry, k interface{}) int {
+	return sort.Search(len(es), func(i int) bool {
+		return compareKeys(es[i].key, k) >= 0
+	})
+}
+
+// pairParts is implemented by every Pair, so that the pairs are compared without knowing the
+// types of the parts
+type pairParts interface {
+	parts() (interface{}, interface{})
+	sortable() bool
+	comparePair(other interface{}) (int, bool)
+}
+
+// keyRank orders the key types, -1 for the types not supported
+func keyRank(k interface{}) int {
+	if x, ok := k.(pairParts); ok {
+		if !x.sortable() {
+			return -1
+		}
+		return 5
+	}
+	return scalarRank(k)
+}
+
+// scalarRank is keyRank of the keys but the pairs
+func scalarRank(k interface{}) int {
+	switch k.(type) {
+	case int32:
+		return 0
+	case int64:
+		return 1
+	case uint64:
+		return 2
+	case string:
+		return 3
+	case [16]byte:
+		return 4
+	}
+	return -1
+}
+
+func compareKeys(a, b interface{}) int {
+	ra, rb := keyRank(a), keyRank(b)
+	if ra != rb {
+		return compareOrdered(ra, rb)
+	}
+	if x, ok := a.(pairParts); ok {
+		if c, ok := x.comparePair(b); ok {
+			return c
+		}
+		// pairs of different types
+		x1, x2 := x.parts()
+		y1, y2 := b.(pairParts).parts()
+		if c := compareKeys(x1, y1); c != 0 {
+			return c
+		}
+		return compareKeys(x2, y2)
+	}
+	return compareScalars(a, b)
+}
+
+// compareScalars is compareKeys of two keys of the same type but the pairs
+func compareScalars(a, b interface{}) int {
+	switch x := a.(type) {
+	case int32:
+		return compareOrdered(x, b.(int32))
+	case int64:
+		return compareOrdered(x, b.(int64))
+	case uint64:
+		return compareOrdered(x, b.(uint64))
+	case string:
+		return strings.Compare(x, b.(string))
+	case [16]byte:
+		y := b.([16]byte)
+		return bytes.Compare(x[:], y[:])
+	}
+	return 0
+}
+
+func compareOrdered[T int | int32 | int64 | uint64](x, y T) int {
+	if x < y {
+		return -1
+	}
+	if x > y {
+		return 1
+	}
+	return 0
+}
+
+// sortedData is the BaseData of SortedContainer
+type sortedData struct {
+	entries []sortedEntry
+	prev    int
+}
+
+func (sd *sortedData) Len() int {
+	return len(sd.entries)
+}
+
+func (sd *sortedData) PrevLen() int {
+	return sd.prev
+}
+
+func (sd *sortedData) Range(f func(key, value interface{}) bool) {
+	for _, e := range sd.entries {
+		if !f(e.key, e.value) {
+			return
+		}
+	}
+}
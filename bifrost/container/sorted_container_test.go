@@ -0,0 +1,233 @@
+package container
+
+import (
+	"strconv"
+	"testing"
+
+	"github.com/smartystreets/goconvey/convey"
+)
+
+type incRecord struct {
+	mode  DataMode
+	key   MapKey
+	value interface{}
+}
+
+type incIter struct {
+	records []incRecord
+	i       int
+}
+
+func (it *incIter) HasNext() (bool, error) {
+	return it.i < len(it.records), nil
+}
+
+func (it *incIter) Next() (DataMode, MapKey, interface{}, error) {
+	it.i++
+	r := it.records[it.i-1]
+	return r.mode, r.key, r.value, nil
+}
+
+func sortedKeys(sc *SortedContainer) []interface{} {
+	keys := make([]interface{}, 0)
+	sc.Range(func(key, value interface{}) bool {
+		keys = append(keys, key)
+		return true
+	})
+	return keys
+}
+
+func TestSortedContainer(t *testing.T) {
+	convey.Convey("Test load and order", t, func() {
+		sc := CreateSortedContainer(0)
+		_, err := sc.Get(I64Key(1))
+		convey.So(err, convey.ShouldEqual, NotExistErr)
+		convey.So(sc.LoadBase(NewTestIntDataIter([]string{"30\tc", "10\ta", "20\tb", "10\taa"})), convey.ShouldBeNil)
+		convey.So(sc.Len(), convey.ShouldEqual, 3)
+		convey.So(sortedKeys(sc), convey.ShouldResemble, []interface{}{int64(10), int64(20), int64(30)})
+		v, err := sc.Get(I64Key(10))
+		convey.So(err, convey.ShouldBeNil)
+		convey.So(v, convey.ShouldEqual, "aa")
+		v, err = sc.GetInt64(30)
+		convey.So(err, convey.ShouldBeNil)
+		convey.So(v, convey.ShouldEqual, "c")
+
+		convey.So(sc.LoadInc(&incIter{records: []incRecord{
+			{mode: DataModeAdd, key: I64Key(25), value: "x"},
+			{mode: DataModeDel, key: I64Key(10)},
+			{mode: DataModeUpdate, key: I64Key(30), value: "c2"},
+			{mode: DataModeUpdate, key: I64Key(30), value: "cc"},
+			{mode: DataModeDel, key: I64Key(40)},
+		}}), convey.ShouldBeNil)
+		convey.So(sortedKeys(sc), convey.ShouldResemble, []interface{}{int64(20), int64(25), int64(30)})
+		v, _ = sc.Get(I64Key(30))
+		convey.So(v, convey.ShouldEqual, "cc")
+
+		convey.So(sc.Set(I64Key(5), "e"), convey.ShouldBeNil)
+		sc.Del(I64Key(25), nil)
+		convey.So(sortedKeys(sc), convey.ShouldResemble, []interface{}{int64(5), int64(20), int64(30)})
+		convey.So(sc.Set(NewPairKey(int64(1), 1.5), "p"), convey.ShouldNotBeNil)
+	})
+
+	convey.Convey("Test Floor, Ceil and RangeBetween", t, func() {
+		sc := CreateSortedContainer(0)
+		convey.So(sc.LoadBase(NewTestIntDataIter([]string{"10\ta", "20\tb", "30\tc"})), convey.ShouldBeNil)
+
+		k, v, err := sc.Floor(I64Key(25))
+		convey.So(err, convey.ShouldBeNil)
+		convey.So(k, convey.ShouldEqual, int64(20))
+		convey.So(v, convey.ShouldEqual, "b")
+		k, _, _ = sc.Floor(I64Key(30))
+		convey.So(k, convey.ShouldEqual, int64(30))
+		_, _, err = sc.Floor(I64Key(9))
+		convey.So(err, convey.ShouldEqual, NotExistErr)
+
+		k, _, _ = sc.Ceil(I64Key(11))
+		convey.So(k, convey.ShouldEqual, int64(20))
+		k, _, _ = sc.Ceil(I64Key(10))
+		convey.So(k, convey.ShouldEqual, int64(10))
+		_, _, err = sc.Ceil(I64Key(31))
+		convey.So(err, convey.ShouldEqual, NotExistErr)
+		_, _, err = sc.Ceil(NewPairKey(int64(1), 1.5))
+		convey.So(err, convey.ShouldNotBeNil)
+
+		values := make([]interface{}, 0)
+		convey.So(sc.RangeBetween(I64Key(10), I64Key(30), func(key, value interface{}) bool {
+			values = append(values, value)
+			return true
+		}), convey.ShouldBeNil)
+		convey.So(values, convey.ShouldResemble, []interface{}{"a", "b"})
+		values = values[:0]
+		convey.So(sc.RangeBetween(I64Key(11), I64Key(100), func(key, value interface{}) bool {
+			values = append(values, value)
+			return len(values) < 1
+		}), convey.ShouldBeNil)
+		convey.So(values, convey.ShouldResemble, []interface{}{"b"})
+	})
+
+	convey.Convey("Test PrefixScan", t, func() {
+		sc := CreateSortedContainer(0)
+		convey.So(sc.LoadBase(NewTestDataIter([]string{
+			"com.example.b\t2",
+			"com.example\t0",
+			"com.examples\t3",
+			"com.example.a\t1",
+			"org.example\t4",
+		})), convey.ShouldBeNil)
+		convey.So(sc.Set(I64Key(1), "i"), convey.ShouldBeNil)
+		keys := make([]interface{}, 0)
+		sc.PrefixScan("com.example.", func(key, value interface{}) bool {
+			keys = append(keys, key)
+			return true
+		})
+		convey.So(keys, convey.ShouldResemble, []interface{}{"com.example.a", "com.example.b"})
+		v, err := sc.GetString("org.example")
+		convey.So(err, convey.ShouldBeNil)
+		convey.So(v, convey.ShouldEqual, "4")
+		// the int64 keys are before the string keys
+		convey.So(sortedKeys(sc)[0], convey.ShouldEqual, int64(1))
+	})
+
+	convey.Convey("Test the keys of the other types", t, func() {
+		sc := CreateSortedContainer(0)
+		convey.So(sc.Set(B16Key([16]byte{2}), 2), convey.ShouldBeNil)
+		convey.So(sc.Set(B16Key([16]byte{1, 9}), 1), convey.ShouldBeNil)
+		convey.So(sc.Set(U64Key(1<<63), 3), convey.ShouldBeNil)
+		convey.So(sc.Set(I32Key(-1), 4), convey.ShouldBeNil)
+		values := make([]interface{}, 0)
+		sc.Range(func(key, value interface{}) bool {
+			values = append(values, value)
+			return true
+		})
+		convey.So(values, convey.ShouldResemble, []interface{}{4, 3, 1, 2})
+	})
+
+	convey.Convey("Test the pair keys are ordered by their parts", t, func() {
+		sc := CreateSortedContainer(0)
+		convey.So(sc.Set(NewPairKey(int64(2), "US"), "2US"), convey.ShouldBeNil)
+		convey.So(sc.Set(NewPairKey(int64(10), "CN"), "10CN"), convey.ShouldBeNil)
+		convey.So(sc.Set(NewPairKey(int64(2), "CN"), "2CN"), convey.ShouldBeNil)
+		convey.So(sc.Set(I64Key(99), "int"), convey.ShouldBeNil)
+		values := make([]interface{}, 0)
+		sc.Range(func(key, value interface{}) bool {
+			values = append(values, value)
+			return true
+		})
+		convey.So(values, convey.ShouldResemble, []interface{}{"int", "2CN", "2US", "10CN"})
+
+		v, err := sc.Get(NewPairKey(int64(2), "US"))
+		convey.So(err, convey.ShouldBeNil)
+		convey.So(v, convey.ShouldEqual, "2US")
+		k, v, err := sc.Ceil(NewPairKey(int64(2), "D"))
+		convey.So(err, convey.ShouldBeNil)
+		convey.So(k, convey.ShouldResemble, Pair[int64, string]{First: 2, Second: "US"})
+		convey.So(v, convey.ShouldEqual, "2US")
+
+		// all the countries of campaign 2
+		values = values[:0]
+		convey.So(sc.RangeBetween(NewPairKey(int64(2), ""), NewPairKey(int64(3), ""), func(key, value interface{}) bool {
+			values = append(values, value)
+			return true
+		}), convey.ShouldBeNil)
+		convey.So(values, convey.ShouldResemble, []interface{}{"2CN", "2US"})
+		sc.Del(NewPairKey(int64(2), "CN"), nil)
+		convey.So(sc.Len(), convey.ShouldEqual, 3)
+
+		// the pairs of the same type are compared without allocating
+		key := NewPairKey(int64(10), "CN")
+		allocs := testing.AllocsPerRun(100, func() {
+			_, _ = sc.Get(key)
+		})
+		convey.So(allocs, convey.ShouldEqual, 0)
+
+		// the pairs of different types are ordered by their parts too
+		convey.So(sc.Set(NewPairKey("US", int64(1)), "US1"), convey.ShouldBeNil)
+		convey.So(sc.Set(NewPairKey(int32(1), "US"), "1US"), convey.ShouldBeNil)
+		values = values[:0]
+		sc.Range(func(key, value interface{}) bool {
+			values = append(values, value)
+			return true
+		})
+		convey.So(values, convey.ShouldResemble, []interface{}{"int", "1US", "2US", "10CN", "US1"})
+
+	})
+
+	convey.Convey("Test GetInt64 and GetString don't allocate", t, func() {
+		sc := CreateSortedContainer(0)
+		for i := 0; i < 100; i++ {
+			convey.So(sc.Set(I64Key(int64(i*2)), i), convey.ShouldBeNil)
+			convey.So(sc.Set(StrKey(strconv.Itoa(i*2)), i), convey.ShouldBeNil)
+		}
+		convey.So(sc.Set(I32Key(5), "i32"), convey.ShouldBeNil)
+		convey.So(sc.Set(NewPairKey(int64(5), "5"), "pair"), convey.ShouldBeNil)
+		v, err := sc.GetInt64(10)
+		convey.So(err, convey.ShouldBeNil)
+		convey.So(v, convey.ShouldEqual, 5)
+		v, err = sc.GetString("10")
+		convey.So(err, convey.ShouldBeNil)
+		convey.So(v, convey.ShouldEqual, 5)
+		for _, k := range []int64{5, -1, 1000} {
+			_, err = sc.GetInt64(k)
+			convey.So(err, convey.ShouldEqual, NotExistErr)
+		}
+		for _, k := range []string{"5", "", "zzz"} {
+			_, err = sc.GetString(k)
+			convey.So(err, convey.ShouldEqual, NotExistErr)
+		}
+
+		allocs := testing.AllocsPerRun(100, func() {
+			_, _ = sc.GetInt64(1000)
+			_, _ = sc.GetString("zzz")
+		})
+		convey.So(allocs, convey.ShouldEqual, 0)
+	})
+
+	convey.Convey("Test validation and tolerate", t, func() {
+		sc := CreateSortedContainer(0)
+		sc.SetValidators(MinLen(2))
+		convey.So(sc.LoadBase(NewTestDataIter([]string{"a\t1"})), convey.ShouldHaveSameTypeAs, &ValidationError{})
+		convey.So(sc.Len(), convey.ShouldEqual, 0)
+		convey.So(sc.LoadBase(NewTestIntDataIter([]string{"1\t1", "x\t2"})), convey.ShouldNotBeNil)
+		convey.So(sc.Stats().ErrorNum, convey.ShouldEqual, 1)
+	})
+}
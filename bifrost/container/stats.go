@@ -0,0 +1,45 @@
+package container
+
+import "sync/atomic"
+
+// Stats is a snapshot of the load statistics of a container.
+// The counters are reset by LoadBase and accumulated by the following LoadIncs.
+type Stats struct {
+	ErrorNum int64 `json:"error_num"`
+	TotalNum int64 `json:"total_num"`
+}
+
+// loadStats is embedded by the containers, it's safe to read while loading
+type loadStats struct {
+	errorNum int64
+	totalNum int64
+}
+
+// Stats returns the load statistics, it's safe to be called concurrently with loads
+func (s *loadStats) Stats() Stats {
+	return Stats{
+		ErrorNum: atomic.LoadInt64(&s.errorNum),
+		TotalNum: atomic.LoadInt64(&s.totalNum),
+	}
+}
+
+func (s *loadStats) resetStats() {
+	atomic.StoreInt64(&s.errorNum, 0)
+	atomic.StoreInt64(&s.totalNum, 0)
+}
+
+func (s *loadStats) addTotal() {
+	atomic.AddInt64(&s.totalNum, 1)
+}
+
+func (s *loadStats) addError() {
+	atomic.AddInt64(&s.errorNum, 1)
+}
+
+func (s *loadStats) errorRatio() float64 {
+	st := s.Stats()
+	if st.TotalNum == 0 {
+		return 0
+	}
+	return float64(st.ErrorNum) / float64(st.TotalNum)
+}
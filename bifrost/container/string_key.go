@@ -1,7 +1,5 @@
 package container
 
-import "unsafe"
-
 // StringKey is for the string type key
 type StringKey struct {
 	Data string
@@ -13,18 +11,11 @@ const (
 )
 
 func hash(str string) uint32 {
-	data := ([]byte)(str)
 	var h1 uint32 = 37
 
-	nblocks := len(data) / 4
-	var p uintptr
-	if len(data) > 0 {
-		p = uintptr(unsafe.Pointer(&data[0]))
-	}
-
-	p1 := p + uintptr(4*nblocks)
-	for ; p < p1; p += 4 {
-		k1 := *(*uint32)(unsafe.Pointer(p))
+	nblocks := len(str) / 4
+	for i := 0; i < nblocks*4; i += 4 {
+		k1 := uint32(str[i]) | uint32(str[i+1])<<8 | uint32(str[i+2])<<16 | uint32(str[i+3])<<24
 		k1 *= c1_32
 		k1 = (k1 << 15) | (k1 >> 17) // rotl32(k1, 15)
 		k1 *= c2_32
@@ -34,7 +25,7 @@ func hash(str string) uint32 {
 		h1 = h1*5 + 0xe6546b64
 	}
 
-	tail := data[nblocks*4:]
+	tail := str[nblocks*4:]
 
 	var k1 uint32
 	switch len(tail) & 3 {
@@ -52,7 +43,7 @@ func hash(str string) uint32 {
 		h1 ^= k1
 	}
 
-	h1 ^= uint32(len(data))
+	h1 ^= uint32(len(str))
 
 	h1 ^= h1 >> 16
 	h1 *= 0x85ebca6b
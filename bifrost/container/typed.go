@@ -0,0 +1,54 @@
+package container
+
+// TypedDataIterator is the DataIterator with compile-time key and value types
+type TypedDataIterator[K comparable, V any] interface {
+	HasNext() (bool, error)
+	Next() (DataMode, K, V, error)
+}
+
+// TypedContainer is the Container with compile-time key and value types,
+// lookups neither box the key nor need a type assertion on the value
+type TypedContainer[K comparable, V any] interface {
+	Get(key K) (V, error)
+	Set(key K, value V) error
+	Del(key K)
+
+	Len() int
+	Range(f func(key K, value V) bool)
+
+	LoadBase(dataIter TypedDataIterator[K, V]) error
+	LoadInc(dataIter TypedDataIterator[K, V]) error
+}
+
+// Key converts a typed key to MapKey, int64, int32, uint64, [16]byte, string and Pair keys
+// become Int64Key, Int32Key, Uint64Key, Bytes16Key, StringKey and PairKey
+func Key[K comparable](key K) MapKey {
+	switch k := any(key).(type) {
+	case int64:
+		return I64Key(k)
+	case int32:
+		return I32Key(k)
+	case uint64:
+		return U64Key(k)
+	case [16]byte:
+		return B16Key(k)
+	case string:
+		return StrKey(k)
+	case pairMapKey:
+		return k.mapKey()
+	}
+	return &typedKey[K]{key}
+}
+
+type typedKey[K comparable] struct {
+	Data K
+}
+
+// PartitionKey hashes the key as a part of a PairKey, so that the keys spread over the partitions
+func (k *typedKey[K]) PartitionKey() int64 {
+	return int64(partHash(k.Data))
+}
+
+func (k *typedKey[K]) Value() interface{} {
+	return k.Data
+}
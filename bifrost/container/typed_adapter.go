@@ -0,0 +1,168 @@
+package container
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ToContainer adapts a TypedContainer to the Container interface, so that it can be used by
+// the streamers and Bifrost. Keys whose Value() is not a K are reported as errors.
+func ToContainer[K comparable, V any](c TypedContainer[K, V]) Container {
+	return &containerAdapter[K, V]{typed: c}
+}
+
+// AsTyped returns the TypedContainer behind a Container created by ToContainer
+func AsTyped[K comparable, V any](c Container) (TypedContainer[K, V], bool) {
+	a, ok := c.(*containerAdapter[K, V])
+	if !ok {
+		return nil, false
+	}
+	return a.typed, true
+}
+
+type containerAdapter[K comparable, V any] struct {
+	typed TypedContainer[K, V]
+}
+
+func (a *containerAdapter[K, V]) Get(key MapKey) (interface{}, error) {
+	k, err := typedKeyOf[K](key)
+	if err != nil {
+		return nil, err
+	}
+	v, err := a.typed.Get(k)
+	if err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+func (a *containerAdapter[K, V]) Set(key MapKey, value interface{}) error {
+	k, err := typedKeyOf[K](key)
+	if err != nil {
+		return err
+	}
+	v, err := typedValueOf[V](value)
+	if err != nil {
+		return err
+	}
+	return a.typed.Set(k, v)
+}
+
+func (a *containerAdapter[K, V]) Del(key MapKey, value interface{}) {
+	k, err := typedKeyOf[K](key)
+	if err != nil {
+		return
+	}
+	a.typed.Del(k)
+}
+
+func (a *containerAdapter[K, V]) Len() int {
+	return a.typed.Len()
+}
+
+func (a *containerAdapter[K, V]) Range(f func(key, value interface{}) bool) {
+	a.typed.Range(func(key K, value V) bool {
+		return f(key, value)
+	})
+}
+
+// SetValidators sets the validators of the typed container if it's Validatable
+func (a *containerAdapter[K, V]) SetValidators(validators ...Validator) {
+	if v, ok := a.typed.(Validatable); ok {
+		v.SetValidators(validators...)
+	}
+}
+
+func (a *containerAdapter[K, V]) ValidationFailures() int64 {
+	if v, ok := a.typed.(Validatable); ok {
+		return v.ValidationFailures()
+	}
+	return 0
+}
+
+func (a *containerAdapter[K, V]) LoadBase(dataIter DataIterator) error {
+	return a.typed.LoadBase(ToTypedIterator[K, V](dataIter))
+}
+
+func (a *containerAdapter[K, V]) LoadInc(dataIter DataIterator) error {
+	return a.typed.LoadInc(ToTypedIterator[K, V](dataIter))
+}
+
+// ToTypedIterator adapts a DataIterator to TypedDataIterator, records with a key or value
+// of the wrong type are returned as errors and counted by the container's Tolerate
+func ToTypedIterator[K comparable, V any](iter DataIterator) TypedDataIterator[K, V] {
+	return &typedIterAdapter[K, V]{iter: iter}
+}
+
+type typedIterAdapter[K comparable, V any] struct {
+	iter DataIterator
+}
+
+func (t *typedIterAdapter[K, V]) HasNext() (bool, error) {
+	return t.iter.HasNext()
+}
+
+func (t *typedIterAdapter[K, V]) Next() (DataMode, K, V, error) {
+	var (
+		zk K
+		zv V
+	)
+	m, key, value, e := t.iter.Next()
+	if e != nil {
+		return m, zk, zv, e
+	}
+	k, e := typedKeyOf[K](key)
+	if e != nil {
+		return m, zk, zv, e
+	}
+	if m == DataModeDel && value == nil {
+		return m, k, zv, nil
+	}
+	v, e := typedValueOf[V](value)
+	if e != nil {
+		return m, zk, zv, e
+	}
+	return m, k, v, nil
+}
+
+// FromTypedIterator adapts a TypedDataIterator to DataIterator, keys are converted by Key
+func FromTypedIterator[K comparable, V any](iter TypedDataIterator[K, V]) DataIterator {
+	return &iterAdapter[K, V]{iter: iter}
+}
+
+type iterAdapter[K comparable, V any] struct {
+	iter TypedDataIterator[K, V]
+}
+
+func (t *iterAdapter[K, V]) HasNext() (bool, error) {
+	return t.iter.HasNext()
+}
+
+func (t *iterAdapter[K, V]) Next() (DataMode, MapKey, interface{}, error) {
+	m, k, v, e := t.iter.Next()
+	if e != nil {
+		return m, nil, nil, e
+	}
+	return m, Key(k), v, nil
+}
+
+func typedKeyOf[K comparable](key MapKey) (K, error) {
+	var zk K
+	if key == nil {
+		return zk, errors.New("key is nil")
+	}
+	k, ok := key.Value().(K)
+	if !ok {
+		return zk, fmt.Errorf("key type error, want[%T], got[%T]", zk, key.Value())
+	}
+	return k, nil
+}
+
+func typedValueOf[V any](value interface{}) (V, error) {
+	v, ok := value.(V)
+	if !ok {
+		var zv V
+		return zv, fmt.Errorf("value type error, want[%T], got[%T]", zv, value)
+	}
+	return v, nil
+}
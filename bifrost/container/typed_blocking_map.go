@@ -0,0 +1,131 @@
+package container
+
+import (
+	"fmt"
+	"sync"
+)
+
+// BlockingMap is the typed BlockingMapContainer, safe for concurrent reads and writes, supports increment
+type BlockingMap[K comparable, V any] struct {
+	mu        sync.RWMutex
+	innerData map[K]V
+	loadStats
+	validation
+	Tolerate float64
+}
+
+func CreateBlockingMap[K comparable, V any](tolerate float64) *BlockingMap[K, V] {
+	return &BlockingMap[K, V]{
+		innerData: make(map[K]V),
+		Tolerate:  tolerate,
+	}
+}
+
+func (bm *BlockingMap[K, V]) Get(key K) (V, error) {
+	bm.mu.RLock()
+	data, in := bm.innerData[key]
+	bm.mu.RUnlock()
+	if !in {
+		return data, NotExistErr
+	}
+	return data, nil
+}
+
+func (bm *BlockingMap[K, V]) Set(key K, value V) error {
+	bm.mu.Lock()
+	bm.innerData[key] = value
+	bm.mu.Unlock()
+	return nil
+}
+
+func (bm *BlockingMap[K, V]) Del(key K) {
+	bm.mu.Lock()
+	delete(bm.innerData, key)
+	bm.mu.Unlock()
+}
+
+func (bm *BlockingMap[K, V]) LoadBase(iterator TypedDataIterator[K, V]) error {
+	tmpM := make(map[K]V)
+	bm.resetStats()
+
+	b, e := iterator.HasNext()
+	if e != nil {
+		return fmt.Errorf("LoadBase Error, err[%s]", e.Error())
+	}
+	for b {
+		m, k, v, e := iterator.Next()
+		bm.addTotal()
+		if e != nil {
+			bm.addError()
+		} else {
+			switch m {
+			case DataModeAdd, DataModeUpdate:
+				tmpM[k] = v
+			case DataModeDel:
+				delete(tmpM, k)
+			}
+		}
+		b, e = iterator.HasNext()
+		if e != nil {
+			return fmt.Errorf("LoadBase Error, err[%s]", e.Error())
+		}
+	}
+	f := bm.errorRatio()
+	if f > bm.Tolerate {
+		return fmt.Errorf("LoadBase error, tolerate[%f], err[%f]", bm.Tolerate, f)
+	}
+	if err := bm.validate(&mapData[K, V]{m: tmpM, prev: bm.Len()}); err != nil {
+		return err
+	}
+	bm.mu.Lock()
+	bm.innerData = tmpM
+	bm.mu.Unlock()
+	return nil
+}
+
+func (bm *BlockingMap[K, V]) LoadInc(iterator TypedDataIterator[K, V]) error {
+	b, e := iterator.HasNext()
+	if e != nil {
+		return fmt.Errorf("LoadInc Error, err[%s]", e.Error())
+	}
+	for b {
+		m, k, v, e := iterator.Next()
+		bm.addTotal()
+		if e != nil {
+			bm.addError()
+		} else {
+			switch m {
+			case DataModeAdd, DataModeUpdate:
+				_ = bm.Set(k, v)
+			case DataModeDel:
+				bm.Del(k)
+			}
+		}
+		b, e = iterator.HasNext()
+		if e != nil {
+			return fmt.Errorf("LoadInc Error, err[%s]", e.Error())
+		}
+	}
+	f := bm.errorRatio()
+	if f > bm.Tolerate {
+		return fmt.Errorf("LoadInc error, tolerate[%f], err[%f]", bm.Tolerate, f)
+	}
+	return nil
+}
+
+func (bm *BlockingMap[K, V]) Len() int {
+	bm.mu.RLock()
+	defer bm.mu.RUnlock()
+	return len(bm.innerData)
+}
+
+// Range holds the read lock while iterating, f must not write to the map
+func (bm *BlockingMap[K, V]) Range(f func(key K, value V) bool) {
+	bm.mu.RLock()
+	defer bm.mu.RUnlock()
+	for k, v := range bm.innerData {
+		if !f(k, v) {
+			break
+		}
+	}
+}
@@ -0,0 +1,101 @@
+package container
+
+import (
+	"errors"
+	"fmt"
+	"sync/atomic"
+)
+
+// BufferedMap is the typed BufferedMapContainer, double buffered, only Get/LoadBase are supported
+type BufferedMap[K comparable, V any] struct {
+	innerData atomic.Pointer[map[K]V]
+	loadStats
+	validation
+	Tolerate float64
+}
+
+func CreateBufferedMap[K comparable, V any](tolerate float64) *BufferedMap[K, V] {
+	return &BufferedMap[K, V]{
+		Tolerate: tolerate,
+	}
+}
+
+func (bm *BufferedMap[K, V]) Get(key K) (V, error) {
+	m := bm.innerData.Load()
+	if m == nil {
+		var zv V
+		return zv, NotExistErr
+	}
+	data, in := (*m)[key]
+	if !in {
+		return data, NotExistErr
+	}
+	return data, nil
+}
+
+func (bm *BufferedMap[K, V]) LoadBase(iterator TypedDataIterator[K, V]) error {
+	bm.resetStats()
+	tmpM := make(map[K]V)
+	b, e := iterator.HasNext()
+	if e != nil {
+		return fmt.Errorf("LoadBase Error, err[%s]", e.Error())
+	}
+	for b {
+		m, k, v, e := iterator.Next()
+		bm.addTotal()
+		if e != nil {
+			bm.addError()
+		} else {
+			switch m {
+			case DataModeAdd, DataModeUpdate:
+				tmpM[k] = v
+			case DataModeDel:
+				delete(tmpM, k)
+			}
+		}
+		b, e = iterator.HasNext()
+		if e != nil {
+			return fmt.Errorf("LoadBase Error, err[%s]", e.Error())
+		}
+	}
+	f := bm.errorRatio()
+	if f > bm.Tolerate {
+		return fmt.Errorf("LoadBase error, tolerate[%f], err[%f]", bm.Tolerate, f)
+	}
+	if err := bm.validate(&mapData[K, V]{m: tmpM, prev: bm.Len()}); err != nil {
+		return err
+	}
+	bm.innerData.Store(&tmpM)
+	return nil
+}
+
+func (bm *BufferedMap[K, V]) Set(key K, value V) error {
+	return errors.New("not implement")
+}
+
+func (bm *BufferedMap[K, V]) Del(key K) {
+}
+
+func (bm *BufferedMap[K, V]) LoadInc(iterator TypedDataIterator[K, V]) error {
+	return errors.New("not implement")
+}
+
+func (bm *BufferedMap[K, V]) Len() int {
+	m := bm.innerData.Load()
+	if m == nil {
+		return 0
+	}
+	return len(*m)
+}
+
+func (bm *BufferedMap[K, V]) Range(f func(key K, value V) bool) {
+	m := bm.innerData.Load()
+	if m == nil {
+		return
+	}
+	for k, v := range *m {
+		if !f(k, v) {
+			break
+		}
+	}
+}
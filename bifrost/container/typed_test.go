@@ -0,0 +1,143 @@
+package container
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/smartystreets/goconvey/convey"
+)
+
+type testRecord[K comparable, V any] struct {
+	mode  DataMode
+	key   K
+	value V
+	err   error
+}
+
+type testTypedIter[K comparable, V any] struct {
+	current int
+	data    []testRecord[K, V]
+}
+
+func newTestTypedIter[K comparable, V any](data ...testRecord[K, V]) *testTypedIter[K, V] {
+	return &testTypedIter[K, V]{data: data}
+}
+
+func (it *testTypedIter[K, V]) HasNext() (bool, error) {
+	return it.current < len(it.data), nil
+}
+
+func (it *testTypedIter[K, V]) Next() (DataMode, K, V, error) {
+	r := it.data[it.current]
+	it.current++
+	return r.mode, r.key, r.value, r.err
+}
+
+func TestBufferedMap(t *testing.T) {
+	convey.Convey("Test BufferedMap Get", t, func() {
+		bm := CreateBufferedMap[int64, []int64](0.5)
+		_, e := bm.Get(1)
+		convey.So(e, convey.ShouldEqual, NotExistErr)
+
+		convey.So(bm.LoadBase(newTestTypedIter(
+			testRecord[int64, []int64]{key: 1, value: []int64{1, 2}},
+			testRecord[int64, []int64]{key: 2, value: []int64{3}},
+			testRecord[int64, []int64]{err: errors.New("parse error")},
+		)), convey.ShouldBeNil)
+		convey.So(bm.errorNum, convey.ShouldEqual, 1)
+		convey.So(bm.Len(), convey.ShouldEqual, 2)
+
+		v, e := bm.Get(1)
+		convey.So(e, convey.ShouldBeNil)
+		convey.So(v, convey.ShouldResemble, []int64{1, 2})
+
+		convey.So(bm.LoadBase(newTestTypedIter(
+			testRecord[int64, []int64]{err: errors.New("parse error")},
+		)), convey.ShouldNotBeNil)
+		convey.So(bm.Len(), convey.ShouldEqual, 2)
+		convey.So(bm.LoadInc(newTestTypedIter[int64, []int64]()), convey.ShouldNotBeNil)
+	})
+}
+
+func TestBlockingMap(t *testing.T) {
+	convey.Convey("Test BlockingMap LoadBase and LoadInc", t, func() {
+		bm := CreateBlockingMap[string, int](0)
+		convey.So(bm.LoadBase(newTestTypedIter(
+			testRecord[string, int]{key: "a", value: 1},
+			testRecord[string, int]{key: "b", value: 2},
+		)), convey.ShouldBeNil)
+		convey.So(bm.Len(), convey.ShouldEqual, 2)
+
+		convey.So(bm.LoadInc(newTestTypedIter(
+			testRecord[string, int]{mode: DataModeUpdate, key: "a", value: 10},
+			testRecord[string, int]{mode: DataModeDel, key: "b"},
+			testRecord[string, int]{mode: DataModeAdd, key: "c", value: 3},
+		)), convey.ShouldBeNil)
+		v, e := bm.Get("a")
+		convey.So(e, convey.ShouldBeNil)
+		convey.So(v, convey.ShouldEqual, 10)
+		_, e = bm.Get("b")
+		convey.So(e, convey.ShouldEqual, NotExistErr)
+
+		sum := 0
+		bm.Range(func(key string, value int) bool {
+			sum += value
+			return true
+		})
+		convey.So(sum, convey.ShouldEqual, 13)
+	})
+}
+
+func TestToContainer(t *testing.T) {
+	convey.Convey("Test typed container used through Container", t, func() {
+		c := ToContainer[string, string](CreateBlockingMap[string, string](0.5))
+		convey.So(c.LoadBase(NewTestDataIter([]string{
+			"1\t2",
+			"a\tb",
+		})), convey.ShouldBeNil)
+		convey.So(c.Len(), convey.ShouldEqual, 2)
+
+		v, e := c.Get(StrKey("a"))
+		convey.So(e, convey.ShouldBeNil)
+		convey.So(v, convey.ShouldEqual, "b")
+
+		_, e = c.Get(I64Key(1))
+		convey.So(e, convey.ShouldNotBeNil)
+		convey.So(c.Set(StrKey("c"), 1), convey.ShouldNotBeNil)
+		convey.So(c.Set(StrKey("c"), "d"), convey.ShouldBeNil)
+		c.Del(StrKey("a"), nil)
+		convey.So(c.Len(), convey.ShouldEqual, 2)
+
+		tc, ok := AsTyped[string, string](c)
+		convey.So(ok, convey.ShouldBeTrue)
+		s, e := tc.Get("c")
+		convey.So(e, convey.ShouldBeNil)
+		convey.So(s, convey.ShouldEqual, "d")
+
+		_, ok = AsTyped[int64, string](c)
+		convey.So(ok, convey.ShouldBeFalse)
+	})
+
+	convey.Convey("Test wrong key type counts as error", t, func() {
+		c := ToContainer[int64, string](CreateBufferedMap[int64, string](0.5))
+		convey.So(c.LoadBase(NewTestIntDataIter([]string{
+			"1\t2",
+			"4\tb",
+		})), convey.ShouldBeNil)
+		convey.So(c.LoadBase(NewTestDataIter([]string{
+			"1\t2",
+			"a\tb",
+		})), convey.ShouldNotBeNil)
+		convey.So(c.Len(), convey.ShouldEqual, 2)
+	})
+
+	convey.Convey("Test FromTypedIterator", t, func() {
+		bm := CreateBlockingMapContainer(1, 0)
+		convey.So(bm.LoadBase(FromTypedIterator[int64, string](newTestTypedIter(
+			testRecord[int64, string]{key: 7, value: "seven"},
+		))), convey.ShouldBeNil)
+		v, e := bm.Get(I64Key(7))
+		convey.So(e, convey.ShouldBeNil)
+		convey.So(v, convey.ShouldEqual, "seven")
+	})
+}
@@ -0,0 +1,169 @@
+package container
+
+import (
+	"fmt"
+	"sync/atomic"
+)
+
+// BaseData is the data of a base load, given to the validators before it replaces the current data
+type BaseData interface {
+	// Len is the number of keys of the new data
+	Len() int
+	// PrevLen is the number of keys of the current data
+	PrevLen() int
+	Range(f func(key, value interface{}) bool)
+}
+
+// Validator checks the data of a base load, a non-nil error rejects it
+type Validator func(data BaseData) error
+
+// Validatable is implemented by the containers running validators in LoadBase. A rejected load
+// keeps the current data, LoadBase returns a *ValidationError.
+type Validatable interface {
+	// SetValidators sets the validators, call it before the first load
+	SetValidators(validators ...Validator)
+	// ValidationFailures returns the number of base loads rejected by the validators
+	ValidationFailures() int64
+}
+
+// ValidationError is returned by LoadBase when a validator rejects the new data
+type ValidationError struct {
+	Len     int
+	PrevLen int
+	Err     error
+}
+
+func (e *ValidationError) Error() string {
+	return fmt.Sprintf("LoadBase validation error, len[%d], prev_len[%d], err[%s]", e.Len, e.PrevLen, e.Err.Error())
+}
+
+func (e *ValidationError) Unwrap() error {
+	return e.Err
+}
+
+// MinLen rejects the data with less than n keys
+func MinLen(n int) Validator {
+	return func(data BaseData) error {
+		if data.Len() < n {
+			return fmt.Errorf("len[%d] is less than min[%d]", data.Len(), n)
+		}
+		return nil
+	}
+}
+
+// MaxLen rejects the data with more than n keys
+func MaxLen(n int) Validator {
+	return func(data BaseData) error {
+		if data.Len() > n {
+			return fmt.Errorf("len[%d] is more than max[%d]", data.Len(), n)
+		}
+		return nil
+	}
+}
+
+// MaxShrink rejects the data which lost more than percent% of the keys of the current data,
+// the first load is never rejected
+func MaxShrink(percent float64) Validator {
+	return func(data BaseData) error {
+		prev := data.PrevLen()
+		if prev == 0 || data.Len() >= prev {
+			return nil
+		}
+		shrink := float64(prev-data.Len()) * 100 / float64(prev)
+		if shrink > percent {
+			return fmt.Errorf("shrink[%.2f%%] is more than max[%.2f%%]", shrink, percent)
+		}
+		return nil
+	}
+}
+
+// Predicate rejects the data if f returns false for any record
+func Predicate(f func(key, value interface{}) bool) Validator {
+	return func(data BaseData) error {
+		var bad interface{}
+		found := false
+		data.Range(func(key, value interface{}) bool {
+			if !f(key, value) {
+				bad, found = key, true
+				return false
+			}
+			return true
+		})
+		if found {
+			return fmt.Errorf("predicate failed, key[%v]", bad)
+		}
+		return nil
+	}
+}
+
+// validation is embedded by the containers implementing Validatable
+type validation struct {
+	validators []Validator
+	failures   int64
+}
+
+func (v *validation) SetValidators(validators ...Validator) {
+	v.validators = validators
+}
+
+func (v *validation) ValidationFailures() int64 {
+	return atomic.LoadInt64(&v.failures)
+}
+
+func (v *validation) validate(data BaseData) error {
+	for _, f := range v.validators {
+		if err := f(data); err != nil {
+			atomic.AddInt64(&v.failures, 1)
+			return &ValidationError{Len: data.Len(), PrevLen: data.PrevLen(), Err: err}
+		}
+	}
+	return nil
+}
+
+// mapData is the BaseData of the typed map based containers
+type mapData[K comparable, V any] struct {
+	m    map[K]V
+	prev int
+}
+
+func (md *mapData[K, V]) Len() int {
+	return len(md.m)
+}
+
+func (md *mapData[K, V]) PrevLen() int {
+	return md.prev
+}
+
+func (md *mapData[K, V]) Range(f func(key, value interface{}) bool) {
+	for k, v := range md.m {
+		if !f(k, v) {
+			return
+		}
+	}
+}
+
+// mapsData is the BaseData of the untyped map based containers, the keys are spread over the maps
+type mapsData struct {
+	maps []*keyedMap[interface{}]
+	prev int
+}
+
+func (ms *mapsData) Len() int {
+	l := 0
+	for _, m := range ms.maps {
+		l += m.len()
+	}
+	return l
+}
+
+func (ms *mapsData) PrevLen() int {
+	return ms.prev
+}
+
+func (ms *mapsData) Range(f func(key, value interface{}) bool) {
+	for _, m := range ms.maps {
+		if !m.rangeAll(f) {
+			return
+		}
+	}
+}
@@ -0,0 +1,64 @@
+package container
+
+import (
+	"errors"
+	"strconv"
+	"testing"
+
+	"github.com/smartystreets/goconvey/convey"
+)
+
+func records(n int) []string {
+	data := make([]string, 0, n)
+	for i := 0; i < n; i++ {
+		data = append(data, strconv.Itoa(i)+"\tv"+strconv.Itoa(i))
+	}
+	return data
+}
+
+func TestValidators(t *testing.T) {
+	convey.Convey("Test validators of LoadBase", t, func() {
+		containers := map[string]Container{
+			"blocking_map":   CreateBlockingMapContainer(4, 0),
+			"buffered_map":   &BufferedMapContainer{},
+			"buffered_klist": CreateBufferedKListContainer(),
+			"typed_blocking": ToContainer[string, string](CreateBlockingMap[string, string](0)),
+			"typed_buffered": ToContainer[string, string](CreateBufferedMap[string, string](0)),
+		}
+		for _, c := range containers {
+			v := c.(Validatable)
+			v.SetValidators(MinLen(2), MaxLen(10), MaxShrink(50))
+			convey.So(c.LoadBase(NewTestDataIter(records(10))), convey.ShouldBeNil)
+
+			// too few, the previous data is kept
+			err := c.LoadBase(NewTestDataIter(records(1)))
+			var ve *ValidationError
+			convey.So(errors.As(err, &ve), convey.ShouldBeTrue)
+			convey.So(ve.Len, convey.ShouldEqual, 1)
+			convey.So(ve.PrevLen, convey.ShouldEqual, 10)
+			convey.So(c.Len(), convey.ShouldEqual, 10)
+
+			// shrinks by 60%
+			err = c.LoadBase(NewTestDataIter(records(4)))
+			convey.So(err.Error(), convey.ShouldEqual, "LoadBase validation error, len[4], prev_len[10], err[shrink[60.00%] is more than max[50.00%]]")
+			convey.So(c.LoadBase(NewTestDataIter(records(11))), convey.ShouldNotBeNil)
+			convey.So(v.ValidationFailures(), convey.ShouldEqual, 3)
+
+			convey.So(c.LoadBase(NewTestDataIter(records(5))), convey.ShouldBeNil)
+			convey.So(c.Len(), convey.ShouldEqual, 5)
+		}
+	})
+
+	convey.Convey("Test Predicate", t, func() {
+		c := CreateBlockingMapContainer(1, 0)
+		c.SetValidators(Predicate(func(key, value interface{}) bool {
+			return value != ""
+		}))
+		convey.So(c.LoadBase(NewTestDataIter([]string{"a\ta", "b\tb"})), convey.ShouldBeNil)
+		err := c.LoadBase(NewTestDataIter([]string{"a\ta", "c\t"}))
+		convey.So(err.Error(), convey.ShouldEqual, "LoadBase validation error, len[2], prev_len[2], err[predicate failed, key[c]]")
+		v, err := c.Get(StrKey("b"))
+		convey.So(err, convey.ShouldBeNil)
+		convey.So(v, convey.ShouldEqual, "b")
+	})
+}
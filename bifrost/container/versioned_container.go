@@ -0,0 +1,384 @@
+package container
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Describer is implemented by the iterators describing the source of their data, such as the
+// streamers, VersionedContainer records it with each version
+type Describer interface {
+	Describe() string
+}
+
+// PinIncMode is what VersionedContainer does with the inc loads while a version is pinned
+type PinIncMode int
+
+const (
+	// PinIncApply applies the inc loads to the pinned version
+	PinIncApply PinIncMode = iota
+	// PinIncPause keeps the pinned version unchanged
+	PinIncPause
+)
+
+// Version describes a base version kept by VersionedContainer
+type Version struct {
+	ID       int64     `json:"id"`
+	LoadTime time.Time `json:"load_time"`
+	Source   string    `json:"source"`
+	Len      int       `json:"len"`
+	Active   bool      `json:"active"`
+	Pinned   bool      `json:"pinned"`
+}
+
+type version struct {
+	id       int64
+	loadTime time.Time
+	source   string
+	c        Container
+}
+
+// VersionedContainer keeps the last N base loads, each in its own container created by the
+// factory, and serves one of them. The latest version is served unless a version is pinned,
+// Rollback serves an older version and drops the newer ones. Inc loads, Set and Del change
+// the served version.
+//
+// While a version is pinned the base loads are kept without being served, and the inc records,
+// Set and Del included, are applied to the pinned version or not depending on PinIncMode. They
+// are also buffered, then replayed on the latest version by Unpin, the buffer is dropped by each base load since
+// the new base already has the changes. Pins are meant to be short, the buffer is unbounded.
+type VersionedContainer struct {
+	create  func() Container
+	keep    int
+	incMode PinIncMode
+	validation
+
+	mu       sync.RWMutex // guards the fields below, Get only needs the read lock
+	versions []*version   // the oldest first
+	active   *version
+	pinned   bool
+	nextID   int64
+
+	loadMu  sync.Mutex // serializes LoadInc, Set, Del, the swap of LoadBase and the version operations
+	pending []record   // the inc records received while pinned
+}
+
+// CreateVersionedContainer keeps keep versions (at least 1), each created by create
+func CreateVersionedContainer(keep int, incMode PinIncMode, create func() Container) *VersionedContainer {
+	if keep <= 0 {
+		keep = 1
+	}
+	return &VersionedContainer{
+		create:  create,
+		keep:    keep,
+		incMode: incMode,
+		nextID:  1,
+	}
+}
+
+func (vc *VersionedContainer) current() Container {
+	vc.mu.RLock()
+	defer vc.mu.RUnlock()
+	if vc.active == nil {
+		return nil
+	}
+	return vc.active.c
+}
+
+func (vc *VersionedContainer) Get(key MapKey) (interface{}, error) {
+	c := vc.current()
+	if c == nil {
+		return nil, NotExistErr
+	}
+	return c.Get(key)
+}
+
+func (vc *VersionedContainer) GetInt64(key int64) (interface{}, error) {
+	c := vc.current()
+	if c == nil {
+		return nil, NotExistErr
+	}
+	return GetInt64(c, key)
+}
+
+func (vc *VersionedContainer) GetString(key string) (interface{}, error) {
+	c := vc.current()
+	if c == nil {
+		return nil, NotExistErr
+	}
+	return GetString(c, key)
+}
+
+// Set changes the served version, see VersionedContainer for a pinned one
+func (vc *VersionedContainer) Set(key MapKey, value interface{}) error {
+	vc.loadMu.Lock()
+	defer vc.loadMu.Unlock()
+	vc.mu.RLock()
+	active, pinned := vc.active, vc.pinned
+	vc.mu.RUnlock()
+	if active == nil {
+		return errors.New("no version loaded")
+	}
+	if pinned {
+		vc.pending = append(vc.pending, record{mode: DataModeAdd, key: key, value: value})
+		if vc.incMode == PinIncPause {
+			return nil
+		}
+	}
+	return active.c.Set(key, value)
+}
+
+// Del changes the served version, see VersionedContainer for a pinned one
+func (vc *VersionedContainer) Del(key MapKey, value interface{}) {
+	vc.loadMu.Lock()
+	defer vc.loadMu.Unlock()
+	vc.mu.RLock()
+	active, pinned := vc.active, vc.pinned
+	vc.mu.RUnlock()
+	if active == nil {
+		return
+	}
+	if pinned {
+		vc.pending = append(vc.pending, record{mode: DataModeDel, key: key, value: value})
+		if vc.incMode == PinIncPause {
+			return
+		}
+	}
+	active.c.Del(key, value)
+}
+
+func (vc *VersionedContainer) Len() int {
+	c := vc.current()
+	if c == nil {
+		return 0
+	}
+	return c.Len()
+}
+
+func (vc *VersionedContainer) Range(f func(key, value interface{}) bool) {
+	if c := vc.current(); c != nil {
+		c.Range(f)
+	}
+}
+
+// LoadBase loads a new version into a new container, it's served at once unless a version is
+// pinned. The validators see the latest version as the previous data.
+func (vc *VersionedContainer) LoadBase(dataIter DataIterator) error {
+	c := vc.create()
+	if err := c.LoadBase(dataIter); err != nil {
+		return err
+	}
+	vc.mu.RLock()
+	prev := 0
+	if n := len(vc.versions); n > 0 {
+		prev = vc.versions[n-1].c.Len()
+	}
+	vc.mu.RUnlock()
+	if err := vc.validate(&containerData{c: c, prev: prev}); err != nil {
+		return err
+	}
+	v := &version{loadTime: time.Now(), c: c}
+	if d, ok := dataIter.(Describer); ok {
+		v.source = d.Describe()
+	}
+
+	vc.loadMu.Lock()
+	defer vc.loadMu.Unlock()
+	vc.mu.Lock()
+	defer vc.mu.Unlock()
+	v.id = vc.nextID
+	vc.nextID++
+	vc.versions = append(vc.versions, v)
+	if !vc.pinned {
+		vc.active = v
+	}
+	vc.pending = nil
+	vc.trim()
+	return nil
+}
+
+// trim drops the oldest versions beyond keep, except the served one and the latest one, so a
+// pinned version may be kept besides keep versions. It must be called with vc.mu held.
+func (vc *VersionedContainer) trim() {
+	for len(vc.versions) > vc.keep {
+		i := 0
+		if vc.versions[0] == vc.active {
+			i = 1
+		}
+		if i == len(vc.versions)-1 {
+			return
+		}
+		vc.versions = append(vc.versions[:i], vc.versions[i+1:]...)
+	}
+}
+
+// LoadInc applies the records to the served version, see VersionedContainer for a pinned one
+func (vc *VersionedContainer) LoadInc(dataIter DataIterator) error {
+	vc.loadMu.Lock()
+	defer vc.loadMu.Unlock()
+	vc.mu.RLock()
+	active, pinned := vc.active, vc.pinned
+	vc.mu.RUnlock()
+	if active == nil {
+		return errors.New("no version loaded")
+	}
+	if !pinned {
+		return active.c.LoadInc(dataIter)
+	}
+	iter := &bufferedIter{DataIterator: dataIter}
+	if vc.incMode == PinIncApply {
+		err := active.c.LoadInc(iter)
+		vc.pending = append(vc.pending, iter.records...)
+		return err
+	}
+	for {
+		b, err := iter.HasNext()
+		if err != nil {
+			return fmt.Errorf("LoadInc Error, err[%s]", err.Error())
+		}
+		if !b {
+			break
+		}
+		_, _, _, _ = iter.Next()
+	}
+	vc.pending = append(vc.pending, iter.records...)
+	return nil
+}
+
+// Versions returns the kept versions, the oldest first
+func (vc *VersionedContainer) Versions() []Version {
+	vc.mu.RLock()
+	defer vc.mu.RUnlock()
+	versions := make([]Version, 0, len(vc.versions))
+	for _, v := range vc.versions {
+		versions = append(versions, Version{
+			ID:       v.id,
+			LoadTime: v.loadTime,
+			Source:   v.source,
+			Len:      v.c.Len(),
+			Active:   v == vc.active,
+			Pinned:   v == vc.active && vc.pinned,
+		})
+	}
+	return versions
+}
+
+// Rollback serves the version id and drops the newer versions, the next base load is served
+// as usual. It unpins the pinned version.
+func (vc *VersionedContainer) Rollback(id int64) error {
+	vc.loadMu.Lock()
+	defer vc.loadMu.Unlock()
+	vc.mu.Lock()
+	defer vc.mu.Unlock()
+	i := vc.find(id)
+	if i < 0 {
+		return fmt.Errorf("version[%d] not exist", id)
+	}
+	vc.active = vc.versions[i]
+	vc.versions = vc.versions[:i+1]
+	vc.pinned = false
+	vc.pending = nil
+	return nil
+}
+
+// Pin serves the version id until Unpin, the base loads in between are kept but not served
+func (vc *VersionedContainer) Pin(id int64) error {
+	vc.loadMu.Lock()
+	defer vc.loadMu.Unlock()
+	vc.mu.Lock()
+	defer vc.mu.Unlock()
+	i := vc.find(id)
+	if i < 0 {
+		return fmt.Errorf("version[%d] not exist", id)
+	}
+	vc.active = vc.versions[i]
+	vc.pinned = true
+	return nil
+}
+
+// Unpin serves the latest version again, with the inc records received while pinned replayed
+// on it unless they were already applied to it
+func (vc *VersionedContainer) Unpin() error {
+	vc.loadMu.Lock()
+	defer vc.loadMu.Unlock()
+	vc.mu.RLock()
+	pinned, active := vc.pinned, vc.active
+	var latest *version
+	if n := len(vc.versions); n > 0 {
+		latest = vc.versions[n-1]
+	}
+	vc.mu.RUnlock()
+	if !pinned || latest == nil {
+		return errors.New("no version pinned")
+	}
+	var err error
+	if len(vc.pending) > 0 && (latest != active || vc.incMode == PinIncPause) {
+		err = latest.c.LoadInc(&replayIter{records: vc.pending})
+	}
+	vc.pending = nil
+	vc.mu.Lock()
+	vc.active = latest
+	vc.pinned = false
+	vc.mu.Unlock()
+	return err
+}
+
+// find must be called with vc.mu held
+func (vc *VersionedContainer) find(id int64) int {
+	for i, v := range vc.versions {
+		if v.id == id {
+			return i
+		}
+	}
+	return -1
+}
+
+// containerData is the BaseData of a loaded container
+type containerData struct {
+	c    Container
+	prev int
+}
+
+func (cd *containerData) Len() int {
+	return cd.c.Len()
+}
+
+func (cd *containerData) PrevLen() int {
+	return cd.prev
+}
+
+func (cd *containerData) Range(f func(key, value interface{}) bool) {
+	cd.c.Range(f)
+}
+
+// bufferedIter keeps the records read from the iterator
+type bufferedIter struct {
+	DataIterator
+	records []record
+}
+
+func (bi *bufferedIter) Next() (DataMode, MapKey, interface{}, error) {
+	m, k, v, e := bi.DataIterator.Next()
+	if e == nil && k != nil {
+		bi.records = append(bi.records, record{mode: m, key: k, value: v})
+	}
+	return m, k, v, e
+}
+
+// replayIter iterates the buffered records, their keys are the MapKeys
+type replayIter struct {
+	records []record
+	i       int
+}
+
+func (ri *replayIter) HasNext() (bool, error) {
+	return ri.i < len(ri.records), nil
+}
+
+func (ri *replayIter) Next() (DataMode, MapKey, interface{}, error) {
+	r := ri.records[ri.i]
+	ri.i++
+	return r.mode, r.key.(MapKey), r.value, nil
+}
@@ -0,0 +1,173 @@
+package container
+
+import (
+	"testing"
+
+	"github.com/smartystreets/goconvey/convey"
+)
+
+type describedIter struct {
+	DataIterator
+	source string
+}
+
+func (di *describedIter) Describe() string {
+	return di.source
+}
+
+func createVersioned(mode PinIncMode) *VersionedContainer {
+	return CreateVersionedContainer(3, mode, func() Container {
+		return CreateBlockingMapContainer(1, 0)
+	})
+}
+
+func versionIDs(vc *VersionedContainer) []int64 {
+	ids := make([]int64, 0)
+	for _, v := range vc.Versions() {
+		ids = append(ids, v.ID)
+	}
+	return ids
+}
+
+func TestVersionedContainer(t *testing.T) {
+	convey.Convey("Test versions and rollback", t, func() {
+		vc := createVersioned(PinIncApply)
+		_, err := vc.Get(StrKey("a"))
+		convey.So(err, convey.ShouldEqual, NotExistErr)
+		convey.So(vc.LoadInc(NewTestDataIter([]string{"a\t1"})), convey.ShouldNotBeNil)
+
+		for i := 1; i <= 4; i++ {
+			iter := &describedIter{DataIterator: NewTestDataIter(records(i)), source: "test"}
+			convey.So(vc.LoadBase(iter), convey.ShouldBeNil)
+		}
+		convey.So(versionIDs(vc), convey.ShouldResemble, []int64{2, 3, 4})
+		versions := vc.Versions()
+		convey.So(versions[2].Active, convey.ShouldBeTrue)
+		convey.So(versions[2].Len, convey.ShouldEqual, 4)
+		convey.So(versions[2].Source, convey.ShouldEqual, "test")
+		convey.So(vc.Len(), convey.ShouldEqual, 4)
+
+		convey.So(vc.Rollback(1).Error(), convey.ShouldEqual, "version[1] not exist")
+		convey.So(vc.Rollback(2), convey.ShouldBeNil)
+		convey.So(versionIDs(vc), convey.ShouldResemble, []int64{2})
+		convey.So(vc.Len(), convey.ShouldEqual, 2)
+		convey.So(vc.Unpin().Error(), convey.ShouldEqual, "no version pinned")
+
+		// the next base load is served again
+		convey.So(vc.LoadBase(NewTestDataIter(records(5))), convey.ShouldBeNil)
+		convey.So(versionIDs(vc), convey.ShouldResemble, []int64{2, 5})
+		convey.So(vc.Len(), convey.ShouldEqual, 5)
+	})
+
+	convey.Convey("Test pin with the inc loads applied", t, func() {
+		vc := createVersioned(PinIncApply)
+		convey.So(vc.LoadBase(NewTestDataIter(records(2))), convey.ShouldBeNil)
+		convey.So(vc.Pin(1), convey.ShouldBeNil)
+		convey.So(vc.LoadBase(NewTestDataIter(records(3))), convey.ShouldBeNil)
+		convey.So(vc.LoadBase(NewTestDataIter(records(4))), convey.ShouldBeNil)
+		convey.So(vc.LoadBase(NewTestDataIter(records(5))), convey.ShouldBeNil)
+		// the pinned version is never dropped
+		convey.So(versionIDs(vc), convey.ShouldResemble, []int64{1, 3, 4})
+		convey.So(vc.Versions()[0].Pinned, convey.ShouldBeTrue)
+		convey.So(vc.Len(), convey.ShouldEqual, 2)
+
+		convey.So(vc.LoadInc(NewTestDataIter([]string{"x\tx"})), convey.ShouldBeNil)
+		convey.So(vc.Set(StrKey("s"), "s"), convey.ShouldBeNil)
+		vc.Del(StrKey("0"), nil)
+		v, err := vc.Get(StrKey("x"))
+		convey.So(err, convey.ShouldBeNil)
+		convey.So(v, convey.ShouldEqual, "x")
+		v, err = vc.GetString("x")
+		convey.So(err, convey.ShouldBeNil)
+		convey.So(v, convey.ShouldEqual, "x")
+		v, err = vc.Get(StrKey("s"))
+		convey.So(err, convey.ShouldBeNil)
+		convey.So(v, convey.ShouldEqual, "s")
+		_, err = vc.Get(StrKey("0"))
+		convey.So(err, convey.ShouldEqual, NotExistErr)
+
+		// replayed on the latest version
+		convey.So(vc.Unpin(), convey.ShouldBeNil)
+		convey.So(vc.Len(), convey.ShouldEqual, 6)
+		v, err = vc.Get(StrKey("x"))
+		convey.So(err, convey.ShouldBeNil)
+		convey.So(v, convey.ShouldEqual, "x")
+		v, err = vc.Get(StrKey("s"))
+		convey.So(err, convey.ShouldBeNil)
+		convey.So(v, convey.ShouldEqual, "s")
+		_, err = vc.Get(StrKey("0"))
+		convey.So(err, convey.ShouldEqual, NotExistErr)
+		convey.So(vc.Versions()[2].Active, convey.ShouldBeTrue)
+	})
+
+	convey.Convey("Test pin with the inc loads paused", t, func() {
+		vc := createVersioned(PinIncPause)
+		convey.So(vc.LoadBase(NewTestDataIter(records(2))), convey.ShouldBeNil)
+		convey.So(vc.Pin(1), convey.ShouldBeNil)
+		convey.So(vc.LoadInc(NewTestDataIter([]string{"x\tx"})), convey.ShouldBeNil)
+		convey.So(vc.Set(StrKey("s"), "s"), convey.ShouldBeNil)
+		vc.Del(StrKey("0"), nil)
+		_, err := vc.Get(StrKey("x"))
+		convey.So(err, convey.ShouldEqual, NotExistErr)
+		_, err = vc.Get(StrKey("s"))
+		convey.So(err, convey.ShouldEqual, NotExistErr)
+		_, err = vc.Get(StrKey("0"))
+		convey.So(err, convey.ShouldBeNil)
+
+		convey.So(vc.Unpin(), convey.ShouldBeNil)
+		v, err := vc.Get(StrKey("x"))
+		convey.So(err, convey.ShouldBeNil)
+		convey.So(v, convey.ShouldEqual, "x")
+		v, err = vc.Get(StrKey("s"))
+		convey.So(err, convey.ShouldBeNil)
+		convey.So(v, convey.ShouldEqual, "s")
+		_, err = vc.Get(StrKey("0"))
+		convey.So(err, convey.ShouldEqual, NotExistErr)
+
+		// a base load drops the paused records, the new base has them
+		convey.So(vc.Pin(1), convey.ShouldBeNil)
+		convey.So(vc.LoadInc(NewTestDataIter([]string{"y\ty"})), convey.ShouldBeNil)
+		convey.So(vc.LoadBase(NewTestDataIter(records(3))), convey.ShouldBeNil)
+		convey.So(vc.Unpin(), convey.ShouldBeNil)
+		_, err = vc.Get(StrKey("y"))
+		convey.So(err, convey.ShouldEqual, NotExistErr)
+		convey.So(vc.Len(), convey.ShouldEqual, 3)
+	})
+
+	convey.Convey("Test Unpin without versions", t, func() {
+		vc := createVersioned(PinIncApply)
+		convey.So(vc.Unpin().Error(), convey.ShouldEqual, "no version pinned")
+	})
+
+	convey.Convey("Test a pin doesn't drop the latest version when keeping one", t, func() {
+		vc := CreateVersionedContainer(1, PinIncPause, func() Container {
+			return CreateBlockingMapContainer(1, 0)
+		})
+		convey.So(vc.LoadBase(NewTestDataIter(records(2))), convey.ShouldBeNil)
+		convey.So(vc.Pin(1), convey.ShouldBeNil)
+		convey.So(vc.LoadBase(NewTestDataIter(records(3))), convey.ShouldBeNil)
+		convey.So(vc.LoadBase(NewTestDataIter(records(4))), convey.ShouldBeNil)
+		convey.So(versionIDs(vc), convey.ShouldResemble, []int64{1, 3})
+		convey.So(vc.LoadInc(NewTestDataIter([]string{"x\tx"})), convey.ShouldBeNil)
+		convey.So(vc.Len(), convey.ShouldEqual, 2)
+
+		convey.So(vc.Unpin(), convey.ShouldBeNil)
+		convey.So(vc.Len(), convey.ShouldEqual, 5)
+		v, err := vc.Get(StrKey("x"))
+		convey.So(err, convey.ShouldBeNil)
+		convey.So(v, convey.ShouldEqual, "x")
+
+		// the unpinned version is dropped by the next base load
+		convey.So(vc.LoadBase(NewTestDataIter(records(5))), convey.ShouldBeNil)
+		convey.So(versionIDs(vc), convey.ShouldResemble, []int64{4})
+	})
+
+	convey.Convey("Test validators of VersionedContainer", t, func() {
+		vc := createVersioned(PinIncApply)
+		vc.SetValidators(MaxShrink(50))
+		convey.So(vc.LoadBase(NewTestDataIter(records(10))), convey.ShouldBeNil)
+		convey.So(vc.LoadBase(NewTestDataIter(records(2))), convey.ShouldNotBeNil)
+		convey.So(versionIDs(vc), convey.ShouldResemble, []int64{1})
+		convey.So(vc.ValidationFailures(), convey.ShouldEqual, 1)
+	})
+}
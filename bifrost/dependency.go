@@ -0,0 +1,202 @@
+package bifrost
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"strings"
+
+	"github.com/Mintegral-official/mtggokit/bifrost/streamer"
+)
+
+// RegisterOption configures a streamer added by Register
+type RegisterOption func(*registration)
+
+type registration struct {
+	deps []string
+}
+
+// DependsOn declares the streamers the registered one depends on, see dependencies
+func DependsOn(names ...string) RegisterOption {
+	return func(r *registration) {
+		r.deps = append(r.deps, names...)
+	}
+}
+
+// dependencies returns the names a streamer depends on, given by DependsOn and by
+// streamer.Dependent. Bifrost starts a streamer after the first successful base load of its
+// dependencies reported to their observers, or after their UpdateData returns if they aren't
+// streamer.Observable, and reloads its base after every successful base load of any of them.
+// A dependency whose UpdateData fails doesn't hold back its dependents.
+func dependencies(s streamer.Streamer, opts []RegisterOption) []string {
+	r := &registration{}
+	for _, opt := range opts {
+		opt(r)
+	}
+	if d, ok := s.(streamer.Dependent); ok {
+		r.deps = append(r.deps, d.DependsOn()...)
+	}
+	seen := make(map[string]bool, len(r.deps))
+	deps := make([]string, 0, len(r.deps))
+	for _, name := range r.deps {
+		if !seen[name] {
+			seen[name] = true
+			deps = append(deps, name)
+		}
+	}
+	return deps
+}
+
+// sortStreamers returns the names of the streamers in an order where every streamer follows
+// its dependencies, it must be called with l.mu held
+func (l *Bifrost) sortStreamers() ([]string, error) {
+	names := make([]string, 0, len(l.DataStreamers))
+	for name := range l.DataStreamers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	pending := make(map[string]int, len(names))
+	dependents := make(map[string][]string)
+	for _, name := range names {
+		for _, dep := range l.deps[name] {
+			if _, ok := l.DataStreamers[dep]; !ok {
+				return nil, errors.New("streamer[" + name + "] depends on not found streamer[" + dep + "]")
+			}
+			pending[name]++
+			dependents[dep] = append(dependents[dep], name)
+		}
+	}
+	order := make([]string, 0, len(names))
+	for _, name := range names {
+		if pending[name] == 0 {
+			order = append(order, name)
+		}
+	}
+	for i := 0; i < len(order); i++ {
+		for _, d := range dependents[order[i]] {
+			if pending[d]--; pending[d] == 0 {
+				order = append(order, d)
+			}
+		}
+	}
+	if len(order) < len(names) {
+		// the streamers left are in a cycle or depend on one, only the former are reported
+		cycle := make([]string, 0, len(names)-len(order))
+		for _, name := range names {
+			if pending[name] > 0 && l.reaches(name, name, make(map[string]bool)) {
+				cycle = append(cycle, name)
+			}
+		}
+		return nil, errors.New("dependency cycle among streamers[" + strings.Join(cycle, ",") + "]")
+	}
+	return order, nil
+}
+
+// reaches reports whether from depends on to, directly or not, it must be called with l.mu held
+func (l *Bifrost) reaches(from, to string, seen map[string]bool) bool {
+	for _, dep := range l.deps[from] {
+		if dep == to {
+			return true
+		}
+		if !seen[dep] {
+			seen[dep] = true
+			if l.reaches(dep, to, seen) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// markLoaded releases the dependents of name waiting for its first base load
+func (l *Bifrost) markLoaded(name string) {
+	l.mu.RLock()
+	r := l.runnings[name]
+	l.mu.RUnlock()
+	if r != nil {
+		r.markLoaded()
+	}
+}
+
+// dependentsOf returns the streamers depending on name, it must be called with l.mu held
+func (l *Bifrost) dependentsOf(name string) []string {
+	var names []string
+	for n, deps := range l.deps {
+		for _, dep := range deps {
+			if dep == name {
+				names = append(names, n)
+				break
+			}
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// propagate asks the dependents of name to reload their base, the requests made while a reload
+// is pending are merged. The dependents whose first load hasn't begun are skipped, that load
+// sees the new data anyway.
+func (l *Bifrost) propagate(name string) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	for _, d := range l.dependentsOf(name) {
+		r := l.runnings[d]
+		if r == nil || r.reload == nil {
+			continue
+		}
+		select {
+		case <-r.loading:
+		default:
+			continue
+		}
+		select {
+		case r.reload <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// waitDeps waits for the first base load of the dependencies, or for their UpdateData to fail,
+// it returns false if ctx is done first
+func waitDeps(ctx context.Context, deps []*running) bool {
+	for _, d := range deps {
+		select {
+		case <-d.loaded:
+			continue
+		case <-d.ready:
+		case <-ctx.Done():
+			return false
+		}
+		if d.err != nil {
+			continue
+		}
+		select {
+		case <-d.loaded:
+		case <-ctx.Done():
+			return false
+		}
+	}
+	return true
+}
+
+// reloadLoop reloads the base of a dependent streamer on the requests of propagate, after its
+// first load
+func (l *Bifrost) reloadLoop(ctx context.Context, name string, rl streamer.Reloader, r *running) {
+	defer close(r.reloadDone)
+	select {
+	case <-r.ready:
+	case <-ctx.Done():
+		return
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-r.reload:
+			if err := rl.Reload(ctx, streamer.LoadKindBase); err != nil && l.logger != nil {
+				l.logger.Warnf("streamer[%s] reload after its dependencies error: %s", name, err.Error())
+			}
+		}
+	}
+}
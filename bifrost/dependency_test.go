@@ -0,0 +1,220 @@
+package bifrost
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Mintegral-official/mtggokit/bifrost/container"
+	"github.com/Mintegral-official/mtggokit/bifrost/streamer"
+	"github.com/smartystreets/goconvey/convey"
+)
+
+// baseStreamer loads its "k\tv" records as the base and reports the loads
+type baseStreamer struct {
+	FakeStreamer
+	mu       sync.Mutex
+	records  []string
+	c        container.Container
+	observer streamer.Observer
+}
+
+func (bs *baseStreamer) GetContainer() container.Container {
+	return bs.c
+}
+
+func (bs *baseStreamer) SetObserver(o streamer.Observer) {
+	bs.observer = o
+}
+
+func (bs *baseStreamer) UpdateData(ctx context.Context) error {
+	return bs.Reload(ctx, streamer.LoadKindBase)
+}
+
+func (bs *baseStreamer) Reload(ctx context.Context, kind streamer.LoadKind) error {
+	bs.mu.Lock()
+	defer bs.mu.Unlock()
+	results := make([]streamer.ParserResult, 0, len(bs.records))
+	for _, r := range bs.records {
+		kv := strings.SplitN(r, "\t", 2)
+		results = append(results, streamer.ParserResult{Key: container.StrKey(kv[0]), Value: kv[1]})
+	}
+	err := bs.c.LoadBase(&resultsIter{results: results})
+	if bs.observer != nil {
+		bs.observer(streamer.LoadEvent{Kind: streamer.LoadKindBase, Start: time.Now(), Err: err})
+	}
+	return err
+}
+
+func (bs *baseStreamer) setRecords(records ...string) {
+	bs.mu.Lock()
+	bs.records = records
+	bs.mu.Unlock()
+}
+
+// asyncStreamer returns from UpdateData at once, its base is loaded when release is closed
+type asyncStreamer struct {
+	baseStreamer
+	release chan struct{}
+	err     error // returned by UpdateData instead if it's set
+}
+
+func (as *asyncStreamer) UpdateData(ctx context.Context) error {
+	if as.err != nil {
+		return as.err
+	}
+	go func() {
+		select {
+		case <-as.release:
+			_ = as.Reload(ctx, streamer.LoadKindBase)
+		case <-ctx.Done():
+		}
+	}()
+	return nil
+}
+
+// probeStreamer reports the size of upstream when it's started
+type probeStreamer struct {
+	FakeStreamer
+	upstream container.Container
+	started  chan int
+}
+
+func (ps *probeStreamer) UpdateData(ctx context.Context) error {
+	ps.started <- ps.upstream.Len()
+	return nil
+}
+
+type resultsIter struct {
+	results []streamer.ParserResult
+	i       int
+}
+
+func (ri *resultsIter) HasNext() (bool, error) {
+	return ri.i < len(ri.results), nil
+}
+
+func (ri *resultsIter) Next() (container.DataMode, container.MapKey, interface{}, error) {
+	r := ri.results[ri.i]
+	ri.i++
+	return r.DataMode, r.Key, r.Value, r.Err
+}
+
+// joinCampaigns joins the package of each campaign with its advertiser name
+func joinCampaigns(upstreams map[string]container.Container, userData interface{}) []streamer.ParserResult {
+	var results []streamer.ParserResult
+	advertisers := upstreams["advertiser"]
+	upstreams["campaign"].Range(func(key, value interface{}) bool {
+		kv := strings.SplitN(value.(string), ",", 2)
+		name, err := advertisers.Get(container.StrKey(kv[1]))
+		if err != nil {
+			return true
+		}
+		results = append(results, streamer.ParserResult{Key: container.StrKey(key.(string)), Value: kv[0] + "@" + name.(string)})
+		return true
+	})
+	return results
+}
+
+func TestBifrost_Dependencies(t *testing.T) {
+	convey.Convey("Test dependencies and DerivedStreamer", t, func() {
+		bf := NewBifrost()
+		campaign := &baseStreamer{records: []string{"1\tcom.a,903", "2\tcom.b,904"}, c: container.CreateBlockingMapContainer(1, 0)}
+		advertiser := &baseStreamer{records: []string{"903\tfoo", "904\tbar"}, c: container.CreateBlockingMapContainer(1, 0)}
+		derived, err := streamer.NewDerivedStreamer(&streamer.DerivedStreamerCfg{
+			Name:      "campaignAdvertiser",
+			Upstreams: map[string]streamer.Streamer{"campaign": campaign, "advertiser": advertiser},
+			Build:     joinCampaigns,
+		})
+		convey.So(err, convey.ShouldBeNil)
+		derived.SetContainer(container.CreateBlockingMapContainer(1, 0))
+
+		// registered before its upstreams, started after them
+		convey.So(bf.Register("campaignAdvertiser", derived), convey.ShouldBeNil)
+		convey.So(bf.Register("campaign", campaign, DependsOn("advertiser")), convey.ShouldBeNil)
+		convey.So(bf.Register("advertiser", advertiser), convey.ShouldBeNil)
+		order, err := bf.sortStreamers()
+		convey.So(err, convey.ShouldBeNil)
+		convey.So(order, convey.ShouldResemble, []string{"advertiser", "campaign", "campaignAdvertiser"})
+
+		convey.So(bf.Start(context.Background()), convey.ShouldBeNil)
+		defer bf.Stop()
+		convey.So(bf.WaitReady(), convey.ShouldBeNil)
+		v, err := bf.Get("campaignAdvertiser", container.StrKey("1"))
+		convey.So(err, convey.ShouldBeNil)
+		convey.So(v, convey.ShouldEqual, "com.a@foo")
+
+		// a base load of an upstream rebuilds the derived container
+		campaign.setRecords("1\tcom.c,904")
+		convey.So(campaign.Reload(context.Background(), streamer.LoadKindBase), convey.ShouldBeNil)
+		deadline := time.Now().Add(time.Second)
+		for time.Now().Before(deadline) {
+			if v, _ = bf.Get("campaignAdvertiser", container.StrKey("1")); v == "com.c@bar" {
+				break
+			}
+			time.Sleep(5 * time.Millisecond)
+		}
+		convey.So(v, convey.ShouldEqual, "com.c@bar")
+		_, err = bf.Get("campaignAdvertiser", container.StrKey("2"))
+		convey.So(err, convey.ShouldEqual, container.NotExistErr)
+
+		err = bf.Unregister("advertiser")
+		convey.So(err.Error(), convey.ShouldEqual, "streamer[advertiser] is depended on by streamer[campaign,campaignAdvertiser]")
+		err = bf.Register("late", &FakeStreamer{}, DependsOn("not_exist"))
+		convey.So(err.Error(), convey.ShouldEqual, "streamer[late] depends on not found streamer[not_exist]")
+	})
+
+	convey.Convey("Test missing and cyclic dependencies", t, func() {
+		bf := NewBifrost()
+		convey.So(bf.Register("a", &FakeStreamer{}, DependsOn("b")), convey.ShouldBeNil)
+		err := bf.Start(context.Background())
+		convey.So(err.Error(), convey.ShouldEqual, "streamer[a] depends on not found streamer[b]")
+
+		convey.So(bf.Register("b", &FakeStreamer{}, DependsOn("c")), convey.ShouldBeNil)
+		convey.So(bf.Register("c", &FakeStreamer{}, DependsOn("b")), convey.ShouldBeNil)
+		err = bf.Start(context.Background())
+		convey.So(err.Error(), convey.ShouldEqual, "dependency cycle among streamers[b,c]")
+	})
+
+	convey.Convey("Test dependents wait for the base load of an async dependency", t, func() {
+		bf := NewBifrost()
+		advertiser := &asyncStreamer{release: make(chan struct{})}
+		advertiser.records = []string{"903\tfoo", "904\tbar"}
+		advertiser.c = container.CreateBlockingMapContainer(1, 0)
+		probe := &probeStreamer{upstream: advertiser.c, started: make(chan int, 1)}
+		convey.So(bf.Register("advertiser", advertiser), convey.ShouldBeNil)
+		convey.So(bf.Register("probe", probe, DependsOn("advertiser")), convey.ShouldBeNil)
+		convey.So(bf.Start(context.Background()), convey.ShouldBeNil)
+		defer bf.Stop()
+
+		select {
+		case <-probe.started:
+			t.Fatal("started before the base load of its dependency")
+		case <-time.After(50 * time.Millisecond):
+		}
+		close(advertiser.release)
+		select {
+		case n := <-probe.started:
+			convey.So(n, convey.ShouldEqual, 2)
+		case <-time.After(time.Second):
+			t.Fatal("not started after the base load of its dependency")
+		}
+		convey.So(bf.WaitReady(), convey.ShouldBeNil)
+	})
+
+	convey.Convey("Test a failed dependency doesn't hold back its dependents", t, func() {
+		bf := NewBifrost()
+		advertiser := &asyncStreamer{err: errors.New("unavailable")}
+		advertiser.c = container.CreateBlockingMapContainer(1, 0)
+		probe := &probeStreamer{upstream: advertiser.c, started: make(chan int, 1)}
+		convey.So(bf.Register("advertiser", advertiser), convey.ShouldBeNil)
+		convey.So(bf.Register("probe", probe, DependsOn("advertiser")), convey.ShouldBeNil)
+		convey.So(bf.Start(context.Background()), convey.ShouldBeNil)
+		defer bf.Stop()
+		convey.So(bf.WaitReady(), convey.ShouldNotBeNil)
+		convey.So(<-probe.started, convey.ShouldEqual, 0)
+	})
+}
@@ -2,7 +2,6 @@ package main
 
 import (
 	"context"
-	"errors"
 	"fmt"
 	"github.com/Mintegral-official/mtggokit/bifrost"
 	"github.com/Mintegral-official/mtggokit/bifrost/container"
@@ -15,11 +14,11 @@ import (
 )
 
 type UserData struct {
-	Bifrost             *bifrost.Bifrost
-	PackageName         []string
-	CampaignUptime      int64
-	CreativeUptime      int64
-	AuditCreativeUptime int64
+	Bifrost     *bifrost.Bifrost
+	PackageName []string
+	// CreativeParser is the parser of the creatives, the audit creatives are loaded since its
+	// watermark
+	CreativeParser *streamer.StructParser
 }
 
 type CampaignIdsParser struct {
@@ -43,36 +42,35 @@ func (*CampaignIdsParser) Parse(data []byte, userData interface{}) []streamer.Pa
 }
 
 type CampaignInfo struct {
-	CampaignId   int64  `bson:"campaignId,omitempty"`
+	CampaignId   int64  `bson:"campaignId,omitempty" bifrost:"key"`
 	AdvertiserId *int32 `bson:"advertiserId,omitempty"`
 	PackageName  string `bson:"packageName,omitempty"`
-	Uptime       int64  `bson:"updated,omitempty"`
+	Uptime       int64  `bson:"updated,omitempty" bifrost:"watermark"`
 }
 
 type CreativeInfo struct {
-	CampaignId int64 `bson:"campaignId,omitempty"`
+	CampaignId int64 `bson:"campaignId,omitempty" bifrost:"key"`
 	CreativeId int64
-	Uptime     int64 `bson:"updated,omitempty"`
+	Uptime     int64 `bson:"updated,omitempty" bifrost:"watermark"`
 }
 
+// CampaignParser also collects the package names of the campaigns for the creative queries
 type CampaignParser struct {
+	*streamer.StructParser
 }
 
 func (cp *CampaignParser) Parse(data []byte, userData interface{}) []streamer.ParserResult {
+	results := cp.StructParser.Parse(data, userData)
 	ud, ok := userData.(*UserData)
 	if !ok {
-		return nil
-	}
-	campaign := &CampaignInfo{}
-
-	if err := bson.Unmarshal(data, &campaign); err != nil {
-		fmt.Println("bson.Unmarsnal error:" + err.Error())
+		return results
 	}
-	if ud.CampaignUptime < campaign.Uptime {
-		ud.CampaignUptime = campaign.Uptime
+	for _, r := range results {
+		if campaign, ok := r.Value.(*CampaignInfo); ok && r.Err == nil {
+			ud.PackageName = append(ud.PackageName, campaign.PackageName)
+		}
 	}
-	ud.PackageName = append(ud.PackageName, campaign.PackageName)
-	return []streamer.ParserResult{{container.DataModeAdd, container.I64Key(campaign.CampaignId), &campaign, nil}}
+	return results
 }
 
 func GetCampaigns(data *UserData) []int64 {
@@ -87,48 +85,11 @@ func GetCampaigns(data *UserData) []int64 {
 	return campaignIds
 }
 
-type CreativeParser struct {
-}
-
-func (*CreativeParser) Parse(data []byte, userData interface{}) []streamer.ParserResult {
-	ud, ok := userData.(*UserData)
-	if !ok {
-		return nil
-	}
-	creative := &CreativeInfo{}
-
-	if err := bson.Unmarshal(data, &creative); err != nil {
-		fmt.Println("bson.Unmarsnal error:" + err.Error())
-	}
-	if ud.CreativeUptime < creative.Uptime {
-		ud.CreativeUptime = creative.Uptime
-	}
-	return []streamer.ParserResult{{container.DataModeAdd, container.I64Key(creative.CampaignId), &creative, nil}}
-}
-
 type AdxAuditCreativeInfo struct {
-	CampaignId  int64  `bson:"campaignId,omitempty" json:"campaignId"`
+	CampaignId  int64  `bson:"campaignId,omitempty" json:"campaignId" bifrost:"key"`
 	CountryCode string `bson:"countryCode,omitempty" json:"countryCode"`
 	PackageName string `bson:"packageName,omitempty" json:"packageName"`
 }
-type AdxAuditCreativeParser struct {
-}
-
-func (*AdxAuditCreativeParser) Parse(data []byte, userData interface{}) []streamer.ParserResult {
-	ud, ok := userData.(*UserData)
-	if !ok {
-		return []streamer.ParserResult{{container.DataModeAdd, nil, nil, errors.New("user data parse error")}}
-	}
-	creative := &AdxAuditCreativeInfo{}
-
-	if err := bson.Unmarshal(data, &creative); err != nil {
-		fmt.Println("bson.Unmarsnal error:" + err.Error())
-	}
-	if ud.AuditCreativeUptime < ud.CreativeUptime {
-		ud.AuditCreativeUptime = ud.CreativeUptime
-	}
-	return []streamer.ParserResult{{container.DataModeAdd, container.I64Key(creative.CampaignId), creative, nil}}
-}
 
 func getCampaigIdsStreamer() streamer.Streamer {
 	lfs := streamer.NewFileStreamer(&streamer.LocalFileStreamerCfg{
@@ -148,13 +109,16 @@ func getCampaigIdsStreamer() streamer.Streamer {
 		Tolerate: 0.5,
 	})
 
-	if err := lfs.UpdateData(context.Background()); err != nil {
-		fmt.Println("streamer campaignsIds udpateData error: ", err.Error())
-	}
 	return lfs
 }
 
 func getCampaignInfoStreamer(bf *bifrost.Bifrost, ud *UserData) streamer.Streamer {
+	sp, err := streamer.NewStructParser(CampaignInfo{})
+	if err != nil {
+		fmt.Println("parser init err, error:", err.Error())
+		return nil
+	}
+	parser := &CampaignParser{StructParser: sp}
 	// 创建 campaignInfo Streamer
 	ms, err := streamer.NewMongoStreamer(&streamer.MongoStreamerCfg{
 		Name:           "campaignsInfo",
@@ -166,8 +130,8 @@ func getCampaignInfoStreamer(bf *bifrost.Bifrost, ud *UserData) streamer.Streame
 		Collection:     "campaign",
 		ConnectTimeout: 1000000,
 		ReadTimeout:    2000000,
-		BaseParser:     &CampaignParser{},
-		IncParser:      &CampaignParser{},
+		BaseParser:     parser,
+		IncParser:      parser,
 		UserData:       ud,
 		Logger:         logrus.New(),
 		OnBeforeBase: func(userData interface{}) interface{} {
@@ -193,7 +157,7 @@ func getCampaignInfoStreamer(bf *bifrost.Bifrost, ud *UserData) streamer.Streame
 			}
 			incQuery := bson.M{
 				"campaignId": bson.M{"$in": campaignIds}, "publisherId": 0, "status": 1, "system": 5,
-				"updated": bson.M{"$gte": ud.CampaignUptime - 5, "$lte": int(time.Now().Unix())},
+				"updated": bson.M{"$gte": parser.Watermark() - 5, "$lte": int(time.Now().Unix())},
 			}
 			return incQuery
 		},
@@ -206,13 +170,16 @@ func getCampaignInfoStreamer(bf *bifrost.Bifrost, ud *UserData) streamer.Streame
 		return nil
 	}
 	ms.SetContainer(container.CreateBlockingMapContainer(100, 0))
-	if err := ms.UpdateData(context.Background()); err != nil {
-		fmt.Println("CampaignInfoStreamer updateData error: ", err.Error())
-	}
 	return ms
 }
 
 func getCreativeStreamer(bf *bifrost.Bifrost, ud *UserData) streamer.Streamer {
+	parser, err := streamer.NewStructParser(CreativeInfo{})
+	if err != nil {
+		fmt.Println("parser init err, error:", err.Error())
+		return nil
+	}
+	ud.CreativeParser = parser
 	// 创建 creative Streamer
 	ms, err := streamer.NewMongoStreamer(&streamer.MongoStreamerCfg{
 		Name:           "creativeInfo",
@@ -224,8 +191,8 @@ func getCreativeStreamer(bf *bifrost.Bifrost, ud *UserData) streamer.Streamer {
 		Collection:     "creative",
 		ConnectTimeout: 100000,
 		ReadTimeout:    200000,
-		BaseParser:     &CreativeParser{},
-		IncParser:      &CreativeParser{},
+		BaseParser:     parser,
+		IncParser:      parser,
 		UserData:       ud,
 		Logger:         logrus.New(),
 		OnBeforeBase: func(userData interface{}) interface{} {
@@ -255,7 +222,7 @@ func getCreativeStreamer(bf *bifrost.Bifrost, ud *UserData) streamer.Streamer {
 			incQuery := bson.M{"$or": []bson.M{
 				{"campaignId": bson.M{"$in": campaignIds}},
 				{"packageName": bson.M{"$in": ud.PackageName}},
-			}, "updated": bson.M{"$gte": ud.CampaignUptime - 5, "$lte": int(time.Now().Unix())},
+			}, "updated": bson.M{"$gte": parser.Watermark() - 5, "$lte": int(time.Now().Unix())},
 			}
 			return incQuery
 		},
@@ -268,13 +235,15 @@ func getCreativeStreamer(bf *bifrost.Bifrost, ud *UserData) streamer.Streamer {
 		return nil
 	}
 	ms.SetContainer(container.CreateBlockingMapContainer(100, 0))
-	if err := ms.UpdateData(context.Background()); err != nil {
-		fmt.Println("Creative Streamer updateData error: ", err.Error())
-	}
 	return ms
 }
 
 func getAdxAuditCreativeStreamer(ud *UserData) streamer.Streamer {
+	parser, err := streamer.NewStructParser(AdxAuditCreativeInfo{})
+	if err != nil {
+		fmt.Println("parser init err, error:", err.Error())
+		return nil
+	}
 	// 创建 creative Streamer
 	ms, err := streamer.NewMongoStreamer(&streamer.MongoStreamerCfg{
 		Name:           "adxAuditCreativeInfo",
@@ -286,8 +255,8 @@ func getAdxAuditCreativeStreamer(ud *UserData) streamer.Streamer {
 		Collection:     "group_creative_audit",
 		ConnectTimeout: 100000000,
 		ReadTimeout:    2000000,
-		BaseParser:     &AdxAuditCreativeParser{},
-		IncParser:      &AdxAuditCreativeParser{},
+		BaseParser:     parser,
+		IncParser:      parser,
 		UserData:       ud,
 		Logger:         logrus.New(),
 		OnBeforeBase: func(userData interface{}) interface{} {
@@ -312,7 +281,11 @@ func getAdxAuditCreativeStreamer(ud *UserData) streamer.Streamer {
 			if campaignIds == nil {
 				return nil
 			}
-			incQuery := bson.M{"campaignId": bson.M{"$in": campaignIds}, "updated": bson.M{"$gte": ud.AuditCreativeUptime - 5, "$lte": int(time.Now().Unix())}}
+			var uptime int64
+			if ud.CreativeParser != nil {
+				uptime = ud.CreativeParser.Watermark()
+			}
+			incQuery := bson.M{"campaignId": bson.M{"$in": campaignIds}, "updated": bson.M{"$gte": uptime - 5, "$lte": int(time.Now().Unix())}}
 			return incQuery
 		},
 	})
@@ -324,9 +297,6 @@ func getAdxAuditCreativeStreamer(ud *UserData) streamer.Streamer {
 		return nil
 	}
 	ms.SetContainer(container.CreateBlockingMapContainer(100, 0))
-	if err := ms.UpdateData(context.Background()); err != nil {
-		fmt.Println("Creative Streamer updateData error: ", err.Error())
-	}
 	return ms
 }
 
@@ -346,22 +316,32 @@ func run() {
 
 	// 创建 campaignInfo Streamer
 	infoStreamer := getCampaignInfoStreamer(bf, ud)
-	if err := bf.Register("campaignsInfo", infoStreamer); err != nil {
+	if err := bf.Register("campaignsInfo", infoStreamer, bifrost.DependsOn("campaignsIds")); err != nil {
 		fmt.Println("bf.Register campaignsInfo error ")
 	}
 
 	// 创建 creative Streamer
 	creativeStreamer := getCreativeStreamer(bf, ud)
-	if err := bf.Register("creativeInfo", creativeStreamer); err != nil {
+	if err := bf.Register("creativeInfo", creativeStreamer, bifrost.DependsOn("campaignsIds", "campaignsInfo")); err != nil {
 		fmt.Println("bf.Register creativeInfo error ")
 	}
 
 	// 创建 creative Streamer
 	auditCreativeStream := getAdxAuditCreativeStreamer(ud)
-	if err := bf.Register("AuditCreativeInfo", auditCreativeStream); err != nil {
+	if err := bf.Register("AuditCreativeInfo", auditCreativeStream, bifrost.DependsOn("campaignsIds", "creativeInfo")); err != nil {
 		fmt.Println("bf.Register creativeInfo error ")
 	}
 
+	// 按依赖顺序加载: campaignsIds -> campaignsInfo -> creativeInfo -> AuditCreativeInfo，
+	// campaignsIds全量更新后依赖它的streamer会自动重新加载全量
+	if err := bf.Start(context.Background()); err != nil {
+		fmt.Println("bf.Start error: " + err.Error())
+	}
+	if err := bf.WaitReady(); err != nil {
+		fmt.Println("bf.WaitReady error: " + err.Error())
+	}
+	defer bf.Stop()
+
 	// test
 	data, err := bf.Get("campaignsIds", container.StrKey("CampaignList"))
 	if err != nil {
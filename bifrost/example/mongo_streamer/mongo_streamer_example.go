@@ -12,36 +12,19 @@ import (
 	"time"
 )
 
-type UserData struct {
-	Uptime int64
-}
-
 type CampaignInfo struct {
-	CampaignId   int64  `bson:"campaignId,omitempty"`
+	CampaignId   int64  `bson:"campaignId,omitempty" bifrost:"key"`
 	AdvertiserId *int32 `bson:"advertiserId,omitempty"`
-	Uptime       int64  `bson:"updated,omitempty"`
-}
-
-type CampaignParser struct {
-}
-
-func (cp *CampaignParser) Parse(data []byte, userData interface{}) []streamer.ParserResult {
-	ud, ok := userData.(*UserData)
-	if !ok {
-		return nil
-	}
-	campaign := &CampaignInfo{}
-
-	if err := bson.Unmarshal(data, &campaign); err != nil {
-		fmt.Println("bson.Unmarsnal error:" + err.Error())
-	}
-	if ud.Uptime < campaign.Uptime {
-		ud.Uptime = campaign.Uptime
-	}
-	return []streamer.ParserResult{{container.DataModeAdd, container.I64Key(campaign.CampaignId), &campaign, nil}}
+	Status       int    `bson:"status,omitempty" bifrost:"del=2"`
+	Uptime       int64  `bson:"updated,omitempty" bifrost:"watermark"`
 }
 
 func main() {
+	parser, err := streamer.NewStructParser(CampaignInfo{})
+	if err != nil {
+		fmt.Println("Init parser error! err=" + err.Error())
+		os.Exit(1)
+	}
 	ms, err := streamer.NewMongoStreamer(&streamer.MongoStreamerCfg{
 		Name:           "mongo_test",
 		UpdateMode:     streamer.Dynamic,
@@ -52,18 +35,13 @@ func main() {
 		Collection:     "campaign",
 		ConnectTimeout: 100000000,
 		ReadTimeout:    200000000,
-		BaseParser:     &CampaignParser{},
-		IncParser:      &CampaignParser{},
+		BaseParser:     parser,
+		IncParser:      parser,
 		BaseQuery:      bson.M{"status": 1, "advertiserId": 903},
 		IncQuery:       bson.M{"advertiserId": 903},
-		UserData:       &UserData{},
 		Logger:         logrus.New(),
 		OnBeforeInc: func(userData interface{}) interface{} {
-			ud, ok := userData.(*UserData)
-			if !ok {
-				return nil
-			}
-			incQuery := bson.M{"advertiserId": 903, "updated": bson.M{"$gte": ud.Uptime - 5, "$lte": int(time.Now().Unix())}}
+			incQuery := bson.M{"advertiserId": 903, "updated": bson.M{"$gte": parser.Watermark() - 5, "$lte": int(time.Now().Unix())}}
 			return incQuery
 		},
 	})
@@ -0,0 +1,225 @@
+package bifrost
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/Mintegral-official/mtggokit/bifrost/streamer"
+)
+
+// running is the state of a streamer started by Bifrost
+type running struct {
+	cancel context.CancelFunc
+	ready  chan struct{} // closed when UpdateData returns
+	err    error         // the error returned by UpdateData, read it after ready is closed
+
+	// closed after the first successful base load reported to the observer, or when UpdateData
+	// returns if the streamer isn't streamer.Observable
+	loaded     chan struct{}
+	loadedOnce sync.Once
+
+	// the base reloads requested by the dependencies, nil if the streamer has none
+	loading    chan struct{} // closed when the dependencies are loaded and UpdateData is called
+	reload     chan struct{}
+	reloadDone chan struct{}
+}
+
+// Start starts the update loop of every registered streamer, each one under its own child
+// context of ctx. Streamers registered later are started by Register. Start doesn't wait
+// for the base loads, use WaitReady for that. With WithScheduler the streamers are handed
+// to the scheduler, whose loop runs until Stop. A streamer with dependencies is started after
+// their first load, Start fails if they are missing or form a cycle.
+func (l *Bifrost) Start(ctx context.Context) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.stopped {
+		return errors.New("bifrost has been stopped")
+	}
+	if l.started {
+		return errors.New("bifrost has already started")
+	}
+	order, err := l.sortStreamers()
+	if err != nil {
+		return err
+	}
+	l.started = true
+	l.ctx, l.cancel = context.WithCancel(ctx)
+	if l.sched != nil {
+		schedCtx, done := l.ctx, make(chan struct{})
+		l.schedDone = done
+		go func() {
+			defer close(done)
+			l.sched.Schedule(schedCtx)
+		}()
+	}
+	if l.collector != nil {
+		l.metricsDone = make(chan struct{})
+		go l.runMetrics(l.ctx, l.metricsDone)
+	}
+	for _, name := range order {
+		l.startStreamer(name, l.DataStreamers[name])
+	}
+	return nil
+}
+
+func (r *running) markLoaded() {
+	r.loadedOnce.Do(func() { close(r.loaded) })
+}
+
+// startStreamer must be called with l.mu held
+func (l *Bifrost) startStreamer(name string, s streamer.Streamer) {
+	ctx, cancel := context.WithCancel(l.ctx)
+	r := &running{
+		cancel:  cancel,
+		ready:   make(chan struct{}),
+		loaded:  make(chan struct{}),
+		loading: make(chan struct{}),
+	}
+	_, observable := s.(streamer.Observable)
+	l.runnings[name] = r
+	deps := make([]*running, 0, len(l.deps[name]))
+	for _, dep := range l.deps[name] {
+		if d := l.runnings[dep]; d != nil {
+			deps = append(deps, d)
+		}
+	}
+	if rl, ok := s.(streamer.Reloader); ok && len(l.deps[name]) > 0 {
+		r.reload = make(chan struct{}, 1)
+		r.reloadDone = make(chan struct{})
+		go l.reloadLoop(ctx, name, rl, r)
+	}
+	go func() {
+		defer close(r.ready)
+		if !waitDeps(ctx, deps) {
+			return
+		}
+		close(r.loading)
+		if !observable {
+			defer r.markLoaded()
+		}
+		if l.sched != nil {
+			select {
+			case err := <-l.sched.AddStreamer(ctx, name, s, l.onSchedError):
+				if err != nil {
+					r.err = fmt.Errorf("streamer[%s] UpdateData error: %s", name, err.Error())
+				}
+			case <-ctx.Done():
+			}
+			return
+		}
+		if err := s.UpdateData(ctx); err != nil {
+			r.err = fmt.Errorf("streamer[%s] UpdateData error: %s", name, err.Error())
+			if l.logger != nil {
+				l.logger.Warnf("%s", r.err.Error())
+			}
+		}
+	}()
+}
+
+func (l *Bifrost) onSchedError(name string, err error) {
+	if l.logger != nil {
+		l.logger.Warnf("streamer[%s] update error: %s", name, err.Error())
+	}
+}
+
+// WaitReady blocks until every started streamer returns from UpdateData, that is until
+// every sync streamer has finished its first base load. It returns the first error.
+func (l *Bifrost) WaitReady() error {
+	l.mu.RLock()
+	runnings := make([]*running, 0, len(l.runnings))
+	for _, r := range l.runnings {
+		runnings = append(runnings, r)
+	}
+	l.mu.RUnlock()
+
+	var err error
+	for _, r := range runnings {
+		<-r.ready
+		if err == nil && r.err != nil {
+			err = r.err
+		}
+	}
+	return err
+}
+
+// Unregister stops the streamer, waits for its update loop to exit and closes its resources.
+// A streamer can't be unregistered while others depend on it.
+func (l *Bifrost) Unregister(name string) error {
+	l.mu.Lock()
+	s, ok := l.DataStreamers[name]
+	if !ok {
+		l.mu.Unlock()
+		return errors.New("not found streamer[" + name + "]")
+	}
+	if dependents := l.dependentsOf(name); len(dependents) > 0 {
+		l.mu.Unlock()
+		return errors.New("streamer[" + name + "] is depended on by streamer[" + strings.Join(dependents, ",") + "]")
+	}
+	delete(l.DataStreamers, name)
+	delete(l.deps, name)
+	r := l.runnings[name]
+	delete(l.runnings, name)
+	l.mu.Unlock()
+
+	err := l.stopStreamer(name, s, r)
+	l.removeMetrics(name)
+	return err
+}
+
+// Stop stops all streamers and closes their resources, Bifrost can't be started again
+func (l *Bifrost) Stop() error {
+	l.mu.Lock()
+	if l.stopped {
+		l.mu.Unlock()
+		return nil
+	}
+	l.stopped = true
+	streamers := make(map[string]streamer.Streamer, len(l.DataStreamers))
+	for name, s := range l.DataStreamers {
+		streamers[name] = s
+	}
+	runnings := l.runnings
+	l.runnings = make(map[string]*running)
+	cancel, schedDone, metricsDone := l.cancel, l.schedDone, l.metricsDone
+	l.mu.Unlock()
+
+	for _, r := range runnings {
+		r.cancel()
+	}
+	if cancel != nil {
+		cancel()
+	}
+	if schedDone != nil {
+		<-schedDone
+	}
+	if metricsDone != nil {
+		<-metricsDone
+	}
+	var err error
+	for name, s := range streamers {
+		if e := l.stopStreamer(name, s, runnings[name]); e != nil && err == nil {
+			err = fmt.Errorf("streamer[%s] close error: %s", name, e.Error())
+		}
+	}
+	return err
+}
+
+func (l *Bifrost) stopStreamer(name string, s streamer.Streamer, r *running) error {
+	if r != nil {
+		r.cancel()
+		<-r.ready
+		if r.reloadDone != nil {
+			<-r.reloadDone
+		}
+	}
+	if l.sched != nil {
+		l.sched.RemoveStreamer(name)
+	}
+	if c, ok := s.(streamer.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
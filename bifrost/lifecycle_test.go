@@ -0,0 +1,194 @@
+package bifrost
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Mintegral-official/mtggokit/bifrost/container"
+	"github.com/Mintegral-official/mtggokit/bifrost/streamer"
+	"github.com/smartystreets/goconvey/convey"
+)
+
+// loopStreamer mimics the builtin streamers: a sync base load in UpdateData, then an update loop
+type loopStreamer struct {
+	FakeStreamer
+	baseDelay time.Duration
+	baseErr   error
+	c         container.Container
+	wg        sync.WaitGroup
+	loaded    int32
+	running   int32
+	closed    int32
+}
+
+func (ls *loopStreamer) GetContainer() container.Container {
+	return ls.c
+}
+
+func (ls *loopStreamer) UpdateData(ctx context.Context) error {
+	time.Sleep(ls.baseDelay)
+	if ls.baseErr != nil {
+		return ls.baseErr
+	}
+	atomic.StoreInt32(&ls.loaded, 1)
+	atomic.StoreInt32(&ls.running, 1)
+	ls.wg.Add(1)
+	go func() {
+		defer ls.wg.Done()
+		<-ctx.Done()
+		atomic.StoreInt32(&ls.running, 0)
+	}()
+	return nil
+}
+
+func (ls *loopStreamer) Close() error {
+	ls.wg.Wait()
+	atomic.StoreInt32(&ls.closed, 1)
+	return nil
+}
+
+func TestBifrost_Lifecycle(t *testing.T) {
+	convey.Convey("Test Start, WaitReady and Stop", t, func() {
+		bf := NewBifrost()
+		slow := &loopStreamer{baseDelay: 50 * time.Millisecond}
+		fast := &loopStreamer{}
+		convey.So(bf.Register("slow", slow), convey.ShouldBeNil)
+		convey.So(bf.Register("fast", fast), convey.ShouldBeNil)
+
+		convey.So(bf.Start(context.Background()), convey.ShouldBeNil)
+		convey.So(bf.Start(context.Background()), convey.ShouldNotBeNil)
+		convey.So(bf.WaitReady(), convey.ShouldBeNil)
+		convey.So(atomic.LoadInt32(&slow.loaded), convey.ShouldEqual, 1)
+		convey.So(atomic.LoadInt32(&fast.running), convey.ShouldEqual, 1)
+
+		// registered after Start, started at once
+		late := &loopStreamer{}
+		convey.So(bf.Register("late", late), convey.ShouldBeNil)
+		convey.So(bf.WaitReady(), convey.ShouldBeNil)
+		convey.So(atomic.LoadInt32(&late.running), convey.ShouldEqual, 1)
+
+		convey.So(bf.Stop(), convey.ShouldBeNil)
+		for _, ls := range []*loopStreamer{slow, fast, late} {
+			convey.So(atomic.LoadInt32(&ls.running), convey.ShouldEqual, 0)
+			convey.So(atomic.LoadInt32(&ls.closed), convey.ShouldEqual, 1)
+		}
+		convey.So(bf.Start(context.Background()), convey.ShouldNotBeNil)
+		convey.So(bf.Register("again", &loopStreamer{}), convey.ShouldNotBeNil)
+		convey.So(bf.Stop(), convey.ShouldBeNil)
+	})
+
+	convey.Convey("Test Unregister", t, func() {
+		bf := NewBifrost()
+		ls := &loopStreamer{c: container.CreateBlockingMapContainer(1, 0)}
+		other := &loopStreamer{}
+		convey.So(bf.Register("ls", ls), convey.ShouldBeNil)
+		convey.So(bf.Register("other", other), convey.ShouldBeNil)
+		convey.So(bf.Start(context.Background()), convey.ShouldBeNil)
+		convey.So(bf.WaitReady(), convey.ShouldBeNil)
+
+		convey.So(bf.Unregister("ls"), convey.ShouldBeNil)
+		convey.So(atomic.LoadInt32(&ls.running), convey.ShouldEqual, 0)
+		convey.So(atomic.LoadInt32(&ls.closed), convey.ShouldEqual, 1)
+		convey.So(atomic.LoadInt32(&other.running), convey.ShouldEqual, 1)
+		_, err := bf.Get("ls", container.StrKey("a"))
+		convey.So(err, convey.ShouldNotBeNil)
+		convey.So(bf.Unregister("ls"), convey.ShouldNotBeNil)
+
+		// the name can be reused
+		convey.So(bf.Register("ls", &loopStreamer{}), convey.ShouldBeNil)
+		convey.So(bf.Stop(), convey.ShouldBeNil)
+	})
+
+	convey.Convey("Test WaitReady returns the base load error", t, func() {
+		bf := NewBifrost()
+		convey.So(bf.Register("bad", &loopStreamer{baseErr: errors.New("no data")}), convey.ShouldBeNil)
+		convey.So(bf.Register("good", &loopStreamer{}), convey.ShouldBeNil)
+		convey.So(bf.Start(context.Background()), convey.ShouldBeNil)
+		err := bf.WaitReady()
+		convey.So(err, convey.ShouldNotBeNil)
+		convey.So(err.Error(), convey.ShouldEqual, "streamer[bad] UpdateData error: no data")
+		convey.So(bf.Stop(), convey.ShouldBeNil)
+	})
+
+	convey.Convey("Test Stop with the builtin file streamer", t, func() {
+		bf := NewBifrost()
+		lfs := streamer.NewFileStreamer(&streamer.LocalFileStreamerCfg{
+			Name:       "not_exist",
+			Path:       "/not/exist/file",
+			UpdatMode:  streamer.Dynamic,
+			Interval:   1,
+			DataParser: &streamer.DefaultTextParser{},
+		})
+		lfs.SetContainer(&container.BufferedMapContainer{})
+		convey.So(bf.Register("file", lfs), convey.ShouldBeNil)
+		convey.So(bf.Start(context.Background()), convey.ShouldBeNil)
+		convey.So(bf.WaitReady(), convey.ShouldBeNil)
+		convey.So(bf.Stop(), convey.ShouldBeNil)
+	})
+}
+
+// schedStreamer is a Schedulable fake counting its rounds
+type schedStreamer struct {
+	FakeStreamer
+	err     error
+	rounds  int32
+	running *int32
+	maxSeen *int32
+}
+
+func (ss *schedStreamer) GetSchedInfo() *streamer.SchedInfo {
+	return &streamer.SchedInfo{TimeInterval: 1}
+}
+
+func (ss *schedStreamer) Update(ctx context.Context) error {
+	n := atomic.AddInt32(ss.running, 1)
+	defer atomic.AddInt32(ss.running, -1)
+	if n > atomic.LoadInt32(ss.maxSeen) {
+		atomic.StoreInt32(ss.maxSeen, n)
+	}
+	time.Sleep(10 * time.Millisecond)
+	atomic.AddInt32(&ss.rounds, 1)
+	return ss.err
+}
+
+func TestBifrost_Scheduler(t *testing.T) {
+	convey.Convey("Test streamers run under one scheduler", t, func() {
+		var running, maxSeen int32
+		bf := NewBifrost(WithScheduler(streamer.WithConcurrency(1)))
+		streamers := make([]*schedStreamer, 0, 4)
+		for _, name := range []string{"a", "b", "c", "d"} {
+			ss := &schedStreamer{running: &running, maxSeen: &maxSeen}
+			streamers = append(streamers, ss)
+			convey.So(bf.Register(name, ss), convey.ShouldBeNil)
+		}
+		convey.So(bf.Start(context.Background()), convey.ShouldBeNil)
+		convey.So(bf.WaitReady(), convey.ShouldBeNil)
+		for _, ss := range streamers {
+			convey.So(atomic.LoadInt32(&ss.rounds), convey.ShouldBeGreaterThanOrEqualTo, 1)
+		}
+		convey.So(atomic.LoadInt32(&maxSeen), convey.ShouldEqual, 1)
+
+		convey.So(bf.Unregister("a"), convey.ShouldBeNil)
+		rounds := atomic.LoadInt32(&streamers[0].rounds)
+		time.Sleep(1200 * time.Millisecond)
+		convey.So(atomic.LoadInt32(&streamers[0].rounds), convey.ShouldEqual, rounds)
+		convey.So(atomic.LoadInt32(&streamers[1].rounds), convey.ShouldBeGreaterThanOrEqualTo, 2)
+		convey.So(bf.Stop(), convey.ShouldBeNil)
+	})
+
+	convey.Convey("Test WaitReady returns the first round error", t, func() {
+		var running, maxSeen int32
+		bf := NewBifrost(WithScheduler())
+		bad := &schedStreamer{err: errors.New("no data"), running: &running, maxSeen: &maxSeen}
+		convey.So(bf.Register("bad", bad), convey.ShouldBeNil)
+		convey.So(bf.Start(context.Background()), convey.ShouldBeNil)
+		err := bf.WaitReady()
+		convey.So(err, convey.ShouldNotBeNil)
+		convey.So(err.Error(), convey.ShouldEqual, "streamer[bad] UpdateData error: no data")
+		convey.So(bf.Stop(), convey.ShouldBeNil)
+	})
+}
@@ -0,0 +1,111 @@
+package bifrost
+
+import (
+	"context"
+	"time"
+
+	"github.com/Mintegral-official/mtggokit/bifrost/metrics"
+	"github.com/Mintegral-official/mtggokit/bifrost/streamer"
+)
+
+const defaultMetricsInterval = 15 * time.Second
+
+// WithMetrics exports the metrics of every registered streamer to c. The load counters and
+// durations are reported after each load of the streamers implementing streamer.Observable,
+// the gauges are also refreshed every interval, 15s if interval <= 0.
+func WithMetrics(c metrics.Collector, interval time.Duration) Option {
+	return func(l *Bifrost) {
+		if interval <= 0 {
+			interval = defaultMetricsInterval
+		}
+		l.collector = c
+		l.metricsInterval = interval
+	}
+}
+
+// observer returns the observer given to the streamer registered as name
+func (l *Bifrost) observer(name string) streamer.Observer {
+	return func(e streamer.LoadEvent) {
+		if e.Kind == streamer.LoadKindBase && e.Err == nil {
+			l.markLoaded(name)
+			l.propagate(name)
+		}
+		if l.collector == nil {
+			return
+		}
+		e.Name = name
+		l.collector.ObserveLoad(e)
+
+		l.statsMu.Lock()
+		g := l.gauges[name]
+		if e.Info != nil {
+			g.Size = e.Info.TotalNum
+			g.AddNum = e.Info.AddNum
+			g.ErrorNum = e.Info.ErrorNum
+		}
+		if e.Err == nil {
+			g.LastLoad = e.Start.Add(e.Used)
+		}
+		l.gauges[name] = g
+		l.statsMu.Unlock()
+		l.collector.SetGauges(name, g)
+	}
+}
+
+// refreshGauges updates the gauges of all streamers, the container size is read at once and
+// the streamers which don't report their loads are sampled by GetInfo
+func (l *Bifrost) refreshGauges() {
+	l.mu.RLock()
+	streamers := make(map[string]streamer.Streamer, len(l.DataStreamers))
+	for name, s := range l.DataStreamers {
+		streamers[name] = s
+	}
+	l.mu.RUnlock()
+
+	for name, s := range streamers {
+		l.statsMu.Lock()
+		g := l.gauges[name]
+		if c := s.GetContainer(); c != nil {
+			g.Size = c.Len()
+		}
+		if _, ok := s.(streamer.Observable); !ok {
+			if info := s.GetInfo(); info != nil {
+				g.AddNum = info.AddNum
+				g.ErrorNum = info.ErrorNum
+				g.LastLoad = info.LastBaseTime
+				if info.LastIncTime.After(g.LastLoad) {
+					g.LastLoad = info.LastIncTime
+				}
+			}
+		}
+		l.gauges[name] = g
+		l.statsMu.Unlock()
+		l.collector.SetGauges(name, g)
+	}
+}
+
+func (l *Bifrost) runMetrics(ctx context.Context, done chan struct{}) {
+	defer close(done)
+	ticker := time.NewTicker(l.metricsInterval)
+	defer ticker.Stop()
+	l.refreshGauges()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			l.refreshGauges()
+		}
+	}
+}
+
+// removeMetrics drops the metrics of an unregistered streamer, call it after the streamer stopped
+func (l *Bifrost) removeMetrics(name string) {
+	if l.collector == nil {
+		return
+	}
+	l.statsMu.Lock()
+	delete(l.gauges, name)
+	l.statsMu.Unlock()
+	l.collector.Remove(name)
+}
@@ -0,0 +1,26 @@
+package metrics
+
+import (
+	"time"
+
+	"github.com/Mintegral-official/mtggokit/bifrost/streamer"
+)
+
+// Gauges is the state of a streamer sampled by Bifrost
+type Gauges struct {
+	Size     int       // number of entries in the container
+	AddNum   int       // records read by the last base load and the incs after it
+	ErrorNum int       // records failed since the last base load
+	LastLoad time.Time // time of the last successful load, zero if none
+}
+
+// Collector receives the metrics of the streamers registered on a Bifrost, implement it to
+// send them to a backend other than PromCollector. The methods may be called concurrently.
+type Collector interface {
+	// ObserveLoad is called after every base or inc load
+	ObserveLoad(e streamer.LoadEvent)
+	// SetGauges is called after every load and periodically
+	SetGauges(name string, g Gauges)
+	// Remove drops the metrics of an unregistered streamer
+	Remove(name string)
+}
@@ -0,0 +1,220 @@
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Mintegral-official/mtggokit/bifrost/streamer"
+)
+
+// DefBuckets are the default load duration buckets in seconds
+var DefBuckets = []float64{0.01, 0.05, 0.1, 0.5, 1, 5, 10, 30, 60, 300}
+
+const contentType = "text/plain; version=0.0.4; charset=utf-8"
+
+type loadKey struct {
+	name string
+	kind string
+}
+
+type histogram struct {
+	counts []uint64 // counts[i] is the number of observations <= buckets[i]
+	count  uint64
+	sum    float64
+}
+
+// PromCollector keeps the metrics in memory and serves them in the Prometheus text
+// exposition format, register it on the /metrics path of the service:
+//
+//	c := metrics.NewPromCollector("bifrost")
+//	bf := bifrost.NewBifrost(bifrost.WithMetrics(c, 15*time.Second))
+//	http.Handle("/metrics", c)
+type PromCollector struct {
+	namespace string
+	buckets   []float64
+
+	mu        sync.Mutex
+	gauges    map[string]Gauges
+	loads     map[loadKey]uint64
+	failures  map[loadKey]uint64
+	durations map[loadKey]*histogram
+}
+
+// NewPromCollector creates a PromCollector, the metric names are prefixed by namespace and
+// the load durations use DefBuckets if no bucket is given
+func NewPromCollector(namespace string, buckets ...float64) *PromCollector {
+	if namespace == "" {
+		namespace = "bifrost"
+	}
+	if len(buckets) == 0 {
+		buckets = DefBuckets
+	}
+	b := make([]float64, len(buckets))
+	copy(b, buckets)
+	sort.Float64s(b)
+	return &PromCollector{
+		namespace: namespace,
+		buckets:   b,
+		gauges:    make(map[string]Gauges),
+		loads:     make(map[loadKey]uint64),
+		failures:  make(map[loadKey]uint64),
+		durations: make(map[loadKey]*histogram),
+	}
+}
+
+func (c *PromCollector) ObserveLoad(e streamer.LoadEvent) {
+	k := loadKey{name: e.Name, kind: e.Kind.String()}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.loads[k]++
+	if e.Err != nil {
+		c.failures[k]++
+	}
+	h, ok := c.durations[k]
+	if !ok {
+		h = &histogram{counts: make([]uint64, len(c.buckets))}
+		c.durations[k] = h
+	}
+	v := e.Used.Seconds()
+	for i, b := range c.buckets {
+		if v <= b {
+			h.counts[i]++
+		}
+	}
+	h.count++
+	h.sum += v
+}
+
+func (c *PromCollector) SetGauges(name string, g Gauges) {
+	c.mu.Lock()
+	c.gauges[name] = g
+	c.mu.Unlock()
+}
+
+func (c *PromCollector) Remove(name string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.gauges, name)
+	for _, m := range []map[loadKey]uint64{c.loads, c.failures} {
+		for k := range m {
+			if k.name == name {
+				delete(m, k)
+			}
+		}
+	}
+	for k := range c.durations {
+		if k.name == name {
+			delete(c.durations, k)
+		}
+	}
+}
+
+func (c *PromCollector) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", contentType)
+	bw := bufio.NewWriter(w)
+	c.write(bw, time.Now())
+	_ = bw.Flush()
+}
+
+// write writes all metrics in the text exposition format, the data age is computed at now
+func (c *PromCollector) write(w *bufio.Writer, now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	names := make([]string, 0, len(c.gauges))
+	for name := range c.gauges {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	gauge := func(metric, help string, value func(g Gauges) (float64, bool)) {
+		c.header(w, metric, help, "gauge")
+		for _, name := range names {
+			if v, ok := value(c.gauges[name]); ok {
+				c.sample(w, metric, labels("streamer", name), v)
+			}
+		}
+	}
+	gauge("container_size", "Number of entries in the container.", func(g Gauges) (float64, bool) {
+		return float64(g.Size), true
+	})
+	gauge("data_age_seconds", "Seconds since the last successful load.", func(g Gauges) (float64, bool) {
+		if g.LastLoad.IsZero() {
+			return 0, false
+		}
+		return now.Sub(g.LastLoad).Seconds(), true
+	})
+	gauge("records_added", "Records read since the last base load.", func(g Gauges) (float64, bool) {
+		return float64(g.AddNum), true
+	})
+	gauge("records_failed", "Records failed since the last base load.", func(g Gauges) (float64, bool) {
+		return float64(g.ErrorNum), true
+	})
+
+	keys := make([]loadKey, 0, len(c.loads))
+	for k := range c.loads {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].name != keys[j].name {
+			return keys[i].name < keys[j].name
+		}
+		return keys[i].kind < keys[j].kind
+	})
+	c.header(w, "loads_total", "Number of base and inc loads.", "counter")
+	for _, k := range keys {
+		c.sample(w, "loads_total", labels("streamer", k.name, "kind", k.kind), float64(c.loads[k]))
+	}
+	c.header(w, "load_failures_total", "Number of failed base and inc loads.", "counter")
+	for _, k := range keys {
+		c.sample(w, "load_failures_total", labels("streamer", k.name, "kind", k.kind), float64(c.failures[k]))
+	}
+	c.header(w, "load_duration_seconds", "Duration of base and inc loads.", "histogram")
+	for _, k := range keys {
+		h := c.durations[k]
+		for i, b := range c.buckets {
+			c.sample(w, "load_duration_seconds_bucket",
+				labels("streamer", k.name, "kind", k.kind, "le", formatFloat(b)), float64(h.counts[i]))
+		}
+		c.sample(w, "load_duration_seconds_bucket", labels("streamer", k.name, "kind", k.kind, "le", "+Inf"), float64(h.count))
+		c.sample(w, "load_duration_seconds_sum", labels("streamer", k.name, "kind", k.kind), h.sum)
+		c.sample(w, "load_duration_seconds_count", labels("streamer", k.name, "kind", k.kind), float64(h.count))
+	}
+}
+
+func (c *PromCollector) header(w *bufio.Writer, metric, help, typ string) {
+	_, _ = fmt.Fprintf(w, "# HELP %s_%s %s\n# TYPE %s_%s %s\n", c.namespace, metric, help, c.namespace, metric, typ)
+}
+
+func (c *PromCollector) sample(w *bufio.Writer, metric, labels string, v float64) {
+	_, _ = fmt.Fprintf(w, "%s_%s{%s} %s\n", c.namespace, metric, labels, formatFloat(v))
+}
+
+func labels(kv ...string) string {
+	var sb strings.Builder
+	for i := 0; i+1 < len(kv); i += 2 {
+		if i > 0 {
+			sb.WriteByte(',')
+		}
+		sb.WriteString(kv[i])
+		sb.WriteString(`="`)
+		sb.WriteString(escapeLabel(kv[i+1]))
+		sb.WriteByte('"')
+	}
+	return sb.String()
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func escapeLabel(s string) string {
+	return labelEscaper.Replace(s)
+}
+
+func formatFloat(v float64) string {
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
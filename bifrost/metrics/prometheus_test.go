@@ -0,0 +1,64 @@
+package metrics
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Mintegral-official/mtggokit/bifrost/streamer"
+	"github.com/smartystreets/goconvey/convey"
+)
+
+func scrape(c *PromCollector) string {
+	w := httptest.NewRecorder()
+	c.ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+	body, _ := ioutil.ReadAll(w.Result().Body)
+	return string(body)
+}
+
+func TestPromCollector(t *testing.T) {
+	convey.Convey("Test text exposition", t, func() {
+		c := NewPromCollector("", 0.1, 1)
+		c.ObserveLoad(streamer.LoadEvent{Name: "s1", Kind: streamer.LoadKindBase, Used: 50 * time.Millisecond})
+		c.ObserveLoad(streamer.LoadEvent{Name: "s1", Kind: streamer.LoadKindBase, Used: 500 * time.Millisecond, Err: errors.New("err")})
+		c.ObserveLoad(streamer.LoadEvent{Name: "s1", Kind: streamer.LoadKindInc, Used: 2 * time.Second})
+		c.SetGauges("s1", Gauges{Size: 10, AddNum: 12, ErrorNum: 2, LastLoad: time.Now().Add(-time.Minute)})
+		c.SetGauges(`a"b`, Gauges{Size: 1})
+
+		w := httptest.NewRecorder()
+		c.ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+		convey.So(w.Header().Get("Content-Type"), convey.ShouldEqual, contentType)
+		out := scrape(c)
+		for _, line := range []string{
+			"# TYPE bifrost_container_size gauge",
+			`bifrost_container_size{streamer="s1"} 10`,
+			`bifrost_container_size{streamer="a\"b"} 1`,
+			`bifrost_records_added{streamer="s1"} 12`,
+			`bifrost_records_failed{streamer="s1"} 2`,
+			"# TYPE bifrost_loads_total counter",
+			`bifrost_loads_total{streamer="s1",kind="base"} 2`,
+			`bifrost_loads_total{streamer="s1",kind="inc"} 1`,
+			`bifrost_load_failures_total{streamer="s1",kind="base"} 1`,
+			`bifrost_load_failures_total{streamer="s1",kind="inc"} 0`,
+			"# TYPE bifrost_load_duration_seconds histogram",
+			`bifrost_load_duration_seconds_bucket{streamer="s1",kind="base",le="0.1"} 1`,
+			`bifrost_load_duration_seconds_bucket{streamer="s1",kind="base",le="1"} 2`,
+			`bifrost_load_duration_seconds_bucket{streamer="s1",kind="base",le="+Inf"} 2`,
+			`bifrost_load_duration_seconds_bucket{streamer="s1",kind="inc",le="1"} 0`,
+			`bifrost_load_duration_seconds_count{streamer="s1",kind="inc"} 1`,
+			`bifrost_load_duration_seconds_sum{streamer="s1",kind="inc"} 2`,
+		} {
+			convey.So(out, convey.ShouldContainSubstring, line+"\n")
+		}
+		convey.So(out, convey.ShouldContainSubstring, `bifrost_data_age_seconds{streamer="s1"} 6`)
+		// never loaded, no age
+		convey.So(out, convey.ShouldNotContainSubstring, `bifrost_data_age_seconds{streamer="a\"b"}`)
+
+		c.Remove("s1")
+		out = scrape(c)
+		convey.So(strings.Contains(out, `streamer="s1"`), convey.ShouldBeFalse)
+	})
+}
@@ -0,0 +1,60 @@
+package bifrost
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Mintegral-official/mtggokit/bifrost/container"
+	"github.com/Mintegral-official/mtggokit/bifrost/metrics"
+	"github.com/Mintegral-official/mtggokit/bifrost/streamer"
+	"github.com/smartystreets/goconvey/convey"
+)
+
+func TestBifrost_Metrics(t *testing.T) {
+	convey.Convey("Test metrics of registered streamers", t, func() {
+		dir, err := ioutil.TempDir("", "bifrost")
+		convey.So(err, convey.ShouldBeNil)
+		defer os.RemoveAll(dir)
+		path := filepath.Join(dir, "base")
+		convey.So(ioutil.WriteFile(path, []byte("a\t1\nb\t2\nbad\n"), 0644), convey.ShouldBeNil)
+
+		c := metrics.NewPromCollector("bifrost")
+		bf := NewBifrost(WithMetrics(c, 10*time.Millisecond))
+		lfs := streamer.NewFileStreamer(&streamer.LocalFileStreamerCfg{
+			Name:       "file",
+			Path:       path,
+			UpdatMode:  streamer.Static,
+			IsSync:     true,
+			DataParser: &streamer.DefaultTextParser{},
+		})
+		lfs.SetContainer(&container.BufferedMapContainer{Tolerate: 0.5})
+		convey.So(bf.Register("file", lfs), convey.ShouldBeNil)
+		// not observable, sampled by GetInfo
+		convey.So(bf.Register("fake", &FakeStreamer{}), convey.ShouldBeNil)
+		convey.So(bf.Start(context.Background()), convey.ShouldBeNil)
+		convey.So(bf.WaitReady(), convey.ShouldBeNil)
+		time.Sleep(50 * time.Millisecond)
+
+		w := httptest.NewRecorder()
+		c.ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+		out := w.Body.String()
+		convey.So(out, convey.ShouldContainSubstring, `bifrost_container_size{streamer="file"} 2`+"\n")
+		convey.So(out, convey.ShouldContainSubstring, `bifrost_records_added{streamer="file"} 3`+"\n")
+		convey.So(out, convey.ShouldContainSubstring, `bifrost_records_failed{streamer="file"} 1`+"\n")
+		convey.So(out, convey.ShouldContainSubstring, `bifrost_loads_total{streamer="file",kind="base"} 1`+"\n")
+		convey.So(out, convey.ShouldContainSubstring, `bifrost_load_failures_total{streamer="file",kind="base"} 0`+"\n")
+		convey.So(out, convey.ShouldContainSubstring, `bifrost_data_age_seconds{streamer="file"}`)
+		convey.So(out, convey.ShouldContainSubstring, `bifrost_container_size{streamer="fake"} 0`+"\n")
+
+		convey.So(bf.Unregister("file"), convey.ShouldBeNil)
+		w = httptest.NewRecorder()
+		c.ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+		convey.So(w.Body.String(), convey.ShouldNotContainSubstring, `streamer="file"`)
+		convey.So(bf.Stop(), convey.ShouldBeNil)
+	})
+}
@@ -0,0 +1,135 @@
+package bifrost
+
+import (
+	"errors"
+	"sync"
+
+	"github.com/Mintegral-official/mtggokit/bifrost/container"
+	"github.com/Mintegral-official/mtggokit/bifrost/streamer"
+)
+
+// ContainerCreator creates a container for the streamers built from config
+type ContainerCreator func(numPartition int, tolerate float64) container.Container
+
+var registry = struct {
+	sync.RWMutex
+	parsers    map[string]streamer.DataParser
+	containers map[string]ContainerCreator
+	codecs     map[string]container.ValueCodec
+	types      map[string]interface{}
+}{
+	parsers: map[string]streamer.DataParser{
+		"default": &streamer.DefaultTextParser{},
+		"tsv":     delimitedParser(streamer.NewTSVParser),
+		"csv":     delimitedParser(streamer.NewCSVParser),
+	},
+	containers: map[string]ContainerCreator{
+		"buffered_map": func(numPartition int, tolerate float64) container.Container {
+			return &container.BufferedMapContainer{Tolerate: tolerate}
+		},
+		"blocking_map": func(numPartition int, tolerate float64) container.Container {
+			return container.CreateBlockingMapContainer(numPartition, tolerate)
+		},
+		"buffered_klist": func(numPartition int, tolerate float64) container.Container {
+			return container.CreateBufferedKListContainer()
+		},
+		"sorted": func(numPartition int, tolerate float64) container.Container {
+			return container.CreateSortedContainer(tolerate)
+		},
+	},
+	codecs: map[string]container.ValueCodec{
+		"string": container.StringCodec{},
+	},
+	types: map[string]interface{}{},
+}
+
+// delimitedParser creates the parser keyed by the first column, the value is all the columns
+func delimitedParser(create func(*streamer.DelimitedParserCfg) (*streamer.DelimitedParser, error)) streamer.DataParser {
+	p, _ := create(&streamer.DelimitedParserCfg{})
+	return p
+}
+
+// RegisterParser makes a DataParser selectable by name from the config file
+func RegisterParser(name string, parser streamer.DataParser) error {
+	registry.Lock()
+	defer registry.Unlock()
+	if _, ok := registry.parsers[name]; ok {
+		return errors.New("parser[" + name + "] has already exist")
+	}
+	registry.parsers[name] = parser
+	return nil
+}
+
+// RegisterContainer makes a container type selectable by name from the config file
+func RegisterContainer(name string, creator ContainerCreator) error {
+	registry.Lock()
+	defer registry.Unlock()
+	if _, ok := registry.containers[name]; ok {
+		return errors.New("container[" + name + "] has already exist")
+	}
+	registry.containers[name] = creator
+	return nil
+}
+
+// RegisterCodec makes a snapshot value codec selectable by name from the config file
+func RegisterCodec(name string, codec container.ValueCodec) error {
+	registry.Lock()
+	defer registry.Unlock()
+	if _, ok := registry.codecs[name]; ok {
+		return errors.New("codec[" + name + "] has already exist")
+	}
+	registry.codecs[name] = codec
+	return nil
+}
+
+// RegisterType makes a struct type selectable by name as the value type of the parsers
+// declared by the config file, prototype is a value of the struct or a pointer to it
+func RegisterType(name string, prototype interface{}) error {
+	registry.Lock()
+	defer registry.Unlock()
+	if _, ok := registry.types[name]; ok {
+		return errors.New("type[" + name + "] has already exist")
+	}
+	registry.types[name] = prototype
+	return nil
+}
+
+func getParser(name string) (streamer.DataParser, error) {
+	registry.RLock()
+	defer registry.RUnlock()
+	p, ok := registry.parsers[name]
+	if !ok {
+		return nil, errors.New("not found parser[" + name + "]")
+	}
+	return p, nil
+}
+
+func newContainer(name string, numPartition int, tolerate float64) (container.Container, error) {
+	registry.RLock()
+	defer registry.RUnlock()
+	c, ok := registry.containers[name]
+	if !ok {
+		return nil, errors.New("not found container[" + name + "]")
+	}
+	return c(numPartition, tolerate), nil
+}
+
+func getCodec(name string) (container.ValueCodec, error) {
+	registry.RLock()
+	defer registry.RUnlock()
+	c, ok := registry.codecs[name]
+	if !ok {
+		return nil, errors.New("not found codec[" + name + "]")
+	}
+	return c, nil
+}
+
+func getType(name string) (interface{}, error) {
+	registry.RLock()
+	defer registry.RUnlock()
+	t, ok := registry.types[name]
+	if !ok {
+		return nil, errors.New("not found type[" + name + "]")
+	}
+	return t, nil
+}
@@ -0,0 +1,83 @@
+package streamer
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/Mintegral-official/mtggokit/bifrost/container"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/bsontype"
+)
+
+type BSONParserCfg struct {
+	KeyField string  // the bson name of the key field, "a.b" for a field of a sub document
+	KeyType  KeyType // the type of the key
+	// Type is a struct or a pointer to a struct each document is unmarshaled into, the value
+	// is a pointer to it. The value is a bson.M if it's nil.
+	Type interface{}
+}
+
+// BSONParser parses the documents read by MongoStreamer
+type BSONParser struct {
+	cfg  BSONParserCfg
+	path []string
+	typ  reflect.Type
+}
+
+func NewBSONParser(cfg *BSONParserCfg) (*BSONParser, error) {
+	if cfg.KeyField == "" {
+		return nil, errors.New("KeyField is empty")
+	}
+	bp := &BSONParser{cfg: *cfg, path: strings.Split(cfg.KeyField, ".")}
+	if cfg.Type != nil {
+		t, err := structType(cfg.Type)
+		if err != nil {
+			return nil, err
+		}
+		bp.typ = t
+	}
+	return bp, nil
+}
+
+func (bp *BSONParser) Parse(data []byte, userData interface{}) []ParserResult {
+	rv, err := bson.Raw(data).LookupErr(bp.path...)
+	if err != nil {
+		return []ParserResult{{Err: errors.New("not found key field[" + bp.cfg.KeyField + "]")}}
+	}
+	var keyValue interface{}
+	switch rv.Type {
+	case bsontype.String:
+		keyValue = rv.StringValue()
+	case bsontype.Int32:
+		keyValue = rv.Int32()
+	case bsontype.Int64:
+		keyValue = rv.Int64()
+	case bsontype.Double:
+		keyValue = rv.Double()
+	case bsontype.ObjectID:
+		keyValue = rv.ObjectID().Hex()
+	default:
+		return []ParserResult{{Err: fmt.Errorf("not support bson type[%s] of key field[%s]", rv.Type, bp.cfg.KeyField)}}
+	}
+	key, err := keyOf(bp.cfg.KeyType, keyValue)
+	if err != nil {
+		return []ParserResult{{Err: fmt.Errorf("%s, field[%s]", err.Error(), bp.cfg.KeyField)}}
+	}
+	var value interface{}
+	if bp.typ == nil {
+		m := bson.M{}
+		if err := bson.Unmarshal(data, &m); err != nil {
+			return []ParserResult{{Err: errors.New("unmarshal bson error: " + err.Error())}}
+		}
+		value = m
+	} else {
+		v := reflect.New(bp.typ)
+		if err := bson.Unmarshal(data, v.Interface()); err != nil {
+			return []ParserResult{{Err: errors.New("unmarshal bson error: " + err.Error())}}
+		}
+		value = v.Interface()
+	}
+	return []ParserResult{{DataMode: container.DataModeAdd, Key: key, Value: value}}
+}
@@ -0,0 +1,39 @@
+package streamer
+
+import (
+	"testing"
+
+	"github.com/Mintegral-official/mtggokit/bifrost/container"
+	"github.com/smartystreets/goconvey/convey"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+type bsonCampaign struct {
+	CampaignId int64  `bson:"campaignId"`
+	Package    string `bson:"packageName"`
+}
+
+func TestBSONParser(t *testing.T) {
+	convey.Convey("Test BSON parser", t, func() {
+		p, err := NewBSONParser(&BSONParserCfg{KeyField: "campaignId", KeyType: KeyInt64, Type: &bsonCampaign{}})
+		convey.So(err, convey.ShouldBeNil)
+		data, _ := bson.Marshal(bson.M{"campaignId": int32(3), "packageName": "com.a"})
+		r := p.Parse(data, nil)
+		convey.So(r[0].Err, convey.ShouldBeNil)
+		convey.So(r[0].Key, convey.ShouldResemble, container.I64Key(3))
+		convey.So(r[0].Value, convey.ShouldResemble, &bsonCampaign{CampaignId: 3, Package: "com.a"})
+
+		data, _ = bson.Marshal(bson.M{"packageName": "com.a"})
+		convey.So(p.Parse(data, nil)[0].Err.Error(), convey.ShouldEqual, "not found key field[campaignId]")
+		data, _ = bson.Marshal(bson.M{"campaignId": true})
+		convey.So(p.Parse(data, nil)[0].Err.Error(), convey.ShouldEqual, "not support bson type[boolean] of key field[campaignId]")
+
+		// a key of a sub document, into a bson.M
+		p, err = NewBSONParser(&BSONParserCfg{KeyField: "app.package"})
+		convey.So(err, convey.ShouldBeNil)
+		data, _ = bson.Marshal(bson.M{"app": bson.M{"package": "com.b"}})
+		r = p.Parse(data, nil)
+		convey.So(r[0].Key, convey.ShouldResemble, container.StrKey("com.b"))
+		convey.So(r[0].Value.(bson.M)["app"], convey.ShouldResemble, bson.M{"package": "com.b"})
+	})
+}
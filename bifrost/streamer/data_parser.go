@@ -1,6 +1,12 @@
 package streamer
 
 import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+
 	"github.com/Mintegral-official/mtggokit/bifrost/container"
 )
 
@@ -14,3 +20,101 @@ type ParserResult struct {
 type DataParser interface {
 	Parse([]byte, interface{}) []ParserResult
 }
+
+// Row is the current row of a query, *sql.Rows implements it
+type Row interface {
+	Columns() ([]string, error)
+	Scan(dest ...interface{}) error
+}
+
+// RowParser parses the rows read by SQLStreamer
+type RowParser interface {
+	Parse(row Row, userData interface{}) []ParserResult
+}
+
+// KeyType is the type of the keys made by the built-in parsers
+type KeyType int
+
+const (
+	KeyString KeyType = iota // container.StrKey
+	KeyInt64                 // container.I64Key
+)
+
+var keyTypeStrMap = map[KeyType]string{
+	KeyString: "string",
+	KeyInt64:  "int64",
+}
+
+func (kt KeyType) String() string {
+	return keyTypeStrMap[kt]
+}
+
+// ParseKeyType converts "string" or "int64" to KeyType, "" is KeyString
+func ParseKeyType(s string) (KeyType, error) {
+	if s == "" {
+		return KeyString, nil
+	}
+	for k, v := range keyTypeStrMap {
+		if strings.EqualFold(v, s) {
+			return k, nil
+		}
+	}
+	return KeyString, errors.New("unknown key type[" + s + "]")
+}
+
+// makeKey converts a text key
+func makeKey(kt KeyType, s string) (container.MapKey, error) {
+	if kt == KeyInt64 {
+		v, err := strconv.ParseInt(strings.TrimSpace(s), 10, 64)
+		if err != nil {
+			return nil, errors.New("invalid int64 key[" + s + "]")
+		}
+		return container.I64Key(v), nil
+	}
+	return container.StrKey(s), nil
+}
+
+// keyOf converts the key field of a decoded record, such as an int field of a struct or a
+// json.Number of a map
+func keyOf(kt KeyType, v interface{}) (container.MapKey, error) {
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.String:
+		return makeKey(kt, rv.String())
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if kt == KeyInt64 {
+			return container.I64Key(rv.Int()), nil
+		}
+		return container.StrKey(strconv.FormatInt(rv.Int(), 10)), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		if kt == KeyInt64 {
+			return container.I64Key(int64(rv.Uint())), nil
+		}
+		return container.StrKey(strconv.FormatUint(rv.Uint(), 10)), nil
+	case reflect.Float32, reflect.Float64:
+		f := rv.Float()
+		if kt == KeyInt64 && f == float64(int64(f)) {
+			return container.I64Key(int64(f)), nil
+		}
+		if kt == KeyString {
+			return container.StrKey(strconv.FormatFloat(f, 'f', -1, 64)), nil
+		}
+	case reflect.Ptr:
+		if !rv.IsNil() {
+			return keyOf(kt, rv.Elem().Interface())
+		}
+	}
+	return nil, fmt.Errorf("invalid %s key[%v]", kt, v)
+}
+
+// structType returns the struct type of the prototype, a struct or a pointer to it
+func structType(prototype interface{}) (reflect.Type, error) {
+	t := reflect.TypeOf(prototype)
+	if t != nil && t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t == nil || t.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("type[%T] is not a struct", prototype)
+	}
+	return t, nil
+}
@@ -1,9 +1,9 @@
 package streamer
 
 import (
-	"github.com/Mintegral-official/mtggokit/bifrost/container"
-	"github.com/easierway/concurrent_map"
 	"strings"
+
+	"github.com/Mintegral-official/mtggokit/bifrost/container"
 )
 
 type DefaultTextParser struct {
@@ -15,5 +15,5 @@ func (*DefaultTextParser) Parse(data []byte, userData interface{}) []ParserResul
 	if len(items) != 2 {
 		return nil
 	}
-	return []ParserResult{{container.DataModeAdd, concurrent_map.StrKey(items[0]), items[1], nil}}
+	return []ParserResult{{container.DataModeAdd, container.StrKey(items[0]), items[1], nil}}
 }
@@ -0,0 +1,190 @@
+package streamer
+
+import (
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/Mintegral-official/mtggokit/bifrost/container"
+)
+
+type DelimitedParserCfg struct {
+	Comma     rune    // the separator of the columns, '\t' by default
+	KeyColumn int     // the index of the key column, from 0
+	KeyType   KeyType // the type of the key
+	// Columns names the columns, by their index, "" skips a column. The value is a []string of
+	// all the columns if it's empty, a map[string]string of the named columns otherwise, or a
+	// pointer to Type.
+	Columns []string
+	// Type is a struct or a pointer to a struct, the named columns are set to its exported
+	// fields of the same names, they may be strings, bools, ints, uints or floats
+	Type interface{}
+}
+
+// DelimitedParser parses the lines of TSV or CSV files, a line is a record. CSV lines follow
+// RFC 4180 so that they may have quoted fields, TSV lines are only split by the tabs.
+type DelimitedParser struct {
+	cfg    DelimitedParserCfg
+	typ    reflect.Type
+	fields []int // the field index of each column, -1 for the skipped ones
+}
+
+// NewTSVParser creates a DelimitedParser splitting the lines by tabs
+func NewTSVParser(cfg *DelimitedParserCfg) (*DelimitedParser, error) {
+	c := *cfg
+	c.Comma = '\t'
+	return NewDelimitedParser(&c)
+}
+
+// NewCSVParser creates a DelimitedParser splitting the lines by commas
+func NewCSVParser(cfg *DelimitedParserCfg) (*DelimitedParser, error) {
+	c := *cfg
+	c.Comma = ','
+	return NewDelimitedParser(&c)
+}
+
+func NewDelimitedParser(cfg *DelimitedParserCfg) (*DelimitedParser, error) {
+	dp := &DelimitedParser{cfg: *cfg}
+	if dp.cfg.Comma == 0 {
+		dp.cfg.Comma = '\t'
+	}
+	if dp.cfg.KeyColumn < 0 {
+		return nil, fmt.Errorf("invalid key column[%d]", dp.cfg.KeyColumn)
+	}
+	if dp.cfg.Type == nil {
+		return dp, nil
+	}
+	t, err := structType(dp.cfg.Type)
+	if err != nil {
+		return nil, err
+	}
+	if len(dp.cfg.Columns) == 0 {
+		return nil, errors.New("no column for type[" + t.String() + "]")
+	}
+	dp.typ = t
+	dp.fields = make([]int, len(dp.cfg.Columns))
+	for i, name := range dp.cfg.Columns {
+		dp.fields[i] = -1
+		if name == "" {
+			continue
+		}
+		f, ok := t.FieldByName(name)
+		if !ok || len(f.Index) != 1 || f.PkgPath != "" {
+			return nil, errors.New("not found field[" + name + "] in type[" + t.String() + "]")
+		}
+		if !settable(f.Type.Kind()) {
+			return nil, errors.New("not support type[" + f.Type.String() + "] of field[" + name + "]")
+		}
+		dp.fields[i] = f.Index[0]
+	}
+	return dp, nil
+}
+
+func (dp *DelimitedParser) Parse(data []byte, userData interface{}) []ParserResult {
+	line := strings.TrimRight(string(data), "\r\n")
+	if line == "" {
+		return nil
+	}
+	columns, err := dp.split(line)
+	if err != nil {
+		return []ParserResult{{Err: err}}
+	}
+	if dp.cfg.KeyColumn >= len(columns) {
+		return []ParserResult{{Err: fmt.Errorf("no key column[%d], line[%s]", dp.cfg.KeyColumn, line)}}
+	}
+	key, err := makeKey(dp.cfg.KeyType, columns[dp.cfg.KeyColumn])
+	if err != nil {
+		return []ParserResult{{Err: err}}
+	}
+	value, err := dp.value(columns)
+	if err != nil {
+		return []ParserResult{{Err: fmt.Errorf("%s, line[%s]", err.Error(), line)}}
+	}
+	return []ParserResult{{DataMode: container.DataModeAdd, Key: key, Value: value}}
+}
+
+func (dp *DelimitedParser) split(line string) ([]string, error) {
+	if dp.cfg.Comma == '\t' {
+		return strings.Split(line, "\t"), nil
+	}
+	r := csv.NewReader(bytes.NewReader([]byte(line)))
+	r.Comma = dp.cfg.Comma
+	r.FieldsPerRecord = -1
+	return r.Read()
+}
+
+func (dp *DelimitedParser) value(columns []string) (interface{}, error) {
+	if len(dp.cfg.Columns) == 0 {
+		return columns, nil
+	}
+	if dp.typ == nil {
+		m := make(map[string]string, len(dp.cfg.Columns))
+		for i, name := range dp.cfg.Columns {
+			if name != "" && i < len(columns) {
+				m[name] = columns[i]
+			}
+		}
+		return m, nil
+	}
+	v := reflect.New(dp.typ)
+	for i, field := range dp.fields {
+		if field < 0 || i >= len(columns) {
+			continue
+		}
+		if err := setField(v.Elem().Field(field), columns[i]); err != nil {
+			return nil, fmt.Errorf("column[%s]: %s", dp.cfg.Columns[i], err.Error())
+		}
+	}
+	return v.Interface(), nil
+}
+
+func settable(kind reflect.Kind) bool {
+	switch kind {
+	case reflect.String, reflect.Bool,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return true
+	}
+	return false
+}
+
+// setField sets a field of a kind accepted by settable from text, an empty text leaves it zero
+func setField(f reflect.Value, s string) error {
+	if s == "" {
+		return nil
+	}
+	switch f.Kind() {
+	case reflect.String:
+		f.SetString(s)
+	case reflect.Bool:
+		v, err := strconv.ParseBool(s)
+		if err != nil {
+			return errors.New("invalid bool[" + s + "]")
+		}
+		f.SetBool(v)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		v, err := strconv.ParseInt(s, 10, f.Type().Bits())
+		if err != nil {
+			return errors.New("invalid int[" + s + "]")
+		}
+		f.SetInt(v)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		v, err := strconv.ParseUint(s, 10, f.Type().Bits())
+		if err != nil {
+			return errors.New("invalid uint[" + s + "]")
+		}
+		f.SetUint(v)
+	case reflect.Float32, reflect.Float64:
+		v, err := strconv.ParseFloat(s, f.Type().Bits())
+		if err != nil {
+			return errors.New("invalid float[" + s + "]")
+		}
+		f.SetFloat(v)
+	}
+	return nil
+}
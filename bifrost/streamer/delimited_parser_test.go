@@ -0,0 +1,52 @@
+package streamer
+
+import (
+	"testing"
+
+	"github.com/Mintegral-official/mtggokit/bifrost/container"
+	"github.com/smartystreets/goconvey/convey"
+)
+
+type offer struct {
+	Id      int64
+	Package string
+	Price   float64
+	Active  bool
+}
+
+func TestDelimitedParser(t *testing.T) {
+	convey.Convey("Test TSV parser", t, func() {
+		p, err := NewTSVParser(&DelimitedParserCfg{})
+		convey.So(err, convey.ShouldBeNil)
+		r := p.Parse([]byte("a\tb\tc\n"), nil)
+		convey.So(r, convey.ShouldResemble, []ParserResult{{Key: container.StrKey("a"), Value: []string{"a", "b", "c"}}})
+		convey.So(p.Parse([]byte("\n"), nil), convey.ShouldBeNil)
+
+		p, err = NewTSVParser(&DelimitedParserCfg{KeyColumn: 1, KeyType: KeyInt64, Columns: []string{"name", "", "country"}})
+		convey.So(err, convey.ShouldBeNil)
+		r = p.Parse([]byte("foo\t12\tUS"), nil)
+		convey.So(r[0].Key, convey.ShouldResemble, container.I64Key(12))
+		convey.So(r[0].Value, convey.ShouldResemble, map[string]string{"name": "foo", "country": "US"})
+		convey.So(p.Parse([]byte("foo\tx\tUS"), nil)[0].Err.Error(), convey.ShouldEqual, "invalid int64 key[x]")
+		convey.So(p.Parse([]byte("foo"), nil)[0].Err.Error(), convey.ShouldEqual, "no key column[1], line[foo]")
+	})
+
+	convey.Convey("Test CSV parser into a struct", t, func() {
+		p, err := NewCSVParser(&DelimitedParserCfg{
+			KeyType: KeyInt64,
+			Columns: []string{"Id", "Package", "Price", "Active"},
+			Type:    offer{},
+		})
+		convey.So(err, convey.ShouldBeNil)
+		r := p.Parse([]byte(`7,"com.a,b",1.5,true`), nil)
+		convey.So(r[0].Err, convey.ShouldBeNil)
+		convey.So(r[0].Key, convey.ShouldResemble, container.I64Key(7))
+		convey.So(r[0].Value, convey.ShouldResemble, &offer{Id: 7, Package: "com.a,b", Price: 1.5, Active: true})
+		convey.So(p.Parse([]byte("7,a,x,true"), nil)[0].Err.Error(), convey.ShouldEqual, "column[Price]: invalid float[x], line[7,a,x,true]")
+
+		_, err = NewCSVParser(&DelimitedParserCfg{Columns: []string{"Name"}, Type: &offer{}})
+		convey.So(err.Error(), convey.ShouldEqual, "not found field[Name] in type[streamer.offer]")
+		_, err = NewCSVParser(&DelimitedParserCfg{Type: 1})
+		convey.So(err.Error(), convey.ShouldEqual, "type[int] is not a struct")
+	})
+}
@@ -0,0 +1,188 @@
+package streamer
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Mintegral-official/mtggokit/bifrost/container"
+	"github.com/Mintegral-official/mtggokit/bifrost/log"
+)
+
+// Dependent is implemented by the streamers built over others. Bifrost runs the first load of
+// the streamers it depends on before its own, and reloads its base after every successful base
+// load of any of them.
+type Dependent interface {
+	DependsOn() []string
+}
+
+type DerivedStreamerCfg struct {
+	Name string
+	// Upstreams are the streamers the container is built from, by the names they are registered
+	// to Bifrost with
+	Upstreams map[string]Streamer
+	// Build returns the records of the container from the containers of the upstreams, they
+	// are loaded by LoadBase. It's called with the upstreams read only, it must not modify them.
+	Build        func(upstreams map[string]container.Container, userData interface{}) []ParserResult
+	UserData     interface{}
+	Logger       log.BiLogger
+	OnFinishBase func(streamer Streamer)
+}
+
+// DerivedStreamer builds its container by a user function over the containers of other
+// streamers, such as a join of campaigns and creatives. It has no update loop of its own: it's
+// built once by UpdateData, then rebuilt by Reload, which Bifrost calls after the base loads of
+// the upstreams.
+type DerivedStreamer struct {
+	container container.Container
+	cfg       *DerivedStreamerCfg
+	result    []ParserResult
+	curLen    int
+	loadInfo
+	observer Observer
+	mu       sync.Mutex // serializes the builds
+}
+
+func NewDerivedStreamer(cfg *DerivedStreamerCfg) (*DerivedStreamer, error) {
+	if cfg.Build == nil {
+		return nil, errors.New("Build is nil, streamer[" + cfg.Name + "]")
+	}
+	if len(cfg.Upstreams) == 0 {
+		return nil, errors.New("no upstream, streamer[" + cfg.Name + "]")
+	}
+	return &DerivedStreamer{cfg: cfg}, nil
+}
+
+func (ds *DerivedStreamer) SetContainer(c container.Container) {
+	ds.container = c
+}
+
+func (ds *DerivedStreamer) GetContainer() container.Container {
+	return ds.container
+}
+
+// SetObserver sets the observer notified after each build
+func (ds *DerivedStreamer) SetObserver(o Observer) {
+	ds.observer = o
+}
+
+// GetSchedInfo has no interval, the container is only rebuilt on demand
+func (ds *DerivedStreamer) GetSchedInfo() *SchedInfo {
+	return &SchedInfo{}
+}
+
+// DependsOn returns the names of the upstreams, sorted
+func (ds *DerivedStreamer) DependsOn() []string {
+	names := make([]string, 0, len(ds.cfg.Upstreams))
+	for name := range ds.cfg.Upstreams {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Describe returns the upstreams, see container.Describer
+func (ds *DerivedStreamer) Describe() string {
+	return "derived[" + strings.Join(ds.DependsOn(), ",") + "]"
+}
+
+func (ds *DerivedStreamer) HasNext() (bool, error) {
+	return ds.curLen < len(ds.result), nil
+}
+
+func (ds *DerivedStreamer) Next() (container.DataMode, container.MapKey, interface{}, error) {
+	ds.addTotal()
+	if ds.curLen >= len(ds.result) {
+		ds.addError()
+		return container.DataModeAdd, nil, nil, errors.New("no more records")
+	}
+	r := ds.result[ds.curLen]
+	ds.curLen++
+	if r.Err != nil {
+		ds.addError()
+	}
+	return r.DataMode, r.Key, r.Value, r.Err
+}
+
+// UpdateData builds the container once, it starts no goroutine
+func (ds *DerivedStreamer) UpdateData(ctx context.Context) error {
+	return ds.Update(ctx)
+}
+
+// Update builds the container, it is called by Sched once
+func (ds *DerivedStreamer) Update(ctx context.Context) error {
+	if err := ds.Reload(ctx, LoadKindBase); err != nil {
+		ds.WarnStatus("Build error:" + err.Error())
+		return err
+	}
+	ds.InfoStatus("Build succ")
+	return nil
+}
+
+// Reload rebuilds the container whatever the kind is
+func (ds *DerivedStreamer) Reload(ctx context.Context, kind LoadKind) (err error) {
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+	start := time.Now()
+	ds.setLastBaseTime(start)
+	defer func() {
+		ds.setBaseTimeUsed(time.Now().Sub(start))
+		ds.notify(start, err)
+	}()
+	upstreams := make(map[string]container.Container, len(ds.cfg.Upstreams))
+	for name, s := range ds.cfg.Upstreams {
+		c := s.GetContainer()
+		if c == nil {
+			return errors.New("container of upstream[" + name + "] is nil")
+		}
+		upstreams[name] = c
+	}
+	ds.resetNums()
+	ds.result = ds.cfg.Build(upstreams, ds.cfg.UserData)
+	ds.curLen = 0
+	err = ds.container.LoadBase(ds)
+	ds.result = nil
+	if ds.cfg.OnFinishBase != nil {
+		ds.cfg.OnFinishBase(ds)
+	}
+	return err
+}
+
+func (ds *DerivedStreamer) notify(start time.Time, err error) {
+	if ds.observer == nil {
+		return
+	}
+	ds.observer(LoadEvent{
+		Name:  ds.cfg.Name,
+		Kind:  LoadKindBase,
+		Start: start,
+		Used:  time.Since(start),
+		Err:   err,
+		Info:  ds.GetInfo(),
+	})
+}
+
+func (ds *DerivedStreamer) GetInfo() *Info {
+	return ds.info(ds.cfg.Name, ds.container)
+}
+
+func (ds *DerivedStreamer) InfoStatus(s string) {
+	if ds.cfg.Logger != nil {
+		ds.cfg.Logger.Infof("%s, streamInfo[%s]", s, ds.getInfoStr())
+	}
+}
+
+func (ds *DerivedStreamer) WarnStatus(s string) {
+	if ds.cfg.Logger != nil {
+		ds.cfg.Logger.Warnf("%s, streamInfo[%s]", s, ds.getInfoStr())
+	}
+}
+
+func (ds *DerivedStreamer) getInfoStr() string {
+	data, _ := json.Marshal(ds.GetInfo())
+	return string(data)
+}
@@ -1,5 +1,10 @@
 package streamer
 
+import (
+	"errors"
+	"strings"
+)
+
 type UpdatMode int64
 
 const (
@@ -24,3 +29,13 @@ func (um *UpdatMode) toString() string {
 		return v
 	}
 }
+
+// ParseUpdatMode converts a mode name such as "Dynamic" or "dyninc" to UpdatMode
+func ParseUpdatMode(s string) (UpdatMode, error) {
+	for k, v := range updatModeStrMap {
+		if strings.EqualFold(v, s) {
+			return k, nil
+		}
+	}
+	return Static, errors.New("unknown update mode[" + s + "]")
+}
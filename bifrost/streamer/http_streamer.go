@@ -0,0 +1,409 @@
+package streamer
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Mintegral-official/mtggokit/bifrost/container"
+	"github.com/klauspost/compress/zstd"
+)
+
+const (
+	defaultHTTPMaxBytes  = 1 << 30
+	defaultHTTPRetryWait = time.Second
+)
+
+var errBodyTooLarge = errors.New("body too large")
+
+// HTTPStreamer downloads a text file from a URL and loads it as the base, line by line. Like the
+// mtime check of LocalFileStreamer, the file is only downloaded again when it changed: the
+// ETag and Last-Modified of the last load are sent as If-None-Match and If-Modified-Since, and a
+// 304 response keeps the data.
+type HTTPStreamer struct {
+	container    container.Container
+	cfg          *HTTPStreamerCfg
+	client       *http.Client
+	reader       *bufio.Reader
+	line         []byte
+	readErr      error
+	result       []ParserResult
+	curLen       int
+	hasInit      bool
+	etag         string
+	lastModified string
+	loadInfo
+
+	observer Observer
+	mu       sync.Mutex // serializes Update and Reload
+	wg       sync.WaitGroup
+}
+
+func NewHTTPStreamer(cfg *HTTPStreamerCfg) *HTTPStreamer {
+	hs := &HTTPStreamer{
+		cfg:    cfg,
+		client: cfg.Client,
+	}
+	if hs.client == nil {
+		hs.client = &http.Client{}
+	}
+	return hs
+}
+
+func (hs *HTTPStreamer) SetContainer(container container.Container) {
+	hs.container = container
+}
+
+func (hs *HTTPStreamer) GetContainer() container.Container {
+	return hs.container
+}
+
+// SetObserver sets the observer notified after each load, call it before UpdateData
+func (hs *HTTPStreamer) SetObserver(o Observer) {
+	hs.observer = o
+}
+
+func (hs *HTTPStreamer) GetSchedInfo() *SchedInfo {
+	return &SchedInfo{
+		TimeInterval: hs.cfg.Interval,
+	}
+}
+
+// Describe returns the source of the base loads, see container.Describer
+func (hs *HTTPStreamer) Describe() string {
+	return "http[" + hs.cfg.URL + "]"
+}
+
+func (hs *HTTPStreamer) HasNext() (bool, error) {
+	if hs.curLen < len(hs.result) {
+		return true, nil
+	}
+	for {
+		line, err := hs.reader.ReadBytes('\n')
+		if len(line) > 0 && (err == nil || err == io.EOF) {
+			line = trimLine(line)
+			if len(line) == 0 {
+				continue
+			}
+			hs.line = line
+			return true, nil
+		}
+		if err == io.EOF {
+			return false, nil
+		}
+		if err != nil {
+			// the download broke, LoadBase keeps the current data
+			hs.readErr = err
+			return false, err
+		}
+	}
+}
+
+func trimLine(line []byte) []byte {
+	for len(line) > 0 && (line[len(line)-1] == '\n' || line[len(line)-1] == '\r') {
+		line = line[:len(line)-1]
+	}
+	return line
+}
+
+func (hs *HTTPStreamer) Next() (container.DataMode, container.MapKey, interface{}, error) {
+	hs.addTotal()
+	if hs.curLen < len(hs.result) {
+		r := hs.result[hs.curLen]
+		hs.curLen++
+		if r.Err != nil {
+			hs.addError()
+		}
+		return r.DataMode, r.Key, r.Value, r.Err
+	}
+	result := hs.cfg.DataParser.Parse(hs.line, hs.cfg.UserData)
+	if result == nil {
+		hs.addError()
+		return container.DataModeAdd, nil, nil, errors.New("Parser error")
+	}
+	hs.curLen = 0
+	hs.result = result
+	if hs.curLen < len(hs.result) {
+		r := hs.result[hs.curLen]
+		hs.curLen++
+		if r.Err != nil {
+			hs.addError()
+		}
+		return r.DataMode, r.Key, r.Value, r.Err
+	}
+	hs.addError()
+	return container.DataModeAdd, nil, nil, errors.New(fmt.Sprintf("Index[%d] error, len[%d]", hs.curLen, len(hs.result)))
+}
+
+func (hs *HTTPStreamer) UpdateData(ctx context.Context) error {
+	if hs.cfg.IsSync {
+		if err := hs.Update(ctx); err != nil {
+			return err
+		}
+	}
+	hs.wg.Add(1)
+	go func() {
+		defer hs.wg.Done()
+		if !hs.cfg.IsSync {
+			_ = hs.Update(ctx)
+		}
+		for {
+			base := time.After(time.Duration(hs.cfg.Interval) * time.Second)
+			select {
+			case <-ctx.Done():
+				return
+			case <-base:
+				_ = hs.Update(ctx)
+			}
+		}
+	}()
+	return nil
+}
+
+// Update runs one round of the update loop, it is called by Sched
+func (hs *HTTPStreamer) Update(ctx context.Context) error {
+	hs.mu.Lock()
+	defer hs.mu.Unlock()
+	switch hs.cfg.UpdatMode {
+	case Static, Dynamic:
+		if hs.hasInit && hs.cfg.UpdatMode == Static {
+			return nil
+		}
+	default:
+		return errors.New("not support mode[" + hs.cfg.UpdatMode.toString() + "]")
+	}
+	loaded, err := hs.loadBase(ctx)
+	if err != nil {
+		hs.WarnStatus("LoadBase error: " + err.Error())
+		return err
+	}
+	if loaded {
+		hs.InfoStatus("LoadBase succ")
+	}
+	return nil
+}
+
+// Reload downloads the file even if it is not modified, an inc load does nothing
+func (hs *HTTPStreamer) Reload(ctx context.Context, kind LoadKind) error {
+	if kind == LoadKindInc {
+		return nil
+	}
+	hs.mu.Lock()
+	defer hs.mu.Unlock()
+	hs.etag = ""
+	hs.lastModified = ""
+	_, err := hs.loadBase(ctx)
+	return err
+}
+
+// Close waits for the update loop to exit
+func (hs *HTTPStreamer) Close() error {
+	hs.wg.Wait()
+	return nil
+}
+
+// loadBase downloads and loads the file, retrying with backoff. It returns whether the data was
+// reloaded, a 304 response doesn't reload it.
+func (hs *HTTPStreamer) loadBase(ctx context.Context) (loaded bool, err error) {
+	wait := time.Duration(hs.cfg.RetryWait) * time.Millisecond
+	if wait <= 0 {
+		wait = defaultHTTPRetryWait
+	}
+	for i := 0; ; i++ {
+		var retry bool
+		loaded, retry, err = hs.loadBase2(ctx)
+		if err == nil || !retry || i >= hs.cfg.TryTimes {
+			return loaded, err
+		}
+		if hs.cfg.Logger != nil {
+			hs.cfg.Logger.Warnf("LoadBase error[%s], tryTimes[%d]", err, i+1)
+		}
+		select {
+		case <-ctx.Done():
+			return false, err
+		case <-time.After(wait):
+		}
+		wait *= 2
+	}
+}
+
+// loadBase2 runs one download, it returns whether the error is worth a retry
+func (hs *HTTPStreamer) loadBase2(ctx context.Context) (loaded bool, retry bool, err error) {
+	start := time.Now()
+	defer func() {
+		if loaded || err != nil {
+			hs.notify(LoadKindBase, start, err)
+		}
+	}()
+	if hs.cfg.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, time.Duration(hs.cfg.Timeout)*time.Millisecond)
+		defer cancel()
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, hs.cfg.URL, nil)
+	if err != nil {
+		return false, false, err
+	}
+	for k, v := range hs.cfg.Header {
+		req.Header[k] = v
+	}
+	// set explicitly, the transport doesn't decode the body then
+	req.Header.Set("Accept-Encoding", "gzip, zstd")
+	if hs.hasInit {
+		if hs.etag != "" {
+			req.Header.Set("If-None-Match", hs.etag)
+		}
+		if hs.lastModified != "" {
+			req.Header.Set("If-Modified-Since", hs.lastModified)
+		}
+	}
+	resp, err := hs.client.Do(req)
+	if err != nil {
+		return false, true, err
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	switch {
+	case resp.StatusCode == http.StatusNotModified:
+		return false, false, nil
+	case resp.StatusCode != http.StatusOK:
+		retry = resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests
+		return false, retry, errors.New("unexpected status[" + resp.Status + "]")
+	}
+
+	body, err := hs.decode(resp)
+	if err != nil {
+		return false, false, err
+	}
+	defer func() { _ = body.Close() }()
+
+	hs.resetNums()
+	hs.setLastBaseTime(start)
+	hs.reader = bufio.NewReader(body)
+	hs.readErr = nil
+	hs.result = nil
+	hs.curLen = 0
+	err = hs.container.LoadBase(hs)
+	hs.setBaseTimeUsed(time.Now().Sub(start))
+	if hs.cfg.OnFinishBase != nil {
+		hs.cfg.OnFinishBase(hs)
+	}
+	if err != nil {
+		return false, hs.readErr != nil && hs.readErr != errBodyTooLarge, err
+	}
+	hs.hasInit = true
+	hs.etag = resp.Header.Get("ETag")
+	hs.lastModified = resp.Header.Get("Last-Modified")
+	return true, false, nil
+}
+
+// decode returns the decoded body limited to MaxBytes. The encoding is given by
+// Content-Encoding, or by the extension of the URL for the servers serving the compressed
+// files as they are.
+func (hs *HTTPStreamer) decode(resp *http.Response) (io.ReadCloser, error) {
+	encoding := strings.ToLower(resp.Header.Get("Content-Encoding"))
+	if encoding == "" || encoding == "identity" {
+		path := strings.ToLower(resp.Request.URL.Path)
+		switch {
+		case strings.HasSuffix(path, ".gz"):
+			encoding = "gzip"
+		case strings.HasSuffix(path, ".zst"):
+			encoding = "zstd"
+		}
+	}
+	maxBytes := hs.cfg.MaxBytes
+	if maxBytes <= 0 {
+		maxBytes = defaultHTTPMaxBytes
+	}
+	switch encoding {
+	case "", "identity":
+		return io.NopCloser(&limitReader{r: resp.Body, n: maxBytes}), nil
+	case "gzip":
+		zr, err := gzip.NewReader(resp.Body)
+		if err != nil {
+			return nil, errors.New("gzip error: " + err.Error())
+		}
+		return &decodeReader{limitReader{r: zr, n: maxBytes}, zr.Close}, nil
+	case "zstd":
+		zr, err := zstd.NewReader(resp.Body, zstd.WithDecoderConcurrency(1))
+		if err != nil {
+			return nil, errors.New("zstd error: " + err.Error())
+		}
+		return &decodeReader{limitReader{r: zr, n: maxBytes}, func() error { zr.Close(); return nil }}, nil
+	default:
+		return nil, errors.New("not support Content-Encoding[" + encoding + "]")
+	}
+}
+
+// limitReader fails with errBodyTooLarge after n bytes, so that a large file is not loaded partially
+type limitReader struct {
+	r io.Reader
+	n int64
+}
+
+func (lr *limitReader) Read(p []byte) (int, error) {
+	if lr.n < 0 {
+		return 0, errBodyTooLarge
+	}
+	if int64(len(p)) > lr.n+1 {
+		p = p[:lr.n+1]
+	}
+	n, err := lr.r.Read(p)
+	lr.n -= int64(n)
+	if lr.n < 0 {
+		return n, errBodyTooLarge
+	}
+	return n, err
+}
+
+type decodeReader struct {
+	limitReader
+	close func() error
+}
+
+func (dr *decodeReader) Close() error {
+	return dr.close()
+}
+
+func (hs *HTTPStreamer) notify(kind LoadKind, start time.Time, err error) {
+	if hs.observer == nil {
+		return
+	}
+	hs.observer(LoadEvent{
+		Name:  hs.cfg.Name,
+		Kind:  kind,
+		Start: start,
+		Used:  time.Since(start),
+		Err:   err,
+		Info:  hs.GetInfo(),
+	})
+}
+
+func (hs *HTTPStreamer) InfoStatus(s string) {
+	if hs.cfg.Logger != nil {
+		hs.cfg.Logger.Infof("%s, streamerInfo[%s]", s, hs.getInfoStr())
+	}
+}
+
+func (hs *HTTPStreamer) WarnStatus(s string) {
+	if hs.cfg.Logger != nil {
+		hs.cfg.Logger.Warnf("%s, streamerInfo[%s]", s, hs.getInfoStr())
+	}
+}
+
+func (hs *HTTPStreamer) GetInfo() *Info {
+	return hs.info(hs.cfg.Name, hs.container)
+}
+
+func (hs *HTTPStreamer) getInfoStr() string {
+	data, _ := json.Marshal(hs.GetInfo())
+	return string(data)
+}
@@ -0,0 +1,26 @@
+package streamer
+
+import (
+	"net/http"
+
+	"github.com/Mintegral-official/mtggokit/bifrost/log"
+)
+
+type HTTPStreamerCfg struct {
+	Name       string
+	URL        string
+	Header     http.Header // extra request headers, such as Authorization
+	UpdatMode  UpdatMode   // Static or Dynamic
+	Interval   int
+	IsSync     bool
+	Timeout    int   // millisecond, the timeout of a download, 0 means no timeout
+	TryTimes   int   // the retries after a failed download
+	RetryWait  int   // millisecond, the wait before the first retry, doubled for each next one
+	MaxBytes   int64 // the limit of the decoded body, 1GB by default
+	Client     *http.Client
+	DataParser DataParser
+	UserData   interface{}
+	Logger     log.BiLogger
+
+	OnFinishBase func(streamer Streamer)
+}
@@ -0,0 +1,146 @@
+package streamer
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/Mintegral-official/mtggokit/bifrost/container"
+	"github.com/klauspost/compress/zstd"
+	"github.com/smartystreets/goconvey/convey"
+)
+
+func newHTTPStreamer(url string, maxBytes int64) *HTTPStreamer {
+	hs := NewHTTPStreamer(&HTTPStreamerCfg{
+		Name:       "http_test",
+		URL:        url,
+		UpdatMode:  Dynamic,
+		TryTimes:   2,
+		RetryWait:  1,
+		MaxBytes:   maxBytes,
+		DataParser: &deltaParser{},
+	})
+	hs.SetContainer(&container.BufferedMapContainer{})
+	return hs
+}
+
+func TestHTTPStreamer(t *testing.T) {
+	convey.Convey("Test conditional requests", t, func() {
+		body := "a\taa\nb\tbb\n"
+		etag := `"v1"`
+		var requests, notModified int32
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			atomic.AddInt32(&requests, 1)
+			if r.Header.Get("If-None-Match") == etag {
+				atomic.AddInt32(&notModified, 1)
+				w.WriteHeader(http.StatusNotModified)
+				return
+			}
+			w.Header().Set("ETag", etag)
+			_, _ = w.Write([]byte(body))
+		}))
+		defer srv.Close()
+
+		hs := newHTTPStreamer(srv.URL, 0)
+		convey.So(hs.Update(context.Background()), convey.ShouldBeNil)
+		convey.So(hs.GetContainer().Len(), convey.ShouldEqual, 2)
+		convey.So(getValue(hs, "b"), convey.ShouldEqual, "bb")
+
+		convey.So(hs.Update(context.Background()), convey.ShouldBeNil)
+		convey.So(atomic.LoadInt32(&notModified), convey.ShouldEqual, 1)
+		convey.So(hs.GetContainer().Len(), convey.ShouldEqual, 2)
+
+		body, etag = "c\tcc\n", `"v2"`
+		convey.So(hs.Update(context.Background()), convey.ShouldBeNil)
+		convey.So(hs.GetContainer().Len(), convey.ShouldEqual, 1)
+		convey.So(getValue(hs, "c"), convey.ShouldEqual, "cc")
+
+		// Reload ignores the ETag
+		convey.So(hs.Reload(context.Background(), LoadKindBase), convey.ShouldBeNil)
+		convey.So(atomic.LoadInt32(&requests), convey.ShouldEqual, 4)
+		convey.So(atomic.LoadInt32(&notModified), convey.ShouldEqual, 1)
+	})
+
+	convey.Convey("Test compressed bodies", t, func() {
+		var gz, zs bytes.Buffer
+		gw := gzip.NewWriter(&gz)
+		_, _ = gw.Write([]byte("a\tgzip\n"))
+		_ = gw.Close()
+		zw, _ := zstd.NewWriter(&zs)
+		_, _ = zw.Write([]byte("a\tzstd\n"))
+		_ = zw.Close()
+		mux := http.NewServeMux()
+		mux.HandleFunc("/gzip", func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Encoding", "gzip")
+			_, _ = w.Write(gz.Bytes())
+		})
+		mux.HandleFunc("/zstd", func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Encoding", "zstd")
+			_, _ = w.Write(zs.Bytes())
+		})
+		mux.HandleFunc("/dict.txt.gz", func(w http.ResponseWriter, r *http.Request) {
+			_, _ = w.Write(gz.Bytes())
+		})
+		srv := httptest.NewServer(mux)
+		defer srv.Close()
+
+		hs := newHTTPStreamer(srv.URL+"/gzip", 0)
+		convey.So(hs.Update(context.Background()), convey.ShouldBeNil)
+		convey.So(getValue(hs, "a"), convey.ShouldEqual, "gzip")
+
+		hs = newHTTPStreamer(srv.URL+"/zstd", 0)
+		convey.So(hs.Update(context.Background()), convey.ShouldBeNil)
+		convey.So(getValue(hs, "a"), convey.ShouldEqual, "zstd")
+
+		hs = newHTTPStreamer(srv.URL+"/dict.txt.gz", 0)
+		convey.So(hs.Update(context.Background()), convey.ShouldBeNil)
+		convey.So(getValue(hs, "a"), convey.ShouldEqual, "gzip")
+	})
+
+	convey.Convey("Test size limit and retries", t, func() {
+		body := "a\taa\n"
+		var fails, requests int32
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			atomic.AddInt32(&requests, 1)
+			if atomic.AddInt32(&fails, -1) >= 0 {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+			if r.URL.Path == "/missing" {
+				http.NotFound(w, r)
+				return
+			}
+			_, _ = w.Write([]byte(body))
+		}))
+		defer srv.Close()
+
+		hs := newHTTPStreamer(srv.URL, 8)
+		convey.So(hs.Update(context.Background()), convey.ShouldBeNil)
+		convey.So(hs.GetContainer().Len(), convey.ShouldEqual, 1)
+
+		// too large, the data is kept
+		body = "a\taa\nb\tbb\n"
+		atomic.StoreInt32(&requests, 0)
+		convey.So(hs.Update(context.Background()), convey.ShouldNotBeNil)
+		convey.So(atomic.LoadInt32(&requests), convey.ShouldEqual, 1)
+		convey.So(hs.GetContainer().Len(), convey.ShouldEqual, 1)
+
+		// 503 twice, then ok
+		body = "b\tbb\n"
+		atomic.StoreInt32(&fails, 2)
+		atomic.StoreInt32(&requests, 0)
+		convey.So(hs.Update(context.Background()), convey.ShouldBeNil)
+		convey.So(atomic.LoadInt32(&requests), convey.ShouldEqual, 3)
+		convey.So(getValue(hs, "b"), convey.ShouldEqual, "bb")
+
+		// 404 is not retried
+		hs = newHTTPStreamer(srv.URL+"/missing", 0)
+		atomic.StoreInt32(&requests, 0)
+		convey.So(hs.Update(context.Background()), convey.ShouldNotBeNil)
+		convey.So(atomic.LoadInt32(&requests), convey.ShouldEqual, 1)
+	})
+}
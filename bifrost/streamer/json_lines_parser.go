@@ -0,0 +1,94 @@
+package streamer
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/Mintegral-official/mtggokit/bifrost/container"
+)
+
+type JSONLinesParserCfg struct {
+	KeyField string  // the json name of the key field, a top level field
+	KeyType  KeyType // the type of the key
+	// Type is a struct or a pointer to a struct each line is unmarshaled into, the value is a
+	// pointer to it. The value is a map[string]interface{} with json.Number numbers if it's nil.
+	Type interface{}
+}
+
+// JSONLinesParser parses the lines of JSON lines files, a line is a JSON object
+type JSONLinesParser struct {
+	cfg   JSONLinesParserCfg
+	typ   reflect.Type
+	field int // the index of the key field in typ
+}
+
+func NewJSONLinesParser(cfg *JSONLinesParserCfg) (*JSONLinesParser, error) {
+	if cfg.KeyField == "" {
+		return nil, errors.New("KeyField is empty")
+	}
+	jp := &JSONLinesParser{cfg: *cfg}
+	if cfg.Type == nil {
+		return jp, nil
+	}
+	t, err := structType(cfg.Type)
+	if err != nil {
+		return nil, err
+	}
+	jp.typ = t
+	jp.field = jsonField(t, cfg.KeyField)
+	if jp.field < 0 {
+		return nil, errors.New("not found key field[" + cfg.KeyField + "] in type[" + t.String() + "]")
+	}
+	return jp, nil
+}
+
+func (jp *JSONLinesParser) Parse(data []byte, userData interface{}) []ParserResult {
+	data = bytes.TrimSpace(data)
+	if len(data) == 0 {
+		return nil
+	}
+	var value, keyValue interface{}
+	if jp.typ == nil {
+		m := make(map[string]interface{})
+		d := json.NewDecoder(bytes.NewReader(data))
+		d.UseNumber()
+		if err := d.Decode(&m); err != nil {
+			return []ParserResult{{Err: fmt.Errorf("unmarshal json error: %s, line[%s]", err.Error(), data)}}
+		}
+		value, keyValue = m, m[jp.cfg.KeyField]
+	} else {
+		v := reflect.New(jp.typ)
+		if err := json.Unmarshal(data, v.Interface()); err != nil {
+			return []ParserResult{{Err: fmt.Errorf("unmarshal json error: %s, line[%s]", err.Error(), data)}}
+		}
+		value, keyValue = v.Interface(), v.Elem().Field(jp.field).Interface()
+	}
+	if n, ok := keyValue.(json.Number); ok {
+		keyValue = n.String()
+	}
+	key, err := keyOf(jp.cfg.KeyType, keyValue)
+	if err != nil {
+		return []ParserResult{{Err: fmt.Errorf("%s, field[%s]", err.Error(), jp.cfg.KeyField)}}
+	}
+	return []ParserResult{{DataMode: container.DataModeAdd, Key: key, Value: value}}
+}
+
+// jsonField returns the index of the top level field named name by its json tag, or by its
+// field name if it has none, -1 if there is no such field
+func jsonField(t reflect.Type, name string) int {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.PkgPath != "" {
+			continue
+		}
+		tag := strings.Split(f.Tag.Get("json"), ",")[0]
+		if tag == name || (tag == "" && strings.EqualFold(f.Name, name)) {
+			return i
+		}
+	}
+	return -1
+}
@@ -0,0 +1,38 @@
+package streamer
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/Mintegral-official/mtggokit/bifrost/container"
+	"github.com/smartystreets/goconvey/convey"
+)
+
+type jsonOffer struct {
+	Id      int64  `json:"offer_id"`
+	Package string `json:"package"`
+}
+
+func TestJSONLinesParser(t *testing.T) {
+	convey.Convey("Test JSON lines parser", t, func() {
+		p, err := NewJSONLinesParser(&JSONLinesParserCfg{KeyField: "offer_id", KeyType: KeyInt64, Type: jsonOffer{}})
+		convey.So(err, convey.ShouldBeNil)
+		r := p.Parse([]byte(`{"offer_id": 9007199254740993, "package": "com.a"}`+"\n"), nil)
+		convey.So(r[0].Err, convey.ShouldBeNil)
+		convey.So(r[0].Key, convey.ShouldResemble, container.I64Key(9007199254740993))
+		convey.So(r[0].Value, convey.ShouldResemble, &jsonOffer{Id: 9007199254740993, Package: "com.a"})
+		convey.So(p.Parse([]byte(`{"offer_id": "x"}`), nil)[0].Err, convey.ShouldNotBeNil)
+		convey.So(p.Parse([]byte(" "), nil), convey.ShouldBeNil)
+
+		// a map value keeps the precision of the numbers
+		p, err = NewJSONLinesParser(&JSONLinesParserCfg{KeyField: "id", KeyType: KeyInt64})
+		convey.So(err, convey.ShouldBeNil)
+		r = p.Parse([]byte(`{"id": 9007199254740993, "name": "a"}`), nil)
+		convey.So(r[0].Key, convey.ShouldResemble, container.I64Key(9007199254740993))
+		convey.So(r[0].Value, convey.ShouldResemble, map[string]interface{}{"id": json.Number("9007199254740993"), "name": "a"})
+		convey.So(p.Parse([]byte(`{"name": "a"}`), nil)[0].Err.Error(), convey.ShouldEqual, "invalid int64 key[<nil>], field[id]")
+
+		_, err = NewJSONLinesParser(&JSONLinesParserCfg{KeyField: "id", Type: jsonOffer{}})
+		convey.So(err.Error(), convey.ShouldEqual, "not found key field[id] in type[streamer.jsonOffer]")
+	})
+}
@@ -0,0 +1,425 @@
+package streamer
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/Mintegral-official/mtggokit/bifrost/container"
+)
+
+const (
+	defaultKafkaBatchSize       = 1000
+	defaultKafkaBatchWait       = 100 * time.Millisecond
+	defaultKafkaMaxBatchRetries = 3
+	defaultKafkaRetryBackoff    = time.Second
+	maxKafkaRetryBackoff        = time.Minute
+)
+
+type KafkaMessage struct {
+	Partition int32
+	Offset    int64
+	Key       []byte
+	Value     []byte
+}
+
+// KafkaConsumer is the part of a kafka client used by KafkaStreamer, wrap the client of your
+// choice with it, a partition consumer or a member of a consumer group
+type KafkaConsumer interface {
+	// Fetch returns the next message, it blocks until there is one or ctx is done
+	Fetch(ctx context.Context) (KafkaMessage, error)
+	// Commit stores the next offset to consume of each partition
+	Commit(ctx context.Context, offsets map[int32]int64) error
+	// Seek makes Fetch return the message at the given offset of each partition next
+	Seek(offsets map[int32]int64) error
+	Close() error
+}
+
+// KafkaStreamer consumes a topic as the incremental source of a container. The values of the
+// messages are given to DataParser and applied by LoadInc in micro-batches, the offsets are
+// committed after each batch is applied. A batch failing LoadInc is consumed again after a
+// backoff, up to MaxBatchRetries times, then it's dropped and committed past. The base is loaded
+// by another streamer, see KafkaStreamerCfg.Base.
+type KafkaStreamer struct {
+	container container.Container
+	cfg       *KafkaStreamerCfg
+	hasInit   bool
+	offsets   map[int32]int64 // the next offset to consume of each partition
+	batch     []KafkaMessage
+	pos       int
+	result    []ParserResult
+	curLen    int
+	retries   int       // the times the current batch failed LoadInc
+	retryAt   time.Time // the current batch is consumed again after it
+	dropped   int64     // the messages dropped after MaxBatchRetries, atomic
+	loadInfo
+
+	observer Observer
+	mu       sync.Mutex // serializes Update and Reload
+	wg       sync.WaitGroup
+}
+
+func NewKafkaStreamer(cfg *KafkaStreamerCfg) (*KafkaStreamer, error) {
+	if cfg.Consumer == nil {
+		return nil, errors.New("Consumer is nil, streamer[" + cfg.Name + "]")
+	}
+	if cfg.DataParser == nil {
+		return nil, errors.New("DataParser is nil, streamer[" + cfg.Name + "]")
+	}
+	return &KafkaStreamer{
+		cfg:     cfg,
+		offsets: make(map[int32]int64),
+	}, nil
+}
+
+// SetContainer sets the container, it's also given to the base streamer
+func (ks *KafkaStreamer) SetContainer(c container.Container) {
+	ks.container = c
+	if s, ok := ks.cfg.Base.(interface{ SetContainer(container.Container) }); ok {
+		s.SetContainer(c)
+	}
+}
+
+func (ks *KafkaStreamer) GetContainer() container.Container {
+	return ks.container
+}
+
+// SetObserver sets the observer notified after each load, call it before UpdateData
+func (ks *KafkaStreamer) SetObserver(o Observer) {
+	ks.observer = o
+}
+
+func (ks *KafkaStreamer) GetSchedInfo() *SchedInfo {
+	interval := ks.cfg.IncInterval
+	if interval <= 0 {
+		interval = 1
+	}
+	return &SchedInfo{
+		TimeInterval: interval,
+	}
+}
+
+func (ks *KafkaStreamer) HasNext() (bool, error) {
+	return ks.curLen < len(ks.result) || ks.pos < len(ks.batch), nil
+}
+
+func (ks *KafkaStreamer) Next() (container.DataMode, container.MapKey, interface{}, error) {
+	ks.addTotal()
+	if ks.curLen < len(ks.result) {
+		return ks.nextResult()
+	}
+	if ks.pos >= len(ks.batch) {
+		ks.addError()
+		return container.DataModeAdd, nil, nil, errors.New("no more messages")
+	}
+	msg := ks.batch[ks.pos]
+	ks.pos++
+	result := ks.cfg.DataParser.Parse(msg.Value, ks.cfg.UserData)
+	if result == nil {
+		ks.addError()
+		return container.DataModeAdd, nil, nil, fmt.Errorf("Parse error, partition[%d], offset[%d]", msg.Partition, msg.Offset)
+	}
+	ks.curLen = 0
+	ks.result = result
+	if ks.curLen < len(ks.result) {
+		return ks.nextResult()
+	}
+	ks.addError()
+	return container.DataModeAdd, nil, nil, errors.New(fmt.Sprintf("Index[%d] error, len[%d]", ks.curLen, len(ks.result)))
+}
+
+func (ks *KafkaStreamer) nextResult() (container.DataMode, container.MapKey, interface{}, error) {
+	r := ks.result[ks.curLen]
+	ks.curLen++
+	if r.Err != nil {
+		ks.addError()
+	}
+	return r.DataMode, r.Key, r.Value, r.Err
+}
+
+func (ks *KafkaStreamer) UpdateData(ctx context.Context) error {
+	if ks.cfg.IsSync {
+		if err := ks.Update(ctx); err != nil {
+			return err
+		}
+	}
+	ks.wg.Add(1)
+	go func() {
+		defer ks.wg.Done()
+		if !ks.cfg.IsSync {
+			_ = ks.Update(ctx)
+		}
+		for {
+			inc := time.After(time.Duration(ks.cfg.IncInterval) * time.Second)
+			select {
+			case <-ctx.Done():
+				ks.InfoStatus("LoadInc Finish:")
+				return
+			case <-inc:
+				_ = ks.Update(ctx)
+			}
+		}
+	}()
+	return nil
+}
+
+// Update runs one round of the update loop, it is called by Sched. The base is loaded when it
+// has never succeeded or BaseInterval has passed, otherwise a batch of messages is applied.
+func (ks *KafkaStreamer) Update(ctx context.Context) error {
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+	baseInterval := time.Duration(ks.cfg.BaseInterval) * time.Second
+	if ks.cfg.Base != nil && (!ks.hasInit || baseInterval > 0 && time.Since(ks.lastBaseTime) >= baseInterval) {
+		if err := ks.loadBase(ctx); err != nil {
+			ks.WarnStatus("LoadBase error:" + err.Error())
+			return err
+		}
+		ks.InfoStatus("LoadBase succ")
+		return nil
+	}
+	if err := ks.loadInc(ctx); err != nil {
+		ks.WarnStatus("LoadInc error:" + err.Error())
+		return err
+	}
+	return nil
+}
+
+// Reload runs a base load or applies a batch at once
+func (ks *KafkaStreamer) Reload(ctx context.Context, kind LoadKind) error {
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+	if kind == LoadKindInc {
+		return ks.loadInc(ctx)
+	}
+	if ks.cfg.Base == nil {
+		return errors.New("no base, streamer[" + ks.cfg.Name + "]")
+	}
+	return ks.loadBase(ctx)
+}
+
+// loadBase loads the base by cfg.Base, then seeks the consumer back to the offsets the base is
+// consistent with. It must be called with ks.mu held.
+func (ks *KafkaStreamer) loadBase(ctx context.Context) (err error) {
+	start := time.Now()
+	ks.setLastBaseTime(start)
+	defer func() {
+		ks.setBaseTimeUsed(time.Now().Sub(start))
+		if ks.cfg.OnFinishBase != nil {
+			ks.cfg.OnFinishBase(ks)
+		}
+		ks.notify(LoadKindBase, start, err)
+	}()
+	offsets := make(map[int32]int64, len(ks.offsets))
+	for p, o := range ks.offsets {
+		offsets[p] = o
+	}
+	if err := ks.cfg.Base.Reload(ctx, LoadKindBase); err != nil {
+		return err
+	}
+	if ks.cfg.BaseOffsets != nil {
+		if offsets, err = ks.cfg.BaseOffsets(ks.cfg.UserData); err != nil {
+			return errors.New("BaseOffsets error: " + err.Error())
+		}
+	}
+	if len(offsets) > 0 {
+		if err := ks.cfg.Consumer.Seek(offsets); err != nil {
+			return errors.New("SeekError: " + err.Error())
+		}
+		for p, o := range offsets {
+			ks.offsets[p] = o
+		}
+		ks.retries = 0
+		ks.retryAt = time.Time{}
+	}
+	ks.hasInit = true
+	return nil
+}
+
+// loadInc applies a batch of messages and commits their offsets, it must be called with ks.mu held
+func (ks *KafkaStreamer) loadInc(ctx context.Context) (err error) {
+	if time.Now().Before(ks.retryAt) {
+		return nil
+	}
+	batch, fetchErr := ks.fetchBatch(ctx)
+	if len(batch) == 0 {
+		if fetchErr != nil {
+			return errors.New("FetchError: " + fetchErr.Error())
+		}
+		return nil
+	}
+	start := time.Now()
+	ks.setLastIncTime(start)
+	defer func() {
+		ks.setIncTimeUsed(time.Now().Sub(start))
+		ks.notify(LoadKindInc, start, err)
+	}()
+
+	ks.batch = batch
+	ks.pos = 0
+	ks.result = nil
+	ks.curLen = 0
+	err = ks.container.LoadInc(ks)
+	ks.batch = nil
+	if ks.cfg.OnFinishInc != nil {
+		ks.cfg.OnFinishInc(ks)
+	}
+
+	if err != nil && ks.retries < ks.maxBatchRetries() {
+		// nothing is committed, the batch is consumed again after the backoff
+		ks.retries++
+		ks.retryAt = time.Now().Add(ks.retryBackoff())
+		first := make(map[int32]int64)
+		for _, msg := range batch {
+			if o, ok := first[msg.Partition]; !ok || msg.Offset < o {
+				first[msg.Partition] = msg.Offset
+			}
+		}
+		if e := ks.cfg.Consumer.Seek(first); e != nil {
+			ks.WarnStatus("Seek error:" + e.Error())
+		}
+		return err
+	}
+	if err != nil {
+		ks.WarnStatus(fmt.Sprintf("drop batch of [%d] messages after [%d] retries, error[%s]", len(batch), ks.retries, err))
+		atomic.AddInt64(&ks.dropped, int64(len(batch)))
+		if ks.cfg.OnDropBatch != nil {
+			ks.cfg.OnDropBatch(batch, err)
+		}
+	}
+	ks.retries = 0
+	ks.retryAt = time.Time{}
+
+	// the records failed within the tolerance of the container, and the dropped batches, are not
+	// consumed again
+	next := make(map[int32]int64)
+	for _, msg := range batch {
+		next[msg.Partition] = msg.Offset + 1
+	}
+	for p, o := range next {
+		ks.offsets[p] = o
+	}
+	if e := ks.cfg.Consumer.Commit(ctx, next); e != nil {
+		err = errors.New("CommitError: " + e.Error())
+	}
+	if ks.cfg.Base == nil {
+		ks.hasInit = true
+	}
+	if err == nil && fetchErr != nil {
+		err = errors.New("FetchError: " + fetchErr.Error())
+	}
+	return err
+}
+
+func (ks *KafkaStreamer) maxBatchRetries() int {
+	if ks.cfg.MaxBatchRetries == 0 {
+		return defaultKafkaMaxBatchRetries
+	}
+	return ks.cfg.MaxBatchRetries
+}
+
+// retryBackoff returns the wait before the current batch is consumed again, RetryBackoff doubled
+// by each retry
+func (ks *KafkaStreamer) retryBackoff() time.Duration {
+	backoff := time.Duration(ks.cfg.RetryBackoff) * time.Millisecond
+	if backoff <= 0 {
+		backoff = defaultKafkaRetryBackoff
+	}
+	for i := 1; i < ks.retries && backoff < maxKafkaRetryBackoff; i++ {
+		backoff *= 2
+	}
+	if backoff > maxKafkaRetryBackoff {
+		backoff = maxKafkaRetryBackoff
+	}
+	return backoff
+}
+
+// fetchBatch fetches up to BatchSize messages, waiting at most BatchWait for them
+func (ks *KafkaStreamer) fetchBatch(ctx context.Context) ([]KafkaMessage, error) {
+	size := ks.cfg.BatchSize
+	if size <= 0 {
+		size = defaultKafkaBatchSize
+	}
+	wait := time.Duration(ks.cfg.BatchWait) * time.Millisecond
+	if wait <= 0 {
+		wait = defaultKafkaBatchWait
+	}
+	wctx, cancel := context.WithTimeout(ctx, wait)
+	defer cancel()
+	batch := make([]KafkaMessage, 0)
+	for len(batch) < size {
+		msg, err := ks.cfg.Consumer.Fetch(wctx)
+		if err != nil {
+			if wctx.Err() != nil && ctx.Err() == nil {
+				// no more messages in this round
+				return batch, nil
+			}
+			return batch, err
+		}
+		batch = append(batch, msg)
+	}
+	return batch, nil
+}
+
+// Offsets returns the next offset to consume of each partition
+func (ks *KafkaStreamer) Offsets() map[int32]int64 {
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+	offsets := make(map[int32]int64, len(ks.offsets))
+	for p, o := range ks.offsets {
+		offsets[p] = o
+	}
+	return offsets
+}
+
+func (ks *KafkaStreamer) notify(kind LoadKind, start time.Time, err error) {
+	if ks.observer == nil {
+		return
+	}
+	ks.observer(LoadEvent{
+		Name:  ks.cfg.Name,
+		Kind:  kind,
+		Start: start,
+		Used:  time.Since(start),
+		Err:   err,
+		Info:  ks.GetInfo(),
+	})
+}
+
+// Close waits for the update loop to exit, then closes the consumer and the base streamer
+func (ks *KafkaStreamer) Close() error {
+	ks.wg.Wait()
+	err := ks.cfg.Consumer.Close()
+	if c, ok := ks.cfg.Base.(Closer); ok {
+		if e := c.Close(); err == nil {
+			err = e
+		}
+	}
+	return err
+}
+
+func (ks *KafkaStreamer) GetInfo() *Info {
+	info := ks.info(ks.cfg.Name, ks.container)
+	info.DroppedNum = int(atomic.LoadInt64(&ks.dropped))
+	return info
+}
+
+func (ks *KafkaStreamer) InfoStatus(s string) {
+	if ks.cfg.Logger != nil {
+		ks.cfg.Logger.Infof("%s, streamerInfo[%s]", s, ks.getInfoStr())
+	}
+}
+
+func (ks *KafkaStreamer) WarnStatus(s string) {
+	if ks.cfg.Logger != nil {
+		ks.cfg.Logger.Warnf("%s, streamerInfo[%s]", s, ks.getInfoStr())
+	}
+}
+
+func (ks *KafkaStreamer) getInfoStr() string {
+	data, _ := json.Marshal(ks.GetInfo())
+	return string(data)
+}
@@ -0,0 +1,38 @@
+package streamer
+
+import (
+	"github.com/Mintegral-official/mtggokit/bifrost/log"
+)
+
+type KafkaStreamerCfg struct {
+	Name         string
+	Consumer     KafkaConsumer
+	DataParser   DataParser
+	UserData     interface{}
+	IsSync       bool
+	IncInterval  int // seconds between two batches, 0 means back to back (1s when run by Sched)
+	BatchSize    int // the max messages applied by a LoadInc, 1000 by default
+	BatchWait    int // millisecond, the max wait to fill a batch, 100 by default
+	Logger       log.BiLogger
+	OnFinishInc  func(streamer Streamer)
+	OnFinishBase func(streamer Streamer)
+
+	// MaxBatchRetries is the times a batch failing LoadInc is consumed again, 3 by default, a
+	// negative value drops it at once. A dropped batch is given to OnDropBatch, committed past and
+	// counted by Info.DroppedNum. RetryBackoff is the millisecond wait before the first retry,
+	// doubled by each one, 1000 by default.
+	MaxBatchRetries int
+	RetryBackoff    int
+	OnDropBatch     func(messages []KafkaMessage, err error)
+
+	// Base loads the base into the container of the KafkaStreamer by Reload(ctx, LoadKindBase),
+	// such as a LocalFileStreamer or a MongoStreamer, nil means the topic is the only source.
+	// The base is loaded first, then every BaseInterval seconds if BaseInterval > 0.
+	Base         Reloader
+	BaseInterval int
+	// BaseOffsets returns the offsets the loaded base is consistent with, for example the ones
+	// written alongside the base file. The consumer seeks back to them after each base load so
+	// that the messages newer than the base are applied again. When it's nil, the offsets
+	// consumed before the base load started are used.
+	BaseOffsets func(userData interface{}) (map[int32]int64, error)
+}
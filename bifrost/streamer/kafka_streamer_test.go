@@ -0,0 +1,213 @@
+package streamer
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Mintegral-official/mtggokit/bifrost/container"
+	"github.com/smartystreets/goconvey/convey"
+)
+
+// fakeBroker is a topic of one partition, the offset of a message is its index
+type fakeBroker struct {
+	mu        sync.Mutex
+	messages  []KafkaMessage
+	pos       int64
+	committed map[int32]int64
+	seeks     []map[int32]int64
+	closed    bool
+}
+
+func (fb *fakeBroker) produce(values ...string) {
+	fb.mu.Lock()
+	defer fb.mu.Unlock()
+	for _, v := range values {
+		fb.messages = append(fb.messages, KafkaMessage{Offset: int64(len(fb.messages)), Value: []byte(v)})
+	}
+}
+
+func (fb *fakeBroker) Fetch(ctx context.Context) (KafkaMessage, error) {
+	fb.mu.Lock()
+	defer fb.mu.Unlock()
+	if fb.pos < int64(len(fb.messages)) {
+		fb.pos++
+		return fb.messages[fb.pos-1], nil
+	}
+	<-ctx.Done()
+	return KafkaMessage{}, ctx.Err()
+}
+
+func (fb *fakeBroker) Commit(ctx context.Context, offsets map[int32]int64) error {
+	fb.mu.Lock()
+	defer fb.mu.Unlock()
+	fb.committed = offsets
+	return nil
+}
+
+func (fb *fakeBroker) Seek(offsets map[int32]int64) error {
+	fb.mu.Lock()
+	defer fb.mu.Unlock()
+	fb.seeks = append(fb.seeks, offsets)
+	fb.pos = offsets[0]
+	return nil
+}
+
+func (fb *fakeBroker) Close() error {
+	fb.closed = true
+	return nil
+}
+
+// fakeBase loads its records as the base
+type fakeBase struct {
+	container container.Container
+	records   []string
+	loads     int
+}
+
+func (fb *fakeBase) SetContainer(c container.Container) {
+	fb.container = c
+}
+
+func (fb *fakeBase) Reload(ctx context.Context, kind LoadKind) error {
+	fb.loads++
+	results := make([]ParserResult, 0, len(fb.records))
+	for _, r := range fb.records {
+		results = append(results, (&deltaParser{}).Parse([]byte(r), nil)...)
+	}
+	return fb.container.LoadBase(&sliceIter{results: results})
+}
+
+type sliceIter struct {
+	results []ParserResult
+	i       int
+}
+
+func (si *sliceIter) HasNext() (bool, error) {
+	return si.i < len(si.results), nil
+}
+
+func (si *sliceIter) Next() (container.DataMode, container.MapKey, interface{}, error) {
+	r := si.results[si.i]
+	si.i++
+	return r.DataMode, r.Key, r.Value, r.Err
+}
+
+func TestKafkaStreamer(t *testing.T) {
+	convey.Convey("Test KafkaStreamer", t, func() {
+		broker := &fakeBroker{}
+		base := &fakeBase{records: []string{"a\taa", "b\tbb"}}
+		var baseOffsets map[int32]int64
+		ks, err := NewKafkaStreamer(&KafkaStreamerCfg{
+			Name:       "kafka_test",
+			Consumer:   broker,
+			DataParser: &deltaParser{},
+			BatchSize:  2,
+			BatchWait:  10,
+			Base:       base,
+			BaseOffsets: func(interface{}) (map[int32]int64, error) {
+				return baseOffsets, nil
+			},
+		})
+		convey.So(err, convey.ShouldBeNil)
+		ks.SetContainer(container.CreateBlockingMapContainer(1, 0))
+		ctx := context.Background()
+
+		// the first round loads the base
+		broker.produce("c\tcc", "-\ta", "b\tBB")
+		convey.So(ks.Update(ctx), convey.ShouldBeNil)
+		convey.So(base.loads, convey.ShouldEqual, 1)
+		convey.So(ks.GetContainer().Len(), convey.ShouldEqual, 2)
+		convey.So(len(broker.seeks), convey.ShouldEqual, 0)
+
+		convey.Convey("micro-batches are committed after they are applied", func() {
+			convey.So(ks.Update(ctx), convey.ShouldBeNil)
+			convey.So(getValue(ks, "c"), convey.ShouldEqual, "cc")
+			convey.So(getValue(ks, "a"), convey.ShouldEqual, container.NotExistErr)
+			convey.So(broker.committed, convey.ShouldResemble, map[int32]int64{0: 2})
+
+			convey.So(ks.Update(ctx), convey.ShouldBeNil)
+			convey.So(getValue(ks, "b"), convey.ShouldEqual, "BB")
+			convey.So(broker.committed, convey.ShouldResemble, map[int32]int64{0: 3})
+
+			// nothing to consume
+			convey.So(ks.Update(ctx), convey.ShouldBeNil)
+			convey.So(ks.Offsets(), convey.ShouldResemble, map[int32]int64{0: 3})
+		})
+
+		convey.Convey("the consumer seeks back after a base reload", func() {
+			convey.So(ks.Update(ctx), convey.ShouldBeNil)
+			convey.So(ks.Update(ctx), convey.ShouldBeNil)
+			convey.So(getValue(ks, "b"), convey.ShouldEqual, "BB")
+
+			// the base is older than the messages consumed
+			baseOffsets = map[int32]int64{0: 1}
+			convey.So(ks.Reload(ctx, LoadKindBase), convey.ShouldBeNil)
+			convey.So(broker.seeks, convey.ShouldResemble, []map[int32]int64{{0: 1}})
+			convey.So(getValue(ks, "a"), convey.ShouldEqual, "aa")
+			convey.So(getValue(ks, "b"), convey.ShouldEqual, "bb")
+
+			convey.So(ks.Update(ctx), convey.ShouldBeNil)
+			convey.So(getValue(ks, "a"), convey.ShouldEqual, container.NotExistErr)
+			convey.So(getValue(ks, "b"), convey.ShouldEqual, "BB")
+			convey.So(broker.committed, convey.ShouldResemble, map[int32]int64{0: 3})
+
+			// by default the consumer goes back to where the base load started
+			ks.cfg.BaseOffsets = nil
+			convey.So(ks.Reload(ctx, LoadKindBase), convey.ShouldBeNil)
+			convey.So(broker.seeks[1], convey.ShouldResemble, map[int32]int64{0: 3})
+		})
+
+		convey.Convey("a batch failing LoadInc is consumed again after a backoff, then dropped", func() {
+			var dropped []KafkaMessage
+			ks.cfg.MaxBatchRetries = 2
+			ks.cfg.RetryBackoff = 20
+			ks.cfg.OnDropBatch = func(messages []KafkaMessage, err error) {
+				dropped = messages
+			}
+			broker.produce("bad")
+			convey.So(ks.Update(ctx), convey.ShouldBeNil)
+			convey.So(ks.Update(ctx), convey.ShouldNotBeNil)
+			convey.So(ks.GetInfo().ErrorNum, convey.ShouldEqual, 1)
+			convey.So(broker.committed, convey.ShouldResemble, map[int32]int64{0: 2})
+			convey.So(broker.seeks, convey.ShouldResemble, []map[int32]int64{{0: 2}})
+			convey.So(ks.Offsets(), convey.ShouldResemble, map[int32]int64{0: 2})
+
+			// backing off
+			convey.So(ks.Update(ctx), convey.ShouldBeNil)
+			convey.So(ks.GetInfo().ErrorNum, convey.ShouldEqual, 1)
+
+			time.Sleep(25 * time.Millisecond)
+			convey.So(ks.Update(ctx), convey.ShouldNotBeNil)
+			convey.So(ks.GetInfo().ErrorNum, convey.ShouldEqual, 2)
+			convey.So(broker.committed, convey.ShouldResemble, map[int32]int64{0: 2})
+			convey.So(len(broker.seeks), convey.ShouldEqual, 2)
+
+			// the backoff is doubled
+			time.Sleep(25 * time.Millisecond)
+			convey.So(ks.Update(ctx), convey.ShouldBeNil)
+			convey.So(ks.GetInfo().ErrorNum, convey.ShouldEqual, 2)
+
+			time.Sleep(20 * time.Millisecond)
+			convey.So(ks.Update(ctx), convey.ShouldNotBeNil)
+			convey.So(len(broker.seeks), convey.ShouldEqual, 2)
+			convey.So(broker.committed, convey.ShouldResemble, map[int32]int64{0: 4})
+			convey.So(ks.GetInfo().DroppedNum, convey.ShouldEqual, 2)
+			convey.So(len(dropped), convey.ShouldEqual, 2)
+			convey.So(dropped[0].Offset, convey.ShouldEqual, 2)
+
+			// the consumer goes on after the dropped batch
+			convey.So(ks.Offsets(), convey.ShouldResemble, map[int32]int64{0: 4})
+			convey.So(broker.pos, convey.ShouldEqual, 4)
+		})
+
+		convey.Convey("the update loop stops with its context", func() {
+			ctx, cancel := context.WithCancel(ctx)
+			convey.So(ks.UpdateData(ctx), convey.ShouldBeNil)
+			cancel()
+			convey.So(ks.Close(), convey.ShouldBeNil)
+			convey.So(broker.closed, convey.ShouldBeTrue)
+		})
+	})
+}
@@ -0,0 +1,91 @@
+package streamer
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/Mintegral-official/mtggokit/bifrost/container"
+)
+
+// loadInfo is embedded by the streamers, it's the part of Info written by the loads. GetInfo
+// is called by the metrics and the admin goroutines during the loads, so the numbers of records
+// are atomics, the other fields are written and read by GetInfo with infoMu held. The load mutex
+// of a streamer can't be used, it's held for a whole load, during which the observer calls
+// GetInfo too. The fields are written by the loads with the load mutex held, which may read them
+// holding it without infoMu.
+type loadInfo struct {
+	addNum        int64
+	errorNum      int64
+	infoMu        sync.Mutex
+	lastBaseTime  time.Time
+	lastIncTime   time.Time
+	baseTimeUsed  time.Duration
+	incTimeUsed   time.Duration
+	watermarkUnix int64
+}
+
+func (li *loadInfo) addTotal() {
+	atomic.AddInt64(&li.addNum, 1)
+}
+
+func (li *loadInfo) addError() {
+	atomic.AddInt64(&li.errorNum, 1)
+}
+
+// resetNums resets the numbers of records at the start of a base load
+func (li *loadInfo) resetNums() {
+	atomic.StoreInt64(&li.addNum, 0)
+	atomic.StoreInt64(&li.errorNum, 0)
+}
+
+func (li *loadInfo) setLastBaseTime(t time.Time) {
+	li.infoMu.Lock()
+	li.lastBaseTime = t
+	li.infoMu.Unlock()
+}
+
+func (li *loadInfo) setLastIncTime(t time.Time) {
+	li.infoMu.Lock()
+	li.lastIncTime = t
+	li.infoMu.Unlock()
+}
+
+func (li *loadInfo) setBaseTimeUsed(d time.Duration) {
+	li.infoMu.Lock()
+	li.baseTimeUsed = d
+	li.infoMu.Unlock()
+}
+
+func (li *loadInfo) setIncTimeUsed(d time.Duration) {
+	li.infoMu.Lock()
+	li.incTimeUsed = d
+	li.infoMu.Unlock()
+}
+
+func (li *loadInfo) setWatermark(w int64) {
+	li.infoMu.Lock()
+	li.watermarkUnix = w
+	li.infoMu.Unlock()
+}
+
+// info returns the Info of the streamer name loading into c
+func (li *loadInfo) info(name string, c container.Container) *Info {
+	li.infoMu.Lock()
+	info := &Info{
+		Name:         name,
+		AddNum:       int(atomic.LoadInt64(&li.addNum)),
+		ErrorNum:     int(atomic.LoadInt64(&li.errorNum)),
+		LastBaseTime: li.lastBaseTime,
+		LastIncTime:  li.lastIncTime,
+		BaseTimeUsed: li.baseTimeUsed,
+		IncTimeUsed:  li.incTimeUsed,
+		Watermark:    li.watermarkUnix,
+	}
+	li.infoMu.Unlock()
+	if c != nil {
+		info.TotalNum = c.Len()
+		info.ValidationFailures = validationFailures(c)
+	}
+	return info
+}
@@ -0,0 +1,92 @@
+package streamer
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Mintegral-official/mtggokit/bifrost/container"
+	"github.com/smartystreets/goconvey/convey"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// run it with the race detector: go test -race ./bifrost/streamer/
+func TestLoadInfo_GetInfoDuringLoads(t *testing.T) {
+	convey.Convey("Test GetInfo is safe to be called during the loads", t, func() {
+		broker := &fakeBroker{}
+		ks, err := NewKafkaStreamer(&KafkaStreamerCfg{
+			Name:       "kafka_info",
+			Consumer:   broker,
+			DataParser: &deltaParser{},
+			BatchSize:  2,
+			BatchWait:  1,
+			Base:       &fakeBase{records: []string{"a\taa"}},
+		})
+		convey.So(err, convey.ShouldBeNil)
+		ks.SetContainer(container.CreateBlockingMapContainer(1, 0.5))
+		ctx := context.Background()
+
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			for i := 0; i < 50; i++ {
+				broker.produce("b\tbb", "bad")
+				_ = ks.Update(ctx)
+				if i%10 == 0 {
+					_ = ks.Reload(ctx, LoadKindBase)
+				}
+			}
+		}()
+		for reading := true; reading; {
+			select {
+			case <-done:
+				reading = false
+			default:
+				_ = ks.GetInfo()
+			}
+		}
+		info := ks.GetInfo()
+		convey.So(info.AddNum, convey.ShouldBeGreaterThan, 0)
+		convey.So(info.ErrorNum, convey.ShouldBeGreaterThan, 0)
+		convey.So(info.LastIncTime.IsZero(), convey.ShouldBeFalse)
+	})
+}
+
+// run it with the race detector: go test -race ./bifrost/streamer/
+func TestLoadInfo_MongoReloadDuringUpdate(t *testing.T) {
+	convey.Convey("Test the admin reloads of mongo are safe to run with Update", t, func() {
+		dir, err := ioutil.TempDir("", "bifrost")
+		convey.So(err, convey.ShouldBeNil)
+		defer os.RemoveAll(dir)
+		ms := newUnreachableStreamer(t, filepath.Join(dir, "snapshot"))
+		defer ms.Close()
+		ms.hasInit = true
+		ms.cfg.BaseInterval = 1
+		ms.cfg.WatermarkField = "updated"
+		ms.cfg.OnBeforeBase = func(interface{}) interface{} { return nil }
+		ms.cfg.OnBeforeInc = func(interface{}) interface{} { return bson.M{} }
+		ms.setLastBaseTime(time.Now().Add(-time.Hour))
+		ctx := context.Background()
+
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			for i := 0; i < 3; i++ {
+				_ = ms.Reload(ctx, LoadKindInc)
+			}
+		}()
+		// let the reload hold the load mutex first
+		time.Sleep(10 * time.Millisecond)
+		for i := 0; i < 3; i++ {
+			_ = ms.Update(ctx)
+			_ = ms.GetInfo()
+		}
+		<-done
+		info := ms.GetInfo()
+		convey.So(info.LastBaseTime, convey.ShouldHappenAfter, time.Now().Add(-time.Minute))
+		convey.So(info.LastIncTime.IsZero(), convey.ShouldBeFalse)
+	})
+}
@@ -2,29 +2,41 @@ package streamer
 
 import (
 	"bufio"
+	"bytes"
 	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"github.com/Mintegral-official/mtggokit/bifrost/container"
+	"io/ioutil"
 	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
 	"time"
 )
 
 type LocalFileStreamer struct {
-	container    container.Container
-	cfg          *LocalFileStreamerCfg
-	fileReader   *bufio.Reader
-	line         []byte
-	eof          bool
-	result       []ParserResult
-	curLen       int
-	hasInit      bool
-	modTime      time.Time
-	addNum       int
-	errorNum     int
-	lastBaseTime time.Time
-	baseTimeUsed time.Duration
+	container  container.Container
+	cfg        *LocalFileStreamerCfg
+	fileReader *bufio.Reader
+	line       []byte
+	eof        bool
+	result     []ParserResult
+	curLen     int
+	hasInit    bool
+	modTime    time.Time
+	loadInfo
+
+	// incremental progress, see loadInc
+	tail       bool
+	incOffset  int64
+	incApplied map[string]bool
+
+	observer Observer
+	mu       sync.Mutex // serializes Update and Reload
+	wg       sync.WaitGroup
 }
 
 func NewFileStreamer(cfg *LocalFileStreamerCfg) *LocalFileStreamer {
@@ -42,19 +54,29 @@ func (fs *LocalFileStreamer) GetContainer() container.Container {
 	return fs.container
 }
 
+// SetObserver sets the observer notified after each load, call it before UpdateData
+func (fs *LocalFileStreamer) SetObserver(o Observer) {
+	fs.observer = o
+}
+
 func (fs *LocalFileStreamer) GetSchedInfo() *SchedInfo {
 	return &SchedInfo{
 		TimeInterval: fs.cfg.Interval,
 	}
 }
 
+// Describe returns the source of the base loads, see container.Describer
+func (fs *LocalFileStreamer) Describe() string {
+	return "file[" + fs.cfg.Path + "]"
+}
+
 func (fs *LocalFileStreamer) HasNext() (bool, error) {
 	if fs.curLen < len(fs.result) {
 		return true, nil
 	}
-	line, err := fs.readLn(fs.fileReader)
+	line, err := fs.nextLine()
 	for err == nil && len(line) == 0 {
-		line, err = fs.readLn(fs.fileReader)
+		line, err = fs.nextLine()
 	}
 
 	if err == nil {
@@ -70,6 +92,24 @@ func (fs *LocalFileStreamer) HasNext() (bool, error) {
 	return false, err
 }
 
+func (fs *LocalFileStreamer) nextLine() ([]byte, error) {
+	if fs.tail {
+		return fs.readTail(fs.fileReader)
+	}
+	return fs.readLn(fs.fileReader)
+}
+
+// readTail only returns complete lines, a trailing line without '\n' is still
+// being written and will be read in the next round
+func (fs *LocalFileStreamer) readTail(r *bufio.Reader) ([]byte, error) {
+	line, err := r.ReadBytes('\n')
+	if err != nil {
+		return nil, err
+	}
+	fs.incOffset += int64(len(line))
+	return bytes.TrimRight(line, "\r\n"), nil
+}
+
 func (fs *LocalFileStreamer) readLn(r *bufio.Reader) ([]byte, error) {
 	var (
 		isPrefix       = true
@@ -91,18 +131,18 @@ func (fs *LocalFileStreamer) isEof(err error) bool {
 }
 
 func (fs *LocalFileStreamer) Next() (container.DataMode, container.MapKey, interface{}, error) {
-	fs.addNum++
+	fs.addTotal()
 	if fs.curLen < len(fs.result) {
 		r := fs.result[fs.curLen]
 		fs.curLen++
 		if r.Err != nil {
-			fs.errorNum++
+			fs.addError()
 		}
 		return r.DataMode, r.Key, r.Value, r.Err
 	}
-	result := fs.cfg.DataParser.Parse(fs.line, nil)
+	result := fs.cfg.DataParser.Parse(fs.line, fs.cfg.UserData)
 	if result == nil {
-		fs.errorNum++
+		fs.addError()
 		return container.DataModeAdd, nil, nil, errors.New(fmt.Sprintf("Parser error"))
 	}
 	fs.curLen = 0
@@ -111,84 +151,287 @@ func (fs *LocalFileStreamer) Next() (container.DataMode, container.MapKey, inter
 		r := fs.result[fs.curLen]
 		fs.curLen++
 		if r.Err != nil {
-			fs.errorNum++
+			fs.addError()
 		}
 		return r.DataMode, r.Key, r.Value, r.Err
 	}
-	fs.errorNum++
+	fs.addError()
 	return container.DataModeAdd, nil, nil, errors.New(fmt.Sprintf("Index[%d] error, len[%d]", fs.curLen, len(fs.result)))
 }
 
 func (fs *LocalFileStreamer) UpdateData(ctx context.Context) error {
 	if fs.cfg.IsSync {
-		fs.lastBaseTime = time.Now()
-		err := fs.updateData(ctx)
-		fs.baseTimeUsed = time.Now().Sub(fs.lastBaseTime)
-		if err != nil {
-			fs.WarnStatus("LoadBase error: " + err.Error())
+		if err := fs.Update(ctx); err != nil {
 			return err
 		}
-		fs.InfoStatus("LoadBase succ")
 	}
+	fs.wg.Add(1)
 	go func() {
+		defer fs.wg.Done()
 		for {
 			inc := time.After(time.Duration(fs.cfg.Interval) * time.Second)
 			select {
 			case <-ctx.Done():
 				return
 			case <-inc:
-				fs.lastBaseTime = time.Now()
-				err := fs.updateData(ctx)
-				fs.baseTimeUsed = time.Now().Sub(fs.lastBaseTime)
-				if err != nil {
-					fs.WarnStatus("LoadBase error: " + err.Error())
-				} else {
-					fs.InfoStatus("LoadBase succ")
-				}
+				_ = fs.Update(ctx)
 			}
 		}
 	}()
 	return nil
 }
 
+// Update runs one round of the update loop, it is called by Sched
+func (fs *LocalFileStreamer) Update(ctx context.Context) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	err := fs.updateData(ctx)
+	if err != nil {
+		fs.WarnStatus("UpdateData error: " + err.Error())
+		return err
+	}
+	fs.InfoStatus("UpdateData succ")
+	return nil
+}
+
+// Reload forces a base load even if the file is not modified, or an inc load
+func (fs *LocalFileStreamer) Reload(ctx context.Context, kind LoadKind) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	if kind == LoadKindInc {
+		return fs.loadInc()
+	}
+	fs.modTime = time.Time{}
+	_, err := fs.loadBase()
+	return err
+}
+
+// Close waits for the update loop to exit
+func (fs *LocalFileStreamer) Close() error {
+	fs.wg.Wait()
+	return nil
+}
+
 func (fs *LocalFileStreamer) updateData(ctx context.Context) error {
 	switch fs.cfg.UpdatMode {
 	case Static, Dynamic:
-		fs.addNum = 0
-		fs.errorNum = 0
 		if fs.hasInit && fs.cfg.UpdatMode == Static {
 			return nil
 		}
-		f, err := os.Open(fs.cfg.Path)
-		defer func() { _ = f.Close() }()
-		if err != nil {
-			return err
-		}
-		stat, _ := f.Stat()
-		modTime := stat.ModTime()
-		if modTime.After(fs.modTime) {
-			fs.modTime = modTime
-			fs.fileReader = bufio.NewReader(f)
-			if fs.cfg.OnBeforeBase != nil {
-				err := fs.cfg.OnBeforeBase(fs)
-				if err != nil {
-					return fmt.Errorf("OnBeforeBase Error: " + err.Error())
-				}
-			}
-			err = fs.container.LoadBase(fs)
-			if fs.cfg.OnFinishBase != nil {
-				fs.cfg.OnFinishBase(fs)
+		return fs.loadBaseOrSnapshot()
+	case Increment:
+		if !fs.hasInit {
+			if err := fs.loadBaseOrSnapshot(); err != nil {
+				return err
 			}
-			return err
 		}
-	case Increment:
+		return fs.loadInc()
 	case DynInc:
+		if err := fs.loadBaseOrSnapshot(); err != nil {
+			return err
+		}
+		return fs.loadInc()
 	default:
 		return errors.New("not support mode[" + fs.cfg.UpdatMode.toString() + "]")
 	}
+}
+
+// loadBaseOrSnapshot loads the base, the snapshot is loaded instead if the first base load fails.
+// The deltas newer than the snapshot are applied by the following inc loads.
+func (fs *LocalFileStreamer) loadBaseOrSnapshot() error {
+	_, err := fs.loadBase()
+	if err == nil || fs.hasInit || fs.cfg.SnapshotPath == "" {
+		return err
+	}
+	created, e := loadSnapshot(fs.container, fs.cfg.SnapshotPath, fs.cfg.SnapshotCodec)
+	if e != nil {
+		fs.WarnStatus("LoadSnapshot error: " + e.Error())
+		return err
+	}
+	fs.hasInit = true
+	fs.setLastBaseTime(created)
+	fs.resetInc(created)
+	fs.WarnStatus("LoadBase error: " + err.Error() + ", loaded snapshot created at " + created.Format(time.RFC3339))
 	return nil
 }
 
+// loadBase reloads the base file if its mtime changed, returns whether the data was reloaded
+func (fs *LocalFileStreamer) loadBase() (loaded bool, err error) {
+	start := time.Now()
+	defer func() {
+		if loaded || err != nil {
+			fs.notify(LoadKindBase, start, err)
+		}
+	}()
+	f, err := os.Open(fs.cfg.Path)
+	if err != nil {
+		return false, err
+	}
+	defer func() { _ = f.Close() }()
+	stat, err := f.Stat()
+	if err != nil {
+		return false, err
+	}
+	modTime := stat.ModTime()
+	if !modTime.After(fs.modTime) {
+		return false, nil
+	}
+	fs.resetNums()
+	fs.setLastBaseTime(start)
+	fs.modTime = modTime
+	fs.resetIter(bufio.NewReader(f), false)
+	if fs.cfg.OnBeforeBase != nil {
+		err := fs.cfg.OnBeforeBase(fs)
+		if err != nil {
+			return false, fmt.Errorf("OnBeforeBase Error: " + err.Error())
+		}
+	}
+	err = fs.container.LoadBase(fs)
+	fs.setBaseTimeUsed(time.Now().Sub(start))
+	if fs.cfg.OnFinishBase != nil {
+		fs.cfg.OnFinishBase(fs)
+	}
+	if err != nil {
+		return false, err
+	}
+	fs.hasInit = true
+	fs.resetInc(modTime)
+	if fs.cfg.SnapshotPath != "" {
+		if err := saveSnapshot(fs.container, fs.cfg.SnapshotPath, fs.cfg.SnapshotCodec); err != nil {
+			fs.WarnStatus("SaveSnapshot error: " + err.Error())
+		}
+	}
+	return true, nil
+}
+
+// resetInc drops the incremental progress after a base load.
+// Delta files not newer than the base are treated as merged into it, an
+// append-only delta file is replayed from the beginning.
+func (fs *LocalFileStreamer) resetInc(baseModTime time.Time) {
+	fs.incOffset = 0
+	fs.incApplied = make(map[string]bool)
+	if fs.cfg.IncPath == "" {
+		return
+	}
+	files, err := ioutil.ReadDir(fs.cfg.IncPath)
+	if err != nil {
+		return
+	}
+	for _, fi := range files {
+		if !fi.ModTime().After(baseModTime) {
+			fs.incApplied[fi.Name()] = true
+		}
+	}
+}
+
+// loadInc applies the deltas found in cfg.IncPath. A directory is treated as
+// a set of delta files applied once each in name order, a regular file is
+// treated as an append-only log tailed by byte offset.
+func (fs *LocalFileStreamer) loadInc() (err error) {
+	if fs.cfg.IncPath == "" {
+		return nil
+	}
+	stat, err := os.Stat(fs.cfg.IncPath)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	start := time.Now()
+	fs.setLastIncTime(start)
+	defer func() {
+		fs.setIncTimeUsed(time.Now().Sub(start))
+		fs.notify(LoadKindInc, start, err)
+	}()
+	if stat.IsDir() {
+		return fs.loadIncDir()
+	}
+	return fs.loadIncTail(stat.Size())
+}
+
+func (fs *LocalFileStreamer) loadIncDir() error {
+	files, err := ioutil.ReadDir(fs.cfg.IncPath)
+	if err != nil {
+		return err
+	}
+	if fs.incApplied == nil {
+		fs.incApplied = make(map[string]bool)
+	}
+	names := make([]string, 0, len(files))
+	for _, fi := range files {
+		// hidden files are the ones still being written
+		if fi.IsDir() || strings.HasPrefix(fi.Name(), ".") || fs.incApplied[fi.Name()] {
+			continue
+		}
+		names = append(names, fi.Name())
+	}
+	sort.Strings(names)
+
+	// a file failing is loaded again by the next round, the files after it wait for it so that
+	// the deltas are applied in order
+	for _, name := range names {
+		if err := fs.loadIncFile(filepath.Join(fs.cfg.IncPath, name)); err != nil {
+			fs.WarnStatus("LoadInc file[" + name + "] error: " + err.Error())
+			return err
+		}
+		fs.incApplied[name] = true
+	}
+	return nil
+}
+
+func (fs *LocalFileStreamer) loadIncFile(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = f.Close() }()
+	fs.resetIter(bufio.NewReader(f), false)
+	return fs.container.LoadInc(fs)
+}
+
+func (fs *LocalFileStreamer) loadIncTail(size int64) error {
+	if size < fs.incOffset {
+		// the file was truncated or rotated, start over
+		fs.incOffset = 0
+	}
+	if size == fs.incOffset {
+		return nil
+	}
+	f, err := os.Open(fs.cfg.IncPath)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = f.Close() }()
+	if _, err := f.Seek(fs.incOffset, 0); err != nil {
+		return err
+	}
+	fs.resetIter(bufio.NewReader(f), true)
+	return fs.container.LoadInc(fs)
+}
+
+func (fs *LocalFileStreamer) resetIter(r *bufio.Reader, tail bool) {
+	fs.fileReader = r
+	fs.tail = tail
+	fs.eof = false
+	fs.result = nil
+	fs.curLen = 0
+}
+
+func (fs *LocalFileStreamer) notify(kind LoadKind, start time.Time, err error) {
+	if fs.observer == nil {
+		return
+	}
+	fs.observer(LoadEvent{
+		Name:  fs.cfg.Name,
+		Kind:  kind,
+		Start: start,
+		Used:  time.Since(start),
+		Err:   err,
+		Info:  fs.GetInfo(),
+	})
+}
+
 func (fs *LocalFileStreamer) InfoStatus(s string) {
 	if fs.cfg.Logger != nil {
 		fs.cfg.Logger.Infof("%s, streamerInfo[%s]", s, fs.getInfoStr())
@@ -202,14 +445,7 @@ func (fs *LocalFileStreamer) WarnStatus(s string) {
 }
 
 func (fs *LocalFileStreamer) GetInfo() *Info {
-	return &Info{
-		Name:         fs.cfg.Name,
-		TotalNum:     fs.container.Len(),
-		AddNum:       fs.addNum,
-		ErrorNum:     fs.errorNum,
-		LastBaseTime: fs.lastBaseTime,
-		BaseTimeUsed: fs.baseTimeUsed,
-	}
+	return fs.info(fs.cfg.Name, fs.container)
 }
 
 func (fs *LocalFileStreamer) getInfoStr() string {
@@ -1,10 +1,14 @@
 package streamer
 
-import "github.com/Mintegral-official/mtggokit/bifrost/log"
+import (
+	"github.com/Mintegral-official/mtggokit/bifrost/container"
+	"github.com/Mintegral-official/mtggokit/bifrost/log"
+)
 
 type LocalFileStreamerCfg struct {
 	Name         string
 	Path         string
+	IncPath      string // Increment/DynInc: a directory of delta files or an append-only delta file
 	UpdatMode    UpdatMode
 	Interval     int
 	IsSync       bool
@@ -13,4 +17,9 @@ type LocalFileStreamerCfg struct {
 	Logger       log.BiLogger
 	OnBeforeBase func(streamer Streamer) error
 	OnFinishBase func(streamer Streamer)
+
+	// SnapshotPath enables the snapshot: the container is dumped to it after each successful
+	// base load, and loaded from it when the first base load fails
+	SnapshotPath  string
+	SnapshotCodec container.ValueCodec
 }
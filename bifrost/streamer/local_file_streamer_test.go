@@ -6,6 +6,7 @@ import (
 	"github.com/Mintegral-official/mtggokit/bifrost/container"
 	"github.com/sirupsen/logrus"
 	"github.com/smartystreets/goconvey/convey"
+	"io/ioutil"
 	"os"
 	"path/filepath"
 	"runtime"
@@ -130,3 +131,217 @@ func TestLocalFileStreamer_UpdateData(t *testing.T) {
 		//})
 	})
 }
+
+// deltaParser parses "key\tvalue" as add and "-\tkey" as delete
+type deltaParser struct {
+}
+
+func (*deltaParser) Parse(data []byte, userData interface{}) []ParserResult {
+	items := strings.SplitN(string(data), "\t", 2)
+	if len(items) != 2 {
+		return nil
+	}
+	if items[0] == "-" {
+		return []ParserResult{{DataMode: container.DataModeDel, Key: container.StrKey(items[1])}}
+	}
+	return []ParserResult{{DataMode: container.DataModeAdd, Key: container.StrKey(items[0]), Value: items[1]}}
+}
+
+func writeFile(path, data string) error {
+	return ioutil.WriteFile(path, []byte(data), 0644)
+}
+
+func appendFile(path, data string) error {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	_, err = f.WriteString(data)
+	if e := f.Close(); err == nil {
+		err = e
+	}
+	return err
+}
+
+func TestLocalFileStreamer_Increment(t *testing.T) {
+	convey.Convey("Test Increment with a directory of delta files", t, func() {
+		dir, err := ioutil.TempDir("", "bifrost")
+		convey.So(err, convey.ShouldBeNil)
+		defer os.RemoveAll(dir)
+		base := filepath.Join(dir, "base")
+		incDir := filepath.Join(dir, "inc")
+		convey.So(os.Mkdir(incDir, 0755), convey.ShouldBeNil)
+		convey.So(writeFile(base, "a\taa\nb\tbb\n"), convey.ShouldBeNil)
+
+		lfs := NewFileStreamer(&LocalFileStreamerCfg{
+			Name:       "inc",
+			Path:       base,
+			IncPath:    incDir,
+			UpdatMode:  Increment,
+			DataParser: &deltaParser{},
+		})
+		lfs.SetContainer(container.CreateBlockingMapContainer(1, 0))
+		convey.So(lfs.updateData(context.Background()), convey.ShouldBeNil)
+		convey.So(lfs.GetContainer().Len(), convey.ShouldEqual, 2)
+
+		convey.So(writeFile(filepath.Join(incDir, "0002"), "-\ta\n"), convey.ShouldBeNil)
+		convey.So(writeFile(filepath.Join(incDir, "0001"), "c\tcc\na\tAA\n"), convey.ShouldBeNil)
+		convey.So(writeFile(filepath.Join(incDir, ".0003"), "d\tdd\n"), convey.ShouldBeNil)
+		convey.So(lfs.updateData(context.Background()), convey.ShouldBeNil)
+
+		_, err = lfs.GetContainer().Get(container.StrKey("a"))
+		convey.So(err, convey.ShouldEqual, container.NotExistErr)
+		v, err := lfs.GetContainer().Get(container.StrKey("c"))
+		convey.So(err, convey.ShouldBeNil)
+		convey.So(v, convey.ShouldEqual, "cc")
+		_, err = lfs.GetContainer().Get(container.StrKey("d"))
+		convey.So(err, convey.ShouldEqual, container.NotExistErr)
+
+		// applied files are not applied again
+		convey.So(lfs.GetContainer().Set(container.StrKey("c"), "changed"), convey.ShouldBeNil)
+		convey.So(lfs.updateData(context.Background()), convey.ShouldBeNil)
+		v, _ = lfs.GetContainer().Get(container.StrKey("c"))
+		convey.So(v, convey.ShouldEqual, "changed")
+
+		// a file failing is loaded again, the files after it wait for it
+		convey.So(os.Symlink(filepath.Join(dir, "missing"), filepath.Join(incDir, "0004")), convey.ShouldBeNil)
+		convey.So(writeFile(filepath.Join(incDir, "0005"), "e\tEE\n"), convey.ShouldBeNil)
+		convey.So(lfs.updateData(context.Background()), convey.ShouldNotBeNil)
+		_, err = lfs.GetContainer().Get(container.StrKey("e"))
+		convey.So(err, convey.ShouldEqual, container.NotExistErr)
+		convey.So(writeFile(filepath.Join(dir, "missing"), "e\tee\nf\tff\n"), convey.ShouldBeNil)
+		convey.So(lfs.updateData(context.Background()), convey.ShouldBeNil)
+		v, _ = lfs.GetContainer().Get(container.StrKey("e"))
+		convey.So(v, convey.ShouldEqual, "EE")
+		v, _ = lfs.GetContainer().Get(container.StrKey("f"))
+		convey.So(v, convey.ShouldEqual, "ff")
+	})
+
+	convey.Convey("Test Increment with an append-only delta file", t, func() {
+		dir, err := ioutil.TempDir("", "bifrost")
+		convey.So(err, convey.ShouldBeNil)
+		defer os.RemoveAll(dir)
+		base := filepath.Join(dir, "base")
+		incFile := filepath.Join(dir, "inc")
+		convey.So(writeFile(base, "a\taa\n"), convey.ShouldBeNil)
+
+		lfs := NewFileStreamer(&LocalFileStreamerCfg{
+			Name:       "tail",
+			Path:       base,
+			IncPath:    incFile,
+			UpdatMode:  Increment,
+			DataParser: &deltaParser{},
+		})
+		lfs.SetContainer(container.CreateBlockingMapContainer(1, 0))
+		convey.So(lfs.updateData(context.Background()), convey.ShouldBeNil)
+		convey.So(lfs.GetContainer().Len(), convey.ShouldEqual, 1)
+
+		convey.So(appendFile(incFile, "b\tbb\nc\tc"), convey.ShouldBeNil)
+		convey.So(lfs.updateData(context.Background()), convey.ShouldBeNil)
+		convey.So(lfs.GetContainer().Len(), convey.ShouldEqual, 2)
+		_, err = lfs.GetContainer().Get(container.StrKey("c"))
+		convey.So(err, convey.ShouldEqual, container.NotExistErr)
+
+		// the incomplete line is read once it is finished
+		convey.So(appendFile(incFile, "c\n-\ta\n"), convey.ShouldBeNil)
+		convey.So(lfs.updateData(context.Background()), convey.ShouldBeNil)
+		v, err := lfs.GetContainer().Get(container.StrKey("c"))
+		convey.So(err, convey.ShouldBeNil)
+		convey.So(v, convey.ShouldEqual, "cc")
+		_, err = lfs.GetContainer().Get(container.StrKey("a"))
+		convey.So(err, convey.ShouldEqual, container.NotExistErr)
+		convey.So(lfs.incOffset, convey.ShouldEqual, len("b\tbb\nc\tcc\n-\ta\n"))
+	})
+}
+
+func TestLocalFileStreamer_DynInc(t *testing.T) {
+	convey.Convey("Test DynInc reloads the base when its mtime changes", t, func() {
+		dir, err := ioutil.TempDir("", "bifrost")
+		convey.So(err, convey.ShouldBeNil)
+		defer os.RemoveAll(dir)
+		base := filepath.Join(dir, "base")
+		incDir := filepath.Join(dir, "inc")
+		convey.So(os.Mkdir(incDir, 0755), convey.ShouldBeNil)
+		convey.So(writeFile(base, "a\taa\n"), convey.ShouldBeNil)
+		old := time.Now().Add(-time.Hour)
+		convey.So(os.Chtimes(base, old, old), convey.ShouldBeNil)
+
+		lfs := NewFileStreamer(&LocalFileStreamerCfg{
+			Name:       "dyninc",
+			Path:       base,
+			IncPath:    incDir,
+			UpdatMode:  DynInc,
+			DataParser: &deltaParser{},
+		})
+		lfs.SetContainer(container.CreateBlockingMapContainer(1, 0))
+		convey.So(lfs.updateData(context.Background()), convey.ShouldBeNil)
+		convey.So(writeFile(filepath.Join(incDir, "0001"), "b\tbb\n"), convey.ShouldBeNil)
+		convey.So(lfs.updateData(context.Background()), convey.ShouldBeNil)
+		convey.So(lfs.GetContainer().Len(), convey.ShouldEqual, 2)
+
+		// the new base already contains delta 0001, only newer deltas are applied
+		convey.So(writeFile(base, "x\txx\n"), convey.ShouldBeNil)
+		convey.So(lfs.updateData(context.Background()), convey.ShouldBeNil)
+		convey.So(lfs.GetContainer().Len(), convey.ShouldEqual, 1)
+		v, err := lfs.GetContainer().Get(container.StrKey("x"))
+		convey.So(err, convey.ShouldBeNil)
+		convey.So(v, convey.ShouldEqual, "xx")
+
+		future := time.Now().Add(time.Hour)
+		convey.So(writeFile(filepath.Join(incDir, "0002"), "c\tcc\n"), convey.ShouldBeNil)
+		convey.So(os.Chtimes(filepath.Join(incDir, "0002"), future, future), convey.ShouldBeNil)
+		convey.So(lfs.updateData(context.Background()), convey.ShouldBeNil)
+		convey.So(lfs.GetContainer().Len(), convey.ShouldEqual, 2)
+	})
+}
+
+func TestLocalFileStreamer_Snapshot(t *testing.T) {
+	convey.Convey("Test warm start from the snapshot", t, func() {
+		dir, err := ioutil.TempDir("", "bifrost")
+		convey.So(err, convey.ShouldBeNil)
+		defer os.RemoveAll(dir)
+		base := filepath.Join(dir, "base")
+		incDir := filepath.Join(dir, "inc")
+		snapshot := filepath.Join(dir, "snapshot")
+		convey.So(os.Mkdir(incDir, 0755), convey.ShouldBeNil)
+		convey.So(writeFile(base, "a\taa\nb\tbb\n"), convey.ShouldBeNil)
+		cfg := &LocalFileStreamerCfg{
+			Name:          "snapshot",
+			Path:          base,
+			IncPath:       incDir,
+			UpdatMode:     Increment,
+			DataParser:    &deltaParser{},
+			SnapshotPath:  snapshot,
+			SnapshotCodec: container.StringCodec{},
+		}
+		lfs := NewFileStreamer(cfg)
+		lfs.SetContainer(container.CreateBlockingMapContainer(1, 0))
+		convey.So(lfs.updateData(context.Background()), convey.ShouldBeNil)
+		_, err = os.Stat(snapshot)
+		convey.So(err, convey.ShouldBeNil)
+
+		// the base is gone, the deltas older than the snapshot are merged in it
+		convey.So(os.Remove(base), convey.ShouldBeNil)
+		now := time.Now()
+		convey.So(writeFile(filepath.Join(incDir, "0001"), "-\ta\n"), convey.ShouldBeNil)
+		convey.So(os.Chtimes(filepath.Join(incDir, "0001"), now, now.Add(-time.Hour)), convey.ShouldBeNil)
+		convey.So(writeFile(filepath.Join(incDir, "0002"), "c\tcc\n"), convey.ShouldBeNil)
+		convey.So(os.Chtimes(filepath.Join(incDir, "0002"), now, now.Add(time.Hour)), convey.ShouldBeNil)
+
+		warm := NewFileStreamer(cfg)
+		warm.SetContainer(container.CreateBlockingMapContainer(1, 0))
+		convey.So(warm.updateData(context.Background()), convey.ShouldBeNil)
+		convey.So(warm.GetContainer().Len(), convey.ShouldEqual, 3)
+		for k, v := range map[string]string{"a": "aa", "b": "bb", "c": "cc"} {
+			value, err := warm.GetContainer().Get(container.StrKey(k))
+			convey.So(err, convey.ShouldBeNil)
+			convey.So(value, convey.ShouldEqual, v)
+		}
+
+		// no snapshot, the error of the base is returned
+		convey.So(os.Remove(snapshot), convey.ShouldBeNil)
+		cold := NewFileStreamer(cfg)
+		cold.SetContainer(container.CreateBlockingMapContainer(1, 0))
+		convey.So(cold.updateData(context.Background()), convey.ShouldNotBeNil)
+	})
+}
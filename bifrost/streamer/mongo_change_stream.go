@@ -0,0 +1,252 @@
+package streamer
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"time"
+
+	"github.com/Mintegral-official/mtggokit/bifrost/container"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// changeStreamWait is how long an inc round waits for new events
+var changeStreamWait = time.Second
+
+const (
+	// changeStreamBatch bounds the events applied by an inc round, the rest are left to the next
+	changeStreamBatch = 10000
+
+	errorChangeStreamFatal       int32 = 280
+	errorChangeStreamHistoryLost int32 = 286
+)
+
+// ChangeStream is the part of *mongo.ChangeStream used by MongoStreamer
+type ChangeStream interface {
+	Next(ctx context.Context) bool
+	Decode(val interface{}) error
+	ResumeToken() bson.Raw
+	Err() error
+	Close(ctx context.Context) error
+}
+
+type changeEvent struct {
+	OperationType string   `bson:"operationType"`
+	FullDocument  bson.Raw `bson:"fullDocument"`
+	DocumentKey   bson.Raw `bson:"documentKey"`
+}
+
+func (ms *MongoStreamer) watchCollection(ctx context.Context, resumeAfter bson.Raw) (ChangeStream, error) {
+	opt := options.ChangeStream().SetFullDocument(options.UpdateLookup)
+	if resumeAfter != nil {
+		opt.SetResumeAfter(resumeAfter)
+	}
+	return ms.collection.Watch(ctx, mongo.Pipeline{}, opt)
+}
+
+// openChangeStream watches the collection from the saved resume token. When the token has
+// expired, or there is no token for the data already loaded, a base load is needed to catch up.
+// It must be called with ms.mu held.
+func (ms *MongoStreamer) openChangeStream(ctx context.Context) error {
+	if ms.stream != nil {
+		return nil
+	}
+	if !ms.tokenLoaded {
+		ms.tokenLoaded = true
+		ms.resumeToken = ms.readResumeToken()
+	}
+	if ms.resumeToken == nil && ms.hasInit {
+		ms.needBase = true
+	}
+	watch := ms.watch
+	if watch == nil {
+		watch = ms.watchCollection
+	}
+	stream, err := watch(ctx, ms.resumeToken)
+	if err != nil && ms.resumeToken != nil && isHistoryLost(err) {
+		ms.WarnStatus("resume token expired, reload base:" + err.Error())
+		ms.dropResumeToken()
+		ms.needBase = ms.hasInit
+		stream, err = watch(ctx, nil)
+	}
+	if err != nil {
+		return err
+	}
+	ms.stream = stream
+	return nil
+}
+
+// loadChanges applies the events received since the previous round, it must be called with
+// ms.mu held
+func (ms *MongoStreamer) loadChanges(ctx context.Context) (err error) {
+	start := time.Now()
+	ms.setLastIncTime(start)
+	defer func() {
+		ms.setIncTimeUsed(time.Now().Sub(start))
+		ms.notify(LoadKindInc, start, err)
+	}()
+	if err := ms.openChangeStream(ctx); err != nil {
+		return errors.New("WatchError: " + err.Error())
+	}
+	if ms.needBase {
+		if err := ms.loadBaseLocked(ctx); err != nil {
+			return err
+		}
+		ms.needBase = false
+	}
+
+	wctx, cancel := context.WithTimeout(ctx, changeStreamWait)
+	defer cancel()
+	results := make([]ParserResult, 0)
+	n := 0
+	for n < changeStreamBatch && ms.stream.Next(wctx) {
+		n++
+		results = append(results, ms.parseChange()...)
+	}
+	streamErr := ms.stream.Err()
+	// the driver tries to resume the stream with the expired context, which breaks it, so the
+	// stream is reopened from the resume token by the next round
+	reopen := wctx.Err() != nil
+	if reopen && ctx.Err() == nil {
+		// no more events in this round
+		streamErr = nil
+	}
+	// the token of the last event, or the one the server sends with an empty batch
+	token := ms.stream.ResumeToken()
+
+	if len(results) > 0 {
+		err = ms.container.LoadInc(&resultIter{ms: ms, results: results})
+	}
+	if err != nil {
+		// the stream has moved past the events, they're read again from the saved token
+		reopen = true
+	} else if token != nil && !bytes.Equal(token, ms.resumeToken) {
+		ms.saveResumeToken(token)
+	}
+	if streamErr != nil || reopen {
+		_ = ms.stream.Close(ctx)
+		ms.stream = nil
+	}
+	if streamErr != nil {
+		if isHistoryLost(streamErr) {
+			ms.dropResumeToken()
+			ms.needBase = true
+		}
+		return errors.New("ChangeStreamError: " + streamErr.Error())
+	}
+	return err
+}
+
+// parseChange maps the current event to DataModeAdd for insert, DataModeUpdate for update and
+// replace, DataModeDel for delete. The other events such as drop invalidate the stream, they
+// are reported by its Err.
+func (ms *MongoStreamer) parseChange() []ParserResult {
+	var e changeEvent
+	if err := ms.stream.Decode(&e); err != nil {
+		return []ParserResult{{Err: errors.New("DecodeError: " + err.Error())}}
+	}
+	parser := ms.cfg.IncParser
+	data := e.FullDocument
+	var mode container.DataMode
+	switch e.OperationType {
+	case "insert":
+		mode = container.DataModeAdd
+	case "update", "replace":
+		if len(e.FullDocument) == 0 {
+			// deleted after the update, the delete event follows
+			return nil
+		}
+		mode = container.DataModeUpdate
+	case "delete":
+		mode = container.DataModeDel
+		data = e.DocumentKey
+		if ms.cfg.DeleteParser != nil {
+			parser = ms.cfg.DeleteParser
+		}
+	default:
+		return nil
+	}
+	results := parser.Parse(data, ms.cfg.UserData)
+	if results == nil {
+		return []ParserResult{{Err: errors.New("Parse error, operationType[" + e.OperationType + "]")}}
+	}
+	for i := range results {
+		results[i].DataMode = mode
+	}
+	return results
+}
+
+func (ms *MongoStreamer) readResumeToken() bson.Raw {
+	if ms.cfg.ResumeTokenPath == "" {
+		return nil
+	}
+	data, err := ioutil.ReadFile(ms.cfg.ResumeTokenPath)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			ms.WarnStatus("read resume token error:" + err.Error())
+		}
+		return nil
+	}
+	token := bson.Raw(data)
+	if err := token.Validate(); err != nil {
+		ms.WarnStatus("invalid resume token:" + err.Error())
+		return nil
+	}
+	return token
+}
+
+func (ms *MongoStreamer) saveResumeToken(token bson.Raw) {
+	ms.resumeToken = token
+	if ms.cfg.ResumeTokenPath == "" {
+		return
+	}
+	tmp := ms.cfg.ResumeTokenPath + ".tmp"
+	if err := ioutil.WriteFile(tmp, token, 0644); err != nil {
+		ms.WarnStatus("save resume token error:" + err.Error())
+		return
+	}
+	if err := os.Rename(tmp, ms.cfg.ResumeTokenPath); err != nil {
+		ms.WarnStatus("save resume token error:" + err.Error())
+	}
+}
+
+func (ms *MongoStreamer) dropResumeToken() {
+	ms.resumeToken = nil
+	if ms.cfg.ResumeTokenPath != "" {
+		_ = os.Remove(ms.cfg.ResumeTokenPath)
+	}
+}
+
+func isHistoryLost(err error) bool {
+	var ce mongo.CommandError
+	if !errors.As(err, &ce) {
+		return false
+	}
+	return ce.Code == errorChangeStreamHistoryLost || ce.Code == errorChangeStreamFatal ||
+		ce.Name == "ChangeStreamHistoryLost"
+}
+
+// resultIter iterates the parsed events, the records are counted as the ones of the cursor
+type resultIter struct {
+	ms      *MongoStreamer
+	results []ParserResult
+	i       int
+}
+
+func (ri *resultIter) HasNext() (bool, error) {
+	return ri.i < len(ri.results), nil
+}
+
+func (ri *resultIter) Next() (container.DataMode, container.MapKey, interface{}, error) {
+	r := ri.results[ri.i]
+	ri.i++
+	ri.ms.addTotal()
+	if r.Err != nil {
+		ri.ms.addError()
+	}
+	return r.DataMode, r.Key, r.Value, r.Err
+}
@@ -0,0 +1,260 @@
+package streamer
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/Mintegral-official/mtggokit/bifrost/container"
+	"github.com/smartystreets/goconvey/convey"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// idParser parses {_id: int64, name: string}
+type idParser struct{}
+
+func (*idParser) Parse(data []byte, userData interface{}) []ParserResult {
+	id, ok := bson.Raw(data).Lookup("_id").Int64OK()
+	if !ok {
+		return nil
+	}
+	name, _ := bson.Raw(data).Lookup("name").StringValueOK()
+	return []ParserResult{{DataMode: container.DataModeAdd, Key: container.I64Key(id), Value: name}}
+}
+
+// fakeChangeStream returns its events, then err if any, otherwise it waits for more until ctx
+// is done. Like the driver, it can't be used after a context error.
+type fakeChangeStream struct {
+	events []bson.Raw
+	err    error
+	ctxErr error
+	start  bson.Raw // the token it was opened from
+	i      int
+	closed bool
+}
+
+func (fc *fakeChangeStream) Next(ctx context.Context) bool {
+	if fc.ctxErr != nil {
+		return false
+	}
+	if fc.i < len(fc.events) {
+		fc.i++
+		return true
+	}
+	if fc.err == nil {
+		<-ctx.Done()
+		fc.ctxErr = ctx.Err()
+	}
+	return false
+}
+
+func (fc *fakeChangeStream) Decode(val interface{}) error {
+	return bson.Unmarshal(fc.events[fc.i-1], val)
+}
+
+func (fc *fakeChangeStream) ResumeToken() bson.Raw {
+	if fc.i == 0 {
+		return fc.start
+	}
+	token, _ := bson.Marshal(bson.M{"_data": strconv.Itoa(fc.i)})
+	return token
+}
+
+func (fc *fakeChangeStream) Err() error {
+	if fc.ctxErr != nil {
+		return fc.ctxErr
+	}
+	if fc.i < len(fc.events) {
+		return nil
+	}
+	return fc.err
+}
+
+func (fc *fakeChangeStream) Close(ctx context.Context) error {
+	fc.closed = true
+	return nil
+}
+
+// fakeWatcher hands out the queued streams and records the resume tokens it was given
+type fakeWatcher struct {
+	streams []*fakeChangeStream
+	tokens  []bson.Raw
+	expired bool // reject any resume token
+}
+
+func (fw *fakeWatcher) watch(ctx context.Context, resumeAfter bson.Raw) (ChangeStream, error) {
+	fw.tokens = append(fw.tokens, resumeAfter)
+	if resumeAfter != nil && fw.expired {
+		return nil, mongo.CommandError{Code: errorChangeStreamHistoryLost, Name: "ChangeStreamHistoryLost"}
+	}
+	if len(fw.streams) == 0 {
+		return &fakeChangeStream{start: resumeAfter}, nil
+	}
+	s := fw.streams[0]
+	fw.streams = fw.streams[1:]
+	s.start = resumeAfter
+	return s, nil
+}
+
+func event(op string, id int64, name string) bson.Raw {
+	e := bson.M{"operationType": op, "documentKey": bson.M{"_id": id}}
+	if name != "" {
+		e["fullDocument"] = bson.M{"_id": id, "name": name}
+	}
+	raw, _ := bson.Marshal(e)
+	return raw
+}
+
+func newChangeStreamer(fw *fakeWatcher, tokenPath string, baseNum *int) *MongoStreamer {
+	ms := &MongoStreamer{
+		cfg: &MongoStreamerCfg{
+			Name:            "change_stream",
+			IncParser:       &idParser{},
+			ChangeStream:    true,
+			ResumeTokenPath: tokenPath,
+			// nil query, the base load is counted without querying mongo
+			OnBeforeBase: func(interface{}) interface{} {
+				*baseNum++
+				return nil
+			},
+		},
+		watch: fw.watch,
+	}
+	ms.SetContainer(container.CreateBlockingMapContainer(1, 0))
+	return ms
+}
+
+func TestMongoStreamer_ChangeStream(t *testing.T) {
+	dir, err := ioutil.TempDir("", "bifrost")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	defer func(wait time.Duration) { changeStreamWait = wait }(changeStreamWait)
+	changeStreamWait = 10 * time.Millisecond
+
+	convey.Convey("Test events are mapped to data modes", t, func() {
+		tokenPath := filepath.Join(dir, "token1")
+		baseNum := 0
+		fw := &fakeWatcher{streams: []*fakeChangeStream{{events: []bson.Raw{
+			event("insert", 1, "a"),
+			event("insert", 2, "b"),
+			event("insert", 3, "c"),
+			event("update", 1, "aa"),
+			event("replace", 2, "bb"),
+			event("update", 3, ""), // deleted after the update
+			event("delete", 3, ""),
+			event("drop", 0, ""),
+		}}}}
+		ms := newChangeStreamer(fw, tokenPath, &baseNum)
+		convey.So(ms.loadFirst(context.Background()), convey.ShouldBeNil)
+		convey.So(baseNum, convey.ShouldEqual, 1)
+		convey.So(ms.loadInc(context.Background()), convey.ShouldBeNil)
+
+		c := ms.GetContainer()
+		convey.So(c.Len(), convey.ShouldEqual, 2)
+		v, _ := c.Get(container.I64Key(1))
+		convey.So(v, convey.ShouldEqual, "aa")
+		v, _ = c.Get(container.I64Key(2))
+		convey.So(v, convey.ShouldEqual, "bb")
+		_, err := c.Get(container.I64Key(3))
+		convey.So(err, convey.ShouldEqual, container.NotExistErr)
+
+		// the token is persisted, a restart resumes from it
+		data, err := ioutil.ReadFile(tokenPath)
+		convey.So(err, convey.ShouldBeNil)
+		convey.So(bson.Raw(data).Lookup("_data").StringValue(), convey.ShouldEqual, "8")
+		restarted := newChangeStreamer(fw, tokenPath, &baseNum)
+		convey.So(restarted.loadFirst(context.Background()), convey.ShouldBeNil)
+		convey.So(fw.tokens[len(fw.tokens)-1], convey.ShouldResemble, bson.Raw(data))
+	})
+
+	convey.Convey("Test expired resume token falls back to a base load", t, func() {
+		tokenPath := filepath.Join(dir, "token2")
+		token, _ := bson.Marshal(bson.M{"_data": "old"})
+		convey.So(ioutil.WriteFile(tokenPath, token, 0644), convey.ShouldBeNil)
+		baseNum := 0
+		fw := &fakeWatcher{expired: true, streams: []*fakeChangeStream{{events: []bson.Raw{event("insert", 1, "a")}}}}
+		ms := newChangeStreamer(fw, tokenPath, &baseNum)
+		ms.hasInit = true // e.g. warm started from a snapshot
+		convey.So(ms.loadInc(context.Background()), convey.ShouldBeNil)
+		convey.So(len(fw.tokens), convey.ShouldEqual, 2)
+		convey.So(fw.tokens[1], convey.ShouldBeNil)
+		convey.So(baseNum, convey.ShouldEqual, 1)
+		v, _ := ms.GetContainer().Get(container.I64Key(1))
+		convey.So(v, convey.ShouldEqual, "a")
+		data, err := ioutil.ReadFile(tokenPath)
+		convey.So(err, convey.ShouldBeNil)
+		convey.So(bson.Raw(data).Lookup("_data").StringValue(), convey.ShouldEqual, "1")
+	})
+
+	convey.Convey("Test stream errors reopen the stream", t, func() {
+		baseNum := 0
+		lost := &fakeChangeStream{
+			events: []bson.Raw{event("insert", 1, "a")},
+			err:    mongo.CommandError{Code: errorChangeStreamHistoryLost},
+		}
+		fw := &fakeWatcher{streams: []*fakeChangeStream{lost, {events: []bson.Raw{event("insert", 2, "b")}}}}
+		ms := newChangeStreamer(fw, "", &baseNum)
+		convey.So(ms.loadFirst(context.Background()), convey.ShouldBeNil)
+		convey.So(ms.loadInc(context.Background()), convey.ShouldNotBeNil)
+		convey.So(lost.closed, convey.ShouldBeTrue)
+		// the events before the error are applied
+		convey.So(ms.GetContainer().Len(), convey.ShouldEqual, 1)
+
+		convey.So(ms.loadInc(context.Background()), convey.ShouldBeNil)
+		convey.So(baseNum, convey.ShouldEqual, 2)
+		convey.So(fw.tokens[len(fw.tokens)-1], convey.ShouldBeNil)
+		v, _ := ms.GetContainer().Get(container.I64Key(2))
+		convey.So(v, convey.ShouldEqual, "b")
+	})
+	convey.Convey("Test the stream is reopened from the token after an idle round", t, func() {
+		baseNum := 0
+		first := &fakeChangeStream{events: []bson.Raw{event("insert", 1, "a")}}
+		fw := &fakeWatcher{streams: []*fakeChangeStream{first, {events: []bson.Raw{event("insert", 2, "b")}}}}
+		ms := newChangeStreamer(fw, "", &baseNum)
+		convey.So(ms.loadFirst(context.Background()), convey.ShouldBeNil)
+		convey.So(ms.loadInc(context.Background()), convey.ShouldBeNil)
+		// the round waited for more events until the deadline
+		convey.So(first.closed, convey.ShouldBeTrue)
+
+		convey.So(ms.loadInc(context.Background()), convey.ShouldBeNil)
+		token, _ := bson.Marshal(bson.M{"_data": "1"})
+		convey.So(fw.tokens[len(fw.tokens)-1], convey.ShouldResemble, bson.Raw(token))
+		convey.So(baseNum, convey.ShouldEqual, 1)
+		v, _ := ms.GetContainer().Get(container.I64Key(2))
+		convey.So(v, convey.ShouldEqual, "b")
+	})
+
+	convey.Convey("Test the events are read again after LoadInc fails", t, func() {
+		baseNum := 0
+		bad, _ := bson.Marshal(bson.M{"operationType": "insert", "fullDocument": bson.M{"_id": "x"}})
+		failed := &fakeChangeStream{events: []bson.Raw{bad, event("insert", 2, "b")}}
+		fw := &fakeWatcher{streams: []*fakeChangeStream{
+			{events: []bson.Raw{event("insert", 1, "a")}},
+			failed,
+			{events: []bson.Raw{event("insert", 2, "b")}},
+		}}
+		ms := newChangeStreamer(fw, "", &baseNum)
+		// the bad event fails the round it's in, 1 error of 3 records, but not the next one
+		ms.SetContainer(container.CreateBlockingMapContainer(1, 0.3))
+		convey.So(ms.loadFirst(context.Background()), convey.ShouldBeNil)
+		convey.So(ms.loadInc(context.Background()), convey.ShouldBeNil)
+		token, _ := bson.Marshal(bson.M{"_data": "1"})
+		convey.So(ms.resumeToken, convey.ShouldResemble, bson.Raw(token))
+
+		convey.So(ms.loadInc(context.Background()), convey.ShouldNotBeNil)
+		convey.So(failed.closed, convey.ShouldBeTrue)
+		convey.So(ms.resumeToken, convey.ShouldResemble, bson.Raw(token))
+
+		convey.So(ms.loadInc(context.Background()), convey.ShouldBeNil)
+		convey.So(fw.tokens[len(fw.tokens)-1], convey.ShouldResemble, bson.Raw(token))
+		v, _ := ms.GetContainer().Get(container.I64Key(2))
+		convey.So(v, convey.ShouldEqual, "b")
+	})
+}
@@ -6,29 +6,45 @@ import (
 	"errors"
 	"fmt"
 	"github.com/Mintegral-official/mtggokit/bifrost/container"
+	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 	"go.mongodb.org/mongo-driver/mongo/readpref"
+	"sync"
 	"time"
 )
 
+const closeTimeout = 5 * time.Second
+
 type MongoStreamer struct {
-	container    container.Container
-	cfg          *MongoStreamerCfg
-	hasInit      bool
-	totalNum     int
-	errorNum     int
-	curParser    DataParser
-	client       *mongo.Client
-	collection   *mongo.Collection
-	cursor       *mongo.Cursor
-	result       []ParserResult
-	curLen       int
-	findOpt      *options.FindOptions
-	lastBaseTime time.Time
-	lastIncTime  time.Time
-	baseTimeUsed time.Duration
-	incTimeUsed  time.Duration
+	container container.Container
+	cfg       *MongoStreamerCfg
+	hasInit   bool
+	loadInfo
+	curParser  DataParser
+	client     *mongo.Client
+	collection *mongo.Collection
+	cursor     *mongo.Cursor
+	result     []ParserResult
+	curLen     int
+	findOpt    *options.FindOptions
+	observer   Observer
+	mu         sync.Mutex // serializes the loads of the update loop and Reload
+
+	// change stream mode, see mongo_change_stream.go
+	watch       func(ctx context.Context, resumeAfter bson.Raw) (ChangeStream, error)
+	stream      ChangeStream
+	resumeToken bson.Raw
+	tokenLoaded bool
+	needBase    bool
+
+	warm bool // the first load read the snapshot, mongo is caught up at once
+
+	// watermark mode, see mongo_watermark.go
+	watermark        watermark
+	pendingWatermark watermark
+
+	wg sync.WaitGroup
 }
 
 func NewMongoStreamer(mongoConfig *MongoStreamerCfg) (*MongoStreamer, error) {
@@ -36,7 +52,8 @@ func NewMongoStreamer(mongoConfig *MongoStreamerCfg) (*MongoStreamer, error) {
 		cfg: mongoConfig,
 	}
 
-	ctx, _ := context.WithTimeout(context.TODO(), time.Duration(mongoConfig.ConnectTimeout)*time.Microsecond)
+	ctx, cancel := context.WithTimeout(context.TODO(), time.Duration(mongoConfig.ConnectTimeout)*time.Microsecond)
+	defer cancel()
 	opt := options.Client().ApplyURI(mongoConfig.URI)
 	opt.SetReadPreference(readpref.SecondaryPreferred())
 	direct := true
@@ -58,7 +75,10 @@ func NewMongoStreamer(mongoConfig *MongoStreamerCfg) (*MongoStreamer, error) {
 		if mongoConfig.Logger != nil {
 			mongoConfig.Logger.Warnf("mongo ping error, err=[%s]", err.Error())
 		}
-		return nil, err
+		// with a snapshot the streamer starts without mongo, the loads reconnect
+		if mongoConfig.SnapshotPath == "" {
+			return nil, err
+		}
 	}
 
 	streamer.collection = client.Database(mongoConfig.DB).Collection(mongoConfig.Collection)
@@ -80,12 +100,22 @@ func (ms *MongoStreamer) GetContainer() container.Container {
 	return ms.container
 }
 
+// SetObserver sets the observer notified after each load, call it before UpdateData
+func (ms *MongoStreamer) SetObserver(o Observer) {
+	ms.observer = o
+}
+
 func (ms *MongoStreamer) GetSchedInfo() *SchedInfo {
 	return &SchedInfo{
 		TimeInterval: ms.cfg.IncInterval,
 	}
 }
 
+// Describe returns the source of the base loads, see container.Describer
+func (ms *MongoStreamer) Describe() string {
+	return "mongo[" + ms.cfg.DB + "." + ms.cfg.Collection + "]"
+}
+
 func (ms *MongoStreamer) HasNext() (bool, error) {
 	if ms.curLen < len(ms.result) {
 		return true, nil
@@ -98,27 +128,30 @@ func (ms *MongoStreamer) HasNext() (bool, error) {
 }
 
 func (ms *MongoStreamer) Next() (container.DataMode, container.MapKey, interface{}, error) {
-	ms.totalNum++
+	ms.addTotal()
 	if ms.curLen < len(ms.result) {
 		r := ms.result[ms.curLen]
 		ms.curLen++
 		if r.Err != nil {
-			ms.errorNum++
+			ms.addError()
 		}
 		return r.DataMode, r.Key, r.Value, r.Err
 	}
 	if ms.cursor == nil {
-		ms.errorNum++
+		ms.addError()
 		return container.DataModeAdd, nil, nil, errors.New("cursor is nil")
 	}
 	if ms.cursor.Err() != nil {
 		ms.WarnStatus(fmt.Sprintf("cursor is error[%s]", ms.cursor.Err().Error()))
-		ms.errorNum++
+		ms.addError()
 		return container.DataModeAdd, nil, nil, errors.New(fmt.Sprintf("cursor is error[%s]", ms.cursor.Err().Error()))
 	}
+	if ms.cfg.WatermarkField != "" {
+		ms.trackWatermark(ms.cursor.Current)
+	}
 	result := ms.curParser.Parse(ms.cursor.Current, ms.cfg.UserData)
 	if result == nil {
-		ms.errorNum++
+		ms.addError()
 		return container.DataModeAdd, nil, nil, errors.New("Parse error")
 	}
 	ms.curLen = 0
@@ -127,36 +160,35 @@ func (ms *MongoStreamer) Next() (container.DataMode, container.MapKey, interface
 		r := ms.result[ms.curLen]
 		ms.curLen++
 		if r.Err != nil {
-			ms.errorNum++
+			ms.addError()
 		}
 		return r.DataMode, r.Key, r.Value, r.Err
 	}
-	ms.errorNum++
+	ms.addError()
 	return container.DataModeAdd, nil, nil, errors.New(fmt.Sprintf("Index[%d] error, len[%d]", ms.curLen, len(ms.result)))
 }
 
 func (ms *MongoStreamer) UpdateData(ctx context.Context) error {
-	ms.lastBaseTime = time.Now()
-	if !ms.hasInit && ms.cfg.IsSync {
-		err := ms.loadBase(ctx)
-		if err != nil {
-			ms.WarnStatus("LoadBase error:" + err.Error())
-		} else {
-			ms.InfoStatus("LoadBase Succ")
-			ms.hasInit = true
+	if ms.cfg.IsSync {
+		ms.mu.Lock()
+		if !ms.hasInit {
+			_ = ms.loadFirst(ctx)
 		}
+		ms.mu.Unlock()
 	}
+	ms.wg.Add(1)
 	go func() {
-		ms.lastBaseTime = time.Now()
+		defer ms.wg.Done()
+		ms.mu.Lock()
 		if !ms.hasInit {
-			err := ms.loadBase(ctx)
-			if err != nil {
-				ms.WarnStatus("LoadBase error:" + err.Error())
-			} else {
-				ms.InfoStatus("LoadBase succ")
-			}
+			_ = ms.loadFirst(ctx)
 		}
+		warm := ms.warm
+		ms.mu.Unlock()
 		inc := time.After(time.Duration(ms.cfg.IncInterval) * time.Second)
+		if warm {
+			inc = time.After(0)
+		}
 		base := time.After(time.Duration(ms.cfg.BaseInterval) * time.Second)
 		if ms.cfg.BaseInterval == 0 {
 			base = nil
@@ -167,7 +199,6 @@ func (ms *MongoStreamer) UpdateData(ctx context.Context) error {
 				ms.InfoStatus("LoadInc Finish:")
 				return
 			case <-inc:
-				ms.lastIncTime = time.Now()
 				err := ms.loadInc(ctx)
 				if err != nil {
 					ms.WarnStatus("LoadInc Error:" + err.Error())
@@ -176,7 +207,6 @@ func (ms *MongoStreamer) UpdateData(ctx context.Context) error {
 				}
 				inc = time.After(time.Duration(ms.cfg.IncInterval) * time.Second)
 			case <-base:
-				ms.lastBaseTime = time.Now()
 				err := ms.loadBase(ctx)
 				if err != nil {
 					ms.WarnStatus("LoadBase Error:" + err.Error())
@@ -190,31 +220,110 @@ func (ms *MongoStreamer) UpdateData(ctx context.Context) error {
 	return nil
 }
 
-func (ms *MongoStreamer) loadBase(ctx context.Context) (err error) {
+// Update runs one round of the update loop, it is called by Sched. The base is loaded
+// when it has never succeeded or BaseInterval has passed, otherwise the increment is loaded.
+func (ms *MongoStreamer) Update(ctx context.Context) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	if !ms.hasInit {
+		return ms.loadFirst(ctx)
+	}
+	baseInterval := time.Duration(ms.cfg.BaseInterval) * time.Second
+	if baseInterval > 0 && time.Since(ms.lastBaseTime) >= baseInterval {
+		if err := ms.loadBaseLocked(ctx); err != nil {
+			ms.WarnStatus("LoadBase error:" + err.Error())
+			return err
+		}
+		ms.InfoStatus("LoadBase succ")
+		return nil
+	}
+	if err := ms.loadIncLocked(ctx); err != nil {
+		ms.WarnStatus("LoadInc error:" + err.Error())
+		return err
+	}
+	ms.InfoStatus("LoadInc succ")
+	return nil
+}
+
+// loadFirst is the first load: the snapshot if there is one, so that a slow or unavailable
+// mongo doesn't block the start, mongo otherwise. After a snapshot LastBaseTime is the time the
+// snapshot was written, and the next round catches up with an inc from the watermark persisted
+// with the snapshot, or loads the base from mongo without one. It must be called with ms.mu held.
+func (ms *MongoStreamer) loadFirst(ctx context.Context) error {
+	if ms.cfg.ChangeStream {
+		// watch before loading, the changes made during the load are applied by the next inc
+		if err := ms.openChangeStream(ctx); err != nil {
+			ms.WarnStatus("Watch error:" + err.Error())
+		}
+	}
+	if ms.cfg.SnapshotPath != "" {
+		created, err := loadSnapshot(ms.container, ms.cfg.SnapshotPath, ms.cfg.SnapshotCodec)
+		if err == nil {
+			ms.hasInit = true
+			ms.warm = true
+			if ms.cfg.WatermarkField != "" {
+				ms.readWatermark()
+			}
+			ms.needBase = ms.cfg.ChangeStream || ms.watermark.Value == 0
+			ms.setLastBaseTime(created)
+			ms.InfoStatus("LoadSnapshot succ, created at " + created.Format(time.RFC3339))
+			return nil
+		}
+		ms.WarnStatus("LoadSnapshot error:" + err.Error())
+	}
+	if err := ms.loadBaseLocked(ctx); err != nil {
+		ms.WarnStatus("LoadBase error:" + err.Error())
+		return err
+	}
+	ms.InfoStatus("LoadBase succ")
+	return nil
+}
+
+func (ms *MongoStreamer) loadBase(ctx context.Context) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	return ms.loadBaseLocked(ctx)
+}
+
+// loadBaseLocked must be called with ms.mu held
+func (ms *MongoStreamer) loadBaseLocked(ctx context.Context) (err error) {
 	for i := -1; i < ms.cfg.TryTimes; i++ {
 		err = ms.loadBase2(ctx)
 		if err == nil {
+			ms.hasInit = true
+			if ms.cfg.SnapshotPath != "" {
+				if e := saveSnapshot(ms.container, ms.cfg.SnapshotPath, ms.cfg.SnapshotCodec); e != nil {
+					ms.WarnStatus("SaveSnapshot error:" + e.Error())
+				} else if ms.cfg.WatermarkField != "" {
+					ms.saveWatermark()
+				}
+			}
 			return nil
-		} else {
+		} else if ms.cfg.Logger != nil {
 			ms.cfg.Logger.Warnf("LoadBase error[%s], tryTimes[%d]", err, i+1)
 		}
+		if !retryable(err) {
+			return
+		}
 	}
 	return
 }
 
 func (ms *MongoStreamer) loadBase2(context.Context) error {
-
+	start := time.Now()
+	ms.setLastBaseTime(start)
 	if ms.cfg.OnBeforeBase != nil {
 		ms.cfg.BaseQuery = ms.cfg.OnBeforeBase(ms.cfg.UserData)
 		if ms.cfg.BaseQuery == nil {
 			return nil
 		}
 	}
-	ms.totalNum = 0
-	ms.errorNum = 0
+	ms.resetNums()
 	cur, err := ms.collection.Find(nil, ms.cfg.BaseQuery, ms.findOpt)
 	if err != nil {
-		return errors.New("FindError, " + err.Error())
+		err = errors.New("FindError, " + err.Error())
+		ms.notify(LoadKindBase, start, err)
+		return err
 	}
 
 	if ms.cursor != nil {
@@ -222,61 +331,132 @@ func (ms *MongoStreamer) loadBase2(context.Context) error {
 	}
 	ms.cursor = cur
 	ms.curParser = ms.cfg.BaseParser
+	ms.resetWatermark()
 	err = ms.container.LoadBase(ms)
-	ms.baseTimeUsed = time.Now().Sub(ms.lastBaseTime)
+	if err == nil {
+		ms.commitWatermark(true)
+	}
+	ms.setBaseTimeUsed(time.Now().Sub(start))
 	if ms.cfg.OnFinishBase != nil {
 		ms.cfg.OnFinishBase(ms)
 	}
+	ms.notify(LoadKindBase, start, err)
 	return err
 }
 
 func (ms *MongoStreamer) loadInc(ctx context.Context) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	return ms.loadIncLocked(ctx)
+}
+
+// loadIncLocked must be called with ms.mu held
+func (ms *MongoStreamer) loadIncLocked(ctx context.Context) error {
+	if ms.cfg.ChangeStream {
+		return ms.loadChanges(ctx)
+	}
+	if ms.needBase {
+		// started from the snapshot, catch up with mongo before the increments
+		if err := ms.loadBaseLocked(ctx); err != nil {
+			return err
+		}
+		ms.needBase = false
+		return nil
+	}
+	start := time.Now()
+	ms.setLastIncTime(start)
 	if ms.cfg.OnBeforeInc != nil {
 		ms.cfg.IncQuery = ms.cfg.OnBeforeInc(ms.cfg.UserData)
 		if ms.cfg.IncQuery == nil {
 			return nil
 		}
 	}
-	c, _ := context.WithTimeout(ctx, time.Duration(ms.cfg.ReadTimeout)*time.Microsecond)
-	cur, err := ms.collection.Find(nil, ms.cfg.IncQuery, ms.cfg.FindOpt)
+	query := ms.cfg.IncQuery
+	if ms.cfg.WatermarkField != "" {
+		query = ms.watermarkQuery(query)
+	}
+	c, cancel := context.WithTimeout(ctx, time.Duration(ms.cfg.ReadTimeout)*time.Microsecond)
+	defer cancel()
+	cur, err := ms.collection.Find(nil, query, ms.cfg.FindOpt)
 	if err != nil {
-		return errors.New("FindError: " + err.Error())
+		err = errors.New("FindError: " + err.Error())
+		ms.notify(LoadKindInc, start, err)
+		return err
 	}
 	if ms.cursor != nil {
 		_ = ms.cursor.Close(c)
 	}
 	ms.cursor = cur
 	ms.curParser = ms.cfg.IncParser
+	ms.resetWatermark()
 	err = ms.container.LoadInc(ms)
-	ms.incTimeUsed = time.Now().Sub(ms.lastIncTime)
+	if err == nil {
+		ms.commitWatermark(false)
+	}
+	ms.setIncTimeUsed(time.Now().Sub(start))
 	if ms.cfg.OnFinishInc != nil {
 		ms.cfg.OnFinishInc(ms)
 	}
+	ms.notify(LoadKindInc, start, err)
 	return err
 }
 
-func (ms *MongoStreamer) GetInfo() *Info {
-	return &Info{
-		Name:         ms.cfg.Name,
-		TotalNum:     ms.container.Len(),
-		AddNum:       ms.totalNum,
-		ErrorNum:     ms.errorNum,
-		LastBaseTime: ms.lastBaseTime,
-		LastIncTime:  ms.lastIncTime,
-		BaseTimeUsed: ms.baseTimeUsed,
-		IncTimeUsed:  ms.incTimeUsed,
+// Reload runs a base or inc load at once
+func (ms *MongoStreamer) Reload(ctx context.Context, kind LoadKind) error {
+	if kind == LoadKindInc {
+		return ms.loadInc(ctx)
+	}
+	return ms.loadBase(ctx)
+}
+
+func (ms *MongoStreamer) notify(kind LoadKind, start time.Time, err error) {
+	if ms.observer == nil {
+		return
+	}
+	ms.observer(LoadEvent{
+		Name:  ms.cfg.Name,
+		Kind:  kind,
+		Start: start,
+		Used:  time.Since(start),
+		Err:   err,
+		Info:  ms.GetInfo(),
+	})
+}
+
+// Close waits for the update loop to exit, then closes the cursor and disconnects from mongo
+func (ms *MongoStreamer) Close() error {
+	ms.wg.Wait()
+	ctx, cancel := context.WithTimeout(context.Background(), closeTimeout)
+	defer cancel()
+	if ms.cursor != nil {
+		_ = ms.cursor.Close(ctx)
+		ms.cursor = nil
+	}
+	if ms.stream != nil {
+		_ = ms.stream.Close(ctx)
+		ms.stream = nil
+	}
+	if ms.client == nil {
+		return nil
 	}
+	err := ms.client.Disconnect(ctx)
+	ms.client = nil
+	return err
+}
+
+func (ms *MongoStreamer) GetInfo() *Info {
+	return ms.info(ms.cfg.Name, ms.container)
 }
 
 func (ms *MongoStreamer) InfoStatus(s string) {
 	if ms.cfg.Logger != nil {
-		ms.cfg.Logger.Infof("%s, streamInfo[%d]", s, ms.getInfoStr())
+		ms.cfg.Logger.Infof("%s, streamInfo[%s]", s, ms.getInfoStr())
 	}
 }
 
 func (ms *MongoStreamer) WarnStatus(s string) {
 	if ms.cfg.Logger != nil {
-		ms.cfg.Logger.Warnf("%s, streamInfo[%d]", s, ms.getInfoStr())
+		ms.cfg.Logger.Warnf("%s, streamInfo[%s]", s, ms.getInfoStr())
 	}
 }
 
@@ -1,6 +1,7 @@
 package streamer
 
 import (
+	"github.com/Mintegral-official/mtggokit/bifrost/container"
 	"github.com/Mintegral-official/mtggokit/bifrost/log"
 	"go.mongodb.org/mongo-driver/mongo/options"
 )
@@ -28,4 +29,26 @@ type MongoStreamerCfg struct {
 	OnFinishBase   func(streamer Streamer)
 	OnFinishInc    func(streamer Streamer)
 	Logger         log.BiLogger
+
+	// ChangeStream replaces the polled inc loads by a change stream on the collection, each inc
+	// round applies the events received since the previous one. IncParser parses the full
+	// documents of insert, update and replace events, DeleteParser the document keys of delete
+	// events, IncParser is used if it's nil.
+	ChangeStream    bool
+	DeleteParser    DataParser
+	ResumeTokenPath string // persists the resume token, so that restarts don't lose events
+
+	// WatermarkField enables the watermark: the max value of the field over the loaded documents,
+	// a unix timestamp in seconds or a date, is tracked, and the inc query becomes IncQuery and
+	// {WatermarkField: {$gte: watermark - WatermarkOverlap, $lte: now}}. OnBeforeInc still
+	// returns IncQuery if it's set.
+	WatermarkField   string
+	WatermarkOverlap int    // seconds, catches the documents written late with an older value
+	WatermarkPath    string // persists the watermark with the snapshot, a warm start catches up from it
+
+	// SnapshotPath enables the snapshot: the container is dumped to it after each successful
+	// base load, and the first load reads it instead of mongo, which is then caught up by the
+	// next round. NewMongoStreamer doesn't fail when mongo is unreachable if it's set.
+	SnapshotPath  string
+	SnapshotCodec container.ValueCodec
 }
@@ -1,9 +1,17 @@
 package streamer
 
 import (
-	"github.com/smartystreets/goconvey/convey"
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
 	"strings"
 	"testing"
+	"time"
+
+	"github.com/Mintegral-official/mtggokit/bifrost/container"
+	"github.com/smartystreets/goconvey/convey"
+	"go.mongodb.org/mongo-driver/bson"
 )
 
 func TestNewMongoStreamer(t *testing.T) {
@@ -30,3 +38,135 @@ func TestNewMongoStreamer(t *testing.T) {
 		convey.So(ms, convey.ShouldBeNil)
 	})
 }
+
+// newUnreachableStreamer returns a streamer made by NewMongoStreamer whose loads fail, as if
+// mongo were down
+func newUnreachableStreamer(t *testing.T, snapshotPath string) *MongoStreamer {
+	ms, err := NewMongoStreamer(&MongoStreamerCfg{
+		Name:           "mongo_snapshot",
+		IncInterval:    60,
+		URI:            "mongodb://127.0.0.1:1/?serverSelectionTimeoutMS=100",
+		DB:             "db",
+		Collection:     "c",
+		ConnectTimeout: 100000,
+		ReadTimeout:    100000,
+		BaseParser:     &idParser{},
+		BaseQuery:      bson.M{},
+		SnapshotPath:   snapshotPath,
+		SnapshotCodec:  container.StringCodec{},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ms.SetContainer(container.CreateBlockingMapContainer(1, 0))
+	return ms
+}
+
+func TestMongoStreamer_Snapshot(t *testing.T) {
+	dir, err := ioutil.TempDir("", "bifrost")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "snapshot")
+	// writeSnapshot writes {1: a}, the successful base loads overwrite it
+	writeSnapshot := func() {
+		snapshot := container.CreateBlockingMapContainer(1, 0)
+		_ = snapshot.LoadBase(&sliceIter{results: []ParserResult{{DataMode: container.DataModeAdd, Key: container.I64Key(1), Value: "a"}}})
+		if err := saveSnapshot(snapshot, path, container.StringCodec{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	ctx := context.Background()
+
+	convey.Convey("Test the snapshot is loaded without mongo, then the base is caught up from mongo", t, func() {
+		writeSnapshot()
+		ms := newUnreachableStreamer(t, path)
+		defer ms.Close()
+		convey.So(ms.Update(ctx), convey.ShouldBeNil)
+		v, err := ms.GetContainer().Get(container.I64Key(1))
+		convey.So(err, convey.ShouldBeNil)
+		convey.So(v, convey.ShouldEqual, "a")
+		convey.So(ms.needBase, convey.ShouldBeTrue)
+
+		// still down, the next round retries the base instead of an inc
+		convey.So(ms.Update(ctx), convey.ShouldNotBeNil)
+		convey.So(ms.needBase, convey.ShouldBeTrue)
+
+		baseNum := 0
+		ms.cfg.OnBeforeBase = func(interface{}) interface{} {
+			baseNum++
+			return nil
+		}
+		convey.So(ms.Update(ctx), convey.ShouldBeNil)
+		convey.So(baseNum, convey.ShouldEqual, 1)
+		convey.So(ms.needBase, convey.ShouldBeFalse)
+	})
+
+	convey.Convey("Test mongo is loaded without a snapshot", t, func() {
+		_ = os.Remove(path)
+		ms := newUnreachableStreamer(t, path)
+		defer ms.Close()
+		baseNum := 0
+		ms.cfg.OnBeforeBase = func(interface{}) interface{} {
+			baseNum++
+			return nil
+		}
+		convey.So(ms.Update(ctx), convey.ShouldBeNil)
+		convey.So(baseNum, convey.ShouldEqual, 1)
+		convey.So(ms.warm, convey.ShouldBeFalse)
+	})
+
+	convey.Convey("Test the update loop catches up at once after the snapshot", t, func() {
+		writeSnapshot()
+		ms := newUnreachableStreamer(t, path)
+		ms.cfg.IsSync = true
+		loaded := make(chan struct{}, 1)
+		ms.cfg.OnBeforeBase = func(interface{}) interface{} {
+			loaded <- struct{}{}
+			return nil
+		}
+		ctx, cancel := context.WithCancel(ctx)
+		convey.So(ms.UpdateData(ctx), convey.ShouldBeNil)
+		v, err := ms.GetContainer().Get(container.I64Key(1))
+		convey.So(err, convey.ShouldBeNil)
+		convey.So(v, convey.ShouldEqual, "a")
+		select {
+		case <-loaded:
+		case <-time.After(time.Second):
+			t.Fatal("mongo isn't caught up after the snapshot")
+		}
+		cancel()
+		convey.So(ms.Close(), convey.ShouldBeNil)
+	})
+
+	convey.Convey("Test a restart from the snapshot catches up from the persisted watermark", t, func() {
+		writeSnapshot()
+		watermarkPath := filepath.Join(dir, "watermark")
+		convey.So(ioutil.WriteFile(watermarkPath, []byte(`{"value":300}`), 0644), convey.ShouldBeNil)
+		ms := newUnreachableStreamer(t, path)
+		defer ms.Close()
+		ms.cfg.WatermarkField = "updated"
+		ms.cfg.WatermarkOverlap = 5
+		ms.cfg.WatermarkPath = watermarkPath
+		convey.So(ms.Update(ctx), convey.ShouldBeNil)
+		convey.So(ms.needBase, convey.ShouldBeFalse)
+		convey.So(ms.GetInfo().Watermark, convey.ShouldEqual, 300)
+		cond := ms.watermarkQuery(nil).(bson.M)["updated"].(bson.M)
+		convey.So(cond["$gte"], convey.ShouldEqual, int64(295))
+
+		// the next round is an inc
+		baseNum, incNum := 0, 0
+		ms.cfg.OnBeforeBase = func(interface{}) interface{} {
+			baseNum++
+			return nil
+		}
+		ms.cfg.OnBeforeInc = func(interface{}) interface{} {
+			incNum++
+			return nil
+		}
+		convey.So(ms.Update(ctx), convey.ShouldBeNil)
+		convey.So(baseNum, convey.ShouldEqual, 0)
+		convey.So(incNum, convey.ShouldEqual, 1)
+	})
+}
@@ -0,0 +1,120 @@
+package streamer
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/bsontype"
+)
+
+// watermark is the max value of MongoStreamerCfg.WatermarkField seen by the successful loads,
+// in unix seconds. IsDate is set when the field holds dates instead of numbers, so that the inc
+// query compares it with the same type.
+type watermark struct {
+	Value  int64 `json:"value"`
+	IsDate bool  `json:"is_date"`
+}
+
+// watermarkQuery returns the inc query: query and {field: {$gte: watermark - overlap, $lte: now}}.
+// Without a watermark yet, the time of the last base load is used.
+func (ms *MongoStreamer) watermarkQuery(query interface{}) interface{} {
+	from := ms.watermark.Value
+	if from == 0 {
+		from = ms.lastBaseTime.Unix()
+	}
+	from -= int64(ms.cfg.WatermarkOverlap)
+	var cond bson.M
+	if ms.watermark.IsDate {
+		cond = bson.M{"$gte": time.Unix(from, 0), "$lte": time.Now()}
+	} else {
+		cond = bson.M{"$gte": from, "$lte": time.Now().Unix()}
+	}
+	filter := bson.M{ms.cfg.WatermarkField: cond}
+	if query == nil {
+		return filter
+	}
+	return bson.M{"$and": []interface{}{query, filter}}
+}
+
+// trackWatermark keeps the max value of the field over the documents of the current load,
+// the documents without it or with a value of another type are ignored
+func (ms *MongoStreamer) trackWatermark(doc bson.Raw) {
+	v, err := doc.LookupErr(strings.Split(ms.cfg.WatermarkField, ".")...)
+	if err != nil {
+		return
+	}
+	var ts int64
+	switch v.Type {
+	case bsontype.Int32:
+		ts = int64(v.Int32())
+	case bsontype.Int64:
+		ts = v.Int64()
+	case bsontype.Double:
+		ts = int64(v.Double())
+	case bsontype.DateTime:
+		ts = v.DateTime() / 1000
+		ms.pendingWatermark.IsDate = true
+	default:
+		return
+	}
+	if ts > ms.pendingWatermark.Value {
+		ms.pendingWatermark.Value = ts
+	}
+}
+
+// resetWatermark is called before a load reads its documents
+func (ms *MongoStreamer) resetWatermark() {
+	ms.pendingWatermark = watermark{}
+}
+
+// commitWatermark is called after a successful load. A base load sets the watermark to its max,
+// an inc load only moves it forward.
+func (ms *MongoStreamer) commitWatermark(base bool) {
+	pending := ms.pendingWatermark
+	if pending.Value == 0 || !base && pending.Value <= ms.watermark.Value {
+		return
+	}
+	ms.watermark = pending
+	ms.setWatermark(pending.Value)
+}
+
+func (ms *MongoStreamer) readWatermark() {
+	if ms.cfg.WatermarkPath == "" {
+		return
+	}
+	data, err := ioutil.ReadFile(ms.cfg.WatermarkPath)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			ms.WarnStatus("read watermark error:" + err.Error())
+		}
+		return
+	}
+	var w watermark
+	if err := json.Unmarshal(data, &w); err != nil {
+		ms.WarnStatus("invalid watermark:" + err.Error())
+		return
+	}
+	ms.watermark = w
+	ms.setWatermark(w.Value)
+}
+
+// saveWatermark persists the watermark of the snapshot just saved, the ones of the inc loads
+// aren't persisted as they're newer than the snapshot
+func (ms *MongoStreamer) saveWatermark() {
+	if ms.cfg.WatermarkPath == "" {
+		return
+	}
+	data, _ := json.Marshal(ms.watermark)
+	tmp := ms.cfg.WatermarkPath + ".tmp"
+	if err := ioutil.WriteFile(tmp, data, 0644); err != nil {
+		ms.WarnStatus("save watermark error:" + err.Error())
+		return
+	}
+	if err := os.Rename(tmp, ms.cfg.WatermarkPath); err != nil {
+		ms.WarnStatus("save watermark error:" + err.Error())
+	}
+}
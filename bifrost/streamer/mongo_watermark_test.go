@@ -0,0 +1,100 @@
+package streamer
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Mintegral-official/mtggokit/bifrost/container"
+	"github.com/smartystreets/goconvey/convey"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func mustRaw(doc interface{}) bson.Raw {
+	data, err := bson.Marshal(doc)
+	if err != nil {
+		panic(err)
+	}
+	return data
+}
+
+func TestMongoWatermark(t *testing.T) {
+	convey.Convey("Test MongoStreamer watermark", t, func() {
+		dir, err := ioutil.TempDir("", "watermark")
+		convey.So(err, convey.ShouldBeNil)
+		defer os.RemoveAll(dir)
+		path := filepath.Join(dir, "campaign.watermark")
+
+		ms := &MongoStreamer{cfg: &MongoStreamerCfg{
+			Name:             "watermark_test",
+			WatermarkField:   "meta.updated",
+			WatermarkOverlap: 5,
+			WatermarkPath:    path,
+		}}
+		ms.SetContainer(container.CreateBlockingMapContainer(1, 0))
+
+		// a base load sets the watermark to its max
+		ms.resetWatermark()
+		ms.trackWatermark(mustRaw(bson.M{"meta": bson.M{"updated": int32(100)}}))
+		ms.trackWatermark(mustRaw(bson.M{"meta": bson.M{"updated": int64(300)}}))
+		ms.trackWatermark(mustRaw(bson.M{"meta": bson.M{"updated": 200.5}}))
+		ms.trackWatermark(mustRaw(bson.M{"meta": bson.M{"updated": "bad"}}))
+		ms.trackWatermark(mustRaw(bson.M{"name": "no field"}))
+		ms.commitWatermark(true)
+		convey.So(ms.GetInfo().Watermark, convey.ShouldEqual, 300)
+
+		query := ms.watermarkQuery(bson.M{"advertiserId": 903}).(bson.M)
+		and := query["$and"].([]interface{})
+		convey.So(and[0], convey.ShouldResemble, bson.M{"advertiserId": 903})
+		cond := and[1].(bson.M)["meta.updated"].(bson.M)
+		convey.So(cond["$gte"], convey.ShouldEqual, int64(295))
+		convey.So(cond["$lte"], convey.ShouldBeGreaterThanOrEqualTo, time.Now().Unix()-1)
+
+		convey.Convey("inc loads only move it forward", func() {
+			ms.resetWatermark()
+			ms.trackWatermark(mustRaw(bson.M{"meta": bson.M{"updated": 250}}))
+			ms.commitWatermark(false)
+			convey.So(ms.watermark.Value, convey.ShouldEqual, 300)
+
+			ms.resetWatermark()
+			ms.trackWatermark(mustRaw(bson.M{"meta": bson.M{"updated": 400}}))
+			ms.commitWatermark(false)
+			convey.So(ms.watermark.Value, convey.ShouldEqual, 400)
+		})
+
+		convey.Convey("it's persisted with the snapshot", func() {
+			_, err := os.Stat(path)
+			convey.So(os.IsNotExist(err), convey.ShouldBeTrue)
+
+			ms.cfg.SnapshotPath = filepath.Join(dir, "snapshot")
+			ms.cfg.SnapshotCodec = container.StringCodec{}
+			// nil query, the base load succeeds without querying mongo
+			ms.cfg.OnBeforeBase = func(interface{}) interface{} { return nil }
+			convey.So(ms.loadBase(context.Background()), convey.ShouldBeNil)
+			restarted := &MongoStreamer{cfg: ms.cfg}
+			restarted.readWatermark()
+			convey.So(restarted.watermark, convey.ShouldResemble, watermark{Value: 300})
+
+			// the inc loads move past the snapshot, they aren't persisted
+			ms.resetWatermark()
+			ms.trackWatermark(mustRaw(bson.M{"meta": bson.M{"updated": 400}}))
+			ms.commitWatermark(false)
+			restarted.readWatermark()
+			convey.So(restarted.watermark, convey.ShouldResemble, watermark{Value: 300})
+		})
+
+		convey.Convey("dates are compared with dates", func() {
+			updated := time.Unix(1000, 0)
+			ms.resetWatermark()
+			ms.trackWatermark(mustRaw(bson.M{"meta": bson.M{"updated": updated}}))
+			ms.commitWatermark(true)
+			convey.So(ms.watermark, convey.ShouldResemble, watermark{Value: 1000, IsDate: true})
+
+			cond := ms.watermarkQuery(nil).(bson.M)["meta.updated"].(bson.M)
+			convey.So(cond["$gte"].(time.Time).Unix(), convey.ShouldEqual, 995)
+		})
+	})
+}
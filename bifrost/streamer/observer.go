@@ -0,0 +1,37 @@
+package streamer
+
+import "time"
+
+type LoadKind int
+
+const (
+	LoadKindBase LoadKind = iota
+	LoadKindInc
+)
+
+func (k LoadKind) String() string {
+	if k == LoadKindInc {
+		return "inc"
+	}
+	return "base"
+}
+
+// LoadEvent describes one finished base or inc load of a streamer
+type LoadEvent struct {
+	Name  string
+	Kind  LoadKind
+	Start time.Time
+	Used  time.Duration
+	Err   error
+	// Info is the streamer info right after the load, it is taken in the update goroutine
+	// so it's safe to read
+	Info *Info
+}
+
+// Observer is called in the update goroutine of a streamer after each load, it must not block
+type Observer func(e LoadEvent)
+
+// Observable is implemented by the streamers reporting their loads
+type Observable interface {
+	SetObserver(o Observer)
+}
@@ -0,0 +1,668 @@
+package streamer
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Mintegral-official/mtggokit/bifrost/container"
+	"github.com/gomodule/redigo/redis"
+)
+
+const (
+	defaultScanCount = 1000
+	// maxRedisEvents bounds the notifications kept between two inc rounds, beyond it they are
+	// dropped and the next round loads the base instead
+	maxRedisEvents = 100000
+	// redisRetryWait is the wait before subscribing again after the subscription failed
+	redisRetryWait = time.Second
+)
+
+// redisRecord is a raw record given to DataParser, setMode overrides the DataMode it returns
+type redisRecord struct {
+	data    []byte
+	mode    container.DataMode
+	setMode bool
+}
+
+// redisEvent is a keyspace notification or a message of the pub/sub channel
+type redisEvent struct {
+	key     string
+	op      string
+	payload []byte
+}
+
+type RedisStreamer struct {
+	container container.Container
+	cfg       *RedisStreamerCfg
+	pool      *redis.Pool
+	hasInit   bool
+	loadInfo
+	observer Observer
+	mu       sync.Mutex // serializes the loads of the update loop and Reload
+
+	// iterator state
+	conn     redis.Conn
+	cursor   string
+	scanning bool
+	records  []redisRecord
+	pos      int
+	result   []ParserResult
+	curLen   int
+
+	// notifications received since the previous inc round
+	subscribed bool
+	evMu       sync.Mutex
+	events     []redisEvent
+	lost       bool
+
+	wg sync.WaitGroup
+}
+
+func NewRedisStreamer(cfg *RedisStreamerCfg) (*RedisStreamer, error) {
+	if cfg.DataParser == nil {
+		return nil, errors.New("DataParser is nil, streamer[" + cfg.Name + "]")
+	}
+	switch cfg.Source {
+	case RedisScan:
+		if cfg.Pattern == "" {
+			return nil, errors.New("Pattern is empty, streamer[" + cfg.Name + "]")
+		}
+	case RedisHash, RedisSet:
+		if cfg.Key == "" {
+			return nil, errors.New("Key is empty, streamer[" + cfg.Name + "]")
+		}
+	default:
+		return nil, fmt.Errorf("not support source[%d], streamer[%s]", cfg.Source, cfg.Name)
+	}
+	rs := &RedisStreamer{
+		cfg: cfg,
+	}
+	rs.pool = &redis.Pool{
+		MaxIdle:     2,
+		IdleTimeout: 5 * time.Minute,
+		DialContext: func(ctx context.Context) (redis.Conn, error) {
+			return rs.dial(ctx, true)
+		},
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), rs.connectTimeout())
+	defer cancel()
+	conn, err := rs.pool.GetContext(ctx)
+	if err == nil {
+		_, err = conn.Do("PING")
+		_ = conn.Close()
+	}
+	if err != nil {
+		if cfg.Logger != nil {
+			cfg.Logger.Warnf("redis connect error, err=[%s]", err.Error())
+		}
+		_ = rs.pool.Close()
+		return nil, err
+	}
+	return rs, nil
+}
+
+func (rs *RedisStreamer) dial(ctx context.Context, readTimeout bool) (redis.Conn, error) {
+	opts := []redis.DialOption{
+		redis.DialConnectTimeout(rs.connectTimeout()),
+		redis.DialDatabase(rs.cfg.DB),
+	}
+	if rs.cfg.Password != "" {
+		opts = append(opts, redis.DialPassword(rs.cfg.Password))
+	}
+	if readTimeout && rs.cfg.ReadTimeout > 0 {
+		d := time.Duration(rs.cfg.ReadTimeout) * time.Millisecond
+		opts = append(opts, redis.DialReadTimeout(d), redis.DialWriteTimeout(d))
+	}
+	return redis.DialContext(ctx, "tcp", rs.cfg.Addr, opts...)
+}
+
+func (rs *RedisStreamer) connectTimeout() time.Duration {
+	if rs.cfg.ConnectTimeout <= 0 {
+		return 5 * time.Second
+	}
+	return time.Duration(rs.cfg.ConnectTimeout) * time.Millisecond
+}
+
+func (rs *RedisStreamer) SetContainer(container container.Container) {
+	rs.container = container
+}
+
+func (rs *RedisStreamer) GetContainer() container.Container {
+	return rs.container
+}
+
+// SetObserver sets the observer notified after each load, call it before UpdateData
+func (rs *RedisStreamer) SetObserver(o Observer) {
+	rs.observer = o
+}
+
+func (rs *RedisStreamer) GetSchedInfo() *SchedInfo {
+	return &SchedInfo{
+		TimeInterval: rs.cfg.IncInterval,
+	}
+}
+
+// Describe returns the source of the base loads, see container.Describer
+func (rs *RedisStreamer) Describe() string {
+	if rs.cfg.Source == RedisScan {
+		return "redis[" + rs.cfg.Addr + ", scan " + rs.cfg.Pattern + "]"
+	}
+	return "redis[" + rs.cfg.Addr + ", " + rs.cfg.Source.String() + " " + rs.cfg.Key + "]"
+}
+
+func (rs *RedisStreamer) HasNext() (bool, error) {
+	if rs.curLen < len(rs.result) {
+		return true, nil
+	}
+	for rs.pos >= len(rs.records) {
+		if !rs.scanning {
+			return false, nil
+		}
+		if err := rs.scanPage(); err != nil {
+			return false, errors.New("ScanError: " + err.Error())
+		}
+	}
+	return true, nil
+}
+
+func (rs *RedisStreamer) Next() (container.DataMode, container.MapKey, interface{}, error) {
+	rs.addTotal()
+	if rs.curLen < len(rs.result) {
+		return rs.nextResult()
+	}
+	if rs.pos >= len(rs.records) {
+		rs.addError()
+		return container.DataModeAdd, nil, nil, errors.New("no more records")
+	}
+	record := rs.records[rs.pos]
+	rs.pos++
+	result := rs.cfg.DataParser.Parse(record.data, rs.cfg.UserData)
+	if result == nil {
+		rs.addError()
+		return container.DataModeAdd, nil, nil, errors.New("Parse error")
+	}
+	if record.setMode {
+		for i := range result {
+			result[i].DataMode = record.mode
+		}
+	}
+	rs.curLen = 0
+	rs.result = result
+	if rs.curLen < len(rs.result) {
+		return rs.nextResult()
+	}
+	rs.addError()
+	return container.DataModeAdd, nil, nil, errors.New(fmt.Sprintf("Index[%d] error, len[%d]", rs.curLen, len(rs.result)))
+}
+
+func (rs *RedisStreamer) nextResult() (container.DataMode, container.MapKey, interface{}, error) {
+	r := rs.result[rs.curLen]
+	rs.curLen++
+	if r.Err != nil {
+		rs.addError()
+	}
+	return r.DataMode, r.Key, r.Value, r.Err
+}
+
+// scanPage reads the next page of SCAN, the keys deleted since they were scanned are skipped
+func (rs *RedisStreamer) scanPage() error {
+	count := rs.cfg.ScanCount
+	if count <= 0 {
+		count = defaultScanCount
+	}
+	reply, err := redis.Values(rs.conn.Do("SCAN", rs.cursor, "MATCH", rs.cfg.Pattern, "COUNT", count))
+	if err != nil {
+		return err
+	}
+	if len(reply) != 2 {
+		return errors.New("unexpected SCAN reply")
+	}
+	if rs.cursor, err = redis.String(reply[0], nil); err != nil {
+		return err
+	}
+	rs.scanning = rs.cursor != "0"
+	keys, err := redis.Strings(reply[1], nil)
+	if err != nil {
+		return err
+	}
+	rs.records = rs.records[:0]
+	rs.pos = 0
+	if len(keys) == 0 {
+		return nil
+	}
+	values, err := rs.mget(keys)
+	if err != nil {
+		return err
+	}
+	for i, key := range keys {
+		if values[i] != nil {
+			rs.records = append(rs.records, redisRecord{data: joinRecord(key, values[i])})
+		}
+	}
+	return nil
+}
+
+func (rs *RedisStreamer) mget(keys []string) ([][]byte, error) {
+	args := make([]interface{}, len(keys))
+	for i, key := range keys {
+		args[i] = key
+	}
+	return redis.ByteSlices(rs.conn.Do("MGET", args...))
+}
+
+func joinRecord(key string, value []byte) []byte {
+	data := make([]byte, 0, len(key)+1+len(value))
+	data = append(data, key...)
+	data = append(data, '\t')
+	return append(data, value...)
+}
+
+func (rs *RedisStreamer) resetIter(conn redis.Conn) {
+	rs.conn = conn
+	rs.cursor = "0"
+	rs.scanning = false
+	rs.records = nil
+	rs.pos = 0
+	rs.result = nil
+	rs.curLen = 0
+}
+
+func (rs *RedisStreamer) UpdateData(ctx context.Context) error {
+	if rs.cfg.IsSync {
+		if err := rs.Update(ctx); err != nil {
+			return err
+		}
+	}
+	rs.wg.Add(1)
+	go func() {
+		defer rs.wg.Done()
+		if !rs.cfg.IsSync {
+			_ = rs.Update(ctx)
+		}
+		for {
+			inc := time.After(time.Duration(rs.cfg.IncInterval) * time.Second)
+			select {
+			case <-ctx.Done():
+				rs.InfoStatus("LoadInc Finish:")
+				return
+			case <-inc:
+				_ = rs.Update(ctx)
+			}
+		}
+	}()
+	return nil
+}
+
+// Update runs one round of the update loop, it is called by Sched. The base is loaded when it
+// has never succeeded, BaseInterval has passed or notifications were lost, otherwise the
+// notifications received since the previous round are applied.
+func (rs *RedisStreamer) Update(ctx context.Context) error {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	if !rs.subscribed {
+		// subscribe before the first load, so that the changes made during it are not missed
+		rs.subscribed = true
+		rs.subscribe(ctx)
+	}
+	baseInterval := time.Duration(rs.cfg.BaseInterval) * time.Second
+	if !rs.hasInit || baseInterval > 0 && time.Since(rs.lastBaseTime) >= baseInterval {
+		if err := rs.loadBase(ctx); err != nil {
+			rs.WarnStatus("LoadBase error:" + err.Error())
+			return err
+		}
+		rs.InfoStatus("LoadBase succ")
+		return nil
+	}
+	if err := rs.loadInc(ctx); err != nil {
+		rs.WarnStatus("LoadInc error:" + err.Error())
+		return err
+	}
+	return nil
+}
+
+// Reload runs a base or inc load at once
+func (rs *RedisStreamer) Reload(ctx context.Context, kind LoadKind) error {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	if kind == LoadKindInc {
+		return rs.loadInc(ctx)
+	}
+	return rs.loadBase(ctx)
+}
+
+// loadBase must be called with rs.mu held
+func (rs *RedisStreamer) loadBase(ctx context.Context) (err error) {
+	for i := -1; i < rs.cfg.TryTimes; i++ {
+		// the notifications received so far are covered by the base
+		rs.takeEvents()
+		if err = rs.loadBase2(ctx); err == nil {
+			rs.hasInit = true
+			return nil
+		}
+		if rs.cfg.Logger != nil {
+			rs.cfg.Logger.Warnf("LoadBase error[%s], tryTimes[%d]", err, i+1)
+		}
+		if !retryable(err) {
+			return
+		}
+	}
+	return
+}
+
+func (rs *RedisStreamer) loadBase2(ctx context.Context) (err error) {
+	start := time.Now()
+	rs.setLastBaseTime(start)
+	defer func() {
+		rs.notify(LoadKindBase, start, err)
+	}()
+	conn, err := rs.pool.GetContext(ctx)
+	if err != nil {
+		return errors.New("ConnError: " + err.Error())
+	}
+	defer func() { _ = conn.Close() }()
+
+	rs.resetNums()
+	rs.resetIter(conn)
+	switch rs.cfg.Source {
+	case RedisScan:
+		rs.scanning = true
+	case RedisHash:
+		values, err := redis.ByteSlices(conn.Do("HGETALL", rs.cfg.Key))
+		if err != nil {
+			return errors.New("HGETALL error: " + err.Error())
+		}
+		for i := 0; i+1 < len(values); i += 2 {
+			rs.records = append(rs.records, redisRecord{data: joinRecord(string(values[i]), values[i+1])})
+		}
+	case RedisSet:
+		values, err := redis.ByteSlices(conn.Do("SMEMBERS", rs.cfg.Key))
+		if err != nil {
+			return errors.New("SMEMBERS error: " + err.Error())
+		}
+		for _, v := range values {
+			rs.records = append(rs.records, redisRecord{data: v})
+		}
+	}
+	err = rs.container.LoadBase(rs)
+	rs.conn = nil
+	rs.setBaseTimeUsed(time.Now().Sub(start))
+	if rs.cfg.OnFinishBase != nil {
+		rs.cfg.OnFinishBase(rs)
+	}
+	return err
+}
+
+// loadInc applies the notifications received since the previous round, it must be called with
+// rs.mu held
+func (rs *RedisStreamer) loadInc(ctx context.Context) (err error) {
+	events, lost := rs.takeEvents()
+	if lost {
+		rs.WarnStatus("notifications lost, reload base")
+		return rs.loadBase(ctx)
+	}
+	if len(events) == 0 {
+		return nil
+	}
+
+	start := time.Now()
+	rs.setLastIncTime(start)
+	defer func() {
+		rs.setIncTimeUsed(time.Now().Sub(start))
+		rs.notify(LoadKindInc, start, err)
+	}()
+	conn, err := rs.pool.GetContext(ctx)
+	if err != nil {
+		return errors.New("ConnError: " + err.Error())
+	}
+	defer func() { _ = conn.Close() }()
+	rs.resetIter(conn)
+
+	// only the last operation of a key matters, the key is read once
+	var keys []string
+	deleted := make(map[string]bool)
+	for _, e := range events {
+		if e.payload != nil {
+			rs.records = append(rs.records, redisRecord{data: e.payload})
+			continue
+		}
+		if _, in := deleted[e.key]; !in {
+			keys = append(keys, e.key)
+		}
+		deleted[e.key] = isRedisDelete(e.op)
+	}
+	var updates []string
+	for _, key := range keys {
+		if deleted[key] {
+			rs.records = append(rs.records, redisRecord{data: joinRecord(key, nil), mode: container.DataModeDel, setMode: true})
+		} else {
+			updates = append(updates, key)
+		}
+	}
+	if len(updates) > 0 {
+		values, err := rs.mget(updates)
+		if err != nil {
+			return errors.New("MGET error: " + err.Error())
+		}
+		for i, key := range updates {
+			if values[i] == nil {
+				rs.records = append(rs.records, redisRecord{data: joinRecord(key, nil), mode: container.DataModeDel, setMode: true})
+			} else {
+				rs.records = append(rs.records, redisRecord{data: joinRecord(key, values[i]), mode: container.DataModeUpdate, setMode: true})
+			}
+		}
+	}
+
+	err = rs.container.LoadInc(rs)
+	rs.conn = nil
+	if rs.cfg.OnFinishInc != nil {
+		rs.cfg.OnFinishInc(rs)
+	}
+	return err
+}
+
+func isRedisDelete(op string) bool {
+	switch op {
+	case "del", "expired", "evicted", "rename_from":
+		return true
+	}
+	return false
+}
+
+// subscribe starts the subscription to the keyspace notifications and the channel, and waits
+// until it is effective. It must be called with rs.mu held.
+func (rs *RedisStreamer) subscribe(ctx context.Context) {
+	if !rs.cfg.Keyspace && rs.cfg.Channel == "" {
+		return
+	}
+	ready := make(chan struct{})
+	rs.wg.Add(1)
+	go func() {
+		defer rs.wg.Done()
+		rs.subscribeLoop(ctx, ready)
+	}()
+	select {
+	case <-ready:
+	case <-ctx.Done():
+	case <-time.After(rs.connectTimeout()):
+		rs.WarnStatus("Subscribe timeout")
+	}
+}
+
+// subscribeLoop keeps the subscription until ctx is done. The notifications sent while it was
+// broken are lost, so the next inc round loads the base.
+func (rs *RedisStreamer) subscribeLoop(ctx context.Context, ready chan struct{}) {
+	first := true
+	onSubscribed := func() {
+		if first {
+			first = false
+			close(ready)
+			return
+		}
+		rs.evMu.Lock()
+		rs.lost = true
+		rs.evMu.Unlock()
+	}
+	for {
+		err := rs.receive(ctx, onSubscribed)
+		if ctx.Err() != nil {
+			return
+		}
+		if rs.cfg.Logger != nil {
+			// not WarnStatus, the info is being updated by the loads
+			rs.cfg.Logger.Warnf("Subscribe error[%s], streamer[%s]", err.Error(), rs.cfg.Name)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(redisRetryWait):
+		}
+	}
+}
+
+func (rs *RedisStreamer) receive(ctx context.Context, onSubscribed func()) error {
+	conn, err := rs.dial(ctx, false)
+	if err != nil {
+		return err
+	}
+	psc := redis.PubSubConn{Conn: conn}
+	defer func() { _ = psc.Close() }()
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			// unblocks Receive
+			_ = psc.Close()
+		case <-done:
+		}
+	}()
+
+	n := 0
+	if rs.cfg.Channel != "" {
+		if err := psc.Subscribe(rs.cfg.Channel); err != nil {
+			return err
+		}
+		n++
+	}
+	if rs.cfg.Keyspace {
+		if rs.cfg.Source == RedisScan {
+			err = psc.PSubscribe(rs.keyspacePrefix() + rs.cfg.Pattern)
+		} else {
+			err = psc.Subscribe(rs.keyspacePrefix() + rs.cfg.Key)
+		}
+		if err != nil {
+			return err
+		}
+		n++
+	}
+	for {
+		switch v := psc.Receive().(type) {
+		case redis.Message:
+			rs.addEvent(v)
+		case redis.Subscription:
+			if v.Kind == "subscribe" || v.Kind == "psubscribe" {
+				if n--; n == 0 {
+					onSubscribed()
+				}
+			}
+		case error:
+			return v
+		}
+	}
+}
+
+func (rs *RedisStreamer) keyspacePrefix() string {
+	return "__keyspace@" + strconv.Itoa(rs.cfg.DB) + "__:"
+}
+
+func (rs *RedisStreamer) addEvent(m redis.Message) {
+	rs.evMu.Lock()
+	defer rs.evMu.Unlock()
+	if rs.lost {
+		// a base load is coming
+		return
+	}
+	var e redisEvent
+	switch {
+	case m.Channel == rs.cfg.Channel:
+		e.payload = m.Data
+		if e.payload == nil {
+			e.payload = []byte{}
+		}
+	case strings.HasPrefix(m.Channel, rs.keyspacePrefix()):
+		if rs.cfg.Source != RedisScan {
+			// the notification doesn't tell which field or member changed
+			rs.lost = true
+			rs.events = nil
+			return
+		}
+		e.key = strings.TrimPrefix(m.Channel, rs.keyspacePrefix())
+		e.op = string(m.Data)
+	default:
+		return
+	}
+	if len(rs.events) >= maxRedisEvents {
+		rs.lost = true
+		rs.events = nil
+		return
+	}
+	rs.events = append(rs.events, e)
+}
+
+// takeEvents returns the notifications received since the previous call, and whether some were lost
+func (rs *RedisStreamer) takeEvents() ([]redisEvent, bool) {
+	rs.evMu.Lock()
+	defer rs.evMu.Unlock()
+	events, lost := rs.events, rs.lost
+	rs.events = nil
+	rs.lost = false
+	return events, lost
+}
+
+func (rs *RedisStreamer) notify(kind LoadKind, start time.Time, err error) {
+	if rs.observer == nil {
+		return
+	}
+	rs.observer(LoadEvent{
+		Name:  rs.cfg.Name,
+		Kind:  kind,
+		Start: start,
+		Used:  time.Since(start),
+		Err:   err,
+		Info:  rs.GetInfo(),
+	})
+}
+
+// Close waits for the update loop and the subscription to exit, then closes the connections
+func (rs *RedisStreamer) Close() error {
+	rs.wg.Wait()
+	return rs.pool.Close()
+}
+
+func (rs *RedisStreamer) GetInfo() *Info {
+	return rs.info(rs.cfg.Name, rs.container)
+}
+
+func (rs *RedisStreamer) InfoStatus(s string) {
+	if rs.cfg.Logger != nil {
+		rs.cfg.Logger.Infof("%s, streamerInfo[%s]", s, rs.getInfoStr())
+	}
+}
+
+func (rs *RedisStreamer) WarnStatus(s string) {
+	if rs.cfg.Logger != nil {
+		rs.cfg.Logger.Warnf("%s, streamerInfo[%s]", s, rs.getInfoStr())
+	}
+}
+
+func (rs *RedisStreamer) getInfoStr() string {
+	data, _ := json.Marshal(rs.GetInfo())
+	return string(data)
+}
@@ -0,0 +1,71 @@
+package streamer
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/Mintegral-official/mtggokit/bifrost/log"
+)
+
+// RedisSource is where RedisStreamer reads the data of a base load
+type RedisSource int
+
+const (
+	// RedisScan reads the string keys matching Pattern by SCAN and MGET, each record is "key\tvalue"
+	RedisScan RedisSource = iota
+	// RedisHash reads the hash Key by HGETALL, each record is "field\tvalue"
+	RedisHash
+	// RedisSet reads the set Key by SMEMBERS, each record is a member
+	RedisSet
+)
+
+var redisSourceStrMap = map[RedisSource]string{
+	RedisScan: "scan",
+	RedisHash: "hash",
+	RedisSet:  "set",
+}
+
+func (rs RedisSource) String() string {
+	return redisSourceStrMap[rs]
+}
+
+// ParseRedisSource converts "scan", "hash" or "set" to RedisSource
+func ParseRedisSource(s string) (RedisSource, error) {
+	for k, v := range redisSourceStrMap {
+		if strings.EqualFold(v, s) {
+			return k, nil
+		}
+	}
+	return RedisScan, errors.New("unknown redis source[" + s + "]")
+}
+
+type RedisStreamerCfg struct {
+	Name           string
+	IncInterval    int
+	BaseInterval   int
+	IsSync         bool
+	TryTimes       int
+	Addr           string
+	Password       string
+	DB             int
+	ConnectTimeout int // millisecond
+	ReadTimeout    int // millisecond
+	Source         RedisSource
+	Pattern        string // RedisScan: the MATCH pattern of SCAN
+	Key            string // RedisHash, RedisSet: the key of the hash or the set
+	ScanCount      int    // RedisScan: the COUNT hint of SCAN, 1000 by default
+	DataParser     DataParser
+	UserData       interface{}
+	OnFinishBase   func(streamer Streamer)
+	OnFinishInc    func(streamer Streamer)
+	Logger         log.BiLogger
+
+	// Keyspace subscribes to the keyspace notifications of the source, the server must enable
+	// them by notify-keyspace-events. With RedisScan the changed keys are read again and applied
+	// as updates, the removed ones as deletes; with RedisHash and RedisSet a change of Key
+	// triggers a base load, as the notifications don't tell which field or member changed.
+	Keyspace bool
+	// Channel subscribes to a pub/sub channel, each message is given to DataParser and applied
+	// with the DataMode of its results
+	Channel string
+}
@@ -0,0 +1,169 @@
+package streamer
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Mintegral-official/mtggokit/bifrost/container"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/smartystreets/goconvey/convey"
+)
+
+func newRedisStreamer(m *miniredis.Miniredis, cfg *RedisStreamerCfg) *RedisStreamer {
+	cfg.Name = "redis_test"
+	cfg.Addr = m.Addr()
+	cfg.DataParser = &deltaParser{}
+	rs, err := NewRedisStreamer(cfg)
+	convey.So(err, convey.ShouldBeNil)
+	rs.SetContainer(container.CreateBlockingMapContainer(1, 0))
+	return rs
+}
+
+// waitEvents waits until the subscription received n notifications
+func waitEvents(rs *RedisStreamer, n int) {
+	for i := 0; i < 100; i++ {
+		rs.evMu.Lock()
+		got := len(rs.events)
+		lost := rs.lost
+		rs.evMu.Unlock()
+		if got >= n || lost {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func getValue(s Streamer, key string) interface{} {
+	v, err := s.GetContainer().Get(container.StrKey(key))
+	if err != nil {
+		return err
+	}
+	return v
+}
+
+func TestRedisStreamer_Base(t *testing.T) {
+	convey.Convey("Test base loads", t, func() {
+		m := miniredis.RunT(t)
+		_ = m.Set("cfg:a", "aa")
+		_ = m.Set("cfg:b", "bb")
+		_ = m.Set("cfg:c", "cc")
+		_ = m.Set("other", "oo")
+		m.HSet("hash", "x", "xx", "y", "yy")
+		_, _ = m.SetAdd("set", "m1\t1", "m2\t2")
+
+		convey.Convey("scan", func() {
+			rs := newRedisStreamer(m, &RedisStreamerCfg{Source: RedisScan, Pattern: "cfg:*", ScanCount: 1})
+			convey.So(rs.Update(context.Background()), convey.ShouldBeNil)
+			convey.So(rs.GetContainer().Len(), convey.ShouldEqual, 3)
+			convey.So(getValue(rs, "cfg:b"), convey.ShouldEqual, "bb")
+			convey.So(getValue(rs, "other"), convey.ShouldEqual, container.NotExistErr)
+			convey.So(rs.GetInfo().AddNum, convey.ShouldEqual, 3)
+			convey.So(rs.Close(), convey.ShouldBeNil)
+		})
+
+		convey.Convey("hash and set", func() {
+			rs := newRedisStreamer(m, &RedisStreamerCfg{Source: RedisHash, Key: "hash"})
+			convey.So(rs.Update(context.Background()), convey.ShouldBeNil)
+			convey.So(rs.GetContainer().Len(), convey.ShouldEqual, 2)
+			convey.So(getValue(rs, "y"), convey.ShouldEqual, "yy")
+
+			rs = newRedisStreamer(m, &RedisStreamerCfg{Source: RedisSet, Key: "set"})
+			convey.So(rs.Update(context.Background()), convey.ShouldBeNil)
+			convey.So(rs.GetContainer().Len(), convey.ShouldEqual, 2)
+			convey.So(getValue(rs, "m1"), convey.ShouldEqual, "1")
+		})
+
+		convey.Convey("wrong type", func() {
+			rs := newRedisStreamer(m, &RedisStreamerCfg{Source: RedisHash, Key: "cfg:a"})
+			convey.So(rs.Update(context.Background()), convey.ShouldNotBeNil)
+			convey.So(rs.GetContainer().Len(), convey.ShouldEqual, 0)
+		})
+	})
+}
+
+func TestRedisStreamer_Inc(t *testing.T) {
+	convey.Convey("Test inc loads", t, func() {
+		m := miniredis.RunT(t)
+		_ = m.Set("cfg:a", "aa")
+		_ = m.Set("cfg:b", "bb")
+		ctx, cancel := context.WithCancel(context.Background())
+
+		convey.Convey("keyspace notifications of scanned keys", func() {
+			rs := newRedisStreamer(m, &RedisStreamerCfg{Source: RedisScan, Pattern: "cfg:*", Keyspace: true})
+			convey.So(rs.Update(ctx), convey.ShouldBeNil)
+			convey.So(rs.GetContainer().Len(), convey.ShouldEqual, 2)
+
+			// miniredis doesn't send keyspace notifications, publish them
+			_ = m.Set("cfg:c", "cc")
+			m.Publish("__keyspace@0__:cfg:c", "set")
+			_ = m.Set("cfg:a", "AA")
+			m.Publish("__keyspace@0__:cfg:a", "set")
+			m.Del("cfg:b")
+			m.Publish("__keyspace@0__:cfg:b", "del")
+			m.Publish("__keyspace@0__:cfg:a", "expire")
+			waitEvents(rs, 4)
+
+			convey.So(rs.Update(ctx), convey.ShouldBeNil)
+			convey.So(getValue(rs, "cfg:a"), convey.ShouldEqual, "AA")
+			convey.So(getValue(rs, "cfg:b"), convey.ShouldEqual, container.NotExistErr)
+			convey.So(getValue(rs, "cfg:c"), convey.ShouldEqual, "cc")
+			convey.So(rs.GetInfo().AddNum, convey.ShouldEqual, 5)
+
+			// nothing received
+			convey.So(rs.Update(ctx), convey.ShouldBeNil)
+			convey.So(rs.GetContainer().Len(), convey.ShouldEqual, 2)
+
+			cancel()
+			convey.So(rs.Close(), convey.ShouldBeNil)
+		})
+
+		convey.Convey("keyspace notifications of a hash reload the base", func() {
+			m.HSet("hash", "x", "xx")
+			rs := newRedisStreamer(m, &RedisStreamerCfg{Source: RedisHash, Key: "hash", Keyspace: true})
+			convey.So(rs.Update(ctx), convey.ShouldBeNil)
+			convey.So(rs.GetContainer().Len(), convey.ShouldEqual, 1)
+
+			m.HSet("hash", "y", "yy")
+			m.Publish("__keyspace@0__:hash", "hset")
+			waitEvents(rs, 1)
+			convey.So(rs.Update(ctx), convey.ShouldBeNil)
+			convey.So(getValue(rs, "y"), convey.ShouldEqual, "yy")
+
+			cancel()
+			convey.So(rs.Close(), convey.ShouldBeNil)
+		})
+
+		convey.Convey("pub/sub channel", func() {
+			rs := newRedisStreamer(m, &RedisStreamerCfg{Source: RedisScan, Pattern: "cfg:*", Channel: "cfg_changes",
+				IsSync: true, IncInterval: 60})
+			convey.So(rs.UpdateData(ctx), convey.ShouldBeNil)
+
+			m.Publish("cfg_changes", "cfg:d\tdd")
+			m.Publish("cfg_changes", "-\tcfg:a")
+			m.Publish("cfg_changes", "bad")
+			waitEvents(rs, 3)
+			// the bad message exceeds the tolerance, the others are applied anyway
+			convey.So(rs.Reload(ctx, LoadKindInc), convey.ShouldNotBeNil)
+			convey.So(getValue(rs, "cfg:d"), convey.ShouldEqual, "dd")
+			convey.So(getValue(rs, "cfg:a"), convey.ShouldEqual, container.NotExistErr)
+			convey.So(rs.GetInfo().ErrorNum, convey.ShouldEqual, 1)
+
+			cancel()
+			convey.So(rs.Close(), convey.ShouldBeNil)
+		})
+		cancel()
+	})
+}
+
+func TestNewRedisStreamer(t *testing.T) {
+	convey.Convey("Test invalid configs", t, func() {
+		_, err := NewRedisStreamer(&RedisStreamerCfg{Name: "r", Source: RedisScan, DataParser: &deltaParser{}})
+		convey.So(err, convey.ShouldNotBeNil)
+		_, err = NewRedisStreamer(&RedisStreamerCfg{Name: "r", Source: RedisSet, Key: "k"})
+		convey.So(err, convey.ShouldNotBeNil)
+		_, err = NewRedisStreamer(&RedisStreamerCfg{Name: "r", Source: RedisSet, Key: "k", DataParser: &deltaParser{},
+			Addr: "127.0.0.1:1", ConnectTimeout: 100})
+		convey.So(err, convey.ShouldNotBeNil)
+	})
+}
@@ -3,6 +3,8 @@ package streamer
 import (
 	"container/heap"
 	"context"
+	"math/rand"
+	"sync"
 	"time"
 )
 
@@ -10,75 +12,257 @@ type SchedInfo struct {
 	TimeInterval int
 }
 
+// Schedulable is implemented by the streamers which can hand their timing over to Sched.
+// Update runs one round of the streamer's update loop, it must not start any goroutine.
+type Schedulable interface {
+	Streamer
+	Update(ctx context.Context) error
+}
+
 type SchedUnit struct {
 	name     string
+	ctx      context.Context
 	streamer Streamer
-	deadline int
+	deadline time.Time
 	index    int
+	onError  func(name string, err error)
+	first    chan error    // receives the result of the first round
+	done     chan struct{} // closed when the running round finishes, nil if not running
+	removed  bool
 }
 
-type Sched []*SchedUnit
+// schedHeap is a min-heap of SchedUnit ordered by deadline
+type schedHeap []*SchedUnit
 
-func (s Sched) Len() int { return len(s) }
+func (s schedHeap) Len() int { return len(s) }
 
-func (s Sched) Less(i, j int) bool {
-	return s[i].deadline < s[j].deadline
+func (s schedHeap) Less(i, j int) bool {
+	return s[i].deadline.Before(s[j].deadline)
 }
 
-func (s Sched) Swap(i, j int) {
+func (s schedHeap) Swap(i, j int) {
 	s[i], s[j] = s[j], s[i]
 	s[i].index = i
 	s[j].index = j
 }
 
-func (s *Sched) Push(x interface{}) {
+func (s *schedHeap) Push(x interface{}) {
 	item := x.(*SchedUnit)
-	n := len(*s)
-	item.index = n
+	item.index = len(*s)
 	*s = append(*s, item)
 }
 
-func (s *Sched) Top() *SchedUnit {
-	if len(*s) == 0 {
-		return nil
-	}
-	return (*s)[0]
-}
-
-func (s *Sched) Pop() interface{} {
+func (s *schedHeap) Pop() interface{} {
 	old := *s
 	n := len(old)
 	item := old[n-1]
+	old[n-1] = nil
 	item.index = -1 // for safety
 	*s = old[0 : n-1]
 	return item
 }
 
-func (s *Sched) AddStreamer(name string, dataStreamer Streamer) {
-	s.Push(&SchedUnit{
+// SchedOption configures a Sched
+type SchedOption func(*Sched)
+
+// WithConcurrency bounds the number of rounds running at the same time, 0 means no bound
+func WithConcurrency(n int) SchedOption {
+	return func(s *Sched) {
+		if n > 0 {
+			s.sem = make(chan struct{}, n)
+		}
+	}
+}
+
+// WithJitter adds a random delay in [0, jitter) to every interval, so that streamers with
+// the same interval don't reload at the same moment
+func WithJitter(jitter time.Duration) SchedOption {
+	return func(s *Sched) {
+		s.jitter = jitter
+	}
+}
+
+// WithErrorHandler sets the callback for the streamers added without their own one
+func WithErrorHandler(f func(name string, err error)) SchedOption {
+	return func(s *Sched) {
+		s.onError = f
+	}
+}
+
+// Sched owns the timing of its streamers: each Schedulable streamer runs a round right after
+// it's added, then every SchedInfo.TimeInterval seconds after the previous round finished.
+// Rounds of the same streamer never overlap. A streamer which isn't Schedulable runs its own
+// loop, Sched only calls its UpdateData once.
+type Sched struct {
+	mu      sync.Mutex
+	units   schedHeap
+	byName  map[string]*SchedUnit
+	wake    chan struct{}
+	sem     chan struct{}
+	jitter  time.Duration
+	onError func(name string, err error)
+	wg      sync.WaitGroup
+	rand    *rand.Rand
+}
+
+func NewSched(opts ...SchedOption) *Sched {
+	s := &Sched{
+		byName: make(map[string]*SchedUnit),
+		wake:   make(chan struct{}, 1),
+		rand:   rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	heap.Init(&s.units)
+	return s
+}
+
+// AddStreamer schedules a streamer, its rounds run with ctx. onError is called with the error of
+// every failed round, nil means the handler given by WithErrorHandler. The returned channel
+// receives the result of the first round.
+func (s *Sched) AddStreamer(ctx context.Context, name string, dataStreamer Streamer, onError func(name string, err error)) <-chan error {
+	first := make(chan error, 1)
+	u := &SchedUnit{
 		name:     name,
+		ctx:      ctx,
 		streamer: dataStreamer,
-		deadline: int(time.Now().Unix()) + dataStreamer.GetSchedInfo().TimeInterval,
-	})
+		deadline: time.Now(),
+		onError:  onError,
+		first:    first,
+	}
+	s.mu.Lock()
+	s.byName[name] = u
+	heap.Push(&s.units, u)
+	s.mu.Unlock()
+	s.notify()
+	return first
 }
 
+// RemoveStreamer unschedules a streamer and waits for its running round to finish
+func (s *Sched) RemoveStreamer(name string) {
+	s.mu.Lock()
+	u, ok := s.byName[name]
+	if !ok {
+		s.mu.Unlock()
+		return
+	}
+	delete(s.byName, name)
+	u.removed = true
+	if u.index >= 0 {
+		heap.Remove(&s.units, u.index)
+	}
+	done := u.done
+	s.mu.Unlock()
+	if done != nil {
+		<-done
+	}
+}
+
+// Schedule runs the streamers until ctx is done, then waits for the running rounds to finish
 func (s *Sched) Schedule(ctx context.Context) {
+	defer s.wg.Wait()
 	for {
+		s.mu.Lock()
+		wait := time.Hour
+		if len(s.units) > 0 {
+			wait = time.Until(s.units[0].deadline)
+		}
+		if wait <= 0 {
+			u := heap.Pop(&s.units).(*SchedUnit)
+			u.done = make(chan struct{})
+			s.mu.Unlock()
+			if !s.acquire(ctx) {
+				s.finish(u, false)
+				return
+			}
+			s.wg.Add(1)
+			go s.run(u)
+			continue
+		}
+		s.mu.Unlock()
+
+		timer := time.NewTimer(wait)
 		select {
 		case <-ctx.Done():
+			timer.Stop()
 			return
-		default:
-			if time.Now().Unix() < int64(s.Top().deadline) {
-				time.Sleep(time.Second * time.Duration(int(time.Now().Unix())-s.Top().deadline))
-				continue
-			}
-			x := heap.Pop(s)
-			su := x.(*SchedUnit)
-			//TODO handler error
-			_ = su.streamer.UpdateData(context.Background())
-			su.deadline += su.streamer.GetSchedInfo().TimeInterval
-			heap.Push(s, su)
-			time.Sleep(time.Second * time.Duration(s.Top().deadline-int(time.Now().Unix())))
+		case <-s.wake:
+			timer.Stop()
+		case <-timer.C:
+		}
+	}
+}
+
+func (s *Sched) acquire(ctx context.Context) bool {
+	if s.sem == nil {
+		return true
+	}
+	select {
+	case s.sem <- struct{}{}:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+func (s *Sched) run(u *SchedUnit) {
+	defer s.wg.Done()
+	var err error
+	repeat := false
+	if st, ok := u.streamer.(Schedulable); ok {
+		err = st.Update(u.ctx)
+		repeat = true
+	} else {
+		err = u.streamer.UpdateData(u.ctx)
+	}
+	if s.sem != nil {
+		<-s.sem
+	}
+	s.mu.Lock()
+	if u.first != nil {
+		u.first <- err
+		u.first = nil
+	}
+	s.mu.Unlock()
+	if err != nil {
+		if u.onError != nil {
+			u.onError(u.name, err)
+		} else if s.onError != nil {
+			s.onError(u.name, err)
 		}
 	}
+	s.finish(u, repeat && u.ctx.Err() == nil)
+}
+
+// finish puts the unit back to the heap with its next deadline
+func (s *Sched) finish(u *SchedUnit, repeat bool) {
+	s.mu.Lock()
+	var interval time.Duration
+	if info := u.streamer.GetSchedInfo(); info != nil {
+		interval = time.Duration(info.TimeInterval) * time.Second
+	}
+	if u.removed || !repeat || interval <= 0 {
+		if !u.removed && u.first != nil {
+			// never ran, keep it for the next Schedule
+			heap.Push(&s.units, u)
+		}
+	} else {
+		if s.jitter > 0 {
+			interval += time.Duration(s.rand.Int63n(int64(s.jitter)))
+		}
+		u.deadline = time.Now().Add(interval)
+		heap.Push(&s.units, u)
+	}
+	close(u.done)
+	u.done = nil
+	s.mu.Unlock()
+	s.notify()
+}
+
+func (s *Sched) notify() {
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
 }
@@ -1,10 +1,15 @@
 package streamer
 
 import (
+	"container/heap"
 	"context"
+	"errors"
 	"fmt"
 	"github.com/Mintegral-official/mtggokit/bifrost/container"
 	"github.com/smartystreets/goconvey/convey"
+	"strconv"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 )
@@ -35,29 +40,139 @@ func (fs *FakeSchedStreamer) GetInfo() *Info {
 	return nil
 }
 
+// CountSchedStreamer is a Schedulable streamer counting its rounds
+type CountSchedStreamer struct {
+	FakeSchedStreamer
+	err     error
+	delay   time.Duration
+	rounds  int32
+	running *int32
+	maxSeen *int32
+}
+
+func (cs *CountSchedStreamer) UpdateData(ctx context.Context) error {
+	panic("UpdateData must not be called by Sched")
+}
+
+func (cs *CountSchedStreamer) Update(ctx context.Context) error {
+	if cs.running != nil {
+		n := atomic.AddInt32(cs.running, 1)
+		for {
+			m := atomic.LoadInt32(cs.maxSeen)
+			if n <= m || atomic.CompareAndSwapInt32(cs.maxSeen, m, n) {
+				break
+			}
+		}
+		defer atomic.AddInt32(cs.running, -1)
+	}
+	time.Sleep(cs.delay)
+	atomic.AddInt32(&cs.rounds, 1)
+	return cs.err
+}
+
+func newCountStreamer(interval int) *CountSchedStreamer {
+	return &CountSchedStreamer{FakeSchedStreamer: FakeSchedStreamer{SchedInfo: &SchedInfo{TimeInterval: interval}}}
+}
+
+func TestSchedHeap(t *testing.T) {
+	convey.Convey("Test heap pops by deadline", t, func() {
+		now := time.Now()
+		h := &schedHeap{}
+		heap.Init(h)
+		for _, d := range []int{5, 1, 7, 3} {
+			heap.Push(h, &SchedUnit{name: strconv.Itoa(d), deadline: now.Add(time.Duration(d) * time.Second)})
+		}
+		names := make([]string, 0, 4)
+		for h.Len() > 0 {
+			names = append(names, heap.Pop(h).(*SchedUnit).name)
+		}
+		convey.So(names, convey.ShouldResemble, []string{"1", "3", "5", "7"})
+	})
+}
+
 func TestSched_Schedule(t *testing.T) {
 	convey.Convey("Test schedule", t, func() {
-		sched := Sched{}
-		sched.AddStreamer("test1", &FakeSchedStreamer{
-			Name:      "fake1",
-			SchedInfo: &SchedInfo{TimeInterval: 1},
-		})
-		sched.AddStreamer("test3", &FakeSchedStreamer{
-			Name:      "fake3",
-			SchedInfo: &SchedInfo{TimeInterval: 3},
-		})
-		sched.AddStreamer("test7", &FakeSchedStreamer{
-			Name:      "fake7",
-			SchedInfo: &SchedInfo{TimeInterval: 7},
-		})
-		sched.AddStreamer("test5", &FakeSchedStreamer{
-			Name:      "fake5",
-			SchedInfo: &SchedInfo{TimeInterval: 5},
+		var errNames sync.Map
+		sched := NewSched(WithJitter(10*time.Millisecond), WithErrorHandler(func(name string, err error) {
+			errNames.Store(name, err)
+		}))
+		s1 := newCountStreamer(1)
+		s3 := newCountStreamer(3)
+		bad := newCountStreamer(1)
+		bad.err = errors.New("load error")
+		var ownErr int32
+		plain := &FakeSchedStreamer{Name: "plain", SchedInfo: &SchedInfo{TimeInterval: 1}}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		first1 := sched.AddStreamer(ctx, "test1", s1, nil)
+		first3 := sched.AddStreamer(ctx, "test3", s3, nil)
+		firstBad := sched.AddStreamer(ctx, "bad", bad, func(name string, err error) {
+			atomic.AddInt32(&ownErr, 1)
 		})
+		firstPlain := sched.AddStreamer(ctx, "plain", plain, nil)
+
+		done := make(chan struct{})
+		go func() {
+			sched.Schedule(ctx)
+			close(done)
+		}()
+		convey.So(<-first1, convey.ShouldBeNil)
+		convey.So(<-first3, convey.ShouldBeNil)
+		convey.So(<-firstBad, convey.ShouldNotBeNil)
+		convey.So(<-firstPlain, convey.ShouldBeNil)
+
+		time.Sleep(2500 * time.Millisecond)
+		cancel()
+		<-done
+		convey.So(atomic.LoadInt32(&s1.rounds), convey.ShouldEqual, 3)
+		convey.So(atomic.LoadInt32(&s3.rounds), convey.ShouldEqual, 1)
+		convey.So(atomic.LoadInt32(&ownErr), convey.ShouldEqual, 3)
+		_, ok := errNames.Load("bad")
+		convey.So(ok, convey.ShouldBeFalse)
+	})
+
+	convey.Convey("Test bounded concurrency", t, func() {
+		var running, maxSeen int32
+		sched := NewSched(WithConcurrency(2))
+		ctx, cancel := context.WithCancel(context.Background())
+		firsts := make([]<-chan error, 0, 6)
+		streamers := make([]*CountSchedStreamer, 0, 6)
+		for i := 0; i < 6; i++ {
+			cs := newCountStreamer(10)
+			cs.delay = 20 * time.Millisecond
+			cs.running = &running
+			cs.maxSeen = &maxSeen
+			streamers = append(streamers, cs)
+			firsts = append(firsts, sched.AddStreamer(ctx, strconv.Itoa(i), cs, nil))
+		}
+		done := make(chan struct{})
+		go func() {
+			sched.Schedule(ctx)
+			close(done)
+		}()
+		for _, first := range firsts {
+			convey.So(<-first, convey.ShouldBeNil)
+		}
+		cancel()
+		<-done
+		convey.So(atomic.LoadInt32(&maxSeen), convey.ShouldEqual, 2)
+		for _, cs := range streamers {
+			convey.So(atomic.LoadInt32(&cs.rounds), convey.ShouldEqual, 1)
+		}
+	})
 
-		ctx, cancel := context.WithTimeout(context.TODO(), time.Second*10)
+	convey.Convey("Test RemoveStreamer", t, func() {
+		sched := NewSched()
+		cs := newCountStreamer(1)
+		ctx, cancel := context.WithCancel(context.Background())
 		defer cancel()
-		sched.Schedule(ctx)
+		first := sched.AddStreamer(ctx, "cs", cs, nil)
+		go sched.Schedule(ctx)
+		convey.So(<-first, convey.ShouldBeNil)
+		sched.RemoveStreamer("cs")
+		sched.RemoveStreamer("not_exist")
+		time.Sleep(1200 * time.Millisecond)
+		convey.So(atomic.LoadInt32(&cs.rounds), convey.ShouldEqual, 1)
 	})
 }
 
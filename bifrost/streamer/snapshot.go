@@ -0,0 +1,23 @@
+package streamer
+
+import (
+	"errors"
+	"time"
+
+	"github.com/Mintegral-official/mtggokit/bifrost/container"
+)
+
+// loadSnapshot loads the snapshot at path into c, returns the time the snapshot was written
+func loadSnapshot(c container.Container, path string, codec container.ValueCodec) (time.Time, error) {
+	if codec == nil {
+		return time.Time{}, errors.New("SnapshotCodec is nil")
+	}
+	return container.LoadSnapshot(c, path, codec)
+}
+
+func saveSnapshot(c container.Container, path string, codec container.ValueCodec) error {
+	if codec == nil {
+		return errors.New("SnapshotCodec is nil")
+	}
+	return container.WriteSnapshot(c, path, codec)
+}
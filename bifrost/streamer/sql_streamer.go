@@ -0,0 +1,356 @@
+package streamer
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/Mintegral-official/mtggokit/bifrost/container"
+)
+
+// defaultWatermarkOverlap is the WatermarkOverlap of SQLStreamer when it's 0
+const defaultWatermarkOverlap = time.Minute
+
+// SQLStreamer loads the result of a query by database/sql, the rows are parsed one by one as
+// the cursor moves, so a large table is never held in memory besides the container
+type SQLStreamer struct {
+	container container.Container
+	cfg       *SQLStreamerCfg
+	db        *sql.DB
+	ownDB     bool
+	hasInit   bool
+	loadInfo
+	rows      *sql.Rows
+	curParser RowParser
+	result    []ParserResult
+	curLen    int
+	watermark time.Time
+	observer  Observer
+	mu        sync.Mutex // serializes the loads of the update loop and Reload
+
+	wg sync.WaitGroup
+}
+
+func NewSQLStreamer(cfg *SQLStreamerCfg) (*SQLStreamer, error) {
+	if cfg.BaseParser == nil {
+		return nil, errors.New("BaseParser is nil, streamer[" + cfg.Name + "]")
+	}
+	if cfg.BaseQuery == "" {
+		return nil, errors.New("BaseQuery is empty, streamer[" + cfg.Name + "]")
+	}
+	ss := &SQLStreamer{
+		cfg: cfg,
+		db:  cfg.DB,
+	}
+	if ss.db == nil {
+		db, err := sql.Open(cfg.Driver, cfg.DSN)
+		if err != nil {
+			return nil, err
+		}
+		ss.db = db
+		ss.ownDB = true
+	}
+	ctx, cancel := ss.queryContext(context.Background())
+	defer cancel()
+	if err := ss.db.PingContext(ctx); err != nil {
+		if cfg.Logger != nil {
+			cfg.Logger.Warnf("sql ping error, err=[%s]", err.Error())
+		}
+		if ss.ownDB {
+			_ = ss.db.Close()
+		}
+		return nil, err
+	}
+	return ss, nil
+}
+
+func (ss *SQLStreamer) queryContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	if ss.cfg.ReadTimeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, time.Duration(ss.cfg.ReadTimeout)*time.Millisecond)
+}
+
+func (ss *SQLStreamer) SetContainer(container container.Container) {
+	ss.container = container
+}
+
+func (ss *SQLStreamer) GetContainer() container.Container {
+	return ss.container
+}
+
+// SetObserver sets the observer notified after each load, call it before UpdateData
+func (ss *SQLStreamer) SetObserver(o Observer) {
+	ss.observer = o
+}
+
+func (ss *SQLStreamer) GetSchedInfo() *SchedInfo {
+	return &SchedInfo{
+		TimeInterval: ss.cfg.IncInterval,
+	}
+}
+
+// Describe returns the source of the base loads, see container.Describer
+func (ss *SQLStreamer) Describe() string {
+	return "sql[" + ss.cfg.BaseQuery + "]"
+}
+
+func (ss *SQLStreamer) HasNext() (bool, error) {
+	if ss.curLen < len(ss.result) {
+		return true, nil
+	}
+	if ss.rows.Next() {
+		return true, nil
+	}
+	return false, ss.rows.Err()
+}
+
+func (ss *SQLStreamer) Next() (container.DataMode, container.MapKey, interface{}, error) {
+	ss.addTotal()
+	if ss.curLen < len(ss.result) {
+		return ss.nextResult()
+	}
+	result := ss.curParser.Parse(ss.rows, ss.cfg.UserData)
+	if result == nil {
+		ss.addError()
+		return container.DataModeAdd, nil, nil, errors.New("Parse error")
+	}
+	ss.curLen = 0
+	ss.result = result
+	if ss.curLen < len(ss.result) {
+		return ss.nextResult()
+	}
+	ss.addError()
+	return container.DataModeAdd, nil, nil, errors.New(fmt.Sprintf("Index[%d] error, len[%d]", ss.curLen, len(ss.result)))
+}
+
+func (ss *SQLStreamer) nextResult() (container.DataMode, container.MapKey, interface{}, error) {
+	r := ss.result[ss.curLen]
+	ss.curLen++
+	if r.Err != nil {
+		ss.addError()
+	}
+	return r.DataMode, r.Key, r.Value, r.Err
+}
+
+func (ss *SQLStreamer) UpdateData(ctx context.Context) error {
+	if ss.cfg.IsSync {
+		if err := ss.Update(ctx); err != nil {
+			return err
+		}
+	}
+	ss.wg.Add(1)
+	go func() {
+		defer ss.wg.Done()
+		if !ss.cfg.IsSync {
+			_ = ss.Update(ctx)
+		}
+		for {
+			inc := time.After(time.Duration(ss.cfg.IncInterval) * time.Second)
+			select {
+			case <-ctx.Done():
+				ss.InfoStatus("LoadInc Finish:")
+				return
+			case <-inc:
+				_ = ss.Update(ctx)
+			}
+		}
+	}()
+	return nil
+}
+
+// Update runs one round of the update loop, it is called by Sched. The base is loaded
+// when it has never succeeded or BaseInterval has passed, otherwise the increment is loaded.
+func (ss *SQLStreamer) Update(ctx context.Context) error {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+	baseInterval := time.Duration(ss.cfg.BaseInterval) * time.Second
+	if !ss.hasInit || baseInterval > 0 && time.Since(ss.lastBaseTime) >= baseInterval {
+		if err := ss.loadBase(ctx); err != nil {
+			ss.WarnStatus("LoadBase error:" + err.Error())
+			return err
+		}
+		ss.InfoStatus("LoadBase succ")
+		return nil
+	}
+	if err := ss.loadInc(ctx); err != nil {
+		ss.WarnStatus("LoadInc error:" + err.Error())
+		return err
+	}
+	ss.InfoStatus("LoadInc succ")
+	return nil
+}
+
+// Reload runs a base or inc load at once
+func (ss *SQLStreamer) Reload(ctx context.Context, kind LoadKind) error {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+	if kind == LoadKindInc {
+		return ss.loadInc(ctx)
+	}
+	return ss.loadBase(ctx)
+}
+
+// loadBase must be called with ss.mu held
+func (ss *SQLStreamer) loadBase(ctx context.Context) (err error) {
+	for i := -1; i < ss.cfg.TryTimes; i++ {
+		err = ss.loadBase2(ctx)
+		if err == nil {
+			ss.hasInit = true
+			return nil
+		} else if ss.cfg.Logger != nil {
+			ss.cfg.Logger.Warnf("LoadBase error[%s], tryTimes[%d]", err, i+1)
+		}
+		if !retryable(err) {
+			return
+		}
+	}
+	return
+}
+
+func (ss *SQLStreamer) loadBase2(ctx context.Context) (err error) {
+	start := time.Now()
+	ss.setLastBaseTime(start)
+	defer func() {
+		ss.notify(LoadKindBase, start, err)
+	}()
+	qctx, cancel := ss.queryContext(ctx)
+	defer cancel()
+	rows, err := ss.db.QueryContext(qctx, ss.cfg.BaseQuery, ss.cfg.BaseArgs...)
+	if err != nil {
+		return errors.New("QueryError: " + err.Error())
+	}
+	defer func() { _ = rows.Close() }()
+
+	ss.resetNums()
+	ss.resetIter(rows, ss.cfg.BaseParser)
+	err = ss.container.LoadBase(ss)
+	ss.rows = nil
+	ss.setBaseTimeUsed(time.Now().Sub(start))
+	if ss.cfg.OnFinishBase != nil {
+		ss.cfg.OnFinishBase(ss)
+	}
+	if err == nil {
+		ss.watermark = start
+		ss.setWatermark(start.Unix())
+	}
+	return err
+}
+
+// loadInc must be called with ss.mu held
+func (ss *SQLStreamer) loadInc(ctx context.Context) (err error) {
+	if ss.cfg.IncQuery == "" {
+		return nil
+	}
+	// the watermark is the time of the app, the overlap covers the clock skew of the database and
+	// the rows committed late with an older updated_at
+	from := ss.watermark.Add(-ss.watermarkOverlap())
+	args := []interface{}{from}
+	if ss.cfg.OnBeforeInc != nil {
+		if args = ss.cfg.OnBeforeInc(ss.cfg.UserData, from); args == nil {
+			return nil
+		}
+	}
+	start := time.Now()
+	ss.setLastIncTime(start)
+	defer func() {
+		ss.setIncTimeUsed(time.Now().Sub(start))
+		ss.notify(LoadKindInc, start, err)
+	}()
+	qctx, cancel := ss.queryContext(ctx)
+	defer cancel()
+	rows, err := ss.db.QueryContext(qctx, ss.cfg.IncQuery, args...)
+	if err != nil {
+		return errors.New("QueryError: " + err.Error())
+	}
+	defer func() { _ = rows.Close() }()
+
+	parser := ss.cfg.IncParser
+	if parser == nil {
+		parser = ss.cfg.BaseParser
+	}
+	ss.resetIter(rows, parser)
+	err = ss.container.LoadInc(ss)
+	ss.rows = nil
+	if ss.cfg.OnFinishInc != nil {
+		ss.cfg.OnFinishInc(ss)
+	}
+	if err == nil {
+		ss.watermark = start
+		ss.setWatermark(start.Unix())
+	}
+	return err
+}
+
+func (ss *SQLStreamer) resetIter(rows *sql.Rows, parser RowParser) {
+	ss.rows = rows
+	ss.curParser = parser
+	ss.result = nil
+	ss.curLen = 0
+}
+
+// Watermark returns the time the last successful load started, the rows changed after it are
+// loaded by the next inc load
+func (ss *SQLStreamer) watermarkOverlap() time.Duration {
+	if ss.cfg.WatermarkOverlap == 0 {
+		return defaultWatermarkOverlap
+	}
+	if ss.cfg.WatermarkOverlap < 0 {
+		return 0
+	}
+	return time.Duration(ss.cfg.WatermarkOverlap) * time.Second
+}
+
+func (ss *SQLStreamer) Watermark() time.Time {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+	return ss.watermark
+}
+
+func (ss *SQLStreamer) notify(kind LoadKind, start time.Time, err error) {
+	if ss.observer == nil {
+		return
+	}
+	ss.observer(LoadEvent{
+		Name:  ss.cfg.Name,
+		Kind:  kind,
+		Start: start,
+		Used:  time.Since(start),
+		Err:   err,
+		Info:  ss.GetInfo(),
+	})
+}
+
+// Close waits for the update loop to exit, then closes the database if it was opened by the streamer
+func (ss *SQLStreamer) Close() error {
+	ss.wg.Wait()
+	if !ss.ownDB {
+		return nil
+	}
+	return ss.db.Close()
+}
+
+func (ss *SQLStreamer) GetInfo() *Info {
+	return ss.info(ss.cfg.Name, ss.container)
+}
+
+func (ss *SQLStreamer) InfoStatus(s string) {
+	if ss.cfg.Logger != nil {
+		ss.cfg.Logger.Infof("%s, streamInfo[%s]", s, ss.getInfoStr())
+	}
+}
+
+func (ss *SQLStreamer) WarnStatus(s string) {
+	if ss.cfg.Logger != nil {
+		ss.cfg.Logger.Warnf("%s, streamInfo[%s]", s, ss.getInfoStr())
+	}
+}
+
+func (ss *SQLStreamer) getInfoStr() string {
+	data, _ := json.Marshal(ss.GetInfo())
+	return string(data)
+}
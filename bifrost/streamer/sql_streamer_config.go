@@ -0,0 +1,41 @@
+package streamer
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/Mintegral-official/mtggokit/bifrost/log"
+)
+
+type SQLStreamerCfg struct {
+	Name         string
+	IncInterval  int
+	BaseInterval int
+	IsSync       bool
+	TryTimes     int
+	Driver       string  // the name of a registered database/sql driver, such as "mysql"
+	DSN          string  // the data source name given to sql.Open
+	DB           *sql.DB // an opened database, Driver and DSN are ignored if it's set
+	ReadTimeout  int     // millisecond, the timeout of a query including reading its rows
+	BaseQuery    string
+	BaseArgs     []interface{}
+	IncQuery     string // the query of the rows changed since a watermark, such as "... WHERE updated_at > ?"
+	BaseParser   RowParser
+	IncParser    RowParser
+	UserData     interface{}
+	Logger       log.BiLogger
+	OnFinishBase func(streamer Streamer)
+	OnFinishInc  func(streamer Streamer)
+
+	// WatermarkOverlap is subtracted from the watermark given to IncQuery, in seconds. The
+	// watermark is the clock of the app, the overlap covers the clock skew of the database and
+	// the rows committed late with an older updated_at, they're loaded again by the next inc.
+	// It's 60 by default, a negative value means no overlap, which loses the rows committed later
+	// than the next inc started.
+	WatermarkOverlap int
+
+	// OnBeforeInc returns the args of IncQuery from the watermark, which is the time the previous
+	// successful load started minus WatermarkOverlap. The inc load is skipped if it returns nil.
+	// When it's nil, the watermark is the only arg.
+	OnBeforeInc func(userData interface{}, watermark time.Time) []interface{}
+}
@@ -0,0 +1,106 @@
+package streamer
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/Mintegral-official/mtggokit/bifrost/container"
+	"github.com/smartystreets/goconvey/convey"
+)
+
+// campaignRowParser parses the rows of (id, name)
+type campaignRowParser struct{}
+
+func (*campaignRowParser) Parse(row Row, userData interface{}) []ParserResult {
+	var id int64
+	var name string
+	if err := row.Scan(&id, &name); err != nil {
+		return []ParserResult{{Err: err}}
+	}
+	return []ParserResult{{DataMode: container.DataModeAdd, Key: container.I64Key(id), Value: name}}
+}
+
+func TestSQLStreamer(t *testing.T) {
+	convey.Convey("Test SQLStreamer", t, func() {
+		db, mock, err := sqlmock.New()
+		convey.So(err, convey.ShouldBeNil)
+		defer db.Close()
+
+		ss, err := NewSQLStreamer(&SQLStreamerCfg{
+			Name:       "sql_test",
+			DB:         db,
+			TryTimes:   1,
+			BaseQuery:  "SELECT id, name FROM campaign",
+			IncQuery:   "SELECT id, name FROM campaign WHERE updated_at > ?",
+			BaseParser: &campaignRowParser{},
+		})
+		convey.So(err, convey.ShouldBeNil)
+		ss.SetContainer(container.CreateBlockingMapContainer(1, 0))
+		columns := []string{"id", "name"}
+
+		// the first try fails
+		mock.ExpectQuery("SELECT id, name FROM campaign").WillReturnError(errors.New("connection reset"))
+		mock.ExpectQuery("SELECT id, name FROM campaign").
+			WillReturnRows(sqlmock.NewRows(columns).AddRow(1, "a").AddRow(2, "b"))
+		convey.So(ss.Update(context.Background()), convey.ShouldBeNil)
+		convey.So(ss.GetContainer().Len(), convey.ShouldEqual, 2)
+		watermark := ss.Watermark()
+		convey.So(watermark.IsZero(), convey.ShouldBeFalse)
+
+		convey.Convey("inc loads take the watermark", func() {
+			ss.cfg.WatermarkOverlap = -1
+			mock.ExpectQuery("WHERE updated_at > ?").WithArgs(watermark).
+				WillReturnRows(sqlmock.NewRows(columns).AddRow(2, "B").AddRow(3, "c"))
+			convey.So(ss.Update(context.Background()), convey.ShouldBeNil)
+			v, err := ss.GetContainer().Get(container.I64Key(2))
+			convey.So(err, convey.ShouldBeNil)
+			convey.So(v, convey.ShouldEqual, "B")
+			convey.So(ss.GetContainer().Len(), convey.ShouldEqual, 3)
+			convey.So(ss.Watermark().After(watermark), convey.ShouldBeTrue)
+
+			ss.cfg.OnBeforeInc = func(userData interface{}, w time.Time) []interface{} {
+				return nil
+			}
+			convey.So(ss.Update(context.Background()), convey.ShouldBeNil)
+			convey.So(mock.ExpectationsWereMet(), convey.ShouldBeNil)
+		})
+
+		convey.Convey("inc loads overlap the watermark", func() {
+			// a minute by default
+			mock.ExpectQuery("WHERE updated_at > ?").WithArgs(watermark.Add(-time.Minute)).
+				WillReturnRows(sqlmock.NewRows(columns).AddRow(3, "c"))
+			convey.So(ss.Update(context.Background()), convey.ShouldBeNil)
+			ss.cfg.WatermarkOverlap = 10
+			mock.ExpectQuery("WHERE updated_at > ?").WithArgs(ss.Watermark().Add(-10 * time.Second)).
+				WillReturnRows(sqlmock.NewRows(columns))
+			convey.So(ss.Update(context.Background()), convey.ShouldBeNil)
+			convey.So(ss.GetContainer().Len(), convey.ShouldEqual, 3)
+			convey.So(mock.ExpectationsWereMet(), convey.ShouldBeNil)
+		})
+
+		convey.Convey("a broken cursor keeps the data", func() {
+			mock.ExpectQuery("SELECT id, name FROM campaign").
+				WillReturnRows(sqlmock.NewRows(columns).AddRow(4, "d").AddRow(5, "e").RowError(1, errors.New("broken")))
+			mock.ExpectQuery("SELECT id, name FROM campaign").WillReturnError(errors.New("broken"))
+			convey.So(ss.Reload(context.Background(), LoadKindBase), convey.ShouldNotBeNil)
+			convey.So(ss.GetContainer().Len(), convey.ShouldEqual, 2)
+			convey.So(ss.Watermark(), convey.ShouldEqual, watermark)
+			convey.So(mock.ExpectationsWereMet(), convey.ShouldBeNil)
+		})
+
+		convey.Convey("a rejected base load is counted", func() {
+			ss.GetContainer().(container.Validatable).SetValidators(container.MaxShrink(20))
+			// the rejected data isn't loaded again by TryTimes
+			mock.ExpectQuery("SELECT id, name FROM campaign").WillReturnRows(sqlmock.NewRows(columns).AddRow(1, "a"))
+			err := ss.Reload(context.Background(), LoadKindBase)
+			var ve *container.ValidationError
+			convey.So(errors.As(err, &ve), convey.ShouldBeTrue)
+			convey.So(ss.GetContainer().Len(), convey.ShouldEqual, 2)
+			convey.So(ss.GetInfo().ValidationFailures, convey.ShouldEqual, 1)
+			convey.So(mock.ExpectationsWereMet(), convey.ShouldBeNil)
+		})
+	})
+}
@@ -2,6 +2,7 @@ package streamer
 
 import (
 	"context"
+	"errors"
 	"github.com/Mintegral-official/mtggokit/bifrost/container"
 	"time"
 )
@@ -15,6 +16,11 @@ type Info struct {
 	LastIncTime  time.Time     `json:"last_inc_time"`
 	BaseTimeUsed time.Duration `json:"base_time_used"`
 	IncTimeUsed  time.Duration `json:"inc_time_used"`
+	Watermark    int64         `json:"watermark,omitempty"` // unix seconds, the data changed after it is loaded next
+	// ValidationFailures is the number of base loads rejected by the validators of the container
+	ValidationFailures int64 `json:"validation_failures,omitempty"`
+	// DroppedNum is the number of messages dropped after failing LoadInc, see KafkaStreamerCfg
+	DroppedNum int `json:"dropped_num,omitempty"`
 }
 
 type Streamer interface {
@@ -25,3 +31,29 @@ type Streamer interface {
 
 	GetInfo() *Info
 }
+
+// Closer is implemented by the streamers holding resources. Close waits for the update loop
+// started by UpdateData to exit, so the context given to UpdateData must be canceled first.
+type Closer interface {
+	Close() error
+}
+
+// Reloader is implemented by the streamers which can be reloaded on demand, Reload runs
+// exclusively with the rounds of the update loop
+type Reloader interface {
+	Reload(ctx context.Context, kind LoadKind) error
+}
+
+// retryable reports whether a failed base load is worth another try, the data rejected by a
+// validator would be rejected again
+func retryable(err error) bool {
+	var ve *container.ValidationError
+	return !errors.As(err, &ve)
+}
+
+func validationFailures(c container.Container) int64 {
+	if v, ok := c.(container.Validatable); ok {
+		return v.ValidationFailures()
+	}
+	return 0
+}
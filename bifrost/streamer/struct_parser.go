@@ -0,0 +1,164 @@
+package streamer
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/Mintegral-official/mtggokit/bifrost/container"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// StructParser unmarshals the documents read by MongoStreamer into a struct, the value is a
+// pointer to it. Its fields are marked by the bifrost tag:
+//
+//	bifrost:"key"          the key, an int field for an I64Key or a string field for a StrKey
+//	bifrost:"del"          a bool field, the record is a DataModeDel if it's true
+//	bifrost:"del=2|3"      the record is a DataModeDel if the field is one of the values
+//	bifrost:"watermark"    an int or time.Time field, Watermark returns its max value
+//
+// A struct has exactly one key field, and at most one del and one watermark field.
+type StructParser struct {
+	typ       reflect.Type
+	key       int
+	keyType   KeyType
+	del       int // -1 if there is none
+	delValues map[string]bool
+	watermark int // -1 if there is none
+
+	maxWatermark int64
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// NewStructParser creates a StructParser for the type of prototype, a struct or a pointer to it
+func NewStructParser(prototype interface{}) (*StructParser, error) {
+	t, err := structType(prototype)
+	if err != nil {
+		return nil, err
+	}
+	sp := &StructParser{typ: t, key: -1, del: -1, watermark: -1}
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag, ok := f.Tag.Lookup("bifrost")
+		if !ok {
+			continue
+		}
+		if f.PkgPath != "" {
+			return nil, errors.New("field[" + f.Name + "] is not exported")
+		}
+		if err := sp.mark(i, f, tag); err != nil {
+			return nil, err
+		}
+	}
+	if sp.key < 0 {
+		return nil, errors.New("no key field in type[" + t.String() + "]")
+	}
+	return sp, nil
+}
+
+func (sp *StructParser) mark(i int, f reflect.StructField, tag string) error {
+	name, value := tag, ""
+	if n := strings.Index(tag, "="); n >= 0 {
+		name, value = tag[:n], tag[n+1:]
+	}
+	kind := f.Type.Kind()
+	if kind == reflect.Ptr {
+		kind = f.Type.Elem().Kind()
+	}
+	switch name {
+	case "key":
+		if sp.key >= 0 {
+			return errors.New("more than one key field, field[" + f.Name + "]")
+		}
+		switch kind {
+		case reflect.String:
+			sp.keyType = KeyString
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+			reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			sp.keyType = KeyInt64
+		default:
+			return errors.New("not support key type[" + f.Type.String() + "], field[" + f.Name + "]")
+		}
+		sp.key = i
+	case "del":
+		if sp.del >= 0 {
+			return errors.New("more than one del field, field[" + f.Name + "]")
+		}
+		if value == "" {
+			if kind != reflect.Bool {
+				return errors.New("del field without values must be a bool, field[" + f.Name + "]")
+			}
+			value = "true"
+		}
+		sp.del = i
+		sp.delValues = make(map[string]bool)
+		for _, v := range strings.Split(value, "|") {
+			sp.delValues[v] = true
+		}
+	case "watermark":
+		if sp.watermark >= 0 {
+			return errors.New("more than one watermark field, field[" + f.Name + "]")
+		}
+		switch f.Type.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		default:
+			if f.Type != timeType {
+				return errors.New("not support watermark type[" + f.Type.String() + "], field[" + f.Name + "]")
+			}
+		}
+		sp.watermark = i
+	default:
+		return errors.New("unknown bifrost tag[" + tag + "], field[" + f.Name + "]")
+	}
+	return nil
+}
+
+func (sp *StructParser) Parse(data []byte, userData interface{}) []ParserResult {
+	v := reflect.New(sp.typ)
+	if err := bson.Unmarshal(data, v.Interface()); err != nil {
+		return []ParserResult{{Err: errors.New("unmarshal bson error: " + err.Error())}}
+	}
+	s := v.Elem()
+	key, err := keyOf(sp.keyType, s.Field(sp.key).Interface())
+	if err != nil {
+		return []ParserResult{{Err: fmt.Errorf("%s, field[%s]", err.Error(), sp.typ.Field(sp.key).Name)}}
+	}
+	mode := container.DataModeAdd
+	if sp.del >= 0 {
+		if f := reflect.Indirect(s.Field(sp.del)); f.IsValid() && sp.delValues[fmt.Sprint(f.Interface())] {
+			mode = container.DataModeDel
+		}
+	}
+	if sp.watermark >= 0 {
+		sp.track(s.Field(sp.watermark))
+	}
+	return []ParserResult{{DataMode: mode, Key: key, Value: v.Interface()}}
+}
+
+func (sp *StructParser) track(f reflect.Value) {
+	var w int64
+	if t, ok := f.Interface().(time.Time); ok {
+		if t.IsZero() {
+			return
+		}
+		w = t.Unix()
+	} else {
+		w = f.Int()
+	}
+	for {
+		cur := atomic.LoadInt64(&sp.maxWatermark)
+		if w <= cur || atomic.CompareAndSwapInt64(&sp.maxWatermark, cur, w) {
+			return
+		}
+	}
+}
+
+// Watermark returns the max value of the watermark field of the parsed documents, in seconds
+// for a time.Time field, such as the start of the next inc query in OnBeforeInc
+func (sp *StructParser) Watermark() int64 {
+	return atomic.LoadInt64(&sp.maxWatermark)
+}
@@ -0,0 +1,72 @@
+package streamer
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Mintegral-official/mtggokit/bifrost/container"
+	"github.com/smartystreets/goconvey/convey"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+type taggedCampaign struct {
+	CampaignId int64  `bson:"campaignId" bifrost:"key"`
+	Status     int    `bson:"status" bifrost:"del=2|3"`
+	Updated    int64  `bson:"updated" bifrost:"watermark"`
+	Package    string `bson:"packageName"`
+}
+
+type taggedCreative struct {
+	Md5     string    `bson:"md5" bifrost:"key"`
+	Deleted *bool     `bson:"deleted" bifrost:"del"`
+	Updated time.Time `bson:"updated" bifrost:"watermark"`
+}
+
+func TestStructParser(t *testing.T) {
+	convey.Convey("Test StructParser", t, func() {
+		p, err := NewStructParser(taggedCampaign{})
+		convey.So(err, convey.ShouldBeNil)
+		data, _ := bson.Marshal(bson.M{"campaignId": 1, "status": 1, "updated": 100, "packageName": "com.a"})
+		r := p.Parse(data, nil)
+		convey.So(r, convey.ShouldResemble, []ParserResult{{
+			DataMode: container.DataModeAdd,
+			Key:      container.I64Key(1),
+			Value:    &taggedCampaign{CampaignId: 1, Status: 1, Updated: 100, Package: "com.a"},
+		}})
+		data, _ = bson.Marshal(bson.M{"campaignId": 2, "status": 3, "updated": 90})
+		convey.So(p.Parse(data, nil)[0].DataMode, convey.ShouldEqual, container.DataModeDel)
+		convey.So(p.Watermark(), convey.ShouldEqual, 100)
+
+		data, _ = bson.Marshal(bson.M{"campaignId": "x"})
+		convey.So(p.Parse(data, nil)[0].Err, convey.ShouldNotBeNil)
+
+		p, err = NewStructParser(&taggedCreative{})
+		convey.So(err, convey.ShouldBeNil)
+		updated := time.Unix(200, 0)
+		data, _ = bson.Marshal(bson.M{"md5": "abc", "deleted": true, "updated": updated})
+		r = p.Parse(data, nil)
+		convey.So(r[0].Key, convey.ShouldResemble, container.StrKey("abc"))
+		convey.So(r[0].DataMode, convey.ShouldEqual, container.DataModeDel)
+		convey.So(p.Watermark(), convey.ShouldEqual, 200)
+		data, _ = bson.Marshal(bson.M{"md5": "abd"})
+		convey.So(p.Parse(data, nil)[0].DataMode, convey.ShouldEqual, container.DataModeAdd)
+	})
+
+	convey.Convey("Test invalid tags", t, func() {
+		_, err := NewStructParser(struct{ A int }{})
+		convey.So(err.Error(), convey.ShouldEqual, "no key field in type[struct { A int }]")
+		_, err = NewStructParser(struct {
+			A int `bifrost:"key"`
+			B int `bifrost:"del"`
+		}{})
+		convey.So(err.Error(), convey.ShouldEqual, "del field without values must be a bool, field[B]")
+		_, err = NewStructParser(struct {
+			A float64 `bifrost:"key"`
+		}{})
+		convey.So(err.Error(), convey.ShouldEqual, "not support key type[float64], field[A]")
+		_, err = NewStructParser(struct {
+			A int `bifrost:"index"`
+		}{})
+		convey.So(err.Error(), convey.ShouldEqual, "unknown bifrost tag[index], field[A]")
+	})
+}